@@ -1,24 +1,128 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/koba/db-diff/internal/apply"
 	"github.com/koba/db-diff/internal/database"
 	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/export"
 	"github.com/koba/db-diff/internal/generator"
+	"github.com/koba/db-diff/internal/integrity"
+	"github.com/koba/db-diff/internal/lint"
+	"github.com/koba/db-diff/internal/memguard"
+	"github.com/koba/db-diff/internal/schema"
 	"github.com/koba/db-diff/internal/snapshot"
+	"github.com/koba/db-diff/internal/textenc"
 )
 
+// defaultCommitInterval is the number of rows a snapshot commits at a time
+// unless --commit-interval says otherwise
+const defaultCommitInterval = 10000
+
 var (
-	tables    []string
-	limit     int
-	outputDir string
+	label   string
+	dialect string
+
+	maxMemory     int
+	profileMemory bool
+
+	tables      []string
+	exclude     []string
+	excludeCase bool
+	limit       int
+	outputDir   string
+	pkRanges    []string
+	orderBy     []string
+	wheres      []string
+
+	tableTimeout    time.Duration
+	snapshotTimeout time.Duration
+	strict          bool
+	commitInterval  int
+	concurrency     int
+	skipEmpty       bool
+	blobThreshold   int
+	creationOrder   bool
+	force           bool
+	resume          bool
+	baseSnapshot    string
+	systemTables    bool
+	readOnly        bool
+	strictLoad      bool
+	snapshotTag     string
+	latestTags      bool
+	snapshotDir     string
+	hashColumns     []string
+	hashSalt        string
+	snapshotDrift   bool
+
+	dialectOut      string
+	resyncThreshold float64
+	validateApply   bool
+	groupByTable    bool
+	fromEmpty       bool
+	upsert          bool
+	conflictColumns []string
+	insertBatchSize int
+	copyTables      []string
+	copySource      string
+	placeholders    string
+	valuesFile      string
+	tableRebuild    bool
+	ifExists        bool
+	terminator      string
+	delimiterSwitch bool
+	splitOutput     string
+	boolFormat      string
+	numericLocale   string
+	estimate        bool
+	outputEncoding  string
+	maxValueLength  int
+	skipOversized   bool
+
+	checkpoints    bool
+	checkpointSize int
+
+	exportDir  string
+	exportOpts export.Options
+
+	rebaseTable   string
+	rebaseColumn  string
+	rebaseMaps    []string
+	rebaseMapFile string
+	rebaseOutput  string
+
+	lintRules  lint.Rules
+	lintStrict bool
+
+	allowDiffsFile string
+	diffFormat     string
+	diffOutput     string
+	reportFile     string
+	ciMode         string
+	rowFilters     []string
+	identities     []string
+	columnMaps     []string
+	verboseSchema  bool
+	exitCode       bool
+	diffOpts       diff.Options
+	tableSQL       bool
+	autoIncrement  string
 )
 
 func main() {
@@ -39,54 +143,422 @@ var snapshotCmd = &cobra.Command{
 	Short: "Create a database snapshot",
 	Long:  `Create a snapshot of the current database state.`,
 	Args:  cobra.MaximumNArgs(1),
-	RunE:  runSnapshot,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return applyEnvDefaults(cmd, map[string]string{
+			"limit":      "DBDIFF_LIMIT",
+			"output-dir": "DBDIFF_OUTPUT_DIR",
+			"tables":     "DBDIFF_TABLES",
+			"exclude":    "DBDIFF_EXCLUDE",
+			"hash-salt":  "DBDIFF_HASH_SALT",
+		})
+	},
+	RunE: runSnapshot,
+}
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Check the database for drift from its newest snapshot",
+	Long: `Snapshot the database configured by the environment and compare it with the
+newest snapshot in --output-dir (of --tag, when given), selecting the same rows.
+When they differ, the differences are printed, the new snapshot is kept with
+--snapshot-on-drift, and the command exits with a non-zero status.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return applyEnvDefaults(cmd, map[string]string{
+			"output-dir": "DBDIFF_OUTPUT_DIR",
+			"tables":     "DBDIFF_TABLES",
+			"hash-salt":  "DBDIFF_HASH_SALT",
+		})
+	},
+	RunE: runMonitor,
 }
 
 var diffCmd = &cobra.Command{
 	Use:   "diff <snapshot1> <snapshot2>",
 	Short: "Compare two snapshots",
-	Long:  `Compare two database snapshots and display the differences.`,
-	Args:  cobra.ExactArgs(2),
-	RunE:  runDiff,
+	Long: `Compare two database snapshots and display the differences.
+With --latest, the arguments are tags and the most recent snapshot of each
+tag in --snapshot-dir is compared.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDiff,
+}
+
+var tableCmd = &cobra.Command{
+	Use:   "table <snapshot1> <snapshot2> <table>",
+	Short: "Compare a single table",
+	Long:  `Compare one table's schema and data between two snapshots, optionally printing the migration SQL for it.`,
+	Args:  cobra.ExactArgs(3),
+	RunE:  runTable,
+}
+
+var matrixCmd = &cobra.Command{
+	Use:   "matrix <baseline> <snapshot>...",
+	Short: "Compare a baseline with several snapshots",
+	Long: `Compare a baseline snapshot with the snapshots of several environments and
+print a grid of which tables differ (schema, data or both) in which environment.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runMatrix,
 }
 
 var migrateCmd = &cobra.Command{
 	Use:   "migrate <snapshot1> <snapshot2>",
 	Short: "Generate migration SQL",
-	Long:  `Generate DDL and DML statements to migrate from snapshot1 to snapshot2.`,
+	Long: `Generate DDL and DML statements to migrate from snapshot1 to snapshot2.
+With --from-empty, only the target snapshot is given and the statements create
+it from an empty database.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if fromEmpty {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
+	RunE: runMigrate,
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <snapshot1> <snapshot2>",
+	Short: "Apply migration SQL to the database",
+	Long: `Generate the migration from snapshot1 to snapshot2 and execute it against the
+database configured by the environment. Each statement is recorded in a
+dbdiff_migrations table, so re-running after a failure resumes where it stopped.
+Snapshots leave that table out unless it is named with --tables.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runApply,
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export <snapshot1> <snapshot2>",
+	Short: "Export data differences as CSV",
+	Long:  `Write the rows added, deleted and modified between two snapshots to one CSV file per table.`,
 	Args:  cobra.ExactArgs(2),
-	RunE:  runMigrate,
+	RunE:  runExport,
+}
+
+var rebaseCmd = &cobra.Command{
+	Use:   "rebase <snapshot>",
+	Short: "Rewrite a snapshot's key values",
+	Long: `Rewrite the values of a table's key column, and of the foreign key columns
+referencing it, according to an old=new mapping. Use it on a snapshot taken
+before a migration that renumbered surrogate keys so it can be compared with
+a snapshot taken after it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRebase,
+}
+
+var pingCmd = &cobra.Command{
+	Use:   "ping",
+	Short: "Test the database connection",
+	Long:  `Connect to the database configured by the environment and print the server version and number of tables.`,
+	Args:  cobra.NoArgs,
+	RunE:  runPing,
+}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint <snapshot>",
+	Short: "Check naming conventions",
+	Long:  `Report tables, columns, indexes and foreign keys in a snapshot that violate naming conventions.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runLint,
+}
+
+var checkFKCmd = &cobra.Command{
+	Use:   "check-fk <snapshot>",
+	Short: "Check foreign key integrity",
+	Long:  `Report rows in a snapshot whose foreign key values point to rows missing from the referenced table.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCheckFK,
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&label, "label", "", "Label identifying the database in output (default: derived from DB_NAME and DB_HOST, or the snapshots' labels)")
+	rootCmd.PersistentFlags().StringVar(&dialect, "dialect", "", "SQL dialect of generated and displayed SQL: mysql or postgres (default: the snapshots' database type, or mysql)")
+
 	// Snapshot command flags
-	snapshotCmd.Flags().StringSliceVar(&tables, "tables", nil, "Space-separated list of tables to snapshot (default: all tables)")
-	snapshotCmd.Flags().IntVar(&limit, "limit", 0, "Maximum number of rows per table (default: unlimited)")
-	snapshotCmd.Flags().StringVar(&outputDir, "output-dir", "./snapshots", "Output directory for snapshots")
+	snapshotCmd.Flags().StringSliceVar(&tables, "tables", nil, "Space-separated list of tables to snapshot (default: all tables, or $DBDIFF_TABLES)")
+	snapshotCmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Glob patterns of tables not to snapshot, e.g. '*_log,temp_*'; they take precedence over --tables (or $DBDIFF_EXCLUDE)")
+	snapshotCmd.Flags().BoolVar(&excludeCase, "exclude-ignore-case", false, "Match --exclude patterns regardless of case")
+	snapshotCmd.Flags().IntVar(&limit, "limit", 0, "Maximum number of rows per table (default: unlimited, or $DBDIFF_LIMIT)")
+	snapshotCmd.Flags().StringVar(&outputDir, "output-dir", "./snapshots", "Output directory for snapshots (or $DBDIFF_OUTPUT_DIR)")
+	snapshotCmd.Flags().DurationVar(&snapshotTimeout, "timeout", 0, "Abort the snapshot when it takes longer than this (default: no limit)")
+	snapshotCmd.Flags().DurationVar(&tableTimeout, "timeout-per-table", 0, "Skip a table whose schema and data take longer than this to read (default: no limit)")
+	snapshotCmd.Flags().BoolVar(&strict, "strict", false, "Fail instead of skipping tables that time out, or when a --where predicate matches no rows")
+	snapshotCmd.Flags().IntVar(&commitInterval, "commit-interval", defaultCommitInterval, "Commit snapshot writes every N rows (0: one transaction per table)")
+	snapshotCmd.Flags().IntVar(&concurrency, "concurrency", runtime.NumCPU(), "Number of tables read from the database at the same time")
+	snapshotCmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing snapshot with the same name")
+	snapshotCmd.Flags().BoolVar(&resume, "resume", false, "Continue an interrupted snapshot with the same name, capturing only the tables it has not completed")
+	snapshotCmd.Flags().StringVar(&baseSnapshot, "base", "", "Take an incremental snapshot storing only the rows that differ from this snapshot, which must be kept to load it")
+	snapshotCmd.Flags().BoolVar(&systemTables, "include-system-tables", false, "Also snapshot the readable system tables (PostgreSQL pg_catalog and information_schema, MySQL mysql and sys), named schema.table, leaving out credential columns")
+	snapshotCmd.Flags().BoolVar(&readOnly, "readonly", false, "Read the database over read-only sessions so that any write fails, and record it in the snapshot")
+	snapshotCmd.Flags().BoolVar(&creationOrder, "preserve-creation-order", false, "Record tables in the order they were created and show differences in that order")
+	snapshotCmd.Flags().IntVar(&blobThreshold, "blob-threshold", 0, "Store values larger than N bytes once in a separate blobs table instead of inline (0: inline)")
+	snapshotCmd.Flags().BoolVar(&skipEmpty, "skip-empty-tables", false, "Store only the schema of tables that have no rows")
+	snapshotCmd.Flags().StringArrayVar(&orderBy, "order-by", nil, "Store a table's rows ordered by a column, as table:column[:desc] (repeatable)")
+	snapshotCmd.Flags().StringArrayVar(&pkRanges, "pk-range", nil, "Only snapshot rows whose primary key is in a range, as table:from:to (repeatable)")
+	snapshotCmd.Flags().StringArrayVar(&wheres, "where", nil, "Only snapshot rows matching an SQL predicate, as table:predicate (repeatable)")
+	snapshotCmd.Flags().StringVar(&snapshotTag, "tag", "", "Environment tag recorded in the snapshot, e.g. prod or staging, for diff --latest")
+	snapshotCmd.Flags().StringArrayVar(&hashColumns, "hash-columns", nil, "Store salted SHA-256 hashes instead of the values of columns, as table:column[,column...] (repeatable)")
+	snapshotCmd.Flags().StringVar(&hashSalt, "hash-salt", "", "Salt for --hash-columns; snapshots must use the same salt to be compared (or $DBDIFF_HASH_SALT)")
+
+	// Monitor command flags
+	monitorCmd.Flags().StringVar(&outputDir, "output-dir", "./snapshots", "Directory holding the snapshots to compare with (or $DBDIFF_OUTPUT_DIR)")
+	monitorCmd.Flags().StringVar(&snapshotTag, "tag", "", "Compare with the newest snapshot of this tag, and tag a kept snapshot with it")
+	monitorCmd.Flags().StringSliceVar(&tables, "tables", nil, "Space-separated list of tables to check (default: all tables, or $DBDIFF_TABLES)")
+	monitorCmd.Flags().IntVar(&concurrency, "concurrency", runtime.NumCPU(), "Number of tables read from the database at the same time")
+	monitorCmd.Flags().IntVar(&commitInterval, "commit-interval", defaultCommitInterval, "Commit the live snapshot's writes every N rows (0: one transaction per table)")
+	monitorCmd.Flags().StringVar(&hashSalt, "hash-salt", "", "Salt the newest snapshot hashed columns with (or $DBDIFF_HASH_SALT)")
+	monitorCmd.Flags().DurationVar(&snapshotTimeout, "timeout", 0, "Abort the check when reading the database takes longer than this (default: no limit)")
+	monitorCmd.Flags().IntVar(&diffOpts.ShowRows, "max-rows", 10, "Show the key and changed columns of at most N modified rows per table (0: counts only, -1: all)")
+	monitorCmd.Flags().BoolVar(&snapshotDrift, "snapshot-on-drift", false, "Keep the new snapshot in --output-dir when drift is found")
+	monitorCmd.Flags().StringSliceVar(&diffOpts.IgnoreColumns, "ignore-columns", nil, "Leave columns out of the data comparison, as column (every table) or table.column, e.g. updated_at,orders.last_seen")
+
+	// Diff command flags
+	diffCmd.Flags().StringVar(&allowDiffsFile, "allow-diffs", "", "File listing expected differences to report separately instead of as failures")
+	diffCmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with an error when unexpected differences are found")
+	diffCmd.Flags().BoolVar(&latestTags, "latest", false, "Take the arguments as tags and compare the most recent snapshot of each")
+	diffCmd.Flags().StringVar(&snapshotDir, "snapshot-dir", "./snapshots", "Directory searched for tagged snapshots with --latest")
+	diffCmd.Flags().StringVar(&diffFormat, "format", "text", "Report format: text, markdown, html (a self-contained page), json (one document) or jsonl (one JSON object per change)")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "", "Write the report to this file instead of stdout")
+	diffCmd.Flags().StringVar(&reportFile, "report-file", "", "Also write an archival report to this file: a summary, the text report and the JSON report in a fenced block")
+	diffCmd.Flags().StringVar(&outputEncoding, "output-encoding", textenc.UTF8, "Encoding of the report, e.g. utf-16 or shift_jis (UTF-16 and utf-8-bom start with a byte order mark)")
+	diffCmd.Flags().StringVar(&ciMode, "ci", "", "Also emit CI annotations: github (workflow commands on stdout, Markdown appended to $GITHUB_STEP_SUMMARY)")
+	diffCmd.Flags().StringArrayVar(&rowFilters, "row-filter", nil, "Only compare a table's rows matching a predicate, as table:column op value, e.g. \"users:status = 'active'\" (repeatable)")
+	diffCmd.Flags().StringArrayVar(&identities, "identity", nil, "Identify a table's rows by an expression over its columns instead of the primary key, as table:expression, e.g. \"users:lower(email)\" (repeatable)")
+	diffCmd.Flags().StringArrayVar(&columnMaps, "column-map", nil, "Compare a column renamed between the snapshots as one column, as table:oldname=newname, e.g. orders:user_id=userId (repeatable)")
+	diffCmd.Flags().BoolVar(&verboseSchema, "verbose-schema", false, "Show the CREATE TABLE of added and dropped tables and changed column attributes side by side")
+	diffCmd.Flags().BoolVar(&diffOpts.MatchIndexesByColumns, "match-indexes-by-columns", false, "Match indexes by their columns instead of by name, ignoring renamed indexes")
+	diffCmd.Flags().BoolVar(&diffOpts.MatchConstraintsByDefinition, "match-constraints-by-definition", false, "Match foreign keys and check constraints by definition, treating a differently named one as renamed (PostgreSQL RENAME CONSTRAINT, MySQL drop and add)")
+	diffCmd.Flags().BoolVar(&diffOpts.NormalizeDefinitions, "normalize-definitions", false, "Compare materialized view and rule definitions ignoring whitespace and letter case outside quotes")
+	diffCmd.Flags().StringVar(&autoIncrement, "auto-increment", "ignore", "Whether next auto-increment values are compared: include or ignore")
+	diffCmd.Flags().BoolVar(&diffOpts.CheckColumnOrder, "check-column-order", false, "Also report tables whose columns are in a different order")
+	diffCmd.Flags().BoolVar(&diffOpts.HintSplits, "hint-splits", false, "Note dropped tables whose columns reappear in added tables that repeat their primary key, which suggests a vertical split")
+	diffCmd.Flags().BoolVar(&diffOpts.OnlyTablesWithData, "only-tables-with-data", false, "Skip the data comparison of tables that are empty in both snapshots")
+	diffCmd.Flags().StringSliceVar(&diffOpts.IgnoreColumns, "ignore-columns", nil, "Leave columns out of the data comparison and of generated WHERE and SET clauses, as column (every table) or table.column, e.g. updated_at,orders.last_seen")
+	diffCmd.Flags().DurationVar(&diffOpts.TimeTolerance, "time-tolerance", 0, "Treat date/time values within this duration of each other as equal, e.g. 2s")
+	diffCmd.Flags().IntVar(&diffOpts.ShowRows, "max-rows", 10, "Show the key and changed columns of at most N modified rows per table in the text report (0: counts only, -1: all)")
+	diffCmd.Flags().BoolVar(&diffOpts.CountOnly, "count-only", false, "Only count added, deleted and modified rows instead of keeping them, to save memory on large tables")
+	diffCmd.Flags().BoolVar(&diffOpts.CollationAware, "collation-aware", false, "Compare values of case-insensitive collation columns ignoring case and accents, as the database does")
+
+	// Memory guardrail
+	for _, c := range []*cobra.Command{snapshotCmd, diffCmd} {
+		c.Flags().IntVar(&maxMemory, "max-memory", 0, "Abort with an error when the process holds more than this many MB of memory (0: no limit)")
+		c.Flags().BoolVar(&profileMemory, "profile-memory", false, "Print the peak memory use to stderr when done")
+	}
+
+	// Fail on malformed snapshots instead of warning
+	for _, c := range []*cobra.Command{diffCmd, tableCmd, migrateCmd, applyCmd} {
+		c.Flags().BoolVar(&strictLoad, "strict", false, "Fail instead of warning when a snapshot's schema is malformed")
+	}
+
+	// Table command flags
+	tableCmd.Flags().IntVar(&diffOpts.ShowRows, "max-rows", 10, "Show the key and changed columns of at most N modified rows (0: counts only, -1: all)")
+	tableCmd.Flags().StringSliceVar(&diffOpts.IgnoreColumns, "ignore-columns", nil, "Leave columns out of the data comparison and of generated WHERE and SET clauses, as column (every table) or table.column, e.g. updated_at,orders.last_seen")
+	tableCmd.Flags().BoolVar(&tableSQL, "sql", false, "Also print the migration SQL for the table")
+
+	// Matrix command flags
+	matrixCmd.Flags().StringSliceVar(&diffOpts.IgnoreColumns, "ignore-columns", nil, "Leave columns out of the data comparison, as column (every table) or table.column, e.g. updated_at,orders.last_seen")
+
+	// Migrate command flags
+	migrateCmd.Flags().StringVar(&autoIncrement, "auto-increment", "ignore", "Whether next auto-increment values are compared and set: include or ignore")
+	migrateCmd.Flags().BoolVar(&diffOpts.MatchIndexesByColumns, "match-indexes-by-columns", false, "Match indexes by their columns instead of by name, ignoring renamed indexes")
+	migrateCmd.Flags().BoolVar(&diffOpts.MatchConstraintsByDefinition, "match-constraints-by-definition", false, "Match foreign keys and check constraints by definition, treating a differently named one as renamed (PostgreSQL RENAME CONSTRAINT, MySQL drop and add)")
+	migrateCmd.Flags().BoolVar(&diffOpts.NormalizeDefinitions, "normalize-definitions", false, "Compare materialized view and rule definitions ignoring whitespace and letter case outside quotes")
+	migrateCmd.Flags().StringSliceVar(&diffOpts.IgnoreColumns, "ignore-columns", nil, "Leave columns out of the data comparison and of generated WHERE and SET clauses, as column (every table) or table.column, e.g. updated_at,orders.last_seen")
+	migrateCmd.Flags().DurationVar(&diffOpts.TimeTolerance, "time-tolerance", 0, "Treat date/time values within this duration of each other as equal, e.g. 2s")
+	migrateCmd.Flags().BoolVar(&diffOpts.CollationAware, "collation-aware", false, "Compare values of case-insensitive collation columns ignoring case and accents, as the database does")
+	migrateCmd.Flags().BoolVar(&diffOpts.CheckColumnOrder, "check-column-order", false, "Also put columns in the order of snapshot2 (MySQL MODIFY ... AFTER; PostgreSQL needs --allow-table-rebuild)")
+	migrateCmd.Flags().BoolVar(&tableRebuild, "allow-table-rebuild", false, "Reorder PostgreSQL columns with --check-column-order by copying the table into a new one that replaces it")
+	migrateCmd.Flags().Float64Var(&resyncThreshold, "resync-threshold", 0, "Rewrite a table's data with TRUNCATE, or DELETE when other tables reference it, and INSERT when more than this fraction of rows changed, e.g. 0.8 (0: disabled)")
+	migrateCmd.Flags().BoolVar(&estimate, "estimate", false, "Print statement counts by type and a risk rating instead of the migration SQL")
+	migrateCmd.Flags().IntVar(&maxValueLength, "max-value-length", 0, "Fail when a statement needs a value literal longer than N bytes (0: no limit)")
+	migrateCmd.Flags().BoolVar(&skipOversized, "skip-oversized", false, "Leave statements with values longer than --max-value-length commented out, with a placeholder and a warning, instead of failing")
+	migrateCmd.Flags().StringVar(&boolFormat, "bool-format", generator.BoolKeyword, "Literal style for boolean values: keyword (TRUE/FALSE), numeric (1/0) or char ('t'/'f')")
+	migrateCmd.Flags().StringVar(&numericLocale, "numeric-locale", "", "Write float values in this locale; C uses '.' as the decimal separator and the shortest exact digits instead of six fixed decimals")
+	migrateCmd.Flags().StringVar(&outputEncoding, "output-encoding", textenc.UTF8, "Encoding of the generated SQL, e.g. utf-16, latin1 or shift_jis (UTF-16 and utf-8-bom start with a byte order mark)")
+	migrateCmd.Flags().StringVar(&splitOutput, "split-output", "", "Write 00_drops.sql, 01_ddl.sql and 02_dml.sql to this directory instead of printing the migration")
+	migrateCmd.Flags().BoolVar(&ifExists, "if-exists", false, "Make table and column DDL safe to re-run with IF [NOT] EXISTS (guarded by information_schema checks for MySQL columns)")
+	migrateCmd.Flags().StringVar(&terminator, "terminator", ";", "Statement terminator to end each generated statement with")
+	migrateCmd.Flags().BoolVar(&delimiterSwitch, "delimiter", false, "Surround the script with DELIMITER commands for the mysql client when --terminator is not ;")
+	migrateCmd.Flags().BoolVar(&upsert, "upsert", false, "Generate added rows as upserts (ON DUPLICATE KEY UPDATE / ON CONFLICT DO UPDATE) on the primary key")
+	migrateCmd.Flags().IntVar(&insertBatchSize, "insert-batch-size", 0, "Group up to this many consecutive added rows of a table with the same columns into one multi-row INSERT (0: one row per INSERT)")
+	migrateCmd.Flags().StringArrayVar(&conflictColumns, "on-conflict-columns", nil, "Conflict target of a table's upserts instead of its primary key, as table:column[,column...] naming a unique index (repeatable)")
+	migrateCmd.Flags().StringSliceVar(&copyTables, "copy-tables", nil, "Reference tables whose added rows are copied with INSERT ... SELECT from --copy-from instead of written as literals")
+	migrateCmd.Flags().StringVar(&copySource, "copy-from", "", "Schema (or MySQL database) on the target server holding the source of --copy-tables")
+	migrateCmd.Flags().StringVar(&placeholders, "placeholders", "", "Generate each table's added rows as one INSERT template with named (:column) or positional ($1 / ?) placeholders, their values going to --values-file")
+	migrateCmd.Flags().StringVar(&valuesFile, "values-file", "", "Write the rows of --placeholders templates to one .csv or .json file per table, named after this path, e.g. values.csv gives values.users.csv")
+	migrateCmd.Flags().BoolVar(&fromEmpty, "from-empty", false, "Generate the SQL creating the only snapshot given from an empty database: every table and every row, in dependency order")
+	migrateCmd.Flags().BoolVar(&groupByTable, "group-by-table", false, "Emit each table's DDL followed by its DML under a per-table header")
+	migrateCmd.Flags().BoolVar(&validateApply, "validate-apply", false, "Check that the generated DDL applies cleanly to a throwaway schema built from snapshot1's tables on the database configured by DB_* (needs the privilege to create one)")
+	migrateCmd.Flags().StringVar(&dialectOut, "dialect-out", "", "Generate SQL for this dialect (mysql or postgres), translating column types from the source")
+
+	// Apply command flags
+	applyCmd.Flags().BoolVar(&checkpoints, "checkpoints", false, "Apply in one transaction with a savepoint per group of statements, rolling back only the failed group")
+	applyCmd.Flags().IntVar(&checkpointSize, "checkpoint-size", 1, "Number of statements per checkpoint with --checkpoints")
+
+	// Export command flags
+	exportCmd.Flags().StringVar(&exportDir, "output-dir", "./export", "Output directory for CSV files")
+	exportCmd.Flags().StringVar(&exportOpts.NullAs, "null-as", "", `Text written for NULL values, e.g. \N or NULL (default: empty, same as an empty string)`)
+	exportCmd.Flags().IntVar(&exportOpts.RowsPerFile, "rows-per-file", 0, "Split each table into <table>.part001.csv, ... files of at most N rows, listed in manifest.json (0: one file per table)")
+
+	// Rebase command flags
+	rebaseCmd.Flags().StringVar(&rebaseTable, "table", "", "Table whose key values are rewritten")
+	rebaseCmd.Flags().StringVar(&rebaseColumn, "column", "", "Key column to rewrite (default: the table's single-column primary key)")
+	rebaseCmd.Flags().StringArrayVar(&rebaseMaps, "map", nil, "Key value mapping as old=new (repeatable)")
+	rebaseCmd.Flags().StringVar(&rebaseMapFile, "map-file", "", "CSV file of old,new key value pairs")
+	rebaseCmd.Flags().StringVar(&rebaseOutput, "output", "", "Write the rebased snapshot to this file instead of rewriting the snapshot in place")
+	rebaseCmd.MarkFlagRequired("table")
+
+	// Lint command flags
+	lintCmd.Flags().StringVar(&lintRules.IndexPrefix, "index-prefix", "idx_", "Required prefix for index names (empty to disable)")
+	lintCmd.Flags().StringVar(&lintRules.FKPrefix, "fk-prefix", "fk_", "Required prefix for foreign key names (empty to disable)")
+	lintCmd.Flags().BoolVar(&lintRules.SnakeCase, "snake-case", true, "Require snake_case names")
+	lintCmd.Flags().BoolVar(&lintStrict, "strict", false, "Exit with an error when violations are found")
 
 	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(monitorCmd)
 	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(tableCmd)
+	rootCmd.AddCommand(matrixCmd)
 	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(rebaseCmd)
+	rootCmd.AddCommand(lintCmd)
+	rootCmd.AddCommand(pingCmd)
+	rootCmd.AddCommand(checkFKCmd)
+}
+
+// applyEnvDefaults sets flags that were not given on the command line from
+// environment variables, so flags always take precedence over the environment
+func applyEnvDefaults(cmd *cobra.Command, envByFlag map[string]string) error {
+	for flag, env := range envByFlag {
+		value, ok := os.LookupEnv(env)
+		if !ok || value == "" || cmd.Flags().Changed(flag) {
+			continue
+		}
+		if err := cmd.Flags().Set(flag, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", env, err)
+		}
+	}
+	return nil
+}
+
+// loadSnapshot loads a snapshot, failing on a malformed one with --strict
+func loadSnapshot(snapshotPath string) (*snapshot.Snapshot, error) {
+	return snapshot.LoadSnapshotWithOptions(snapshotPath, snapshot.LoadOptions{Strict: strictLoad})
+}
+
+// errMemoryLimit is the cause of a context cancelled by startMemoryGuard
+var errMemoryLimit = errors.New("memory limit exceeded")
+
+// startMemoryGuard watches memory use for --max-memory and --profile-memory.
+// Exceeding the limit cancels the returned context with an error suggesting
+// hint, so the command stops through its usual cleanup; the returned
+// function stops watching and reports the peak.
+func startMemoryGuard(ctx context.Context, hint string) (context.Context, func()) {
+	if maxMemory <= 0 && !profileMemory {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	guard := memguard.Start(uint64(max(maxMemory, 0))<<20, memguard.DefaultInterval, func(inUse uint64) {
+		cancel(fmt.Errorf("%w: memory use reached %d MB, over --max-memory %d MB; %s", errMemoryLimit, inUse>>20, maxMemory, hint))
+	})
+	return ctx, func() {
+		guard.Stop()
+		cancel(nil)
+		if profileMemory {
+			fmt.Fprintf(os.Stderr, "Peak memory: %d MB\n", guard.Peak()>>20)
+		}
+	}
+}
+
+// parseAutoIncrementMode applies the --auto-increment flag to diffOpts
+func parseAutoIncrementMode() error {
+	switch autoIncrement {
+	case "include":
+		diffOpts.IncludeAutoIncrement = true
+	case "ignore":
+		diffOpts.IncludeAutoIncrement = false
+	default:
+		return fmt.Errorf("unsupported --auto-increment %q (expected include or ignore)", autoIncrement)
+	}
+	return nil
 }
 
 func runSnapshot(cmd *cobra.Command, args []string) error {
+	if force && resume {
+		return fmt.Errorf("--force and --resume cannot be used together")
+	}
+	if baseSnapshot != "" && resume {
+		return fmt.Errorf("--base and --resume cannot be used together; a resumed snapshot keeps its base")
+	}
+
+	opts := snapshot.Options{
+		Tables:                tables,
+		Exclude:               exclude,
+		ExcludeIgnoreCase:     excludeCase,
+		Limit:                 limit,
+		PKRanges:              make(map[string]snapshot.PKRange),
+		OrderBy:               make(map[string]database.OrderBy),
+		Where:                 make(map[string]string),
+		TableTimeout:          tableTimeout,
+		Strict:                strict,
+		CommitInterval:        commitInterval,
+		Concurrency:           concurrency,
+		SkipEmptyTables:       skipEmpty,
+		BlobThreshold:         blobThreshold,
+		Overwrite:             force,
+		Resume:                resume,
+		Base:                  baseSnapshot,
+		PreserveCreationOrder: creationOrder,
+	}
+	for _, spec := range pkRanges {
+		tableName, r, err := snapshot.ParsePKRange(spec)
+		if err != nil {
+			return err
+		}
+		opts.PKRanges[tableName] = r
+	}
+	for _, spec := range orderBy {
+		tableName, o, err := snapshot.ParseOrderBy(spec)
+		if err != nil {
+			return err
+		}
+		opts.OrderBy[tableName] = o
+	}
+	for _, spec := range wheres {
+		tableName, where, err := snapshot.ParseWhere(spec)
+		if err != nil {
+			return err
+		}
+		opts.Where[tableName] = where
+	}
+	for _, spec := range hashColumns {
+		tableName, columns, err := snapshot.ParseHashColumns(spec)
+		if err != nil {
+			return err
+		}
+		if opts.HashColumns == nil {
+			opts.HashColumns = make(map[string][]string)
+		}
+		opts.HashColumns[tableName] = append(opts.HashColumns[tableName], columns...)
+	}
+	if len(opts.HashColumns) > 0 {
+		if hashSalt == "" {
+			return fmt.Errorf("--hash-columns requires a salt (--hash-salt or $DBDIFF_HASH_SALT)")
+		}
+		opts.HashSalt = hashSalt
+	}
+
 	// Load database configuration
 	config, err := database.LoadConfigFromEnv()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
-
-	// Create database connection
-	db, err := database.NewDatabase(config)
-	if err != nil {
-		return fmt.Errorf("failed to create database: %w", err)
-	}
-
-	// Connect to database
-	if err := db.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+	if err := checkDialect(config); err != nil {
+		return err
 	}
-	defer db.Close()
+	config.IncludeSystemTables = systemTables
+	config.ReadOnly = readOnly
 
 	// Generate snapshot filename
 	var filename string
@@ -96,76 +568,1139 @@ func runSnapshot(cmd *cobra.Command, args []string) error {
 			filename += ".db"
 		}
 	} else {
-		timestamp := time.Now().Format("2006-01-02-15-04-05")
-		filename = fmt.Sprintf("%s-%s.db", config.Database, timestamp)
+		filename = defaultSnapshotName(config.Database)
 	}
 
 	outputPath := filepath.Join(outputDir, filename)
 
+	// Refuse to clobber an earlier snapshot before doing any work
+	if _, err := os.Stat(outputPath); err == nil && !force && !resume {
+		return fmt.Errorf("snapshot already exists at %s, use --force to overwrite", outputPath)
+	}
+	if baseSnapshot != "" {
+		if _, err := os.Stat(baseSnapshot); err != nil {
+			return fmt.Errorf("base snapshot does not exist: %s", baseSnapshot)
+		}
+	}
+
+	// Create database connection
+	db, err := database.NewDatabase(config)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+
+	ctx, cancel := snapshotContext(cmd)
+	defer cancel()
+	ctx, stopGuard := startMemoryGuard(ctx, "snapshot fewer rows with --limit, --tables or --where, or continue with --resume")
+	defer stopGuard()
+
+	// Connect to database
+	if err := db.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	opts.Label = label
+	opts.Tag = snapshotTag
+	opts.ReadOnly = readOnly
+	if opts.Label == "" {
+		opts.Label = config.Label()
+	}
+
 	// Create snapshot
-	fmt.Printf("Creating snapshot: %s\n", outputPath)
-	if err := snapshot.CreateSnapshot(db, tables, outputPath, limit); err != nil {
-		return fmt.Errorf("failed to create snapshot: %w", err)
+	fmt.Printf("Creating snapshot: %s [%s]\n", outputPath, opts.Label)
+	if err := snapshot.CreateSnapshot(ctx, db, outputPath, opts); err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", snapshotError(ctx, err))
 	}
 
 	fmt.Printf("Snapshot created successfully: %s\n", outputPath)
 	return nil
 }
 
+// snapshotContext returns the context a snapshot reads the database in. It
+// is cancelled by Ctrl-C, which aborts the query in flight instead of
+// killing the process mid-write, and by --timeout when it is set.
+func snapshotContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	if snapshotTimeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// snapshotError explains a snapshot failure caused by its context ending
+func snapshotError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, errMemoryLimit) {
+		return cause
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %s: %w", snapshotTimeout, err)
+	case context.Canceled:
+		return fmt.Errorf("interrupted: %w", err)
+	}
+	return err
+}
+
+// defaultSnapshotName names a snapshot of a database by the current time
+func defaultSnapshotName(dbName string) string {
+	timestamp := time.Now().Format("2006-01-02-15-04-05")
+	return fmt.Sprintf("%s-%s.db", dbName, timestamp)
+}
+
+func runMonitor(cmd *cobra.Command, args []string) error {
+	// Find the snapshot to compare with
+	var storedPath string
+	var err error
+	if snapshotTag != "" {
+		storedPath, err = snapshot.FindLatest(outputDir, snapshotTag)
+	} else {
+		storedPath, err = snapshot.FindNewest(outputDir)
+	}
+	if err != nil {
+		return err
+	}
+	stored, err := loadSnapshot(storedPath)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", storedPath, err)
+	}
+	opts, err := stored.RecaptureOptions(hashSalt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", storedPath, err)
+	}
+	opts.Tables = tables
+	opts.Concurrency = concurrency
+	opts.CommitInterval = commitInterval
+	opts.Overwrite = true
+
+	config, err := database.LoadConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := checkDialect(config); err != nil {
+		return err
+	}
+	db, err := database.NewDatabase(config)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	ctx, cancel := snapshotContext(cmd)
+	defer cancel()
+	if err := db.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+	opts.Label = label
+	if opts.Label == "" {
+		opts.Label = config.Label()
+	}
+	return monitor(ctx, db, storedPath, stored, opts, config.Database)
+}
+
+// monitor snapshots the live database db with opts and compares it with the
+// stored snapshot. It fails when drift is found, keeping the live snapshot
+// as a snapshot of dbName in --output-dir under --snapshot-on-drift.
+func monitor(ctx context.Context, db database.Database, storedPath string, stored *snapshot.Snapshot, opts snapshot.Options, dbName string) error {
+	// The live snapshot is written next to the stored ones, without the .db
+	// extension that would make it a candidate until it is kept
+	tmp, err := os.CreateTemp(outputDir, ".monitor-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create live snapshot: %w", err)
+	}
+	livePath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(livePath)
+
+	fmt.Printf("Comparing %s with %s\n", opts.Label, storedPath)
+	if err := snapshot.CreateSnapshot(ctx, db, livePath, opts); err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", snapshotError(ctx, err))
+	}
+	live, err := loadSnapshot(livePath)
+	if err != nil {
+		return fmt.Errorf("failed to load live snapshot: %w", err)
+	}
+	if err := snapshot.CheckHashCompatible(stored, live); err != nil {
+		return err
+	}
+	if err := diff.CheckIgnoreColumns(stored, live, diffOpts.IgnoreColumns); err != nil {
+		return err
+	}
+
+	result := diff.Compare(stored, live, diffOpts)
+	if !result.HasDifferences() {
+		fmt.Println("No drift found.")
+		return nil
+	}
+	fmt.Println()
+	diff.DisplayTo(result, os.Stdout)
+
+	if snapshotDrift {
+		keptPath := filepath.Join(outputDir, defaultSnapshotName(dbName))
+		if err := os.Rename(livePath, keptPath); err != nil {
+			return fmt.Errorf("failed to keep snapshot: %w", err)
+		}
+		fmt.Printf("Snapshot created successfully: %s\n", keptPath)
+	}
+	return fmt.Errorf("drift found since %s", storedPath)
+}
+
 func runDiff(cmd *cobra.Command, args []string) error {
 	snapshot1Path := args[0]
 	snapshot2Path := args[1]
 
+	if err := parseAutoIncrementMode(); err != nil {
+		return err
+	}
+	if diffFormat != "text" && diffFormat != "markdown" && diffFormat != "html" && diffFormat != "json" && diffFormat != "jsonl" {
+		return fmt.Errorf("unsupported --format %q (expected text, markdown, html, json or jsonl)", diffFormat)
+	}
+	if diffFormat == "html" && !strings.HasPrefix(strings.ToLower(outputEncoding), textenc.UTF8) {
+		return fmt.Errorf("--format html is always written as UTF-8")
+	}
+	if ciMode != "" && ciMode != "github" {
+		return fmt.Errorf("unsupported --ci %q (expected github)", ciMode)
+	}
+	if err := textenc.Check(outputEncoding); err != nil {
+		return fmt.Errorf("--output-encoding: %w", err)
+	}
+	for _, spec := range rowFilters {
+		tableName, f, err := diff.ParseRowFilter(spec)
+		if err != nil {
+			return err
+		}
+		if diffOpts.RowFilters == nil {
+			diffOpts.RowFilters = make(map[string]*diff.RowFilter)
+		}
+		diffOpts.RowFilters[tableName] = f
+	}
+	for _, spec := range identities {
+		tableName, id, err := diff.ParseIdentity(spec)
+		if err != nil {
+			return err
+		}
+		if diffOpts.Identities == nil {
+			diffOpts.Identities = make(map[string]*diff.Identity)
+		}
+		diffOpts.Identities[tableName] = id
+	}
+	for _, spec := range columnMaps {
+		tableName, oldName, newName, err := diff.ParseColumnMap(spec)
+		if err != nil {
+			return err
+		}
+		if diffOpts.ColumnMaps == nil {
+			diffOpts.ColumnMaps = make(map[string]map[string]string)
+		}
+		if diffOpts.ColumnMaps[tableName] == nil {
+			diffOpts.ColumnMaps[tableName] = make(map[string]string)
+		}
+		diffOpts.ColumnMaps[tableName][oldName] = newName
+	}
+
+	// Progress goes to stderr when stdout carries a markdown, HTML, JSON or
+	// transcoded report
+	status := os.Stdout
+	if (diffFormat != "text" || !strings.EqualFold(outputEncoding, textenc.UTF8)) && diffOutput == "" {
+		status = os.Stderr
+	}
+
+	// Row entries are matched against the changed rows, which --count-only
+	// does not keep
+	var allowlist *diff.Allowlist
+	if allowDiffsFile != "" {
+		var err error
+		if allowlist, err = diff.LoadAllowlist(allowDiffsFile); err != nil {
+			return err
+		}
+		if diffOpts.CountOnly && allowlist.HasRows() {
+			return fmt.Errorf("--count-only cannot be used with row entries in --allow-diffs; use data entries or compare without --count-only")
+		}
+	}
+
+	ctx, stopGuard := startMemoryGuard(cmd.Context(), "compare with --count-only, or take the snapshots with --limit or --tables")
+	defer stopGuard()
+
+	// Resolve tags to their latest snapshots
+	if latestTags {
+		var err error
+		if snapshot1Path, err = snapshot.FindLatest(snapshotDir, args[0]); err != nil {
+			return err
+		}
+		if snapshot2Path, err = snapshot.FindLatest(snapshotDir, args[1]); err != nil {
+			return err
+		}
+	}
+
 	// Load snapshots
-	fmt.Printf("Loading snapshot: %s\n", snapshot1Path)
-	snap1, err := snapshot.LoadSnapshot(snapshot1Path)
+	fmt.Fprintf(status, "Loading snapshot: %s\n", snapshot1Path)
+	snap1, err := loadSnapshot(snapshot1Path)
 	if err != nil {
 		return fmt.Errorf("failed to load snapshot1: %w", err)
 	}
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
 
-	fmt.Printf("Loading snapshot: %s\n", snapshot2Path)
-	snap2, err := snapshot.LoadSnapshot(snapshot2Path)
+	fmt.Fprintf(status, "Loading snapshot: %s\n", snapshot2Path)
+	snap2, err := loadSnapshot(snapshot2Path)
 	if err != nil {
 		return fmt.Errorf("failed to load snapshot2: %w", err)
 	}
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+
+	if err := diff.CheckRowFilters(snap1, snap2, diffOpts.RowFilters); err != nil {
+		return err
+	}
+	if err := diff.CheckIdentities(snap1, snap2, diffOpts.Identities); err != nil {
+		return err
+	}
+	if err := diff.CheckColumnMaps(snap1, snap2, diffOpts.ColumnMaps); err != nil {
+		return err
+	}
+	if err := diff.CheckIgnoreColumns(snap1, snap2, diffOpts.IgnoreColumns); err != nil {
+		return err
+	}
+	if err := snapshot.CheckHashCompatible(snap1, snap2); err != nil {
+		return err
+	}
+	warnPKRanges(snap1, snap2)
+	dbType, err := resolveDialect(snap1, snap2)
+	if err != nil {
+		return err
+	}
 
 	// Compare snapshots
-	fmt.Printf("\n=== Comparing snapshots ===\n\n")
-	result := diff.Compare(snap1, snap2)
+	fmt.Fprintf(status, "\n=== Comparing snapshots ===\n")
+	if l := diffLabel(snap1, snap2); l != "" {
+		fmt.Fprintf(status, "Label: %s\n", l)
+	}
+	fmt.Fprintln(status)
+	result := diff.Compare(snap1, snap2, diffOpts)
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+
+	// Separate expected differences declared in the allowlist
+	expected := &diff.DiffResult{}
+	if allowlist != nil {
+		result, expected = allowlist.Filter(result)
+	}
 
 	// Display differences
-	diff.Display(result)
+	var dest io.Writer = os.Stdout
+	if diffOutput != "" {
+		f, err := os.Create(diffOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", diffOutput, err)
+		}
+		defer f.Close()
+		dest = f
+	}
+	out, err := textenc.NewWriter(dest, outputEncoding)
+	if err != nil {
+		return err
+	}
+	if diffFormat == "json" {
+		if err := diff.WriteJSON(result, expected, out); err != nil {
+			return err
+		}
+	} else if diffFormat == "jsonl" {
+		if err := diff.WriteJSONLines(result, expected, out); err != nil {
+			return err
+		}
+	} else if diffFormat == "html" {
+		if err := diff.RenderHTML(result, expected, out); err != nil {
+			return err
+		}
+	} else if diffFormat == "markdown" {
+		diff.DisplayMarkdown(result, out)
+		diff.DisplayMarkdownExpected(expected, out)
+	} else if verboseSchema {
+		diff.DisplayVerbose(result, out, createTableSQL(dbType))
+		diff.DisplayExpected(expected, out)
+	} else {
+		diff.DisplayTo(result, out)
+		diff.DisplayExpected(expected, out)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if diffOutput != "" {
+		fmt.Fprintf(status, "Report written to %s\n", diffOutput)
+	}
+	if reportFile != "" {
+		if err := writeReportFile(reportFile, result, expected); err != nil {
+			return err
+		}
+		fmt.Fprintf(status, "Report file written to %s\n", reportFile)
+	}
+
+	if ciMode == "github" {
+		diff.WriteGitHubAnnotations(result, expected, os.Stdout)
+		if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+			if err := diff.AppendStepSummary(result, expected, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if exitCode && result.HasDifferences() {
+		return fmt.Errorf("differences found")
+	}
 
 	return nil
 }
 
+// writeReportFile writes the archival report of a comparison
+func writeReportFile(path string, result, expected *diff.DiffResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := diff.WriteReport(result, expected, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runTable(cmd *cobra.Command, args []string) error {
+	snap1, err := loadSnapshot(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot1: %w", err)
+	}
+
+	snap2, err := loadSnapshot(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot2: %w", err)
+	}
+	return writeTableDiff(snap1, snap2, args[2], os.Stdout)
+}
+
+// writeTableDiff writes the differences of one table, and with --sql the
+// SQL applying them in the snapshots' dialect
+func writeTableDiff(snap1, snap2 *snapshot.Snapshot, tableName string, out io.Writer) error {
+	if err := snapshot.CheckHashCompatible(snap1, snap2); err != nil {
+		return err
+	}
+	warnPKRanges(snap1, snap2)
+	if tableSQL {
+		for _, snap := range []*snapshot.Snapshot{snap1, snap2} {
+			if err := snapshot.CheckUnhashed(snap); err != nil {
+				return err
+			}
+		}
+	}
+	if err := diff.CheckIgnoreColumns(snap1, snap2, diffOpts.IgnoreColumns); err != nil {
+		return err
+	}
+	dbType, err := resolveDialect(snap1, snap2)
+	if err != nil {
+		return err
+	}
+
+	result, err := diff.CompareTable(snap1, snap2, tableName, diffOpts)
+	if err != nil {
+		return err
+	}
+	diff.DisplayTo(result, out)
+
+	if tableSQL && result.HasDifferences() {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, generator.GenerateSQL(result, generator.Options{Dialect: dbType}))
+	}
+
+	return nil
+}
+
+func runMatrix(cmd *cobra.Command, args []string) error {
+	baseline, err := loadSnapshot(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load baseline: %w", err)
+	}
+
+	var pairs []diff.SnapshotPair
+	names := make(map[string]int)
+	for _, path := range args[1:] {
+		snap, err := loadSnapshot(path)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		if err := snapshot.CheckHashCompatible(baseline, snap); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		warnPKRanges(baseline, snap)
+		if err := diff.CheckIgnoreColumns(baseline, snap, diffOpts.IgnoreColumns); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		// Columns are named by the snapshot's label, or its file name
+		name := snap.Label()
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		names[name]++
+		pairs = append(pairs, diff.SnapshotPair{Name: name, Baseline: baseline, Target: snap})
+	}
+	// Snapshots sharing a label are told apart by their paths
+	for i := range pairs {
+		if names[pairs[i].Name] > 1 {
+			pairs[i].Name = fmt.Sprintf("%s (%s)", pairs[i].Name, args[i+1])
+		}
+	}
+
+	diff.DisplayMatrix(diff.Aggregate(pairs, diffOpts), os.Stdout)
+	return nil
+}
+
 func runMigrate(cmd *cobra.Command, args []string) error {
+	// The comparison keeps the rows of the tables to rewrite
+	diffOpts.ResyncThreshold = resyncThreshold
+	if fromEmpty {
+		return runMigrateFromEmpty(cmd.Context(), args[0])
+	}
 	snapshot1Path := args[0]
 	snapshot2Path := args[1]
 
+	if err := parseAutoIncrementMode(); err != nil {
+		return err
+	}
+
 	// Load snapshots
-	snap1, err := snapshot.LoadSnapshot(snapshot1Path)
+	snap1, err := loadSnapshot(snapshot1Path)
 	if err != nil {
 		return fmt.Errorf("failed to load snapshot1: %w", err)
 	}
 
-	snap2, err := snapshot.LoadSnapshot(snapshot2Path)
+	snap2, err := loadSnapshot(snapshot2Path)
 	if err != nil {
 		return fmt.Errorf("failed to load snapshot2: %w", err)
 	}
+	if err := snapshot.CheckHashCompatible(snap1, snap2); err != nil {
+		return err
+	}
+	if err := diff.CheckIgnoreColumns(snap1, snap2, diffOpts.IgnoreColumns); err != nil {
+		return err
+	}
+	warnPKRanges(snap1, snap2)
 
 	// Compare snapshots
-	result := diff.Compare(snap1, snap2)
+	result := diff.Compare(snap1, snap2, diffOpts)
+	return writeMigration(cmd.Context(), snap1, snap2, result, filepath.Base(snapshot1Path), filepath.Base(snapshot2Path))
+}
+
+// runMigrateFromEmpty generates the SQL creating a snapshot's tables and
+// data from an empty database
+func runMigrateFromEmpty(ctx context.Context, snapshotPath string) error {
+	if err := parseAutoIncrementMode(); err != nil {
+		return err
+	}
+
+	snap, err := loadSnapshot(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	empty := &snapshot.Snapshot{Metadata: map[string]string{}, Tables: map[string]*schema.Table{}}
+	result := diff.CompareFromEmpty(snap, diffOpts)
+	return writeMigration(ctx, empty, snap, result, "(empty)", filepath.Base(snapshotPath))
+}
+
+// writeMigration prints, splits or estimates the migration SQL for result
+// according to the migrate flags
+func writeMigration(ctx context.Context, snap1, snap2 *snapshot.Snapshot, result *diff.DiffResult, name1, name2 string) error {
+	for _, snap := range []*snapshot.Snapshot{snap1, snap2} {
+		if err := snapshot.CheckUnhashed(snap); err != nil {
+			return err
+		}
+	}
+	dbType, err := resolveDialect(snap1, snap2)
+	if err != nil {
+		return err
+	}
+
+	opts := generator.Options{
+		Dialect:              dbType,
+		ResyncThreshold:      resyncThreshold,
+		GroupByTable:         groupByTable,
+		IfExists:             ifExists,
+		Terminator:           terminator,
+		DelimiterSwitch:      delimiterSwitch,
+		IncludeAutoIncrement: diffOpts.IncludeAutoIncrement,
+		BoolFormat:           boolFormat,
+		NumericLocale:        numericLocale,
+		MaxValueLength:       maxValueLength,
+		Upsert:               upsert,
+		InsertBatchSize:      insertBatchSize,
+		AllowTableRebuild:    tableRebuild,
+	}
+	if insertBatchSize < 0 {
+		return fmt.Errorf("--insert-batch-size must not be negative")
+	}
+	for _, spec := range conflictColumns {
+		tableName, columns, err := generator.ParseConflictColumns(spec)
+		if err != nil {
+			return err
+		}
+		if opts.ConflictColumns == nil {
+			opts.ConflictColumns = make(map[string][]string)
+		}
+		opts.ConflictColumns[tableName] = columns
+	}
+	if len(opts.ConflictColumns) > 0 {
+		if !upsert {
+			return fmt.Errorf("--on-conflict-columns requires --upsert")
+		}
+		if err := generator.CheckConflictColumns(snap2, opts.ConflictColumns); err != nil {
+			return err
+		}
+	}
+	if tableRebuild && !diffOpts.CheckColumnOrder {
+		return fmt.Errorf("--allow-table-rebuild requires --check-column-order")
+	}
+	if len(copyTables) > 0 || copySource != "" {
+		if len(copyTables) == 0 || copySource == "" {
+			return fmt.Errorf("--copy-tables and --copy-from must be used together")
+		}
+		opts.CopySource = copySource
+		opts.CopyTables = make(map[string]bool)
+		for _, tableName := range copyTables {
+			if _, ok := snap2.Tables[tableName]; !ok {
+				return fmt.Errorf("--copy-tables: table %s not found in %s", tableName, name2)
+			}
+			opts.CopyTables[tableName] = true
+		}
+	}
+	valuesFormat := ""
+	if placeholders != "" || valuesFile != "" {
+		if placeholders != generator.PlaceholderNamed && placeholders != generator.PlaceholderPositional {
+			return fmt.Errorf("unsupported --placeholders %q (expected named or positional)", placeholders)
+		}
+		if valuesFile == "" {
+			return fmt.Errorf("--placeholders requires --values-file")
+		}
+		if upsert {
+			return fmt.Errorf("--placeholders cannot be combined with --upsert")
+		}
+		var err error
+		if valuesFormat, err = generator.ValuesFormat(valuesFile); err != nil {
+			return err
+		}
+		opts.Placeholders = placeholders
+		opts.ValuesFile = valuesFile
+		opts.TemplateValues = make(map[string]*generator.TableValues)
+	}
+	switch boolFormat {
+	case generator.BoolKeyword, generator.BoolNumeric, generator.BoolChar:
+	default:
+		return fmt.Errorf("unsupported --bool-format %q (expected keyword, numeric or char)", boolFormat)
+	}
+	if numericLocale != "" && numericLocale != generator.NumericLocaleC {
+		return fmt.Errorf("unsupported --numeric-locale %q (expected C)", numericLocale)
+	}
+	if dialectOut != "" {
+		if dialectOut != "mysql" && dialectOut != "postgres" {
+			return fmt.Errorf("unsupported --dialect-out %q (expected mysql or postgres)", dialectOut)
+		}
+		opts.Dialect = dialectOut
+		opts.SourceDialect = dbType
+	}
+	if terminator == "" {
+		return fmt.Errorf("--terminator cannot be empty")
+	}
+	if err := textenc.Check(outputEncoding); err != nil {
+		return fmt.Errorf("--output-encoding: %w", err)
+	}
+	if delimiterSwitch && (opts.Dialect == "postgres" || opts.Dialect == "PostgreSQL") {
+		return fmt.Errorf("--delimiter is a mysql client command and cannot be used with postgres")
+	}
+	if groupByTable && splitOutput != "" {
+		return fmt.Errorf("--group-by-table cannot be used with --split-output, which groups statements by phase")
+	}
+	if skipOversized && maxValueLength <= 0 {
+		return fmt.Errorf("--skip-oversized requires --max-value-length")
+	}
+	if !skipOversized {
+		if err := generator.CheckValueLengths(result, opts); err != nil {
+			return fmt.Errorf("%w; use --skip-oversized to leave them commented out", err)
+		}
+	}
+
+	if validateApply {
+		failures, err := validateMigration(ctx, snap1, result, opts)
+		if err != nil {
+			return fmt.Errorf("failed to validate migration: %w", err)
+		}
+		if len(failures) > 0 {
+			for _, f := range failures {
+				fmt.Fprintf(os.Stderr, "Failed to apply: %s\n  %v\n", f.Statement, f.Err)
+			}
+			return fmt.Errorf("%d migration statement(s) failed validation", len(failures))
+		}
+	}
+
+	header := fmt.Sprintf("-- Migration SQL from %s to %s\n", name1, name2)
+	if l := diffLabel(snap1, snap2); l != "" {
+		header += fmt.Sprintf("-- Label: %s\n", l)
+	}
+	header += fmt.Sprintf("-- Generated at: %s\n", time.Now().Format(time.RFC3339))
 
-	// Detect database type from metadata or use default
-	dbType := "mysql" // Default, could be enhanced to detect from snapshot metadata
+	if estimate {
+		printEstimate(header, generator.EstimateStatements(result, opts))
+		return nil
+	}
+
+	if splitOutput != "" {
+		if err := writeSplitMigration(splitOutput, header, generator.GenerateSplitSQL(result, opts)); err != nil {
+			return err
+		}
+		return writeTemplateValues(opts, valuesFormat)
+	}
 
 	// Generate migration SQL
-	fmt.Printf("-- Migration SQL from %s to %s\n", filepath.Base(snapshot1Path), filepath.Base(snapshot2Path))
-	fmt.Printf("-- Generated at: %s\n\n", time.Now().Format(time.RFC3339))
+	sql := generator.GenerateSQL(result, opts)
+	encoded, err := textenc.Encode(header+"\n"+sql+"\n", outputEncoding)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stdout.Write(encoded); err != nil {
+		return err
+	}
+	return writeTemplateValues(opts, valuesFormat)
+}
 
-	sql := generator.GenerateSQL(result, dbType)
-	fmt.Println(sql)
+// writeTemplateValues writes the rows of each INSERT template to the table's
+// values file
+func writeTemplateValues(opts generator.Options, format string) error {
+	tableNames := make([]string, 0, len(opts.TemplateValues))
+	for tableName := range opts.TemplateValues {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	for _, tableName := range tableNames {
+		path := generator.ValuesPath(opts.ValuesFile, tableName)
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create values file: %w", err)
+		}
+		if err := generator.WriteValues(f, opts.TemplateValues[tableName], format, opts.Dialect); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	}
+	return nil
+}
+
+// printEstimate prints the statement counts of a migration
+func printEstimate(header string, e generator.Estimate) {
+	fmt.Println(header)
+	fmt.Printf("Creates: %d\n", e.Creates)
+	fmt.Printf("Drops:   %d\n", e.Drops)
+	fmt.Printf("Alters:  %d\n", e.Alters)
+	fmt.Printf("Inserts: %d\n", e.Inserts)
+	fmt.Printf("Updates: %d\n", e.Updates)
+	fmt.Printf("Deletes: %d\n", e.Deletes)
+	fmt.Printf("Total:   %d\n", e.Total())
+	fmt.Printf("\nRisk: %s (%d destructive statements)\n", e.Risk(), e.Destructive())
+}
+
+// validateMigration applies the migration DDL to a throwaway schema on the
+// configured database, which must be of the migration's dialect
+func validateMigration(ctx context.Context, snap1 *snapshot.Snapshot, result *diff.DiffResult, opts generator.Options) ([]generator.ValidationFailure, error) {
+	config, err := database.LoadConfigFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := checkDialect(config); err != nil {
+		return nil, err
+	}
+	if dbType := database.NormalizeType(config.Type); dbType != opts.Dialect {
+		return nil, fmt.Errorf("--validate-apply needs a %s database, but the configured database is %s", opts.Dialect, dbType)
+	}
+
+	db, err := database.NewDatabase(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database: %w", err)
+	}
+	if err := db.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	return generator.ValidateDDL(ctx, db.DB(), snap1, result, opts)
+}
+
+// writeSplitMigration writes each phase of a migration to its own file
+func writeSplitMigration(dir, header string, split generator.SplitSQL) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	files := []struct {
+		name, phase, sql string
+	}{
+		{"00_drops.sql", "Destructive DDL", split.Drops},
+		{"01_ddl.sql", "DDL", split.DDL},
+		{"02_dml.sql", "DML", split.DML},
+	}
+	for _, f := range files {
+		content, err := textenc.Encode(fmt.Sprintf("%s-- Phase: %s\n\n%s\n", header, f.phase, f.sql), outputEncoding)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
 
 	return nil
 }
+
+func runApply(cmd *cobra.Command, args []string) error {
+	snap1, err := loadSnapshot(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot1: %w", err)
+	}
+
+	snap2, err := loadSnapshot(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot2: %w", err)
+	}
+	for _, snap := range []*snapshot.Snapshot{snap1, snap2} {
+		if err := snapshot.CheckUnhashed(snap); err != nil {
+			return err
+		}
+	}
+
+	// Load target database configuration
+	config, err := database.LoadConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := checkDialect(config); err != nil {
+		return err
+	}
+
+	db, err := database.NewDatabase(config)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+
+	if err := db.Connect(cmd.Context()); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	// Generate statements for the target database dialect
+	dbType := database.NormalizeType(config.Type)
+	warnPKRanges(snap1, snap2)
+	result := diff.Compare(snap1, snap2, diffOpts)
+	statements := generator.GenerateStatements(result, generator.Options{Dialect: dbType})
+
+	applier := apply.NewApplier(db.DB(), dbType, os.Stdout)
+	var res *apply.Result
+	if checkpoints {
+		res, err = applier.ApplyWithCheckpoints(statements, checkpointSize)
+	} else {
+		res, err = applier.Apply(statements)
+	}
+	if res != nil {
+		fmt.Printf("-- %d statement(s) applied, %d already applied\n", res.Applied, res.Skipped)
+	}
+	if err != nil {
+		return fmt.Errorf("apply stopped, re-run to resume: %w", err)
+	}
+
+	return nil
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	snap, err := loadSnapshot(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	violations := lint.Check(snap, lintRules)
+	if len(violations) == 0 {
+		fmt.Println("No naming violations found.")
+		return nil
+	}
+
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	fmt.Printf("\n%d naming violation(s) found.\n", len(violations))
+
+	if lintStrict {
+		return fmt.Errorf("%d naming violation(s) found", len(violations))
+	}
+	return nil
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	snap1, err := loadSnapshot(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot1: %w", err)
+	}
+
+	snap2, err := loadSnapshot(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot2: %w", err)
+	}
+
+	if exportOpts.RowsPerFile < 0 {
+		return fmt.Errorf("--rows-per-file cannot be negative")
+	}
+
+	result := diff.Compare(snap1, snap2, diffOpts)
+	paths, err := export.WriteCSVFiles(exportDir, result, exportOpts)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		fmt.Printf("Wrote %s\n", path)
+	}
+	if len(result.DataDiffs) == 0 {
+		fmt.Println("No data differences found.")
+	}
+	return nil
+}
+
+func runRebase(cmd *cobra.Command, args []string) error {
+	mapping, err := loadKeyMapping(rebaseMaps, rebaseMapFile)
+	if err != nil {
+		return err
+	}
+	if len(mapping) == 0 {
+		return fmt.Errorf("no key mapping given, use --map or --map-file")
+	}
+
+	path := args[0]
+	if rebaseOutput != "" {
+		if err := copyFile(path, rebaseOutput); err != nil {
+			return err
+		}
+		path = rebaseOutput
+	}
+
+	result, err := snapshot.Rebase(path, rebaseTable, rebaseColumn, mapping)
+	if err != nil {
+		return fmt.Errorf("failed to rebase snapshot: %w", err)
+	}
+
+	names := make([]string, 0, len(result.Rewritten))
+	for name := range result.Rewritten {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %d value(s) rewritten\n", name, result.Rewritten[name])
+	}
+	if len(names) == 0 {
+		fmt.Printf("No values of %s.%s matched the mapping.\n", rebaseTable, result.Column)
+		return nil
+	}
+	fmt.Printf("Rebased snapshot written to %s\n", path)
+	return nil
+}
+
+// loadKeyMapping combines old=new pairs from the command line with the
+// old,new rows of a CSV file
+func loadKeyMapping(pairs []string, file string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range pairs {
+		oldVal, newVal, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --map %q, expected old=new", pair)
+		}
+		mapping[oldVal] = newVal
+	}
+
+	if file == "" {
+		return mapping, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open map file: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read map file: %w", err)
+		}
+		mapping[record[0]] = record[1]
+	}
+	return mapping, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy snapshot: %w", err)
+	}
+	return out.Close()
+}
+
+func runPing(cmd *cobra.Command, args []string) error {
+	config, err := database.LoadConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := database.NewDatabase(config)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+
+	fmt.Printf("Connecting to %s (%s:%s)...\n", config.Label(), config.Host, config.Port)
+	if err := db.Connect(cmd.Context()); err != nil {
+		if hint := database.Diagnose(err); hint != "" {
+			return fmt.Errorf("failed to connect to database: %w\nHint: %s", err, hint)
+		}
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	return ping(cmd.Context(), db, os.Stdout)
+}
+
+// ping prints the server version and the number of tables of a connected database
+func ping(ctx context.Context, db database.Database, w io.Writer) error {
+	var version string
+	if err := db.DB().QueryRowContext(ctx, "SELECT version()").Scan(&version); err != nil {
+		return fmt.Errorf("failed to query server version: %w", err)
+	}
+
+	tables, err := db.GetAllTables(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Server version: %s\n", version)
+	fmt.Fprintf(w, "Tables: %d\n", len(tables))
+	return nil
+}
+
+func runCheckFK(cmd *cobra.Command, args []string) error {
+	snap, err := loadSnapshot(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	violations, skipped := integrity.CheckForeignKeys(snap)
+	for _, s := range skipped {
+		fmt.Printf("Skipped: %s\n", s)
+	}
+
+	if len(violations) == 0 {
+		fmt.Println("No orphaned foreign key values found.")
+		return nil
+	}
+
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	return fmt.Errorf("%d orphaned foreign key value(s) found", len(violations))
+}
+
+// createTableSQL returns the renderer of table definitions for verbose diff
+// output in the given dialect
+func createTableSQL(dbType string) func(*schema.TableSchema) string {
+	ddlGen := generator.NewDDLGenerator(generator.Options{Dialect: dbType})
+	return func(tableSchema *schema.TableSchema) string {
+		return strings.Join(ddlGen.CreateTableStatements(tableSchema), "\n")
+	}
+}
+
+// dialects are the accepted values of --dialect
+var dialects = []string{"mysql", "postgres"}
+
+// resolveDialect returns the dialect of generated and displayed SQL: the
+// --dialect flag, or else the database type recorded in the first snapshot
+// that has one, or else mysql
+func resolveDialect(snaps ...*snapshot.Snapshot) (string, error) {
+	if dialect != "" {
+		if !slices.Contains(dialects, dialect) {
+			return "", fmt.Errorf("unsupported --dialect %q (expected %s)", dialect, strings.Join(dialects, ", "))
+		}
+		return dialect, nil
+	}
+	for _, snap := range snaps {
+		if dbType := database.NormalizeType(snap.Metadata["db_type"]); slices.Contains(dialects, dbType) {
+			return dbType, nil
+		}
+	}
+	return "mysql", nil
+}
+
+// checkDialect rejects a --dialect that contradicts the type of the
+// configured database, which commands connecting to it must use
+func checkDialect(config database.Config) error {
+	if dialect == "" {
+		return nil
+	}
+	if _, err := resolveDialect(); err != nil {
+		return err
+	}
+	if dbType := database.NormalizeType(config.Type); dialect != dbType {
+		return fmt.Errorf("--dialect %s does not match the configured database type %s", dialect, dbType)
+	}
+	return nil
+}
+
+// warnPKRanges prints a warning for each table whose rows the snapshots
+// captured with different primary key ranges
+func warnPKRanges(snap1, snap2 *snapshot.Snapshot) {
+	for _, w := range diff.PKRangeWarnings(snap1, snap2) {
+		fmt.Fprintln(os.Stderr, w)
+	}
+}
+
+// diffLabel returns the --label flag, or the labels recorded in the two snapshots
+func diffLabel(snap1, snap2 *snapshot.Snapshot) string {
+	if label != "" {
+		return label
+	}
+	l1, l2 := snap1.Label(), snap2.Label()
+	switch {
+	case l1 == "" && l2 == "":
+		return ""
+	case l1 == l2:
+		return l1
+	case l1 == "":
+		l1 = "(unlabeled)"
+	case l2 == "":
+		l2 = "(unlabeled)"
+	}
+	return fmt.Sprintf("%s -> %s", l1, l2)
+}
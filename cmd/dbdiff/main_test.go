@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"modernc.org/sqlite"
+
+	"github.com/koba/db-diff/internal/database"
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/generator"
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+	"github.com/koba/db-diff/internal/textenc"
+)
+
+func TestResolveDialect(t *testing.T) {
+	snap := func(dbType string) *snapshot.Snapshot {
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": dbType}, Tables: map[string]*schema.Table{}}
+	}
+	tests := []struct {
+		name    string
+		flag    string
+		snaps   []*snapshot.Snapshot
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: "mysql"},
+		{name: "snapshot metadata", snaps: []*snapshot.Snapshot{snap(""), snap("PostgreSQL")}, want: "postgres"},
+		{name: "flag wins over metadata", flag: "mysql", snaps: []*snapshot.Snapshot{snap("postgres")}, want: "mysql"},
+		{name: "unknown dialect", flag: "oracle", wantErr: true},
+		{name: "sqlserver is not implemented", flag: "sqlserver", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialect = tt.flag
+			defer func() { dialect = "" }()
+			got, err := resolveDialect(tt.snaps...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveDialect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveDialect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartMemoryGuard(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int
+		wantCancel bool
+	}{
+		{name: "under the limit", limit: 1 << 20},
+		{name: "over the limit", limit: 1, wantCancel: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxMemory = tt.limit
+			defer func() { maxMemory = 0 }()
+			ctx, stop := startMemoryGuard(context.Background(), "use --limit")
+			if tt.wantCancel {
+				<-ctx.Done()
+			} else {
+				time.Sleep(50 * time.Millisecond)
+			}
+			stop()
+			err := snapshotError(ctx, context.Canceled)
+			if got := errors.Is(err, errMemoryLimit); got != tt.wantCancel {
+				t.Errorf("snapshotError() = %v, want memory limit error %v", err, tt.wantCancel)
+			}
+		})
+	}
+}
+
+// dialectSnapshots returns two snapshots of a database of type dbType where
+// the second adds a column to users
+func TestApplyEnvDefaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		args       []string
+		wantLimit  int
+		wantDir    string
+		wantTables []string
+		wantErr    bool
+	}{
+		{name: "flag defaults", wantDir: "./snapshots"},
+		{name: "environment", env: map[string]string{"DBDIFF_LIMIT": "100", "DBDIFF_OUTPUT_DIR": "/tmp/snaps", "DBDIFF_TABLES": "users,orders"},
+			wantLimit: 100, wantDir: "/tmp/snaps", wantTables: []string{"users", "orders"}},
+		{name: "flags win", env: map[string]string{"DBDIFF_LIMIT": "100", "DBDIFF_OUTPUT_DIR": "/tmp/snaps", "DBDIFF_TABLES": "users,orders"},
+			args: []string{"--limit", "5", "--tables", "items"}, wantLimit: 5, wantDir: "/tmp/snaps", wantTables: []string{"items"}},
+		{name: "invalid environment", env: map[string]string{"DBDIFF_LIMIT": "many"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for env, value := range tt.env {
+				t.Setenv(env, value)
+			}
+			var limit int
+			var outputDir string
+			var tables []string
+			cmd := &cobra.Command{}
+			cmd.Flags().IntVar(&limit, "limit", 0, "")
+			cmd.Flags().StringVar(&outputDir, "output-dir", "./snapshots", "")
+			cmd.Flags().StringSliceVar(&tables, "tables", nil, "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyEnvDefaults(cmd, map[string]string{"limit": "DBDIFF_LIMIT", "output-dir": "DBDIFF_OUTPUT_DIR", "tables": "DBDIFF_TABLES"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyEnvDefaults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if limit != tt.wantLimit || outputDir != tt.wantDir || !reflect.DeepEqual(tables, tt.wantTables) {
+				t.Errorf("limit, output-dir, tables = %d, %q, %v, want %d, %q, %v", limit, outputDir, tables, tt.wantLimit, tt.wantDir, tt.wantTables)
+			}
+		})
+	}
+}
+
+func TestParseAutoIncrementMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    bool
+		wantErr bool
+	}{
+		{mode: "ignore"},
+		{mode: "include", want: true},
+		{mode: "always", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			autoIncrement = tt.mode
+			defer func() { autoIncrement, diffOpts.IncludeAutoIncrement = "ignore", false }()
+			err := parseAutoIncrementMode()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAutoIncrementMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diffOpts.IncludeAutoIncrement != tt.want {
+				t.Errorf("IncludeAutoIncrement = %v, want %v", diffOpts.IncludeAutoIncrement, tt.want)
+			}
+		})
+	}
+}
+
+func dialectSnapshots(dbType string) (*snapshot.Snapshot, *snapshot.Snapshot) {
+	snap := func(columns ...schema.Column) *snapshot.Snapshot {
+		users := &schema.Table{Schema: schema.TableSchema{Name: "users", Columns: columns}}
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": dbType}, Tables: map[string]*schema.Table{"users": users}}
+	}
+	id := schema.Column{Name: "id", Type: "int", Position: 1}
+	email := schema.Column{Name: "email", Type: "varchar(255)", Nullable: true, Position: 2}
+	return snap(id), snap(id, email)
+}
+
+func TestWriteMigrationDialect(t *testing.T) {
+	tests := []struct {
+		dbType string
+		want   string
+	}{
+		{"mysql", "ALTER TABLE `users` ADD COLUMN `email`"},
+		{"postgres", `ALTER TABLE "users" ADD COLUMN "email"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			terminator, boolFormat, outputEncoding = ";", generator.BoolKeyword, textenc.UTF8
+			splitOutput = t.TempDir()
+			defer func() { terminator, boolFormat, outputEncoding, splitOutput = "", "", "", "" }()
+
+			snap1, snap2 := dialectSnapshots(tt.dbType)
+			if err := writeMigration(context.Background(), snap1, snap2, diff.Compare(snap1, snap2, diff.Options{}), "a.db", "b.db"); err != nil {
+				t.Fatalf("writeMigration() error = %v", err)
+			}
+			ddl, err := os.ReadFile(filepath.Join(splitOutput, "01_ddl.sql"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(ddl), tt.want) {
+				t.Errorf("migration = %q, want it to contain %q", ddl, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteMigrationFromEmpty(t *testing.T) {
+	terminator, boolFormat, outputEncoding = ";", generator.BoolKeyword, textenc.UTF8
+	splitOutput = t.TempDir()
+	defer func() { terminator, boolFormat, outputEncoding, splitOutput = "", "", "", "" }()
+
+	id := schema.Column{Name: "id", Type: "integer", Position: 1}
+	email := schema.Column{Name: "email", Type: "text", Position: 2}
+	userID := schema.Column{Name: "user_id", Type: "integer", Position: 2}
+	users := &schema.Table{
+		Schema: schema.TableSchema{Name: "users", Columns: []schema.Column{id, email}, Indexes: []schema.Index{
+			{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+			{Name: "users_email_key", Columns: []string{"email"}, Unique: true, Comment: "one account per address"},
+		}},
+		Data: []schema.Row{{"id": 1, "email": "a@example.com"}, {"id": 2, "email": "b@example.com"}},
+	}
+	orders := &schema.Table{
+		Schema: schema.TableSchema{Name: "orders", Columns: []schema.Column{id, userID}, Indexes: []schema.Index{
+			{Name: "orders_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+			{Name: "orders_user_id_idx", Columns: []string{"user_id"}},
+		}, ForeignKeys: []schema.ForeignKey{
+			{Name: "orders_user_id_fkey", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+		}},
+		Data: []schema.Row{{"id": 10, "user_id": 1}},
+	}
+	snap := &snapshot.Snapshot{Metadata: map[string]string{"db_type": "postgres"}, Tables: map[string]*schema.Table{"users": users, "orders": orders}}
+	empty := &snapshot.Snapshot{Metadata: map[string]string{}, Tables: map[string]*schema.Table{}}
+
+	if err := writeMigration(context.Background(), empty, snap, diff.CompareFromEmpty(snap, diff.Options{}), "(empty)", "b.db"); err != nil {
+		t.Fatalf("writeMigration() error = %v", err)
+	}
+	ddl, err := os.ReadFile(filepath.Join(splitOutput, "01_ddl.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dml, err := os.ReadFile(filepath.Join(splitOutput, "02_dml.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`CREATE TABLE "users"`,
+		`CREATE TABLE "orders"`,
+		`CREATE UNIQUE INDEX "users_email_key" ON "users" ("email");`,
+		`CREATE INDEX "orders_user_id_idx" ON "orders" ("user_id");`,
+		`COMMENT ON INDEX "users_email_key" IS 'one account per address';`,
+	} {
+		if !strings.Contains(string(ddl), want) {
+			t.Errorf("DDL = %q, want it to contain %q", ddl, want)
+		}
+	}
+	if strings.Index(string(ddl), `CREATE TABLE "users"`) > strings.Index(string(ddl), `CREATE TABLE "orders"`) {
+		t.Errorf("DDL = %q, want users created before orders", ddl)
+	}
+	if got := strings.Count(string(dml), "INSERT INTO"); got != 3 {
+		t.Errorf("DML has %d INSERTs, want 3: %q", got, dml)
+	}
+}
+
+func TestDiffLabel(t *testing.T) {
+	snap := func(label string) *snapshot.Snapshot {
+		metadata := map[string]string{}
+		if label != "" {
+			metadata["label"] = label
+		}
+		return &snapshot.Snapshot{Metadata: metadata}
+	}
+	tests := []struct {
+		name     string
+		flag     string
+		old, new string
+		want     string
+	}{
+		{name: "unlabeled"},
+		{name: "same label", old: "app@prod", new: "app@prod", want: "app@prod"},
+		{name: "different labels", old: "app@prod", new: "app@staging", want: "app@prod -> app@staging"},
+		{name: "one unlabeled", old: "", new: "app@staging", want: "(unlabeled) -> app@staging"},
+		{name: "flag wins", flag: "nightly", old: "app@prod", new: "app@staging", want: "nightly"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label = tt.flag
+			defer func() { label = "" }()
+			if got := diffLabel(snap(tt.old), snap(tt.new)); got != tt.want {
+				t.Errorf("diffLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteMigrationLabel(t *testing.T) {
+	terminator, boolFormat, outputEncoding = ";", generator.BoolKeyword, textenc.UTF8
+	splitOutput = t.TempDir()
+	defer func() { terminator, boolFormat, outputEncoding, splitOutput = "", "", "", "" }()
+
+	snap1, snap2 := dialectSnapshots("mysql")
+	snap1.Metadata["label"], snap2.Metadata["label"] = "app@prod", "app@staging"
+	if err := writeMigration(context.Background(), snap1, snap2, diff.Compare(snap1, snap2, diff.Options{}), "a.db", "b.db"); err != nil {
+		t.Fatalf("writeMigration() error = %v", err)
+	}
+	ddl, err := os.ReadFile(filepath.Join(splitOutput, "01_ddl.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-- Label: app@prod -> app@staging\n"; !strings.Contains(string(ddl), want) {
+		t.Errorf("migration = %q, want it to contain %q", ddl, want)
+	}
+}
+
+func TestWriteMigrationRejectsGroupByTableWithSplitOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		groupByTable bool
+		wantErr      bool
+	}{
+		{name: "split output", wantErr: false},
+		{name: "split output grouped by table", groupByTable: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terminator, boolFormat, outputEncoding = ";", generator.BoolKeyword, textenc.UTF8
+			splitOutput, groupByTable = t.TempDir(), tt.groupByTable
+			defer func() { terminator, boolFormat, outputEncoding, splitOutput, groupByTable = "", "", "", "", false }()
+
+			snap1, snap2 := dialectSnapshots("mysql")
+			err := writeMigration(context.Background(), snap1, snap2, diff.Compare(snap1, snap2, diff.Options{}), "a.db", "b.db")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("writeMigration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteTableDiffDialect(t *testing.T) {
+	tests := []struct {
+		dbType string
+		want   string
+	}{
+		{"mysql", "ALTER TABLE `users` ADD COLUMN `email`"},
+		{"postgres", `ALTER TABLE "users" ADD COLUMN "email"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			tableSQL = true
+			defer func() { tableSQL = false }()
+
+			snap1, snap2 := dialectSnapshots(tt.dbType)
+			var out bytes.Buffer
+			if err := writeTableDiff(snap1, snap2, "users", &out); err != nil {
+				t.Fatalf("writeTableDiff() error = %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("table diff = %q, want it to contain %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateTableSQLDialect(t *testing.T) {
+	tests := []struct {
+		dbType string
+		want   string
+	}{
+		{"mysql", "CREATE TABLE `users`"},
+		{"postgres", `CREATE TABLE "users"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			_, snap := dialectSnapshots(tt.dbType)
+			dbType, err := resolveDialect(snap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := createTableSQL(dbType)(&snap.Tables["users"].Schema); !strings.Contains(got, tt.want) {
+				t.Errorf("createTableSQL() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// liveDatabase serves a users table holding the given names from memory,
+// and queries from db
+type liveDatabase struct {
+	names []string
+	db    *sql.DB
+}
+
+func (l *liveDatabase) Connect(ctx context.Context) error { return nil }
+func (l *liveDatabase) Close() error                      { return nil }
+func (l *liveDatabase) DB() *sql.DB                       { return l.db }
+func (l *liveDatabase) Dialect() string                   { return "mysql" }
+
+func (l *liveDatabase) GetAllTables(ctx context.Context) ([]string, error) {
+	return []string{"users"}, nil
+}
+
+func (l *liveDatabase) GetAllTablesInCreationOrder(ctx context.Context) ([]string, error) {
+	return []string{"users"}, nil
+}
+
+func (l *liveDatabase) GetTableSchema(ctx context.Context, tableName string) (*schema.TableSchema, error) {
+	return &schema.TableSchema{
+		Name:    tableName,
+		Columns: []schema.Column{{Name: "id", Type: "int", Position: 1}, {Name: "name", Type: "varchar(50)", Position: 2}},
+		Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true}},
+	}, nil
+}
+
+func (l *liveDatabase) GetTableSchemas(ctx context.Context, tableNames []string) (map[string]*schema.TableSchema, error) {
+	schemas := make(map[string]*schema.TableSchema)
+	for _, name := range tableNames {
+		schemas[name], _ = l.GetTableSchema(ctx, name)
+	}
+	return schemas, nil
+}
+
+func (l *liveDatabase) GetTableData(ctx context.Context, tableName string, opts database.DataOptions) ([]schema.Row, error) {
+	var rows []schema.Row
+	err := l.StreamTableData(ctx, tableName, opts, func(row schema.Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+func (l *liveDatabase) StreamTableData(ctx context.Context, tableName string, opts database.DataOptions, fn func(schema.Row) error) error {
+	for i, name := range l.names {
+		if err := fn(schema.Row{"id": int64(i + 1), "name": name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *liveDatabase) CountRows(ctx context.Context, tableName string, where string) (int64, error) {
+	return int64(len(l.names)), nil
+}
+
+func TestMonitor(t *testing.T) {
+	tests := []struct {
+		name      string
+		live      []string
+		keep      bool
+		wantErr   bool
+		wantFiles int
+	}{
+		{name: "no drift", live: []string{"alice"}, wantFiles: 1},
+		{name: "drift", live: []string{"alice", "bob"}, wantErr: true, wantFiles: 1},
+		{name: "drift kept", live: []string{"alice", "bob"}, keep: true, wantErr: true, wantFiles: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir, snapshotDrift = t.TempDir(), tt.keep
+			defer func() { outputDir, snapshotDrift = "", false }()
+
+			storedPath := filepath.Join(outputDir, "app-2024-01-01-00-00-00.db")
+			if err := snapshot.CreateSnapshot(context.Background(), &liveDatabase{names: []string{"alice"}}, storedPath, snapshot.Options{}); err != nil {
+				t.Fatal(err)
+			}
+			stored, err := loadSnapshot(storedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts, err := stored.RecaptureOptions("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.Overwrite, opts.Label = true, "live"
+
+			err = monitor(context.Background(), &liveDatabase{names: tt.live}, storedPath, stored, opts, "app")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("monitor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// The live snapshot is removed unless it is kept
+			entries, err := os.ReadDir(outputDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.wantFiles {
+				t.Errorf("%d files in output dir, want %d", len(entries), tt.wantFiles)
+			}
+			for _, entry := range entries {
+				keptPath := filepath.Join(outputDir, entry.Name())
+				if keptPath == storedPath {
+					continue
+				}
+				kept, err := loadSnapshot(keptPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rows := len(kept.Tables["users"].Data); rows != 2 {
+					t.Errorf("kept snapshot %s has %d rows, want 2", keptPath, rows)
+				}
+			}
+		})
+	}
+}
+
+// SQLite stands in for a server in TestPing, answering version() like MySQL does
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("version", 0, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return "8.0.36", nil
+	})
+}
+
+func TestPing(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "ping.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var out bytes.Buffer
+	if err := ping(context.Background(), &liveDatabase{db: db}, &out); err != nil {
+		t.Fatalf("ping() error = %v", err)
+	}
+	if want := "Server version: 8.0.36\nTables: 1\n"; out.String() != want {
+		t.Errorf("ping() printed %q, want %q", out.String(), want)
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/go-sql-driver/mysql v1.8.1
 	github.com/lib/pq v1.10.9
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/text v0.21.0
 	modernc.org/sqlite v1.33.1
 )
 
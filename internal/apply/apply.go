@@ -0,0 +1,337 @@
+package apply
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TrackingTable is the table of the target database in which applied
+// statements are recorded. Snapshots leave it out.
+const TrackingTable = "dbdiff_migrations"
+
+const (
+	statusApplied = "applied"
+	statusFailed  = "failed"
+)
+
+// Result summarizes an apply run
+type Result struct {
+	Applied int
+	Skipped int
+
+	// FailedCheckpoint is the checkpoint rolled back by ApplyWithCheckpoints
+	// (0: none)
+	FailedCheckpoint int
+}
+
+// Applier executes migration statements against a target database and
+// records each one in a tracking table so a failed run can be resumed
+type Applier struct {
+	db      *sql.DB
+	dialect string
+	out     io.Writer
+}
+
+// NewApplier creates a new applier for the given dialect ("mysql" or "postgres")
+func NewApplier(db *sql.DB, dialect string, out io.Writer) *Applier {
+	return &Applier{db: db, dialect: dialect, out: out}
+}
+
+// Apply executes the statements in order, skipping those already recorded
+// as applied by a previous run. It stops at the first failing statement.
+func (a *Applier) Apply(statements []string) (*Result, error) {
+	if err := a.ensureTrackingTable(); err != nil {
+		return nil, err
+	}
+
+	applied, err := a.appliedHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for i, stmt := range StatementIDs(statements) {
+		if applied[stmt.Hash] {
+			result.Skipped++
+			continue
+		}
+
+		if err := a.applyStatement(stmt); err != nil {
+			if recordErr := a.record(a.db, stmt, statusFailed); recordErr != nil {
+				fmt.Fprintf(a.out, "-- failed to record failure: %v\n", recordErr)
+			}
+			return result, fmt.Errorf("statement %d failed: %w\n%s", i+1, err, stmt.SQL)
+		}
+		fmt.Fprintf(a.out, "-- applied: %s\n", firstLine(stmt.SQL))
+		result.Applied++
+	}
+
+	return result, nil
+}
+
+// ApplyWithCheckpoints executes the statements not yet applied in one
+// transaction, with a savepoint before every size statements. When a
+// statement fails, only its checkpoint is rolled back: the checkpoints
+// before it are committed and the error names the failed checkpoint.
+//
+// Savepoints cover DDL only where DDL is transactional (PostgreSQL); MySQL
+// commits each DDL statement implicitly, which releases the savepoints.
+func (a *Applier) ApplyWithCheckpoints(statements []string, size int) (*Result, error) {
+	if size < 1 {
+		size = 1
+	}
+	if err := a.ensureTrackingTable(); err != nil {
+		return nil, err
+	}
+
+	applied, err := a.appliedHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	// Statement numbers refer to the full list, as in Apply
+	type numbered struct {
+		Statement
+		n int
+	}
+	result := &Result{}
+	var pending []numbered
+	for i, stmt := range StatementIDs(statements) {
+		if applied[stmt.Hash] {
+			result.Skipped++
+			continue
+		}
+		pending = append(pending, numbered{stmt, i + 1})
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return result, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(pending); start += size {
+		end := min(start+size, len(pending))
+		checkpoint := start/size + 1
+		savepoint := fmt.Sprintf("dbdiff_checkpoint_%d", checkpoint)
+		if _, err := tx.Exec("SAVEPOINT " + savepoint); err != nil {
+			return result, fmt.Errorf("failed to create checkpoint %d: %w", checkpoint, err)
+		}
+
+		for _, stmt := range pending[start:end] {
+			err := a.execRecorded(tx, stmt.Statement)
+			if err == nil {
+				continue
+			}
+
+			result.FailedCheckpoint = checkpoint
+			if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT " + savepoint); rbErr != nil {
+				return result, fmt.Errorf("statement %d failed and checkpoint %d could not be rolled back (%v): %w\n%s",
+					stmt.n, checkpoint, rbErr, err, stmt.SQL)
+			}
+			if commitErr := tx.Commit(); commitErr != nil {
+				return result, fmt.Errorf("failed to commit the checkpoints before %d: %w", checkpoint, commitErr)
+			}
+			result.Applied = start
+			if recordErr := a.record(a.db, stmt.Statement, statusFailed); recordErr != nil {
+				fmt.Fprintf(a.out, "-- failed to record failure: %v\n", recordErr)
+			}
+			return result, fmt.Errorf("statement %d failed, checkpoint %d (statements %d-%d) rolled back: %w\n%s",
+				stmt.n, checkpoint, pending[start].n, pending[end-1].n, err, stmt.SQL)
+		}
+
+		if _, err := tx.Exec("RELEASE SAVEPOINT " + savepoint); err != nil {
+			return result, fmt.Errorf("failed to release checkpoint %d: %w", checkpoint, err)
+		}
+		for _, stmt := range pending[start:end] {
+			fmt.Fprintf(a.out, "-- applied: %s\n", firstLine(stmt.SQL))
+		}
+		fmt.Fprintf(a.out, "-- checkpoint %d reached\n", checkpoint)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to commit: %w", err)
+	}
+	result.Applied = len(pending)
+	return result, nil
+}
+
+// Statement is a migration statement with its stable identity
+type Statement struct {
+	Hash string
+	SQL  string
+}
+
+// StatementIDs computes a stable identity for each statement. Identical
+// statements are told apart by the number of times they occurred before.
+func StatementIDs(statements []string) []Statement {
+	seen := make(map[string]int)
+	ids := make([]Statement, 0, len(statements))
+	for _, sqlText := range statements {
+		occurrence := seen[sqlText]
+		seen[sqlText]++
+
+		h := sha256.New()
+		h.Write([]byte(sqlText))
+		if occurrence > 0 {
+			fmt.Fprintf(h, "\x00%d", occurrence)
+		}
+		ids = append(ids, Statement{Hash: hex.EncodeToString(h.Sum(nil)), SQL: sqlText})
+	}
+	return ids
+}
+
+// applyStatement runs a statement and its tracking record in one transaction.
+// MySQL commits DDL implicitly, so there the record follows the statement
+// rather than being atomic with it.
+func (a *Applier) applyStatement(stmt Statement) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := a.execRecorded(tx, stmt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// execRecorded runs a statement and records it as applied. The MySQL
+// driver runs one statement per Exec unless multiStatements is set, so a
+// generated statement made of several, such as a guarded column change, is
+// run part by part in the same transaction and session.
+func (a *Applier) execRecorded(tx *sql.Tx, stmt Statement) error {
+	parts := []string{stmt.SQL}
+	if a.dialect == "mysql" {
+		parts = splitStatements(stmt.SQL)
+	}
+	for _, part := range parts {
+		if _, err := tx.Exec(part); err != nil {
+			return err
+		}
+	}
+	return a.record(tx, stmt, statusApplied)
+}
+
+// splitStatements splits MySQL script text at the semicolons that end its
+// statements, ignoring those inside quotes and comments. Parts with only
+// comments are dropped, which MySQL would reject as an empty query.
+func splitStatements(script string) []string {
+	var statements []string
+	start := 0
+	code := false
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			code = true
+		case c == '-' && strings.HasPrefix(script[i:], "-- "), c == '#':
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(script)
+			}
+		case c == ';':
+			if code {
+				statements = append(statements, strings.TrimSpace(script[start:i]))
+			}
+			start = i + 1
+			code = false
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			code = true
+		}
+	}
+	if code {
+		statements = append(statements, strings.TrimSpace(script[start:]))
+	}
+	return statements
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (a *Applier) record(db execer, stmt Statement, status string) error {
+	_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE statement_hash = %s", TrackingTable, a.placeholder(1)), stmt.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to update tracking table: %w", err)
+	}
+
+	_, err = db.Exec(
+		fmt.Sprintf("INSERT INTO %s (statement_hash, statement, status) VALUES (%s, %s, %s)",
+			TrackingTable, a.placeholder(1), a.placeholder(2), a.placeholder(3)),
+		stmt.Hash, stmt.SQL, status,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update tracking table: %w", err)
+	}
+	return nil
+}
+
+func (a *Applier) ensureTrackingTable() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS %s (
+			statement_hash VARCHAR(64) PRIMARY KEY,
+			statement TEXT NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+	if _, err := a.db.Exec(fmt.Sprintf(query, TrackingTable)); err != nil {
+		return fmt.Errorf("failed to create tracking table: %w", err)
+	}
+	return nil
+}
+
+func (a *Applier) appliedHashes() (map[string]bool, error) {
+	rows, err := a.db.Query(fmt.Sprintf("SELECT statement_hash FROM %s WHERE status = %s", TrackingTable, a.placeholder(1)), statusApplied)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tracking table: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to scan tracking row: %w", err)
+		}
+		applied[hash] = true
+	}
+
+	return applied, rows.Err()
+}
+
+func (a *Applier) placeholder(n int) string {
+	if a.dialect == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+	return s
+}
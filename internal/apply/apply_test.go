@@ -0,0 +1,166 @@
+package apply
+
+import (
+	"database/sql"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// openLogDB opens a SQLite database standing in for the target, with a log
+// table the test statements insert their numbers into
+func openLogDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "target.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("CREATE TABLE log (n INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// logged returns the numbers in the log table, in order
+func logged(t *testing.T, db *sql.DB) []int {
+	t.Helper()
+	rows, err := db.Query("SELECT n FROM log ORDER BY n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var numbers []int
+	for rows.Next() {
+		var n int
+		if err := rows.Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{name: "single", script: "DROP TABLE t;", want: []string{"DROP TABLE t"}},
+		{name: "no terminator", script: "DROP TABLE t", want: []string{"DROP TABLE t"}},
+		{
+			name:   "column guard",
+			script: "SET @dbdiff_ddl = IF(1 = 0, 'ALTER TABLE `t` ADD COLUMN `c` int;', 'DO 0');\nPREPARE dbdiff_stmt FROM @dbdiff_ddl;\nEXECUTE dbdiff_stmt;\nDEALLOCATE PREPARE dbdiff_stmt;",
+			want: []string{
+				"SET @dbdiff_ddl = IF(1 = 0, 'ALTER TABLE `t` ADD COLUMN `c` int;', 'DO 0')",
+				"PREPARE dbdiff_stmt FROM @dbdiff_ddl",
+				"EXECUTE dbdiff_stmt",
+				"DEALLOCATE PREPARE dbdiff_stmt",
+			},
+		},
+		{name: "escaped quote", script: `INSERT INTO t VALUES ('a\';b');`, want: []string{`INSERT INTO t VALUES ('a\';b')`}},
+		{name: "doubled quote", script: "INSERT INTO t VALUES ('a'';b');", want: []string{"INSERT INTO t VALUES ('a'';b')"}},
+		{name: "quoted identifier", script: "DROP TABLE `a;b`;", want: []string{"DROP TABLE `a;b`"}},
+		{name: "comments", script: "-- a; b\nDROP TABLE t; /* c; d */", want: []string{"-- a; b\nDROP TABLE t"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyResume(t *testing.T) {
+	db := openLogDB(t)
+	// Statement 3 fails until the gate table exists. Running a statement
+	// twice would fail on the log's primary key.
+	statements := []string{
+		"INSERT INTO log VALUES (1)",
+		"INSERT INTO log VALUES (2)",
+		"INSERT INTO log SELECT 3 FROM gate",
+		"INSERT INTO log VALUES (4)",
+		"INSERT INTO log VALUES (5)",
+	}
+	a := NewApplier(db, "mysql", io.Discard)
+
+	result, err := a.Apply(statements)
+	if err == nil {
+		t.Fatal("Apply() error = nil, want statement 3 to fail")
+	}
+	if result.Applied != 2 {
+		t.Errorf("Applied = %d, want 2", result.Applied)
+	}
+	if got := logged(t, db); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("log = %v, want [1 2]", got)
+	}
+
+	if _, err := db.Exec("CREATE TABLE gate (x INTEGER); INSERT INTO gate VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	result, err = a.Apply(statements)
+	if err != nil {
+		t.Fatalf("resumed Apply() error = %v", err)
+	}
+	if result.Skipped != 2 || result.Applied != 3 {
+		t.Errorf("resumed Result = %+v, want 2 skipped and 3 applied", result)
+	}
+	if got := logged(t, db); !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("log = %v, want [1 2 3 4 5]", got)
+	}
+}
+
+func TestApplyWithCheckpoints(t *testing.T) {
+	db := openLogDB(t)
+	// Statement 4 fails until the gate table exists, in the second
+	// checkpoint of two statements
+	statements := []string{
+		"INSERT INTO log VALUES (1)",
+		"INSERT INTO log VALUES (2)",
+		"INSERT INTO log VALUES (3)",
+		"INSERT INTO log SELECT 4 FROM gate",
+		"INSERT INTO log VALUES (5)",
+	}
+	a := NewApplier(db, "mysql", io.Discard)
+
+	result, err := a.ApplyWithCheckpoints(statements, 2)
+	if err == nil {
+		t.Fatal("ApplyWithCheckpoints() error = nil, want statement 4 to fail")
+	}
+	if result.FailedCheckpoint != 2 || result.Applied != 2 {
+		t.Errorf("Result = %+v, want checkpoint 2 failed with 2 applied", result)
+	}
+	// Statement 3 is rolled back with its checkpoint; the first is kept
+	if got := logged(t, db); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("log = %v, want [1 2]", got)
+	}
+	applied, err := a.appliedHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := StatementIDs(statements)
+	for i, stmt := range ids {
+		if want := i < 2; applied[stmt.Hash] != want {
+			t.Errorf("statement %d recorded as applied = %v, want %v", i+1, applied[stmt.Hash], want)
+		}
+	}
+
+	if _, err := db.Exec("CREATE TABLE gate (x INTEGER); INSERT INTO gate VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	result, err = a.ApplyWithCheckpoints(statements, 2)
+	if err != nil {
+		t.Fatalf("resumed ApplyWithCheckpoints() error = %v", err)
+	}
+	if result.Skipped != 2 || result.Applied != 3 || result.FailedCheckpoint != 0 {
+		t.Errorf("resumed Result = %+v, want 2 skipped and 3 applied", result)
+	}
+	if got := logged(t, db); !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("log = %v, want [1 2 3 4 5]", got)
+	}
+}
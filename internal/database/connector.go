@@ -1,8 +1,11 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/koba/db-diff/internal/schema"
 )
@@ -15,15 +18,104 @@ type Config struct {
 	Database string
 	User     string
 	Password string
+	// IncludeSystemTables adds the tables of the system schemas (PostgreSQL
+	// pg_catalog and information_schema, MySQL mysql and sys) that can be
+	// read, named "schema.table", without their credential columns
+	IncludeSystemTables bool
+	// ReadOnly makes every session read-only, so that any write fails in
+	// the database
+	ReadOnly bool
+	// DSN is the connection string from DB_DSN or DB_URL, in the driver's
+	// format with the query parameters the user gave. Connect uses it
+	// instead of building one from the fields above.
+	DSN string
+	// SSLMode is a PostgreSQL sslmode (disable, require, verify-ca or
+	// verify-full), mapped to the MySQL driver's tls parameter for MySQL,
+	// which also accepts allow and prefer. Unset means disable.
+	SSLMode string
+	// SSLRootCert is a CA certificate file to verify the server with
+	SSLRootCert string
+}
+
+// PKRange restricts table data to rows whose primary key falls between From and To (inclusive)
+type PKRange struct {
+	Column string
+	From   interface{}
+	To     interface{}
+}
+
+// OrderBy sorts table data by a column
+type OrderBy struct {
+	Column     string
+	Descending bool
+}
+
+// DataOptions controls which rows GetTableData and StreamTableData return
+type DataOptions struct {
+	Limit   int
+	Range   *PKRange
+	OrderBy *OrderBy
+	// Where is an SQL predicate rows must satisfy, inserted into the query as is
+	Where string
 }
 
 // Database interface defines operations for database connections
 type Database interface {
-	Connect() error
+	Connect(ctx context.Context) error
 	Close() error
-	GetAllTables() ([]string, error)
-	GetTableSchema(tableName string) (*schema.TableSchema, error)
-	GetTableData(tableName string, limit int) ([]schema.Row, error)
+	DB() *sql.DB
+	// Dialect returns the canonical database type, "mysql" or "postgres"
+	Dialect() string
+	GetAllTables(ctx context.Context) ([]string, error)
+	GetAllTablesInCreationOrder(ctx context.Context) ([]string, error)
+	GetTableSchema(ctx context.Context, tableName string) (*schema.TableSchema, error)
+	GetTableSchemas(ctx context.Context, tableNames []string) (map[string]*schema.TableSchema, error)
+	GetTableData(ctx context.Context, tableName string, opts DataOptions) ([]schema.Row, error)
+	// StreamTableData passes the rows GetTableData would return to fn one
+	// at a time, without holding them all in memory
+	StreamTableData(ctx context.Context, tableName string, opts DataOptions, fn func(schema.Row) error) error
+	// CountRows counts the rows of a table matching the SQL predicate where
+	// (empty: all rows)
+	CountRows(ctx context.Context, tableName string, where string) (int64, error)
+}
+
+// MaterializedViewReader is implemented by databases that have materialized
+// views (PostgreSQL)
+type MaterializedViewReader interface {
+	GetMaterializedViews(ctx context.Context) ([]*schema.MaterializedView, error)
+}
+
+// checkReadOnly confirms that a session is read-only by running a query
+// returning the read-only setting ("1" or "on")
+func checkReadOnly(ctx context.Context, db *sql.DB, query string) error {
+	var value string
+	if err := db.QueryRowContext(ctx, query).Scan(&value); err != nil {
+		return fmt.Errorf("failed to check read-only session: %w", err)
+	}
+	if value != "1" && value != "on" {
+		return fmt.Errorf("session is not read-only (%s)", value)
+	}
+	return nil
+}
+
+// queryTableNames runs a query returning one table name per row
+func queryTableNames(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			return nil, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		tables = append(tables, tableName)
+	}
+
+	return tables, rows.Err()
 }
 
 // NewDatabase creates a new database connection based on type
@@ -38,9 +130,34 @@ func NewDatabase(config Config) (Database, error) {
 	}
 }
 
-// LoadConfigFromEnv loads database configuration from environment variables
+// NormalizeType returns the canonical dialect name ("mysql" or "postgres")
+// for a configured database type, or the input unchanged if it is unknown
+func NormalizeType(dbType string) string {
+	switch dbType {
+	case "mysql", "MySQL":
+		return "mysql"
+	case "postgres", "Postgres", "PostgreSQL":
+		return "postgres"
+	default:
+		return dbType
+	}
+}
+
+// Label returns a short name identifying the configured database, e.g. "mydb@db.example.com"
+func (c Config) Label() string {
+	return fmt.Sprintf("%s@%s", c.Database, c.Host)
+}
+
+// LoadConfigFromEnv loads database configuration from environment variables.
+// A connection URL in DB_DSN (or DB_URL) takes precedence over DB_HOST,
+// DB_PORT, DB_NAME, DB_USER and DB_PASSWORD, which are then ignored.
 func LoadConfigFromEnv() (Config, error) {
 	dbType := os.Getenv("DB_TYPE")
+	for _, env := range []string{"DB_DSN", "DB_URL"} {
+		if dsn := os.Getenv(env); dsn != "" {
+			return configFromDSN(env, dsn, dbType)
+		}
+	}
 	if dbType == "" {
 		return Config{}, fmt.Errorf("DB_TYPE environment variable is required")
 	}
@@ -58,13 +175,14 @@ func LoadConfigFromEnv() (Config, error) {
 	user := os.Getenv("DB_USER")
 	password := os.Getenv("DB_PASSWORD")
 
+	sslMode := os.Getenv("DB_SSLMODE")
+	if err := checkSSLMode(dbType, sslMode); err != nil {
+		return Config{}, err
+	}
+
 	port := os.Getenv("DB_PORT")
 	if port == "" {
-		if dbType == "mysql" || dbType == "MySQL" {
-			port = "3306"
-		} else if dbType == "postgres" || dbType == "Postgres" || dbType == "PostgreSQL" {
-			port = "5432"
-		}
+		port = defaultPort(dbType)
 	}
 
 	return Config{
@@ -74,5 +192,207 @@ func LoadConfigFromEnv() (Config, error) {
 		Database: database,
 		User:     user,
 		Password: password,
+
+		SSLMode:     sslMode,
+		SSLRootCert: os.Getenv("DB_SSLROOTCERT"),
 	}, nil
 }
+
+// splitSystemTable splits a "schema.table" name whose schema is one of
+// systemSchemas
+func splitSystemTable(tableName string, systemSchemas []string) (string, string, bool) {
+	schemaName, name, ok := strings.Cut(tableName, ".")
+	if !ok {
+		return "", "", false
+	}
+	for _, s := range systemSchemas {
+		if s == schemaName {
+			return schemaName, name, true
+		}
+	}
+	return "", "", false
+}
+
+// groupTablesBySchema groups table names by system schema, with unqualified
+// names under ""
+func groupTablesBySchema(tableNames []string, systemSchemas []string) map[string][]string {
+	groups := make(map[string][]string)
+	for _, tableName := range tableNames {
+		if schemaName, name, ok := splitSystemTable(tableName, systemSchemas); ok {
+			groups[schemaName] = append(groups[schemaName], name)
+			continue
+		}
+		groups[""] = append(groups[""], tableName)
+	}
+	return groups
+}
+
+// mergeSystemSchemas adds schemas read from a system schema to all, named
+// "schema.table", without their credential columns
+func mergeSystemSchemas(all map[string]*schema.TableSchema, schemaName string, schemas map[string]*schema.TableSchema) {
+	for name, ts := range schemas {
+		ts.Name = schemaName + "." + name
+		if len(credentialColumns[ts.Name]) > 0 {
+			columns := ts.Columns[:0]
+			for _, col := range ts.Columns {
+				if !isCredentialColumn(ts.Name, col.Name) {
+					columns = append(columns, col)
+				}
+			}
+			ts.Columns = columns
+		}
+		all[ts.Name] = ts
+	}
+}
+
+// credentialColumns are the columns of system tables holding password
+// hashes or other credentials, by "schema.table". They are left out of
+// snapshots.
+var credentialColumns = map[string][]string{
+	"pg_catalog.pg_authid":       {"rolpassword"},
+	"pg_catalog.pg_user_mapping": {"umoptions"},
+	"mysql.user":                 {"authentication_string", "Password"},
+	"mysql.global_priv":          {"Priv"},
+	"mysql.password_history":     {"Password"},
+	"mysql.servers":              {"Password"},
+	"mysql.slave_master_info":    {"User_password"},
+}
+
+// isCredentialColumn reports whether a column of a system table holds
+// credentials. MySQL column names are compared without regard to case.
+func isCredentialColumn(tableName, column string) bool {
+	for _, name := range credentialColumns[tableName] {
+		if strings.EqualFold(name, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// omitCredentials removes the credential columns from a row of a system
+// table
+func omitCredentials(tableName string, row schema.Row) {
+	if len(credentialColumns[tableName]) == 0 {
+		return
+	}
+	for column := range row {
+		if isCredentialColumn(tableName, column) {
+			delete(row, column)
+		}
+	}
+}
+
+// readableTables returns the system tables a query can read, warning about
+// the others, such as PostgreSQL's pg_authid and pg_statistic, which need
+// superuser rights
+func readableTables(ctx context.Context, db *sql.DB, tables []string, tableRef func(string) string) ([]string, error) {
+	var readable []string
+	for _, tableName := range tables {
+		rows, err := db.QueryContext(ctx, "SELECT * FROM "+tableRef(tableName)+" WHERE 1 = 0")
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			fmt.Fprintf(os.Stderr, "Warning: skipping system table %s: %v\n", tableName, err)
+			continue
+		}
+		rows.Close()
+		readable = append(readable, tableName)
+	}
+	return readable, nil
+}
+
+// newTableSchemas returns an empty schema for each table, to be filled in by
+// batched introspection queries
+func newTableSchemas(tableNames []string) map[string]*schema.TableSchema {
+	schemas := make(map[string]*schema.TableSchema, len(tableNames))
+	for _, name := range tableNames {
+		schemas[name] = &schema.TableSchema{
+			Name:        name,
+			Columns:     []schema.Column{},
+			Indexes:     []schema.Index{},
+			ForeignKeys: []schema.ForeignKey{},
+		}
+	}
+	return schemas
+}
+
+// indexCollector assembles indexes from introspection rows that list one
+// index column per row, ordered by position within the index
+type indexCollector struct {
+	tables     map[string][]string // index names per table, in first-seen order
+	indexes    map[[2]string]*schema.Index
+	descending map[[2]string][]bool
+}
+
+func newIndexCollector() *indexCollector {
+	return &indexCollector{
+		tables:     make(map[string][]string),
+		indexes:    make(map[[2]string]*schema.Index),
+		descending: make(map[[2]string][]bool),
+	}
+}
+
+// add records one column of an index; idx supplies the index attributes the
+// first time the index is seen
+func (c *indexCollector) add(tableName string, idx schema.Index, column string, descending bool) {
+	key := [2]string{tableName, idx.Name}
+	c.descending[key] = append(c.descending[key], descending)
+	if existing, ok := c.indexes[key]; ok {
+		existing.Columns = append(existing.Columns, column)
+		return
+	}
+	idx.Columns = []string{column}
+	c.indexes[key] = &idx
+	c.tables[tableName] = append(c.tables[tableName], idx.Name)
+}
+
+// store adds the collected indexes to their tables' schemas
+func (c *indexCollector) store(schemas map[string]*schema.TableSchema) {
+	for tableName, names := range c.tables {
+		ts, ok := schemas[tableName]
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			key := [2]string{tableName, name}
+			idx := c.indexes[key]
+			setDescending(idx, c.descending[key])
+			ts.Indexes = append(ts.Indexes, *idx)
+		}
+	}
+}
+
+// setDescending records per-column index directions, leaving Descending
+// empty when every column is ascending
+func setDescending(idx *schema.Index, descending []bool) {
+	for _, desc := range descending {
+		if desc {
+			idx.Descending = descending
+			return
+		}
+	}
+}
+
+// unwrapParens strips the parentheses enclosing a whole CHECK expression, so
+// "((age > 0))" and "age > 0" compare equal across servers
+func unwrapParens(expr string) string {
+	expr = strings.TrimSpace(expr)
+	for len(expr) >= 2 && expr[0] == '(' && expr[len(expr)-1] == ')' {
+		depth := 0
+		for i := 0; i < len(expr)-1; i++ {
+			switch expr[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 {
+				// the opening parenthesis closes before the end
+				return expr
+			}
+		}
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+	return expr
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestOmitCredentials(t *testing.T) {
+	tests := []struct {
+		name      string
+		tableName string
+		row       schema.Row
+		want      schema.Row
+	}{
+		{
+			name:      "mysql.user",
+			tableName: "mysql.user",
+			row:       schema.Row{"Host": "%", "User": "app", "authentication_string": "*ABC"},
+			want:      schema.Row{"Host": "%", "User": "app"},
+		},
+		{
+			name:      "case of MySQL column names",
+			tableName: "mysql.servers",
+			row:       schema.Row{"Server_name": "s", "password": "secret"},
+			want:      schema.Row{"Server_name": "s"},
+		},
+		{
+			name:      "pg_authid",
+			tableName: "pg_catalog.pg_authid",
+			row:       schema.Row{"rolname": "app", "rolpassword": "SCRAM-SHA-256$..."},
+			want:      schema.Row{"rolname": "app"},
+		},
+		{
+			name:      "other table",
+			tableName: "mysql.db",
+			row:       schema.Row{"Db": "app", "Password": "kept"},
+			want:      schema.Row{"Db": "app", "Password": "kept"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			omitCredentials(tt.tableName, tt.row)
+			if !reflect.DeepEqual(tt.row, tt.want) {
+				t.Errorf("omitCredentials() = %v, want %v", tt.row, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeSystemSchemas(t *testing.T) {
+	all := map[string]*schema.TableSchema{}
+	batch := newTableSchemas([]string{"user", "db"})
+	batch["user"].Columns = []schema.Column{{Name: "Host"}, {Name: "User"}, {Name: "authentication_string"}}
+	batch["db"].Columns = []schema.Column{{Name: "Db"}}
+	mergeSystemSchemas(all, "mysql", batch)
+
+	tests := []struct {
+		tableName string
+		want      []string
+	}{
+		{"mysql.user", []string{"Host", "User"}},
+		{"mysql.db", []string{"Db"}},
+	}
+	for _, tt := range tests {
+		ts, ok := all[tt.tableName]
+		if !ok {
+			t.Fatalf("table %s missing", tt.tableName)
+		}
+		var got []string
+		for _, col := range ts.Columns {
+			got = append(got, col.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s columns = %v, want %v", tt.tableName, got, tt.want)
+		}
+	}
+}
+
+func TestIndexCollectorDescending(t *testing.T) {
+	c := newIndexCollector()
+	c.add("events", schema.Index{Name: "idx_recent"}, "user_id", false)
+	c.add("events", schema.Index{Name: "idx_recent"}, "created_at", true)
+	c.add("events", schema.Index{Name: "idx_kind"}, "kind", false)
+	c.add("events", schema.Index{Name: "idx_kind"}, "user_id", false)
+	schemas := map[string]*schema.TableSchema{"events": {Name: "events"}}
+	c.store(schemas)
+
+	want := []schema.Index{
+		{Name: "idx_recent", Columns: []string{"user_id", "created_at"}, Descending: []bool{false, true}},
+		{Name: "idx_kind", Columns: []string{"kind", "user_id"}},
+	}
+	if got := schemas["events"].Indexes; !reflect.DeepEqual(got, want) {
+		t.Errorf("indexes = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckReadOnly(t *testing.T) {
+	db, err := sql.Open("dbdiff-counting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer func() { counting.answers = nil }()
+
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "1"},
+		{value: "on"},
+		{value: "0", wantErr: true},
+		{value: "off", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			counting.answers = map[string][][]driver.Value{"read_only": {{tt.value}}}
+			err := checkReadOnly(context.Background(), db, "SHOW default_transaction_read_only")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkReadOnly() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := *counting.last.Load(); got != "SHOW default_transaction_read_only" {
+				t.Errorf("query = %q, want the read-only check", got)
+			}
+		})
+	}
+}
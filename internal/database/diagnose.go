@@ -0,0 +1,57 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// Diagnose returns a short hint about the likely cause of a connection
+// error, or an empty string when the cause is not recognized
+func Diagnose(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "DNS lookup failed: check DB_HOST"
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return "could not reach the server: check DB_HOST, DB_PORT and that the database is running"
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1045:
+			return "authentication failed: check DB_USER and DB_PASSWORD"
+		case 1049:
+			return "unknown database: check DB_NAME"
+		}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "28P01", "28000":
+			return "authentication failed: check DB_USER and DB_PASSWORD"
+		case "3D000":
+			return "unknown database: check DB_NAME"
+		}
+	}
+
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuthority) {
+		return "TLS certificate verification failed"
+	}
+	if msg := strings.ToLower(err.Error()); strings.Contains(msg, "ssl") || strings.Contains(msg, "tls") {
+		return "TLS negotiation failed: check the server's SSL settings"
+	}
+
+	return ""
+}
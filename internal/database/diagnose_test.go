@@ -0,0 +1,34 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "dns", err: &net.DNSError{Err: "no such host", Name: "db.invalid"}, want: "DNS lookup failed: check DB_HOST"},
+		{name: "dial", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			want: "could not reach the server: check DB_HOST, DB_PORT and that the database is running"},
+		{name: "mysql auth", err: fmt.Errorf("connect: %w", &mysql.MySQLError{Number: 1045}), want: "authentication failed: check DB_USER and DB_PASSWORD"},
+		{name: "postgres database", err: &pq.Error{Code: "3D000"}, want: "unknown database: check DB_NAME"},
+		{name: "tls", err: errors.New("pq: SSL is not enabled on the server"), want: "TLS negotiation failed: check the server's SSL settings"},
+		{name: "unknown", err: errors.New("something else")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diagnose(tt.err); got != tt.want {
+				t.Errorf("Diagnose() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
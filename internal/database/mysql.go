@@ -1,11 +1,13 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/koba/db-diff/internal/schema"
 )
 
@@ -21,28 +23,61 @@ func NewMySQL(config Config) *MySQL {
 }
 
 // Connect establishes a connection to MySQL
-func (m *MySQL) Connect() error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
-		m.config.User,
-		m.config.Password,
-		m.config.Host,
-		m.config.Port,
-		m.config.Database,
-	)
+func (m *MySQL) Connect(ctx context.Context) error {
+	dsn, err := m.dsn()
+	if err != nil {
+		return err
+	}
 
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return fmt.Errorf("failed to open MySQL connection: %w", err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		return fmt.Errorf("failed to ping MySQL: %w", err)
 	}
 
+	if m.config.ReadOnly {
+		if err := checkReadOnly(ctx, db, "SELECT @@SESSION.transaction_read_only"); err != nil {
+			db.Close()
+			return err
+		}
+	}
+
 	m.db = db
 	return nil
 }
 
+// dsn returns the data source name Connect opens, with the TLS and
+// read-only session parameters the config asks for
+func (m *MySQL) dsn() (string, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+		m.config.User,
+		m.config.Password,
+		m.config.Host,
+		m.config.Port,
+		m.config.Database,
+	)
+	if m.config.DSN != "" {
+		dsn = m.config.DSN
+	} else {
+		tlsParam, err := mysqlTLSParam(m.config)
+		if err != nil {
+			return "", err
+		}
+		if tlsParam != "" {
+			dsn = withParam(dsn, "tls="+tlsParam)
+		}
+	}
+	if m.config.ReadOnly {
+		// The driver runs SET transaction_read_only = 1 on every new
+		// connection, the same as SET SESSION TRANSACTION READ ONLY
+		dsn = withParam(dsn, "transaction_read_only=1")
+	}
+	return dsn, nil
+}
+
 // Close closes the MySQL connection
 func (m *MySQL) Close() error {
 	if m.db != nil {
@@ -51,88 +86,191 @@ func (m *MySQL) Close() error {
 	return nil
 }
 
+// DB returns the underlying MySQL connection pool
+func (m *MySQL) DB() *sql.DB {
+	return m.db
+}
+
+// Dialect returns "mysql"
+func (m *MySQL) Dialect() string {
+	return "mysql"
+}
+
+// mysqlSystemSchemas are the schemas whose tables IncludeSystemTables adds
+var mysqlSystemSchemas = []string{"mysql", "sys"}
+
 // GetAllTables retrieves all table names in the database
-func (m *MySQL) GetAllTables() ([]string, error) {
+func (m *MySQL) GetAllTables(ctx context.Context) ([]string, error) {
 	query := "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME"
-	rows, err := m.db.Query(query, m.config.Database)
+	tables, err := queryTableNames(ctx, m.db, query, m.config.Database)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tables: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
+	return m.withSystemTables(ctx, tables)
+}
 
-	var tables []string
-	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
-			return nil, fmt.Errorf("failed to scan table name: %w", err)
-		}
-		tables = append(tables, tableName)
+// withSystemTables appends the system schemas' tables, qualified by schema,
+// when the configuration asks for them
+func (m *MySQL) withSystemTables(ctx context.Context, tables []string) ([]string, error) {
+	if !m.config.IncludeSystemTables {
+		return tables, nil
+	}
+	query := `
+		SELECT CONCAT(TABLE_SCHEMA, '.', TABLE_NAME)
+		FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA IN (?, ?) AND TABLE_TYPE = 'BASE TABLE'
+		ORDER BY TABLE_SCHEMA, TABLE_NAME
+	`
+	system, err := queryTableNames(ctx, m.db, query, mysqlSystemSchemas[0], mysqlSystemSchemas[1])
+	if err != nil {
+		return nil, err
+	}
+	system, err = readableTables(ctx, m.db, system, m.tableRef)
+	if err != nil {
+		return nil, err
 	}
+	return append(tables, system...), nil
+}
 
-	return tables, rows.Err()
+// systemSchemas returns the schemas qualified table names may refer to
+func (m *MySQL) systemSchemas() []string {
+	if !m.config.IncludeSystemTables {
+		return nil
+	}
+	return mysqlSystemSchemas
 }
 
-// GetTableSchema retrieves the schema for a specific table
-func (m *MySQL) GetTableSchema(tableName string) (*schema.TableSchema, error) {
-	tableSchema := &schema.TableSchema{
-		Name:    tableName,
-		Columns: []schema.Column{},
-		Indexes: []schema.Index{},
-		ForeignKeys: []schema.ForeignKey{},
+// tableRef quotes a table name for use in a query
+func (m *MySQL) tableRef(tableName string) string {
+	if schemaName, name, ok := splitSystemTable(tableName, m.systemSchemas()); ok {
+		return fmt.Sprintf("`%s`.`%s`", schemaName, name)
 	}
+	return fmt.Sprintf("`%s`", tableName)
+}
 
-	// Get columns
-	columns, err := m.getColumns(tableName)
+// GetAllTablesInCreationOrder returns all tables, oldest first. Tables
+// without a recorded creation time come last, by name.
+func (m *MySQL) GetAllTablesInCreationOrder(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT TABLE_NAME
+		FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = ?
+		ORDER BY CREATE_TIME IS NULL, CREATE_TIME, TABLE_NAME
+	`
+	tables, err := queryTableNames(ctx, m.db, query, m.config.Database)
 	if err != nil {
 		return nil, err
 	}
-	tableSchema.Columns = columns
+	return m.withSystemTables(ctx, tables)
+}
 
-	// Get indexes
-	indexes, err := m.getIndexes(tableName)
+// GetTableSchema retrieves the schema for a specific table
+func (m *MySQL) GetTableSchema(ctx context.Context, tableName string) (*schema.TableSchema, error) {
+	schemas, err := m.GetTableSchemas(ctx, []string{tableName})
 	if err != nil {
 		return nil, err
 	}
-	tableSchema.Indexes = indexes
+	return schemas[tableName], nil
+}
 
-	// Get foreign keys
-	foreignKeys, err := m.getForeignKeys(tableName)
-	if err != nil {
-		return nil, err
+// GetTableSchemas retrieves the schemas for several tables with one query
+// each for columns, indexes, foreign keys and auto-increment values
+func (m *MySQL) GetTableSchemas(ctx context.Context, tableNames []string) (map[string]*schema.TableSchema, error) {
+	schemas := newTableSchemas(tableNames)
+	if len(tableNames) == 0 {
+		return schemas, nil
 	}
-	tableSchema.ForeignKeys = foreignKeys
 
-	return tableSchema, nil
+	// System tables are read from their own schema, one batch per schema
+	for schemaName, names := range groupTablesBySchema(tableNames, m.systemSchemas()) {
+		batch := newTableSchemas(names)
+		if schemaName == "" {
+			batch = schemas
+			schemaName = m.config.Database
+		}
+
+		// Get columns
+		if err := m.getColumns(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get indexes
+		if err := m.getIndexes(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get foreign keys
+		if err := m.getForeignKeys(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get check constraints
+		if err := m.getChecks(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get next auto-increment values
+		if err := m.getAutoIncrements(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get partitions
+		if err := m.getPartitions(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		if schemaName != m.config.Database {
+			mergeSystemSchemas(schemas, schemaName, batch)
+		}
+	}
+
+	return schemas, nil
 }
 
-func (m *MySQL) getColumns(tableName string) ([]schema.Column, error) {
+// tableArgs returns an IN (...) placeholder list for tableNames and the
+// query arguments, starting with the schema (database) name
+func tableArgs(schemaName string, tableNames []string) (string, []interface{}) {
+	args := []interface{}{schemaName}
+	for _, name := range tableNames {
+		args = append(args, name)
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(tableNames)), ", "), args
+}
+
+func (m *MySQL) getColumns(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	in, args := tableArgs(schemaName, tableNames)
 	query := `
 		SELECT
+			TABLE_NAME,
 			COLUMN_NAME,
 			COLUMN_TYPE,
 			IS_NULLABLE,
 			COLUMN_DEFAULT,
 			EXTRA,
-			ORDINAL_POSITION
+			ORDINAL_POSITION,
+			COLLATION_NAME,
+			GENERATION_EXPRESSION
 		FROM information_schema.COLUMNS
-		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
-		ORDER BY ORDINAL_POSITION
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME IN (` + in + `)
+		ORDER BY TABLE_NAME, ORDINAL_POSITION
 	`
-	rows, err := m.db.Query(query, m.config.Database, tableName)
+	rows, err := m.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+		return fmt.Errorf("failed to get columns: %w", err)
 	}
 	defer rows.Close()
 
-	var columns []schema.Column
 	for rows.Next() {
+		var tableName string
 		var col schema.Column
 		var nullable string
 		var defaultValue sql.NullString
 		var extra string
+		var collation sql.NullString
+		var generation sql.NullString
 
-		if err := rows.Scan(&col.Name, &col.Type, &nullable, &defaultValue, &extra, &col.Position); err != nil {
-			return nil, fmt.Errorf("failed to scan column: %w", err)
+		if err := rows.Scan(&tableName, &col.Name, &col.Type, &nullable, &defaultValue, &extra, &col.Position, &collation, &generation); err != nil {
+			return fmt.Errorf("failed to scan column: %w", err)
 		}
 
 		col.Nullable = (nullable == "YES")
@@ -140,120 +278,347 @@ func (m *MySQL) getColumns(tableName string) ([]schema.Column, error) {
 			col.DefaultValue = &defaultValue.String
 		}
 		col.AutoIncrement = strings.Contains(strings.ToLower(extra), "auto_increment")
+		// EXTRA is VIRTUAL GENERATED or STORED GENERATED for generated columns
+		if strings.Contains(strings.ToUpper(extra), "GENERATED") && generation.String != "" {
+			col.Generated = generation.String
+			col.Stored = strings.Contains(strings.ToUpper(extra), "STORED")
+		}
+		// COLLATION_NAME is NULL for non-string columns
+		if collation.Valid {
+			col.Collation = collation.String
+		}
 
-		columns = append(columns, col)
+		if ts, ok := schemas[tableName]; ok {
+			ts.Columns = append(ts.Columns, col)
+			setPeriodColumn(ts, col.Name, extra)
+		}
 	}
 
-	return columns, rows.Err()
+	return rows.Err()
+}
+
+// setPeriodColumn records a system-versioned table's period columns, which
+// MariaDB marks with ROW START and ROW END in EXTRA
+func setPeriodColumn(ts *schema.TableSchema, column, extra string) {
+	extra = strings.ToUpper(extra)
+	if !strings.Contains(extra, "ROW START") && !strings.Contains(extra, "ROW END") {
+		return
+	}
+	if ts.SystemVersioning == nil {
+		ts.SystemVersioning = &schema.SystemVersioning{}
+	}
+	if strings.Contains(extra, "ROW START") {
+		ts.SystemVersioning.PeriodStart = column
+	} else {
+		ts.SystemVersioning.PeriodEnd = column
+	}
 }
 
-func (m *MySQL) getIndexes(tableName string) ([]schema.Index, error) {
+func (m *MySQL) getIndexes(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	in, args := tableArgs(schemaName, tableNames)
 	query := `
 		SELECT
+			TABLE_NAME,
 			INDEX_NAME,
 			COLUMN_NAME,
 			NON_UNIQUE,
-			INDEX_TYPE
+			INDEX_TYPE,
+			COLLATION
 		FROM information_schema.STATISTICS
-		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
-		ORDER BY INDEX_NAME, SEQ_IN_INDEX
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME IN (` + in + `)
+		ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX
 	`
-	rows, err := m.db.Query(query, m.config.Database, tableName)
+	rows, err := m.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get indexes: %w", err)
+		return fmt.Errorf("failed to get indexes: %w", err)
 	}
 	defer rows.Close()
 
-	indexMap := make(map[string]*schema.Index)
+	indexes := newIndexCollector()
 	for rows.Next() {
-		var indexName, columnName, indexType string
+		var tableName, indexName, columnName, indexType string
 		var nonUnique int
+		var collation sql.NullString
 
-		if err := rows.Scan(&indexName, &columnName, &nonUnique, &indexType); err != nil {
-			return nil, fmt.Errorf("failed to scan index: %w", err)
+		if err := rows.Scan(&tableName, &indexName, &columnName, &nonUnique, &indexType, &collation); err != nil {
+			return fmt.Errorf("failed to scan index: %w", err)
 		}
 
-		if idx, exists := indexMap[indexName]; exists {
-			idx.Columns = append(idx.Columns, columnName)
-		} else {
-			indexMap[indexName] = &schema.Index{
-				Name:    indexName,
-				Columns: []string{columnName},
-				Unique:  nonUnique == 0,
-				Primary: indexName == "PRIMARY",
-				Type:    indexType,
-			}
-		}
+		// COLLATION is 'D' for descending columns (MySQL 8.0+)
+		indexes.add(tableName, schema.Index{
+			Name:    indexName,
+			Unique:  nonUnique == 0,
+			Primary: indexName == "PRIMARY",
+			Type:    indexType,
+		}, columnName, collation.String == "D")
 	}
-
-	var indexes []schema.Index
-	for _, idx := range indexMap {
-		indexes = append(indexes, *idx)
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	return indexes, rows.Err()
+	indexes.store(schemas)
+	return nil
 }
 
-func (m *MySQL) getForeignKeys(tableName string) ([]schema.ForeignKey, error) {
+func (m *MySQL) getForeignKeys(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	in, args := tableArgs(schemaName, tableNames)
 	query := `
 		SELECT
-			CONSTRAINT_NAME,
-			COLUMN_NAME,
-			REFERENCED_TABLE_NAME,
-			REFERENCED_COLUMN_NAME
-		FROM information_schema.KEY_COLUMN_USAGE
-		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL
+			kcu.TABLE_NAME,
+			kcu.CONSTRAINT_NAME,
+			kcu.COLUMN_NAME,
+			kcu.REFERENCED_TABLE_NAME,
+			kcu.REFERENCED_COLUMN_NAME,
+			rc.DELETE_RULE,
+			rc.UPDATE_RULE
+		FROM information_schema.KEY_COLUMN_USAGE kcu
+		JOIN information_schema.REFERENTIAL_CONSTRAINTS rc
+			ON rc.CONSTRAINT_SCHEMA = kcu.CONSTRAINT_SCHEMA
+			AND rc.CONSTRAINT_NAME = kcu.CONSTRAINT_NAME
+			AND rc.TABLE_NAME = kcu.TABLE_NAME
+		WHERE kcu.TABLE_SCHEMA = ? AND kcu.TABLE_NAME IN (` + in + `) AND kcu.REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY kcu.TABLE_NAME, kcu.CONSTRAINT_NAME, kcu.ORDINAL_POSITION
 	`
-	rows, err := m.db.Query(query, m.config.Database, tableName)
+	rows, err := m.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get foreign keys: %w", err)
+		return fmt.Errorf("failed to get foreign keys: %w", err)
 	}
 	defer rows.Close()
 
-	var foreignKeys []schema.ForeignKey
 	for rows.Next() {
+		var tableName string
 		var fk schema.ForeignKey
 
-		if err := rows.Scan(&fk.Name, &fk.Column, &fk.ReferencedTable, &fk.ReferencedColumn); err != nil {
-			return nil, fmt.Errorf("failed to scan foreign key: %w", err)
+		if err := rows.Scan(&tableName, &fk.Name, &fk.Column, &fk.ReferencedTable, &fk.ReferencedColumn, &fk.OnDelete, &fk.OnUpdate); err != nil {
+			return fmt.Errorf("failed to scan foreign key: %w", err)
 		}
 
-		// Get ON DELETE and ON UPDATE actions
-		actionQuery := `
-			SELECT DELETE_RULE, UPDATE_RULE
-			FROM information_schema.REFERENTIAL_CONSTRAINTS
-			WHERE CONSTRAINT_SCHEMA = ? AND CONSTRAINT_NAME = ?
-		`
-		err := m.db.QueryRow(actionQuery, m.config.Database, fk.Name).Scan(&fk.OnDelete, &fk.OnUpdate)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get FK actions: %w", err)
+		if ts, ok := schemas[tableName]; ok {
+			ts.ForeignKeys = append(ts.ForeignKeys, fk)
+		}
+	}
+
+	return rows.Err()
+}
+
+// getChecks reads the CHECK constraints of each table. Servers older than
+// MySQL 8.0.16 and MariaDB 10.2 have no CHECK_CONSTRAINTS table and report
+// none.
+func (m *MySQL) getChecks(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	// MariaDB names a check's table, since its check names are unique per
+	// table rather than per schema; MySQL records whether it is enforced
+	tableJoin, enforced := "", "'YES'"
+	if ok, err := m.hasInformationSchemaColumn(ctx, "CHECK_CONSTRAINTS", "TABLE_NAME"); err != nil {
+		return err
+	} else if ok {
+		tableJoin = "AND cc.TABLE_NAME = tc.TABLE_NAME"
+	}
+	if ok, err := m.hasInformationSchemaColumn(ctx, "TABLE_CONSTRAINTS", "ENFORCED"); err != nil {
+		return err
+	} else if ok {
+		enforced = "tc.ENFORCED"
+	}
+
+	in, args := tableArgs(schemaName, tableNames)
+	query := `
+		SELECT tc.TABLE_NAME, tc.CONSTRAINT_NAME, cc.CHECK_CLAUSE, ` + enforced + `
+		FROM information_schema.TABLE_CONSTRAINTS tc
+		JOIN information_schema.CHECK_CONSTRAINTS cc
+			ON cc.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA
+			AND cc.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+			` + tableJoin + `
+		WHERE tc.TABLE_SCHEMA = ? AND tc.TABLE_NAME IN (` + in + `) AND tc.CONSTRAINT_TYPE = 'CHECK'
+		ORDER BY tc.TABLE_NAME, tc.CONSTRAINT_NAME
+	`
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1109 { // unknown table in information_schema
+			return nil
+		}
+		return fmt.Errorf("failed to get check constraints: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName, isEnforced string
+		var check schema.CheckConstraint
+		if err := rows.Scan(&tableName, &check.Name, &check.Expression, &isEnforced); err != nil {
+			return fmt.Errorf("failed to scan check constraint: %w", err)
+		}
+		check.Expression = unwrapParens(check.Expression)
+		check.NotEnforced = isEnforced == "NO"
+		if ts, ok := schemas[tableName]; ok {
+			ts.Checks = append(ts.Checks, check)
+		}
+	}
+
+	return rows.Err()
+}
+
+// hasInformationSchemaColumn reports whether an information_schema view
+// has a column, which differs between MySQL and MariaDB versions
+func (m *MySQL) hasInformationSchemaColumn(ctx context.Context, view, column string) (bool, error) {
+	var count int
+	query := `
+		SELECT COUNT(*)
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = 'information_schema' AND TABLE_NAME = ? AND COLUMN_NAME = ?
+	`
+	if err := m.db.QueryRowContext(ctx, query, view, column).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check information_schema.%s: %w", view, err)
+	}
+	return count > 0, nil
+}
+
+// getAutoIncrements reads each table's next AUTO_INCREMENT value. MySQL 8
+// caches this column, so it can lag behind by up to
+// information_schema_stats_expiry seconds.
+func (m *MySQL) getAutoIncrements(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	in, args := tableArgs(schemaName, tableNames)
+	query := `
+		SELECT TABLE_NAME, AUTO_INCREMENT
+		FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME IN (` + in + `) AND AUTO_INCREMENT IS NOT NULL
+	`
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get auto increment values: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName string
+		var next int64
+		if err := rows.Scan(&tableName, &next); err != nil {
+			return fmt.Errorf("failed to scan auto increment value: %w", err)
+		}
+		if ts, ok := schemas[tableName]; ok {
+			ts.AutoIncrement = next
 		}
+	}
+
+	return rows.Err()
+}
 
-		foreignKeys = append(foreignKeys, fk)
+// getPartitions reads the partitioning of partitioned tables. Subpartitions
+// are not captured.
+func (m *MySQL) getPartitions(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	in, args := tableArgs(schemaName, tableNames)
+	query := `
+		SELECT
+			TABLE_NAME,
+			PARTITION_NAME,
+			PARTITION_METHOD,
+			COALESCE(PARTITION_EXPRESSION, ''),
+			COALESCE(PARTITION_DESCRIPTION, '')
+		FROM information_schema.PARTITIONS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME IN (` + in + `)
+			AND PARTITION_NAME IS NOT NULL
+			AND (SUBPARTITION_ORDINAL_POSITION IS NULL OR SUBPARTITION_ORDINAL_POSITION = 1)
+		ORDER BY TABLE_NAME, PARTITION_ORDINAL_POSITION
+	`
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get partitions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName, method, expression, description string
+		var partition schema.Partition
+		if err := rows.Scan(&tableName, &partition.Name, &method, &expression, &description); err != nil {
+			return fmt.Errorf("failed to scan partition: %w", err)
+		}
+		ts, ok := schemas[tableName]
+		if !ok {
+			continue
+		}
+		if ts.Partitioning == nil {
+			ts.Partitioning = &schema.Partitioning{Method: method, Expression: expression}
+		}
+		partition.Bound = mysqlPartitionBound(method, description)
+		ts.Partitioning.Partitions = append(ts.Partitioning.Partitions, partition)
 	}
 
-	return foreignKeys, rows.Err()
+	return rows.Err()
+}
+
+// mysqlPartitionBound builds the VALUES clause of a partition definition
+// from its PARTITION_DESCRIPTION
+func mysqlPartitionBound(method, description string) string {
+	switch {
+	case method == "RANGE" && description == "MAXVALUE":
+		return "VALUES LESS THAN MAXVALUE"
+	case strings.HasPrefix(method, "RANGE"):
+		return "VALUES LESS THAN (" + description + ")"
+	case strings.HasPrefix(method, "LIST"):
+		return "VALUES IN (" + description + ")"
+	}
+	return ""
+}
+
+// CountRows counts the rows of a table matching where
+func (m *MySQL) CountRows(ctx context.Context, tableName string, where string) (int64, error) {
+	query := "SELECT COUNT(*) FROM " + m.tableRef(tableName)
+	if where != "" {
+		query += " WHERE " + where
+	}
+
+	var count int64
+	if err := m.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
 }
 
 // GetTableData retrieves all data from a table
-func (m *MySQL) GetTableData(tableName string, limit int) ([]schema.Row, error) {
-	query := fmt.Sprintf("SELECT * FROM `%s`", tableName)
-	if limit > 0 {
-		query = fmt.Sprintf("%s LIMIT %d", query, limit)
+func (m *MySQL) GetTableData(ctx context.Context, tableName string, opts DataOptions) ([]schema.Row, error) {
+	var data []schema.Row
+	err := m.StreamTableData(ctx, tableName, opts, func(row schema.Row) error {
+		data = append(data, row)
+		return nil
+	})
+	return data, err
+}
+
+// StreamTableData reads a table's rows and passes each one to fn as it is
+// read, stopping at the first error fn returns
+func (m *MySQL) StreamTableData(ctx context.Context, tableName string, opts DataOptions, fn func(schema.Row) error) error {
+	query := "SELECT * FROM " + m.tableRef(tableName)
+	var args []interface{}
+	var conditions []string
+	if opts.Range != nil {
+		conditions = append(conditions, fmt.Sprintf("`%s` BETWEEN ? AND ?", opts.Range.Column))
+		args = append(args, opts.Range.From, opts.Range.To)
+	}
+	if opts.Where != "" {
+		conditions = append(conditions, "("+opts.Where+")")
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if opts.OrderBy != nil {
+		query = fmt.Sprintf("%s ORDER BY `%s`", query, opts.OrderBy.Column)
+		if opts.OrderBy.Descending {
+			query += " DESC"
+		}
+	}
+	if opts.Limit > 0 {
+		query = fmt.Sprintf("%s LIMIT %d", query, opts.Limit)
 	}
 
-	rows, err := m.db.Query(query)
+	rows, err := m.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get table data: %w", err)
+		return fmt.Errorf("failed to get table data: %w", err)
 	}
 	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+		return fmt.Errorf("failed to get columns: %w", err)
 	}
 
-	var data []schema.Row
 	for rows.Next() {
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
@@ -262,7 +627,7 @@ func (m *MySQL) GetTableData(tableName string, limit int) ([]schema.Row, error)
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+			return fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		row := make(schema.Row)
@@ -274,9 +639,14 @@ func (m *MySQL) GetTableData(tableName string, limit int) ([]schema.Row, error)
 				row[col] = val
 			}
 		}
+		if m.config.IncludeSystemTables {
+			omitCredentials(tableName, row)
+		}
 
-		data = append(data, row)
+		if err := fn(row); err != nil {
+			return err
+		}
 	}
 
-	return data, rows.Err()
+	return rows.Err()
 }
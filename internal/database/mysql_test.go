@@ -0,0 +1,56 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestSetPeriodColumn(t *testing.T) {
+	ts := &schema.TableSchema{Name: "prices"}
+	for column, extra := range map[string]string{
+		"id":        "auto_increment",
+		"row_start": "STORED GENERATED, ROW START",
+		"row_end":   "stored generated, row end",
+		"price":     "",
+	} {
+		setPeriodColumn(ts, column, extra)
+	}
+	want := &schema.SystemVersioning{PeriodStart: "row_start", PeriodEnd: "row_end"}
+	if !reflect.DeepEqual(ts.SystemVersioning, want) {
+		t.Errorf("SystemVersioning = %+v, want %+v", ts.SystemVersioning, want)
+	}
+
+	plain := &schema.TableSchema{Name: "users"}
+	setPeriodColumn(plain, "id", "auto_increment")
+	if plain.SystemVersioning != nil {
+		t.Errorf("SystemVersioning = %+v, want nil for a regular table", plain.SystemVersioning)
+	}
+}
+
+func TestMySQLReadOnlyDSN(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{name: "read-write", config: Config{User: "app", Password: "secret", Host: "db", Port: "3306", Database: "shop"},
+			want: "app:secret@tcp(db:3306)/shop?parseTime=true"},
+		{name: "read-only", config: Config{User: "app", Password: "secret", Host: "db", Port: "3306", Database: "shop", ReadOnly: true},
+			want: "app:secret@tcp(db:3306)/shop?parseTime=true&transaction_read_only=1"},
+		{name: "read-only DSN", config: Config{DSN: "app@tcp(db)/shop", ReadOnly: true},
+			want: "app@tcp(db)/shop?transaction_read_only=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewMySQL(tt.config).dsn()
+			if err != nil {
+				t.Fatalf("dsn() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("dsn() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
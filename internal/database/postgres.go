@@ -1,11 +1,12 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/koba/db-diff/internal/schema"
 )
 
@@ -21,28 +22,56 @@ func NewPostgres(config Config) *Postgres {
 }
 
 // Connect establishes a connection to PostgreSQL
-func (p *Postgres) Connect() error {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		p.config.Host,
-		p.config.Port,
-		p.config.User,
-		p.config.Password,
-		p.config.Database,
-	)
-
-	db, err := sql.Open("postgres", dsn)
+func (p *Postgres) Connect(ctx context.Context) error {
+	db, err := sql.Open("postgres", p.dsn())
 	if err != nil {
 		return fmt.Errorf("failed to open PostgreSQL connection: %w", err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		return fmt.Errorf("failed to ping PostgreSQL: %w", err)
 	}
 
+	if p.config.ReadOnly {
+		if err := checkReadOnly(ctx, db, "SHOW default_transaction_read_only"); err != nil {
+			db.Close()
+			return err
+		}
+	}
+
 	p.db = db
 	return nil
 }
 
+// dsn returns the connection string Connect opens, with the read-only
+// session parameter the config asks for
+func (p *Postgres) dsn() string {
+	sslMode := p.config.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		p.config.Host,
+		p.config.Port,
+		p.config.User,
+		p.config.Password,
+		p.config.Database,
+		sslMode,
+	)
+	if p.config.SSLRootCert != "" {
+		dsn += fmt.Sprintf(" sslrootcert='%s'", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(p.config.SSLRootCert))
+	}
+	if p.config.DSN != "" {
+		dsn = p.config.DSN
+	}
+	if p.config.ReadOnly {
+		// Sent as a run-time parameter when each connection starts, the
+		// same as SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY
+		dsn += " default_transaction_read_only=on"
+	}
+	return dsn
+}
+
 // Close closes the PostgreSQL connection
 func (p *Postgres) Close() error {
 	if p.db != nil {
@@ -51,169 +80,340 @@ func (p *Postgres) Close() error {
 	return nil
 }
 
+// DB returns the underlying PostgreSQL connection pool
+func (p *Postgres) DB() *sql.DB {
+	return p.db
+}
+
+// Dialect returns "postgres"
+func (p *Postgres) Dialect() string {
+	return "postgres"
+}
+
 // GetAllTables retrieves all table names in the public schema
-func (p *Postgres) GetAllTables() ([]string, error) {
+func (p *Postgres) GetAllTables(ctx context.Context) ([]string, error) {
 	query := `
 		SELECT table_name
 		FROM information_schema.tables
 		WHERE table_schema = 'public' AND table_type = 'BASE TABLE'
 		ORDER BY table_name
 	`
-	rows, err := p.db.Query(query)
+	tables, err := queryTableNames(ctx, p.db, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tables: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
+	return p.withSystemTables(ctx, tables)
+}
 
-	var tables []string
-	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
-			return nil, fmt.Errorf("failed to scan table name: %w", err)
-		}
-		tables = append(tables, tableName)
+// postgresSystemSchemas are the schemas whose tables IncludeSystemTables adds
+var postgresSystemSchemas = []string{"pg_catalog", "information_schema"}
+
+// withSystemTables appends the system schemas' tables, qualified by schema,
+// when the configuration asks for them
+func (p *Postgres) withSystemTables(ctx context.Context, tables []string) ([]string, error) {
+	if !p.config.IncludeSystemTables {
+		return tables, nil
 	}
+	query := `
+		SELECT table_schema || '.' || table_name
+		FROM information_schema.tables
+		WHERE table_schema = ANY($1) AND table_type = 'BASE TABLE'
+		ORDER BY table_schema, table_name
+	`
+	system, err := queryTableNames(ctx, p.db, query, pq.Array(postgresSystemSchemas))
+	if err != nil {
+		return nil, err
+	}
+	system, err = readableTables(ctx, p.db, system, p.tableRef)
+	if err != nil {
+		return nil, err
+	}
+	return append(tables, system...), nil
+}
 
-	return tables, rows.Err()
+// systemSchemas returns the schemas qualified table names may refer to
+func (p *Postgres) systemSchemas() []string {
+	if !p.config.IncludeSystemTables {
+		return nil
+	}
+	return postgresSystemSchemas
 }
 
-// GetTableSchema retrieves the schema for a specific table
-func (p *Postgres) GetTableSchema(tableName string) (*schema.TableSchema, error) {
-	tableSchema := &schema.TableSchema{
-		Name:        tableName,
-		Columns:     []schema.Column{},
-		Indexes:     []schema.Index{},
-		ForeignKeys: []schema.ForeignKey{},
+// tableRef quotes a table name for use in a query
+func (p *Postgres) tableRef(tableName string) string {
+	if schemaName, name, ok := splitSystemTable(tableName, p.systemSchemas()); ok {
+		return fmt.Sprintf("\"%s\".\"%s\"", schemaName, name)
 	}
+	return fmt.Sprintf("\"%s\"", tableName)
+}
 
-	// Get columns
-	columns, err := p.getColumns(tableName)
+// GetAllTablesInCreationOrder returns all tables, oldest first. PostgreSQL
+// keeps no creation time, so the order of the tables' OIDs, which are
+// assigned as tables are created, is used instead.
+func (p *Postgres) GetAllTablesInCreationOrder(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT c.relname
+		FROM pg_class c
+		WHERE c.relnamespace = 'public'::regnamespace AND c.relkind IN ('r', 'p')
+		ORDER BY c.oid
+	`
+	tables, err := queryTableNames(ctx, p.db, query)
 	if err != nil {
 		return nil, err
 	}
-	tableSchema.Columns = columns
+	return p.withSystemTables(ctx, tables)
+}
 
-	// Get indexes
-	indexes, err := p.getIndexes(tableName)
+// GetTableSchema retrieves the schema for a specific table
+func (p *Postgres) GetTableSchema(ctx context.Context, tableName string) (*schema.TableSchema, error) {
+	schemas, err := p.GetTableSchemas(ctx, []string{tableName})
 	if err != nil {
 		return nil, err
 	}
-	tableSchema.Indexes = indexes
+	return schemas[tableName], nil
+}
 
-	// Get foreign keys
-	foreignKeys, err := p.getForeignKeys(tableName)
-	if err != nil {
-		return nil, err
+// GetTableSchemas retrieves the schemas for several tables with one query
+// each for columns, indexes, foreign keys and auto-increment values
+func (p *Postgres) GetTableSchemas(ctx context.Context, tableNames []string) (map[string]*schema.TableSchema, error) {
+	schemas := newTableSchemas(tableNames)
+	if len(tableNames) == 0 {
+		return schemas, nil
 	}
-	tableSchema.ForeignKeys = foreignKeys
 
-	return tableSchema, nil
+	// System tables are read from their own schema, one batch per schema
+	for schemaName, names := range groupTablesBySchema(tableNames, p.systemSchemas()) {
+		batch := newTableSchemas(names)
+		if schemaName == "" {
+			batch = schemas
+			schemaName = "public"
+		}
+
+		// Get columns
+		if err := p.getColumns(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get indexes
+		if err := p.getIndexes(ctx, schemaName, "r", names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get foreign keys
+		if err := p.getForeignKeys(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get check constraints
+		if err := p.getChecks(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get next sequence values
+		if err := p.getAutoIncrements(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get rewrite rules
+		if err := p.getRules(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		// Get partitions
+		if err := p.getPartitions(ctx, schemaName, names, batch); err != nil {
+			return nil, err
+		}
+
+		if schemaName != "public" {
+			mergeSystemSchemas(schemas, schemaName, batch)
+		}
+	}
+
+	return schemas, nil
 }
 
-func (p *Postgres) getColumns(tableName string) ([]schema.Column, error) {
+func (p *Postgres) getColumns(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
 	query := `
 		SELECT
-			column_name,
-			data_type,
-			is_nullable,
-			column_default,
-			ordinal_position
-		FROM information_schema.columns
-		WHERE table_schema = 'public' AND table_name = $1
-		ORDER BY ordinal_position
+			c.table_name,
+			c.column_name,
+			c.data_type,
+			c.is_nullable,
+			c.column_default,
+			c.ordinal_position,
+			c.collation_name,
+			a.attidentity,
+			c.datetime_precision,
+			c.udt_name,
+			CASE WHEN to_jsonb(a)->>'attgenerated' = 's' THEN pg_get_expr(ad.adbin, ad.adrelid) END
+		FROM information_schema.columns c
+		JOIN pg_attribute a
+			ON a.attrelid = (quote_ident(c.table_schema) || '.' || quote_ident(c.table_name))::regclass
+			AND a.attname = c.column_name
+		LEFT JOIN pg_attrdef ad
+			ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		WHERE c.table_schema = $2 AND c.table_name = ANY($1)
+		ORDER BY c.table_name, c.ordinal_position
 	`
-	rows, err := p.db.Query(query, tableName)
+	rows, err := p.db.QueryContext(ctx, query, pq.Array(tableNames), schemaName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+		return fmt.Errorf("failed to get columns: %w", err)
 	}
 	defer rows.Close()
 
-	var columns []schema.Column
 	for rows.Next() {
+		var tableName string
 		var col schema.Column
 		var nullable string
 		var defaultValue sql.NullString
-
-		if err := rows.Scan(&col.Name, &col.Type, &nullable, &defaultValue, &col.Position); err != nil {
-			return nil, fmt.Errorf("failed to scan column: %w", err)
+		var collation sql.NullString
+		var identity sql.NullString
+		var precision sql.NullInt64
+		var udtName string
+		var generation sql.NullString
+
+		if err := rows.Scan(&tableName, &col.Name, &col.Type, &nullable, &defaultValue, &col.Position, &collation, &identity, &precision, &udtName, &generation); err != nil {
+			return fmt.Errorf("failed to scan column: %w", err)
 		}
 
 		col.Nullable = (nullable == "YES")
 		if defaultValue.Valid {
 			col.DefaultValue = &defaultValue.String
 		}
+		col.Type = withTimePrecision(col.Type, precision)
+		// Extension and custom types (hstore, geometry, enums) are reported
+		// as USER-DEFINED; the underlying type name is more useful
+		if col.Type == "USER-DEFINED" {
+			col.Type = udtName
+		}
+		// collation_name is only set when the column has an explicit collation
+		if collation.Valid {
+			col.Collation = collation.String
+		}
 
-		// Check for serial/identity columns (auto increment)
+		// Check for serial columns (auto increment)
 		if strings.Contains(strings.ToLower(defaultValue.String), "nextval") {
 			col.AutoIncrement = true
 		}
 
-		columns = append(columns, col)
+		// Identity columns have no nextval default; pg_attribute.attidentity
+		// is 'a' for GENERATED ALWAYS and 'd' for GENERATED BY DEFAULT
+		switch identity.String {
+		case "a":
+			col.Identity = "ALWAYS"
+			col.AutoIncrement = true
+		case "d":
+			col.Identity = "BY DEFAULT"
+			col.AutoIncrement = true
+		}
+
+		// pg_attribute.attgenerated (PostgreSQL 12 and later) is 's' for a
+		// stored generated column, whose expression pg_attrdef holds
+		if generation.Valid {
+			col.Generated = generation.String
+			col.Stored = true
+		}
+
+		if ts, ok := schemas[tableName]; ok {
+			ts.Columns = append(ts.Columns, col)
+		}
 	}
 
-	return columns, rows.Err()
+	return rows.Err()
 }
 
-func (p *Postgres) getIndexes(tableName string) ([]schema.Index, error) {
+// withTimePrecision adds a non-default fractional-second precision to a
+// time or timestamp type, e.g. "timestamp(0) without time zone". data_type
+// leaves it out, so a precision change would otherwise go unnoticed.
+func withTimePrecision(dataType string, precision sql.NullInt64) string {
+	if !precision.Valid || precision.Int64 == 6 {
+		return dataType
+	}
+	// Covers time and timestamp, with or without time zone
+	if !strings.HasPrefix(dataType, "time") {
+		return dataType
+	}
+	name, rest, _ := strings.Cut(dataType, " ")
+	if rest == "" {
+		return fmt.Sprintf("%s(%d)", name, precision.Int64)
+	}
+	return fmt.Sprintf("%s(%d) %s", name, precision.Int64, rest)
+}
+
+// getIndexes reads the indexes of relations of the given kind: "r" for
+// tables, "m" for materialized views
+func (p *Postgres) getIndexes(ctx context.Context, schemaName, relkind string, tableNames []string, schemas map[string]*schema.TableSchema) error {
 	query := `
 		SELECT
+			t.relname AS table_name,
 			i.relname AS index_name,
 			a.attname AS column_name,
 			ix.indisunique AS is_unique,
-			ix.indisprimary AS is_primary
+			ix.indisprimary AS is_primary,
+			ix.indisclustered AS is_clustered,
+			-- indoption covers only the key columns, not INCLUDE columns
+			COALESCE(k.ord <= ix.indnkeyatts AND (ix.indoption[k.ord - 1] & 1) = 1, false) AS is_descending,
+			COALESCE(obj_description(i.oid, 'pg_class'), '') AS comment
 		FROM pg_class t
 		JOIN pg_index ix ON t.oid = ix.indrelid
 		JOIN pg_class i ON i.oid = ix.indexrelid
-		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(ix.indkey)
-		WHERE t.relname = $1 AND t.relkind = 'r'
-		ORDER BY i.relname, a.attnum
+		CROSS JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE t.relname = ANY($1) AND t.relkind = $2 AND t.relnamespace = $3::regnamespace
+		ORDER BY t.relname, i.relname, k.ord
 	`
-	rows, err := p.db.Query(query, tableName)
+	rows, err := p.db.QueryContext(ctx, query, pq.Array(tableNames), relkind, schemaName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get indexes: %w", err)
+		return fmt.Errorf("failed to get indexes: %w", err)
 	}
 	defer rows.Close()
 
-	indexMap := make(map[string]*schema.Index)
+	indexes := newIndexCollector()
 	for rows.Next() {
-		var indexName, columnName string
-		var isUnique, isPrimary bool
-
-		if err := rows.Scan(&indexName, &columnName, &isUnique, &isPrimary); err != nil {
-			return nil, fmt.Errorf("failed to scan index: %w", err)
-		}
-
-		if idx, exists := indexMap[indexName]; exists {
-			idx.Columns = append(idx.Columns, columnName)
-		} else {
-			indexMap[indexName] = &schema.Index{
-				Name:    indexName,
-				Columns: []string{columnName},
-				Unique:  isUnique,
-				Primary: isPrimary,
-				Type:    "BTREE", // PostgreSQL default
-			}
+		var tableName, indexName, columnName string
+		var isUnique, isPrimary, isClustered, isDescending bool
+		var comment string
+
+		if err := rows.Scan(&tableName, &indexName, &columnName, &isUnique, &isPrimary, &isClustered, &isDescending, &comment); err != nil {
+			return fmt.Errorf("failed to scan index: %w", err)
 		}
-	}
 
-	var indexes []schema.Index
-	for _, idx := range indexMap {
-		indexes = append(indexes, *idx)
+		indexes.add(tableName, schema.Index{
+			Name:      indexName,
+			Unique:    isUnique,
+			Primary:   isPrimary,
+			Type:      "BTREE", // PostgreSQL default
+			Clustered: isClustered,
+			Comment:   comment,
+		}, columnName, isDescending)
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	return indexes, rows.Err()
+	indexes.store(schemas)
+	return nil
 }
 
-func (p *Postgres) getForeignKeys(tableName string) ([]schema.ForeignKey, error) {
+func (p *Postgres) getForeignKeys(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
 	query := `
 		SELECT
+			tc.table_name,
 			tc.constraint_name,
 			kcu.column_name,
 			ccu.table_name AS referenced_table,
 			ccu.column_name AS referenced_column,
 			rc.update_rule,
-			rc.delete_rule
+			rc.delete_rule,
+			COALESCE(obj_description(c.oid, 'pg_constraint'), '') AS comment,
+			tc.is_deferrable = 'YES',
+			tc.initially_deferred = 'YES',
+			COALESCE(NOT c.convalidated, false) AS not_valid
 		FROM information_schema.table_constraints tc
+		-- Constraint names are unique per table only
+		LEFT JOIN pg_constraint c
+			ON c.conname = tc.constraint_name
+			AND c.conrelid = (quote_ident($2) || '.' || quote_ident(tc.table_name))::regclass
 		JOIN information_schema.key_column_usage kcu
 			ON tc.constraint_name = kcu.constraint_name
 			AND tc.table_schema = kcu.table_schema
@@ -223,48 +423,284 @@ func (p *Postgres) getForeignKeys(tableName string) ([]schema.ForeignKey, error)
 		JOIN information_schema.referential_constraints rc
 			ON rc.constraint_name = tc.constraint_name
 		WHERE tc.constraint_type = 'FOREIGN KEY'
-			AND tc.table_schema = 'public'
-			AND tc.table_name = $1
+			AND tc.table_schema = $2
+			AND tc.table_name = ANY($1)
 	`
-	rows, err := p.db.Query(query, tableName)
+	rows, err := p.db.QueryContext(ctx, query, pq.Array(tableNames), schemaName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get foreign keys: %w", err)
+		return fmt.Errorf("failed to get foreign keys: %w", err)
 	}
 	defer rows.Close()
 
-	var foreignKeys []schema.ForeignKey
 	for rows.Next() {
+		var tableName string
 		var fk schema.ForeignKey
 
-		if err := rows.Scan(&fk.Name, &fk.Column, &fk.ReferencedTable, &fk.ReferencedColumn, &fk.OnUpdate, &fk.OnDelete); err != nil {
-			return nil, fmt.Errorf("failed to scan foreign key: %w", err)
+		if err := rows.Scan(&tableName, &fk.Name, &fk.Column, &fk.ReferencedTable, &fk.ReferencedColumn, &fk.OnUpdate, &fk.OnDelete, &fk.Comment, &fk.Deferrable, &fk.InitiallyDeferred, &fk.NotValid); err != nil {
+			return fmt.Errorf("failed to scan foreign key: %w", err)
 		}
 
-		foreignKeys = append(foreignKeys, fk)
+		if ts, ok := schemas[tableName]; ok {
+			ts.ForeignKeys = append(ts.ForeignKeys, fk)
+		}
+	}
+
+	return rows.Err()
+}
+
+// getAutoIncrements reads the next value of the sequence owned by each
+// table's serial or identity column
+func (p *Postgres) getAutoIncrements(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	query := `
+		SELECT
+			t.relname,
+			COALESCE(s.last_value + s.increment_by, s.start_value)
+		FROM pg_sequences s
+		JOIN pg_class seq ON seq.relname = s.sequencename AND seq.relnamespace = $2::regnamespace
+		JOIN pg_depend d
+			ON d.objid = seq.oid
+			AND d.classid = 'pg_class'::regclass
+			AND d.refclassid = 'pg_class'::regclass
+		JOIN pg_class t ON t.oid = d.refobjid
+		WHERE s.schemaname = $2 AND t.relname = ANY($1)
+	`
+	rows, err := p.db.QueryContext(ctx, query, pq.Array(tableNames), schemaName)
+	if err != nil {
+		return fmt.Errorf("failed to get sequence values: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName string
+		var next int64
+		if err := rows.Scan(&tableName, &next); err != nil {
+			return fmt.Errorf("failed to scan sequence value: %w", err)
+		}
+		if ts, ok := schemas[tableName]; ok {
+			ts.AutoIncrement = next
+		}
+	}
+
+	return rows.Err()
+}
+
+// getChecks reads the CHECK constraints of each table. NOT NULL constraints,
+// which PostgreSQL 18 also stores in pg_constraint, have their own contype.
+func (p *Postgres) getChecks(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	query := `
+		SELECT rel.relname, con.conname, pg_get_constraintdef(con.oid), NOT con.convalidated
+		FROM pg_constraint con
+		JOIN pg_class rel ON rel.oid = con.conrelid
+		WHERE con.contype = 'c'
+			AND rel.relnamespace = $2::regnamespace
+			AND rel.relname = ANY($1)
+		ORDER BY rel.relname, con.conname
+	`
+	rows, err := p.db.QueryContext(ctx, query, pq.Array(tableNames), schemaName)
+	if err != nil {
+		return fmt.Errorf("failed to get check constraints: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName, definition string
+		var check schema.CheckConstraint
+		if err := rows.Scan(&tableName, &check.Name, &definition, &check.NotValid); err != nil {
+			return fmt.Errorf("failed to scan check constraint: %w", err)
+		}
+		definition = strings.TrimSuffix(definition, " NOT VALID")
+		definition = strings.TrimSuffix(definition, " NO INHERIT")
+		check.Expression = unwrapParens(strings.TrimPrefix(definition, "CHECK "))
+		if ts, ok := schemas[tableName]; ok {
+			ts.Checks = append(ts.Checks, check)
+		}
+	}
+
+	return rows.Err()
+}
+
+// getRules reads the rewrite rules of each table
+func (p *Postgres) getRules(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	query := `
+		SELECT tablename, rulename, definition
+		FROM pg_rules
+		WHERE schemaname = $2 AND tablename = ANY($1)
+		ORDER BY tablename, rulename
+	`
+	rows, err := p.db.QueryContext(ctx, query, pq.Array(tableNames), schemaName)
+	if err != nil {
+		return fmt.Errorf("failed to get rules: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName string
+		var rule schema.Rule
+		if err := rows.Scan(&tableName, &rule.Name, &rule.Definition); err != nil {
+			return fmt.Errorf("failed to scan rule: %w", err)
+		}
+		if ts, ok := schemas[tableName]; ok {
+			ts.Rules = append(ts.Rules, rule)
+		}
+	}
+
+	return rows.Err()
+}
+
+// getPartitions reads the partition key and the attached partitions of
+// partitioned tables
+func (p *Postgres) getPartitions(ctx context.Context, schemaName string, tableNames []string, schemas map[string]*schema.TableSchema) error {
+	query := `
+		SELECT
+			parent.relname,
+			pg_get_partkeydef(parent.oid),
+			COALESCE(child.relname, ''),
+			COALESCE(pg_get_expr(child.relpartbound, child.oid), '')
+		FROM pg_class parent
+		LEFT JOIN pg_inherits i ON i.inhparent = parent.oid
+		LEFT JOIN pg_class child ON child.oid = i.inhrelid
+		WHERE parent.relkind = 'p'
+			AND parent.relnamespace = $2::regnamespace
+			AND parent.relname = ANY($1)
+		ORDER BY parent.relname, child.relname
+	`
+	rows, err := p.db.QueryContext(ctx, query, pq.Array(tableNames), schemaName)
+	if err != nil {
+		return fmt.Errorf("failed to get partitions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName, key string
+		var partition schema.Partition
+		if err := rows.Scan(&tableName, &key, &partition.Name, &partition.Bound); err != nil {
+			return fmt.Errorf("failed to scan partition: %w", err)
+		}
+		ts, ok := schemas[tableName]
+		if !ok {
+			continue
+		}
+		if ts.Partitioning == nil {
+			// pg_get_partkeydef returns e.g. "RANGE (created_at)"
+			method, expression, _ := strings.Cut(key, " ")
+			ts.Partitioning = &schema.Partitioning{
+				Method:     method,
+				Expression: strings.TrimSuffix(strings.TrimPrefix(expression, "("), ")"),
+			}
+		}
+		if partition.Name != "" {
+			ts.Partitioning.Partitions = append(ts.Partitioning.Partitions, partition)
+		}
 	}
 
-	return foreignKeys, rows.Err()
+	return rows.Err()
+}
+
+// GetMaterializedViews retrieves the materialized views of the public
+// schema with their indexes
+func (p *Postgres) GetMaterializedViews(ctx context.Context) ([]*schema.MaterializedView, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT matviewname, definition
+		FROM pg_matviews
+		WHERE schemaname = 'public'
+		ORDER BY matviewname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get materialized views: %w", err)
+	}
+	defer rows.Close()
+
+	var views []*schema.MaterializedView
+	var names []string
+	for rows.Next() {
+		view := &schema.MaterializedView{}
+		if err := rows.Scan(&view.Name, &view.Definition); err != nil {
+			return nil, fmt.Errorf("failed to scan materialized view: %w", err)
+		}
+		// pg_get_viewdef ends the query with a semicolon
+		view.Definition = strings.TrimSuffix(strings.TrimSpace(view.Definition), ";")
+		views = append(views, view)
+		names = append(names, view.Name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(views) == 0 {
+		return nil, nil
+	}
+
+	// Indexes are collected the same way as for tables
+	indexed := newTableSchemas(names)
+	if err := p.getIndexes(ctx, "public", "m", names, indexed); err != nil {
+		return nil, err
+	}
+	for _, view := range views {
+		view.Indexes = indexed[view.Name].Indexes
+	}
+	return views, nil
+}
+
+// CountRows counts the rows of a table matching where
+func (p *Postgres) CountRows(ctx context.Context, tableName string, where string) (int64, error) {
+	query := "SELECT COUNT(*) FROM " + p.tableRef(tableName)
+	if where != "" {
+		query += " WHERE " + where
+	}
+
+	var count int64
+	if err := p.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
 }
 
 // GetTableData retrieves all data from a table
-func (p *Postgres) GetTableData(tableName string, limit int) ([]schema.Row, error) {
-	query := fmt.Sprintf("SELECT * FROM \"%s\"", tableName)
-	if limit > 0 {
-		query = fmt.Sprintf("%s LIMIT %d", query, limit)
+func (p *Postgres) GetTableData(ctx context.Context, tableName string, opts DataOptions) ([]schema.Row, error) {
+	var data []schema.Row
+	err := p.StreamTableData(ctx, tableName, opts, func(row schema.Row) error {
+		data = append(data, row)
+		return nil
+	})
+	return data, err
+}
+
+// StreamTableData reads a table's rows and passes each one to fn as it is
+// read, stopping at the first error fn returns
+func (p *Postgres) StreamTableData(ctx context.Context, tableName string, opts DataOptions, fn func(schema.Row) error) error {
+	query := "SELECT * FROM " + p.tableRef(tableName)
+	var args []interface{}
+	var conditions []string
+	if opts.Range != nil {
+		conditions = append(conditions, fmt.Sprintf("\"%s\" BETWEEN $1 AND $2", opts.Range.Column))
+		args = append(args, opts.Range.From, opts.Range.To)
+	}
+	if opts.Where != "" {
+		conditions = append(conditions, "("+opts.Where+")")
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if opts.OrderBy != nil {
+		query = fmt.Sprintf("%s ORDER BY \"%s\"", query, opts.OrderBy.Column)
+		if opts.OrderBy.Descending {
+			query += " DESC"
+		}
+	}
+	if opts.Limit > 0 {
+		query = fmt.Sprintf("%s LIMIT %d", query, opts.Limit)
 	}
 
-	rows, err := p.db.Query(query)
+	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get table data: %w", err)
+		return fmt.Errorf("failed to get table data: %w", err)
 	}
 	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+		return fmt.Errorf("failed to get columns: %w", err)
 	}
 
-	var data []schema.Row
 	for rows.Next() {
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
@@ -273,7 +709,7 @@ func (p *Postgres) GetTableData(tableName string, limit int) ([]schema.Row, erro
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+			return fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		row := make(schema.Row)
@@ -285,9 +721,14 @@ func (p *Postgres) GetTableData(tableName string, limit int) ([]schema.Row, erro
 				row[col] = val
 			}
 		}
+		if p.config.IncludeSystemTables {
+			omitCredentials(tableName, row)
+		}
 
-		data = append(data, row)
+		if err := fn(row); err != nil {
+			return err
+		}
 	}
 
-	return data, rows.Err()
+	return rows.Err()
 }
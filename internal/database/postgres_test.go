@@ -0,0 +1,41 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestWithTimePrecision(t *testing.T) {
+	tests := []struct {
+		dataType  string
+		precision sql.NullInt64
+		want      string
+	}{
+		{"timestamp without time zone", sql.NullInt64{Int64: 0, Valid: true}, "timestamp(0) without time zone"},
+		{"timestamp without time zone", sql.NullInt64{Int64: 6, Valid: true}, "timestamp without time zone"},
+		{"timestamp with time zone", sql.NullInt64{Int64: 3, Valid: true}, "timestamp(3) with time zone"},
+		{"time", sql.NullInt64{Int64: 0, Valid: true}, "time(0)"},
+		{"date", sql.NullInt64{Int64: 0, Valid: true}, "date"},
+		{"integer", sql.NullInt64{}, "integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := withTimePrecision(tt.dataType, tt.precision); got != tt.want {
+				t.Errorf("withTimePrecision(%q, %v) = %q, want %q", tt.dataType, tt.precision.Int64, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresReadOnlyDSN(t *testing.T) {
+	config := Config{User: "app", Password: "secret", Host: "db", Port: "5432", Database: "shop"}
+	if got := NewPostgres(config).dsn(); strings.Contains(got, "read_only") {
+		t.Errorf("dsn() = %q, want no read-only parameter", got)
+	}
+	config.ReadOnly = true
+	want := "host=db port=5432 user=app password=secret dbname=shop sslmode=disable default_transaction_read_only=on"
+	if got := NewPostgres(config).dsn(); got != want {
+		t.Errorf("dsn() = %q, want %q", got, want)
+	}
+}
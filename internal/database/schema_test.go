@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// countingDriver counts the queries it answers: a query containing a key of
+// answers with its rows, a COUNT(*) with 0, and any other query with no
+// rows. It keeps the last query it was sent.
+type countingDriver struct {
+	queries atomic.Int64
+	last    atomic.Pointer[string]
+	answers map[string][][]driver.Value
+}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	return &countingConn{driver: d}, nil
+}
+
+type countingConn struct {
+	driver *countingDriver
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *countingConn) Close() error              { return nil }
+func (c *countingConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.driver.queries.Add(1)
+	c.driver.last.Store(&query)
+	for key, values := range c.driver.answers {
+		if strings.Contains(query, key) {
+			return &rows{values: values}, nil
+		}
+	}
+	if strings.Contains(query, "COUNT(*)") {
+		return &rows{values: [][]driver.Value{{int64(0)}}}, nil
+	}
+	return &rows{}, nil
+}
+
+// rows returns values one row at a time
+type rows struct {
+	values [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	if len(r.values) == 0 {
+		return nil
+	}
+	return make([]string, len(r.values[0]))
+}
+
+func (r *rows) Close() error { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var counting = &countingDriver{}
+
+func init() {
+	sql.Register("dbdiff-counting", counting)
+}
+
+func TestGetTableSchemasQueryCount(t *testing.T) {
+	db, err := sql.Open("dbdiff-counting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tables := func(n int) []string {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf("t%d", i)
+		}
+		return names
+	}
+	tests := []struct {
+		name string
+		get  func([]string) error
+	}{
+		{name: "mysql", get: func(names []string) error {
+			_, err := (&MySQL{config: Config{Database: "app"}, db: db}).GetTableSchemas(context.Background(), names)
+			return err
+		}},
+		{name: "postgres", get: func(names []string) error {
+			_, err := (&Postgres{db: db}).GetTableSchemas(context.Background(), names)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The batched queries don't grow with the number of tables
+			count := func(n int) int64 {
+				before := counting.queries.Load()
+				if err := tt.get(tables(n)); err != nil {
+					t.Fatalf("GetTableSchemas() error = %v", err)
+				}
+				return counting.queries.Load() - before
+			}
+			one, many := count(1), count(50)
+			if one == 0 || many != one {
+				t.Errorf("queries for 1 table = %d, for 50 tables = %d, want the same", one, many)
+			}
+		})
+	}
+}
+
+func TestStreamTableDataOrderBy(t *testing.T) {
+	db, err := sql.Open("dbdiff-counting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mysql := &MySQL{config: Config{Database: "app"}, db: db}
+	postgres := &Postgres{db: db}
+	tests := []struct {
+		name string
+		db   Database
+		opts DataOptions
+		want string
+	}{
+		{name: "mysql", db: mysql, opts: DataOptions{OrderBy: &OrderBy{Column: "created_at"}},
+			want: "SELECT * FROM `orders` ORDER BY `created_at`"},
+		{name: "mysql descending with limit", db: mysql, opts: DataOptions{OrderBy: &OrderBy{Column: "created_at", Descending: true}, Limit: 10},
+			want: "SELECT * FROM `orders` ORDER BY `created_at` DESC LIMIT 10"},
+		{name: "postgres", db: postgres, opts: DataOptions{OrderBy: &OrderBy{Column: "created_at"}},
+			want: `SELECT * FROM "orders" ORDER BY "created_at"`},
+		{name: "postgres descending with filter", db: postgres, opts: DataOptions{OrderBy: &OrderBy{Column: "created_at", Descending: true}, Where: "total > 0"},
+			want: `SELECT * FROM "orders" WHERE (total > 0) ORDER BY "created_at" DESC`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.db.StreamTableData(context.Background(), "orders", tt.opts, func(row schema.Row) error { return nil })
+			if err != nil {
+				t.Fatalf("StreamTableData() error = %v", err)
+			}
+			if got := *counting.last.Load(); got != tt.want {
+				t.Errorf("query = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMySQLForeignKeys(t *testing.T) {
+	db, err := sql.Open("dbdiff-counting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	counting.answers = map[string][][]driver.Value{"REFERENTIAL_CONSTRAINTS": {
+		{"order_items", "fk_items_order", "order_id", "orders", "id", "CASCADE", "NO ACTION"},
+		{"order_items", "fk_items_product", "product_id", "products", "id", "RESTRICT", "CASCADE"},
+		{"order_items", "fk_items_variant", "product_id", "variants", "product_id", "SET NULL", "NO ACTION"},
+		{"order_items", "fk_items_variant", "variant_no", "variants", "variant_no", "SET NULL", "NO ACTION"},
+	}}
+	defer func() { counting.answers = nil }()
+
+	schemas := newTableSchemas([]string{"order_items"})
+	before := counting.queries.Load()
+	if err := (&MySQL{db: db}).getForeignKeys(context.Background(), "app", []string{"order_items"}, schemas); err != nil {
+		t.Fatalf("getForeignKeys() error = %v", err)
+	}
+	if queries := counting.queries.Load() - before; queries != 1 {
+		t.Errorf("queries = %d, want 1", queries)
+	}
+	want := []schema.ForeignKey{
+		{Name: "fk_items_order", Column: "order_id", ReferencedTable: "orders", ReferencedColumn: "id", OnDelete: "CASCADE", OnUpdate: "NO ACTION"},
+		{Name: "fk_items_product", Column: "product_id", ReferencedTable: "products", ReferencedColumn: "id", OnDelete: "RESTRICT", OnUpdate: "CASCADE"},
+		{Name: "fk_items_variant", Column: "product_id", ReferencedTable: "variants", ReferencedColumn: "product_id", OnDelete: "SET NULL", OnUpdate: "NO ACTION"},
+		{Name: "fk_items_variant", Column: "variant_no", ReferencedTable: "variants", ReferencedColumn: "variant_no", OnDelete: "SET NULL", OnUpdate: "NO ACTION"},
+	}
+	if got := schemas["order_items"].ForeignKeys; !reflect.DeepEqual(got, want) {
+		t.Errorf("foreign keys = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SSL modes accepted in DB_SSLMODE, with PostgreSQL's meanings. The
+// PostgreSQL driver does not implement allow and prefer, so they are
+// accepted for MySQL only.
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       false,
+	"prefer":      false,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// mysqlTLSConfigName is the name the custom TLS configuration is registered
+// under with the MySQL driver
+const mysqlTLSConfigName = "dbdiff"
+
+// checkSSLMode reports an error for a DB_SSLMODE value the driver of the
+// database type does not support
+func checkSSLMode(dbType, mode string) error {
+	if mode == "" {
+		return nil
+	}
+	postgres, ok := sslModes[mode]
+	if !ok {
+		return fmt.Errorf("unsupported DB_SSLMODE %q (expected disable, allow, prefer, require, verify-ca or verify-full)", mode)
+	}
+	if !postgres && NormalizeType(dbType) == "postgres" {
+		return fmt.Errorf("unsupported DB_SSLMODE %q for PostgreSQL (expected disable, require, verify-ca or verify-full)", mode)
+	}
+	return nil
+}
+
+// mysqlTLSParam returns the MySQL driver's tls parameter for the configured
+// SSL mode, or "" to connect without TLS. A CA certificate, or verify-ca,
+// needs a TLS configuration of its own, which is registered with the driver.
+func mysqlTLSParam(config Config) (string, error) {
+	mode := config.SSLMode
+	if config.SSLRootCert != "" && mode == "require" {
+		// As in libpq, a root certificate makes require verify the CA
+		mode = "verify-ca"
+	}
+
+	switch mode {
+	case "", "disable":
+		return "", nil
+	case "allow", "prefer":
+		return "preferred", nil
+	case "require":
+		return "skip-verify", nil
+	}
+
+	// verify-ca or verify-full
+	if mode == "verify-full" && config.SSLRootCert == "" {
+		return "true", nil
+	}
+	tlsConfig := &tls.Config{ServerName: config.Host}
+	if config.SSLRootCert != "" {
+		pem, err := os.ReadFile(config.SSLRootCert)
+		if err != nil {
+			return "", fmt.Errorf("failed to read DB_SSLROOTCERT: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("no certificates found in DB_SSLROOTCERT %s", config.SSLRootCert)
+		}
+	}
+	if mode == "verify-ca" {
+		// Verify the certificate chain but not the host name
+		roots := tlsConfig.RootCAs
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, roots)
+		}
+	}
+	if err := mysql.RegisterTLSConfig(mysqlTLSConfigName, tlsConfig); err != nil {
+		return "", fmt.Errorf("failed to register TLS config: %w", err)
+	}
+	return mysqlTLSConfigName, nil
+}
+
+// verifyChain verifies a server certificate chain against roots (the system
+// pool when nil) without checking the host name
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("server sent no certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse server certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
@@ -0,0 +1,52 @@
+package database
+
+import "testing"
+
+func TestCheckSSLMode(t *testing.T) {
+	tests := []struct {
+		dbType  string
+		mode    string
+		wantErr bool
+	}{
+		{"postgres", "", false},
+		{"postgres", "require", false},
+		{"PostgreSQL", "verify-full", false},
+		{"postgres", "prefer", true},
+		{"postgres", "allow", true},
+		{"mysql", "prefer", false},
+		{"mysql", "allow", false},
+		{"mysql", "verify-ca", false},
+		{"mysql", "sometimes", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dbType+"/"+tt.mode, func(t *testing.T) {
+			if err := checkSSLMode(tt.dbType, tt.mode); (err != nil) != tt.wantErr {
+				t.Errorf("checkSSLMode(%q, %q) error = %v, wantErr %v", tt.dbType, tt.mode, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMySQLTLSParam(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", ""},
+		{"disable", ""},
+		{"prefer", "preferred"},
+		{"require", "skip-verify"},
+		{"verify-full", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := mysqlTLSParam(Config{Type: "mysql", Host: "db.example.com", SSLMode: tt.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("mysqlTLSParam(%q) = %q, want %q", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
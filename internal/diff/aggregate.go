@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// SnapshotPair is a baseline snapshot and one environment's snapshot to
+// compare with it
+type SnapshotPair struct {
+	Name     string // environment name used as the matrix column
+	Baseline *snapshot.Snapshot
+	Target   *snapshot.Snapshot
+}
+
+// AggregateResult holds the comparisons of several snapshot pairs
+type AggregateResult struct {
+	Environments []string      // pair names, in the order given
+	Results      []*DiffResult // comparison per environment, by index in Environments
+	Tables       []string      // tables that differ in any environment, sorted
+}
+
+// Aggregate compares each pair and collects which tables differ where
+func Aggregate(pairs []SnapshotPair, opts Options) *AggregateResult {
+	agg := &AggregateResult{}
+
+	tables := make(map[string]bool)
+	for _, pair := range pairs {
+		result := Compare(pair.Baseline, pair.Target, opts)
+		agg.Environments = append(agg.Environments, pair.Name)
+		agg.Results = append(agg.Results, result)
+		for tableName := range result.SchemaDiffs {
+			tables[tableName] = true
+		}
+		for tableName := range result.DataDiffs {
+			tables[tableName] = true
+		}
+	}
+
+	agg.Tables = SortedKeys(tables)
+	return agg
+}
+
+// Cell summarizes how a table differs in the environment at index env:
+// "schema", "data", "schema+data", or "" when it matches the baseline
+func (a *AggregateResult) Cell(env int, tableName string) string {
+	result := a.Results[env]
+	_, schemaChanged := result.SchemaDiffs[tableName]
+	_, dataChanged := result.DataDiffs[tableName]
+	switch {
+	case schemaChanged && dataChanged:
+		return "schema+data"
+	case schemaChanged:
+		return "schema"
+	case dataChanged:
+		return "data"
+	default:
+		return ""
+	}
+}
+
+// DisplayMatrix writes a grid of the tables that differ (rows) by
+// environment (columns). Matching cells are shown as "-".
+func DisplayMatrix(agg *AggregateResult, w io.Writer) {
+	if len(agg.Tables) == 0 {
+		fmt.Fprintln(w, "No differences found.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "TABLE")
+	for _, env := range agg.Environments {
+		fmt.Fprintf(tw, "\t%s", env)
+	}
+	fmt.Fprintln(tw)
+
+	for _, tableName := range agg.Tables {
+		fmt.Fprint(tw, tableName)
+		for env := range agg.Environments {
+			cell := agg.Cell(env, tableName)
+			if cell == "" {
+				cell = "-"
+			}
+			fmt.Fprintf(tw, "\t%s", cell)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	// Per-environment totals help spot the environment furthest from baseline
+	fmt.Fprintln(w)
+	envs := make([]int, len(agg.Environments))
+	for i := range envs {
+		envs[i] = i
+	}
+	sort.SliceStable(envs, func(i, j int) bool { return agg.differing(envs[i]) > agg.differing(envs[j]) })
+	for _, env := range envs {
+		fmt.Fprintf(w, "%s: %d table(s) differ\n", agg.Environments[env], agg.differing(env))
+	}
+}
+
+func (a *AggregateResult) differing(env int) int {
+	n := 0
+	for _, tableName := range a.Tables {
+		if a.Cell(env, tableName) != "" {
+			n++
+		}
+	}
+	return n
+}
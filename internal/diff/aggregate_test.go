@@ -0,0 +1,62 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestAggregateCells(t *testing.T) {
+	snap := func(tables ...string) *snapshot.Snapshot {
+		s := &snapshot.Snapshot{Metadata: map[string]string{}, Tables: map[string]*schema.Table{}}
+		for _, name := range tables {
+			s.Tables[name] = &schema.Table{Schema: schema.TableSchema{Name: name, Columns: []schema.Column{{Name: "id", Type: "int"}},
+				Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}}
+		}
+		return s
+	}
+	baseline := snap("users")
+	tests := []struct {
+		name  string
+		pairs []SnapshotPair
+		want  [][]string // cells per environment, by table
+	}{
+		{
+			name: "distinct names",
+			pairs: []SnapshotPair{
+				{Name: "staging", Baseline: baseline, Target: snap("users", "orders")},
+				{Name: "prod", Baseline: baseline, Target: snap("users")},
+			},
+			want: [][]string{{"schema"}, {""}},
+		},
+		{
+			name: "same name",
+			pairs: []SnapshotPair{
+				{Name: "prod", Baseline: baseline, Target: snap("users", "orders")},
+				{Name: "prod", Baseline: baseline, Target: snap("users")},
+			},
+			want: [][]string{{"schema"}, {""}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg := Aggregate(tt.pairs, Options{})
+			if !reflect.DeepEqual(agg.Tables, []string{"orders"}) {
+				t.Fatalf("Tables = %v, want [orders]", agg.Tables)
+			}
+			var got [][]string
+			for env := range agg.Environments {
+				var cells []string
+				for _, tableName := range agg.Tables {
+					cells = append(cells, agg.Cell(env, tableName))
+				}
+				got = append(got, cells)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cells = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// Allowlist declares differences that are expected between two environments,
+// such as feature-flag or configuration tables. It is read from a file with
+// one entry per line:
+//
+//	table <table>            any schema or data difference in the table
+//	column <table>.<column>  schema changes to a single column
+//	data <table>             any data difference in the table
+//	row <table> <pk>         data differences in one row, by primary key
+//	                         (comma-separated for composite keys)
+//
+// Blank lines and lines starting with # are ignored.
+type Allowlist struct {
+	tables  map[string]bool
+	columns map[string]bool
+	data    map[string]bool
+	rows    map[string]map[string]bool
+}
+
+// LoadAllowlist reads an allowlist file
+func LoadAllowlist(path string) (*Allowlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open allowlist: %w", err)
+	}
+	defer f.Close()
+
+	a := &Allowlist{
+		tables:  make(map[string]bool),
+		columns: make(map[string]bool),
+		data:    make(map[string]bool),
+		rows:    make(map[string]map[string]bool),
+	}
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "table" && len(fields) == 2:
+			a.tables[fields[1]] = true
+		case fields[0] == "column" && len(fields) == 2 && strings.Contains(fields[1], "."):
+			a.columns[fields[1]] = true
+		case fields[0] == "data" && len(fields) == 2:
+			a.data[fields[1]] = true
+		case fields[0] == "row" && len(fields) == 3:
+			if a.rows[fields[1]] == nil {
+				a.rows[fields[1]] = make(map[string]bool)
+			}
+			a.rows[fields[1]][fields[2]] = true
+		default:
+			return nil, fmt.Errorf("%s:%d: invalid allowlist entry %q", path, lineNo, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read allowlist: %w", err)
+	}
+
+	return a, nil
+}
+
+// HasRows reports whether the allowlist has row entries
+func (a *Allowlist) HasRows() bool {
+	return len(a.rows) > 0
+}
+
+// Filter splits a diff result into the differences not covered by the
+// allowlist and the expected ones that are
+func (a *Allowlist) Filter(result *DiffResult) (remaining, expected *DiffResult) {
+	remaining = &DiffResult{SchemaDiffs: make(map[string]*SchemaDiff), DataDiffs: make(map[string]*DataDiff), TableOrder: result.TableOrder,
+		MaterializedViewDiffs: result.MaterializedViewDiffs, MaterializedViews: result.MaterializedViews, ShowRows: result.ShowRows, HintSplits: result.HintSplits}
+	expected = &DiffResult{SchemaDiffs: make(map[string]*SchemaDiff), DataDiffs: make(map[string]*DataDiff), TableOrder: result.TableOrder, ShowRows: result.ShowRows}
+
+	for tableName, schemaDiff := range result.SchemaDiffs {
+		if a.tables[tableName] {
+			expected.SchemaDiffs[tableName] = schemaDiff
+			continue
+		}
+		kept, allowed := a.filterColumns(schemaDiff)
+		if kept != nil {
+			remaining.SchemaDiffs[tableName] = kept
+		}
+		if allowed != nil {
+			expected.SchemaDiffs[tableName] = allowed
+		}
+	}
+
+	for tableName, dataDiff := range result.DataDiffs {
+		if a.tables[tableName] || a.data[tableName] {
+			expected.DataDiffs[tableName] = dataDiff
+			continue
+		}
+		kept, allowed := a.filterRows(dataDiff)
+		if kept != nil {
+			remaining.DataDiffs[tableName] = kept
+		}
+		if allowed != nil {
+			expected.DataDiffs[tableName] = allowed
+		}
+	}
+
+	return remaining, expected
+}
+
+// filterColumns splits the column changes of a MODIFY diff by the column entries
+func (a *Allowlist) filterColumns(schemaDiff *SchemaDiff) (kept, allowed *SchemaDiff) {
+	if schemaDiff.Action != ActionModify {
+		return schemaDiff, nil
+	}
+
+	keptDiff := *schemaDiff
+	allowedDiff := *schemaDiff
+	keptDiff.ColumnChanges = nil
+	allowedDiff.ColumnChanges = nil
+	allowedDiff.IndexChanges = nil
+	allowedDiff.ForeignKeyChanges = nil
+	allowedDiff.RuleChanges = nil
+	allowedDiff.CheckChanges = nil
+	allowedDiff.PartitionChanges = nil
+	allowedDiff.AutoIncrementChanged = false
+	allowedDiff.SystemVersioningChanged = false
+	allowedDiff.PartitioningChanged = false
+	allowedDiff.ColumnOrderChanged = false
+
+	for _, change := range schemaDiff.ColumnChanges {
+		if a.columns[schemaDiff.TableName+"."+change.ColumnName] {
+			allowedDiff.ColumnChanges = append(allowedDiff.ColumnChanges, change)
+		} else {
+			keptDiff.ColumnChanges = append(keptDiff.ColumnChanges, change)
+		}
+	}
+
+	if len(allowedDiff.ColumnChanges) == 0 {
+		return schemaDiff, nil
+	}
+	if len(keptDiff.ColumnChanges) == 0 && len(keptDiff.IndexChanges) == 0 && len(keptDiff.ForeignKeyChanges) == 0 && len(keptDiff.RuleChanges) == 0 && len(keptDiff.CheckChanges) == 0 && len(keptDiff.PartitionChanges) == 0 && !keptDiff.AutoIncrementChanged && !keptDiff.SystemVersioningChanged && !keptDiff.PartitioningChanged && !keptDiff.ColumnOrderChanged {
+		return nil, &allowedDiff
+	}
+	return &keptDiff, &allowedDiff
+}
+
+// filterRows splits a data diff by the row entries for its table
+func (a *Allowlist) filterRows(dataDiff *DataDiff) (kept, allowed *DataDiff) {
+	keys := a.rows[dataDiff.TableName]
+	if len(keys) == 0 || dataDiff.Schema == nil {
+		return dataDiff, nil
+	}
+	pkColumns := dataDiff.Schema.PrimaryKeyColumns()
+	if len(pkColumns) == 0 {
+		return dataDiff, nil
+	}
+	isAllowed := func(row schema.Row) bool {
+		return keys[allowlistKey(row, pkColumns)]
+	}
+
+	keptDiff := &DataDiff{TableName: dataDiff.TableName, Schema: dataDiff.Schema}
+	allowedDiff := &DataDiff{TableName: dataDiff.TableName, Schema: dataDiff.Schema}
+
+	for _, row := range dataDiff.RowsAdded {
+		if isAllowed(row) {
+			allowedDiff.RowsAdded = append(allowedDiff.RowsAdded, row)
+		} else {
+			keptDiff.RowsAdded = append(keptDiff.RowsAdded, row)
+		}
+	}
+	for _, row := range dataDiff.RowsDeleted {
+		if isAllowed(row) {
+			allowedDiff.RowsDeleted = append(allowedDiff.RowsDeleted, row)
+		} else {
+			keptDiff.RowsDeleted = append(keptDiff.RowsDeleted, row)
+		}
+	}
+	for _, mod := range dataDiff.RowsModified {
+		if isAllowed(mod.NewRow) {
+			allowedDiff.RowsModified = append(allowedDiff.RowsModified, mod)
+		} else {
+			keptDiff.RowsModified = append(keptDiff.RowsModified, mod)
+		}
+	}
+
+	if isEmptyDataDiff(allowedDiff) {
+		return dataDiff, nil
+	}
+	if isEmptyDataDiff(keptDiff) {
+		return nil, allowedDiff
+	}
+	return keptDiff, allowedDiff
+}
+
+// allowlistKey formats a row's primary key the way it is written in an allowlist
+func allowlistKey(row schema.Row, pkColumns []string) string {
+	parts := make([]string, len(pkColumns))
+	for i, col := range pkColumns {
+		parts[i] = fmt.Sprintf("%v", row[col])
+	}
+	return strings.Join(parts, ",")
+}
+
+func isEmptyDataDiff(d *DataDiff) bool {
+	return len(d.RowsAdded) == 0 && len(d.RowsDeleted) == 0 && len(d.RowsModified) == 0
+}
@@ -0,0 +1,93 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestAllowlistHasRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries string
+		want    bool
+	}{
+		{name: "empty", entries: "# nothing expected\n"},
+		{name: "table and data entries", entries: "table feature_flags\ndata settings\ncolumn users.nickname\n"},
+		{name: "row entry", entries: "data settings\nrow users 42\n", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "allow.txt")
+			if err := os.WriteFile(path, []byte(tt.entries), 0644); err != nil {
+				t.Fatal(err)
+			}
+			allowlist, err := LoadAllowlist(path)
+			if err != nil {
+				t.Fatalf("LoadAllowlist() error = %v", err)
+			}
+			if got := allowlist.HasRows(); got != tt.want {
+				t.Errorf("HasRows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowlistFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allow.txt")
+	entries := "table feature_flags\ncolumn users.nickname\ndata settings\nrow users 42\n"
+	if err := os.WriteFile(path, []byte(entries), 0644); err != nil {
+		t.Fatal(err)
+	}
+	allowlist, err := LoadAllowlist(path)
+	if err != nil {
+		t.Fatalf("LoadAllowlist() error = %v", err)
+	}
+
+	users := &schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id", Type: "int"}}, Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}
+	result := &DiffResult{
+		SchemaDiffs: map[string]*SchemaDiff{
+			"feature_flags": {TableName: "feature_flags", Action: ActionAdd},
+			"users": {TableName: "users", Action: ActionModify, ColumnChanges: []ColumnChange{
+				{ColumnName: "nickname", Action: ActionAdd},
+				{ColumnName: "email", Action: ActionModify},
+			}},
+			"settings": {TableName: "settings", Action: ActionModify, ColumnChanges: []ColumnChange{{ColumnName: "nickname", Action: ActionAdd}}},
+		},
+		DataDiffs: map[string]*DataDiff{
+			"feature_flags": {TableName: "feature_flags", RowsAdded: []schema.Row{{"id": 1}}},
+			"settings":      {TableName: "settings", RowsDeleted: []schema.Row{{"id": 1}}},
+			"users":         {TableName: "users", Schema: users, RowsAdded: []schema.Row{{"id": 42}, {"id": 43}}},
+		},
+	}
+	remaining, expected := allowlist.Filter(result)
+
+	if got := SortedKeys(remaining.SchemaDiffs); !reflect.DeepEqual(got, []string{"settings", "users"}) {
+		t.Errorf("remaining schema diffs = %v, want [settings users]", got)
+	}
+	if got := SortedKeys(expected.SchemaDiffs); !reflect.DeepEqual(got, []string{"feature_flags", "users"}) {
+		t.Errorf("expected schema diffs = %v, want [feature_flags users]", got)
+	}
+	if got := remaining.SchemaDiffs["users"].ColumnChanges; len(got) != 1 || got[0].ColumnName != "email" {
+		t.Errorf("remaining users column changes = %+v, want email", got)
+	}
+	if got := expected.SchemaDiffs["users"].ColumnChanges; len(got) != 1 || got[0].ColumnName != "nickname" {
+		t.Errorf("expected users column changes = %+v, want nickname", got)
+	}
+
+	if got := SortedKeys(remaining.DataDiffs); !reflect.DeepEqual(got, []string{"users"}) {
+		t.Errorf("remaining data diffs = %v, want [users]", got)
+	}
+	if got := SortedKeys(expected.DataDiffs); !reflect.DeepEqual(got, []string{"feature_flags", "settings", "users"}) {
+		t.Errorf("expected data diffs = %v, want [feature_flags settings users]", got)
+	}
+	if got := remaining.DataDiffs["users"].RowsAdded; !reflect.DeepEqual(got, []schema.Row{{"id": 43}}) {
+		t.Errorf("remaining users rows = %v, want id 43", got)
+	}
+	if got := expected.DataDiffs["users"].RowsAdded; !reflect.DeepEqual(got, []schema.Row{{"id": 42}}) {
+		t.Errorf("expected users rows = %v, want id 42", got)
+	}
+}
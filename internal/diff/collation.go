@@ -0,0 +1,45 @@
+package diff
+
+import (
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// collationCollator returns a collator that compares strings the way a
+// collation does, or nil for case-sensitive and binary collations. MySQL's
+// _ci collations also ignore accents unless they are marked _as_.
+func collationCollator(collation string) *collate.Collator {
+	c := strings.ToLower(collation)
+	if !strings.HasSuffix(c, "_ci") {
+		return nil
+	}
+	if strings.Contains(c, "_as_") {
+		return collate.New(language.Und, collate.IgnoreCase)
+	}
+	return collate.New(language.Und, collate.IgnoreCase, collate.IgnoreDiacritics)
+}
+
+// getCollatedColumns returns a collator for each column with a
+// case-insensitive collation. Collators are not safe for concurrent use, so
+// each comparison gets its own.
+func getCollatedColumns(tableSchema *schema.TableSchema) map[string]*collate.Collator {
+	columns := make(map[string]*collate.Collator)
+	for _, col := range tableSchema.Columns {
+		if c := collationCollator(col.Collation); c != nil {
+			columns[col.Name] = c
+		}
+	}
+	return columns
+}
+
+// collatedEqual reports whether two values are strings the collator
+// considers equal
+func collatedEqual(a, b interface{}, c *collate.Collator) bool {
+	sa, okA := a.(string)
+	sb, okB := b.(string)
+	return okA && okB && c.CompareString(sa, sb) == 0
+}
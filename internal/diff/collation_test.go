@@ -0,0 +1,37 @@
+package diff
+
+import "testing"
+
+func TestCollatedEqual(t *testing.T) {
+	tests := []struct {
+		collation string
+		a, b      string
+		want      bool
+	}{
+		{"utf8mb4_general_ci", "café", "CAFE", true},
+		{"utf8mb4_general_ci", "Straße", "STRASSE", true},
+		{"utf8mb4_general_ci", "café", "cafe", true},
+		{"utf8mb4_0900_as_ci", "Café", "café", true},
+		{"utf8mb4_0900_as_ci", "café", "cafe", false},
+		{"utf8mb4_general_ci", "café", "cafes", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.collation+" "+tt.a+" "+tt.b, func(t *testing.T) {
+			c := collationCollator(tt.collation)
+			if c == nil {
+				t.Fatalf("collationCollator(%q) = nil", tt.collation)
+			}
+			if got := collatedEqual(tt.a, tt.b, c); got != tt.want {
+				t.Errorf("collatedEqual(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollationCollatorCaseSensitive(t *testing.T) {
+	for _, collation := range []string{"", "utf8mb4_bin", "utf8mb4_0900_as_cs", "C"} {
+		if c := collationCollator(collation); c != nil {
+			t.Errorf("collationCollator(%q) = %v, want nil", collation, c)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// ParseColumnMap parses a "table:oldname=newname" column mapping, which
+// pairs a column of the first snapshot with a differently named column of
+// the second
+func ParseColumnMap(spec string) (tableName, oldName, newName string, err error) {
+	tableName, pair, ok := strings.Cut(spec, ":")
+	if ok {
+		oldName, newName, ok = strings.Cut(pair, "=")
+	}
+	tableName, oldName, newName = strings.TrimSpace(tableName), strings.TrimSpace(oldName), strings.TrimSpace(newName)
+	if !ok || tableName == "" || oldName == "" || newName == "" {
+		return "", "", "", fmt.Errorf("invalid column map %q (expected table:oldname=newname)", spec)
+	}
+	return tableName, oldName, newName, nil
+}
+
+// CheckColumnMaps verifies that each mapping names a table present in both
+// snapshots, a column of the first snapshot's table and a column of the
+// second's
+func CheckColumnMaps(snap1, snap2 *snapshot.Snapshot, columnMaps map[string]map[string]string) error {
+	for tableName, renames := range columnMaps {
+		table1, ok1 := snap1.Tables[tableName]
+		table2, ok2 := snap2.Tables[tableName]
+		if !ok1 || !ok2 {
+			return fmt.Errorf("column map table %s not found in both snapshots", tableName)
+		}
+		for oldName, newName := range renames {
+			if !hasColumn(&table1.Schema, oldName) {
+				return fmt.Errorf("column map column %s does not exist in table %s of the first snapshot", oldName, tableName)
+			}
+			if !hasColumn(&table2.Schema, newName) {
+				return fmt.Errorf("column map column %s does not exist in table %s of the second snapshot", newName, tableName)
+			}
+		}
+	}
+	return nil
+}
+
+// mapSchema returns a copy of a first-snapshot table schema with its mapped
+// columns renamed to their second-snapshot names, including the columns its
+// indexes and foreign keys use and the columns its foreign keys reference
+func mapSchema(ts *schema.TableSchema, columnMaps map[string]map[string]string) *schema.TableSchema {
+	renames := columnMaps[ts.Name]
+	rename := func(names map[string]string, name string) string {
+		if newName, ok := names[name]; ok {
+			return newName
+		}
+		return name
+	}
+
+	mapped := *ts
+	mapped.Columns = append([]schema.Column(nil), ts.Columns...)
+	for i := range mapped.Columns {
+		mapped.Columns[i].Name = rename(renames, mapped.Columns[i].Name)
+	}
+	mapped.Indexes = append([]schema.Index(nil), ts.Indexes...)
+	for i := range mapped.Indexes {
+		columns := make([]string, len(mapped.Indexes[i].Columns))
+		for j, name := range mapped.Indexes[i].Columns {
+			columns[j] = rename(renames, name)
+		}
+		mapped.Indexes[i].Columns = columns
+	}
+	mapped.ForeignKeys = append([]schema.ForeignKey(nil), ts.ForeignKeys...)
+	for i := range mapped.ForeignKeys {
+		fk := &mapped.ForeignKeys[i]
+		fk.Column = rename(renames, fk.Column)
+		fk.ReferencedColumn = rename(columnMaps[fk.ReferencedTable], fk.ReferencedColumn)
+	}
+	if ts.SystemVersioning != nil {
+		mapped.SystemVersioning = &schema.SystemVersioning{
+			PeriodStart: rename(renames, ts.SystemVersioning.PeriodStart),
+			PeriodEnd:   rename(renames, ts.SystemVersioning.PeriodEnd),
+		}
+	}
+	return &mapped
+}
+
+// mapRows returns copies of the rows with the mapped columns' keys renamed
+func mapRows(rows []schema.Row, renames map[string]string) []schema.Row {
+	if len(renames) == 0 {
+		return rows
+	}
+	mapped := make([]schema.Row, len(rows))
+	for i, row := range rows {
+		newRow := make(schema.Row, len(row))
+		for col, val := range row {
+			if newName, ok := renames[col]; ok {
+				col = newName
+			}
+			newRow[col] = val
+		}
+		mapped[i] = newRow
+	}
+	return mapped
+}
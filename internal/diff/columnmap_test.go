@@ -0,0 +1,103 @@
+package diff
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestCompareColumnMap(t *testing.T) {
+	orders := func(columns ...string) *snapshot.Snapshot {
+		ts := schema.TableSchema{Name: "orders", Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true, Unique: true}}}
+		row := schema.Row{}
+		for i, col := range append([]string{"id"}, columns...) {
+			ts.Columns = append(ts.Columns, schema.Column{Name: col, Type: "int", Position: i + 1})
+			row[col] = int64(i + 1)
+		}
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": "mysql"}, Tables: map[string]*schema.Table{
+			"orders": {Schema: ts, Data: []schema.Row{row}},
+		}}
+	}
+	tests := []struct {
+		name        string
+		old, new    *snapshot.Snapshot
+		columnMaps  map[string]map[string]string
+		wantChanges []string
+	}{
+		{
+			name:       "mapped",
+			old:        orders("user_id"),
+			new:        orders("userId"),
+			columnMaps: map[string]map[string]string{"orders": {"user_id": "userId"}},
+		},
+		{
+			name:        "unmapped",
+			old:         orders("user_id"),
+			new:         orders("userId"),
+			wantChanges: []string{"ADD userId", "DROP user_id"},
+		},
+		{
+			name:        "mapped beside an unmapped rename",
+			old:         orders("user_id", "shop_id"),
+			new:         orders("userId", "shopId"),
+			columnMaps:  map[string]map[string]string{"orders": {"user_id": "userId"}},
+			wantChanges: []string{"ADD shopId", "DROP shop_id"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckColumnMaps(tt.old, tt.new, tt.columnMaps); err != nil {
+				t.Fatalf("CheckColumnMaps() error = %v", err)
+			}
+			result := Compare(tt.old, tt.new, Options{ColumnMaps: tt.columnMaps})
+
+			var changes []string
+			if schemaDiff := result.SchemaDiffs["orders"]; schemaDiff != nil {
+				for _, change := range schemaDiff.ColumnChanges {
+					changes = append(changes, string(change.Action)+" "+change.ColumnName)
+				}
+			}
+			sort.Strings(changes)
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("column changes = %v, want %v", changes, tt.wantChanges)
+			}
+			if tt.wantChanges == nil && result.DataDiffs["orders"] != nil {
+				t.Errorf("data diff = %+v, want the mapped column's data equal", result.DataDiffs["orders"])
+			}
+		})
+	}
+}
+
+func TestCheckColumnMaps(t *testing.T) {
+	users := func(column string) *snapshot.Snapshot {
+		return &snapshot.Snapshot{Tables: map[string]*schema.Table{"users": {Schema: schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: column}}}}}}
+	}
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "valid", spec: "users:user_id=userId"},
+		{name: "missing table", spec: "orders:user_id=userId", wantErr: true},
+		{name: "missing old column", spec: "users:uid=userId", wantErr: true},
+		{name: "missing new column", spec: "users:user_id=uid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tableName, oldName, newName, err := ParseColumnMap(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseColumnMap() error = %v", err)
+			}
+			err = CheckColumnMaps(users("user_id"), users("userId"), map[string]map[string]string{tableName: {oldName: newName}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckColumnMaps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, _, _, err := ParseColumnMap("users:user_id"); err == nil {
+		t.Error("ParseColumnMap() error = nil, want an error without =newname")
+	}
+}
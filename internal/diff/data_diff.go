@@ -3,6 +3,11 @@ package diff
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/collate"
 
 	"github.com/koba/db-diff/internal/schema"
 )
@@ -10,92 +15,201 @@ import (
 // DataDiff represents data differences for a table
 type DataDiff struct {
 	TableName    string
+	Schema       *schema.TableSchema // schema the rows were keyed by
 	RowsAdded    []schema.Row
 	RowsDeleted  []schema.Row
 	RowsModified []RowModification
+
+	// Row counts of the table in each snapshot, and the full data of the
+	// second snapshot when the table is to be rewritten as a whole (see
+	// Resyncs)
+	OldRowCount int
+	NewRowCount int
+	NewData     []schema.Row `json:"-"`
+
+	// Referenced is set when another table has a foreign key to this one,
+	// which TRUNCATE fails on
+	Referenced bool
+
+	// IgnoredColumns were left out of the comparison (Options.IgnoreColumns)
+	IgnoredColumns map[string]bool `json:"-"`
+
+	// Counts holds the numbers of changed rows of a count-only comparison,
+	// which leaves the row slices empty
+	Counts *RowCounts
+}
+
+// RowCounts are the numbers of added, deleted and modified rows of a table
+type RowCounts struct {
+	Added    int
+	Deleted  int
+	Modified int
+}
+
+// Total returns the number of changed rows
+func (c RowCounts) Total() int {
+	return c.Added + c.Deleted + c.Modified
+}
+
+// ChangedRows returns the numbers of changed rows, whether or not the rows
+// themselves were kept
+func (d *DataDiff) ChangedRows() RowCounts {
+	if d.Counts != nil {
+		return *d.Counts
+	}
+	return RowCounts{Added: len(d.RowsAdded), Deleted: len(d.RowsDeleted), Modified: len(d.RowsModified)}
+}
+
+// Resyncs reports whether the table's data is rewritten as a whole at the
+// given threshold (Options.ResyncThreshold): more than that fraction of its
+// rows changed
+func (d *DataDiff) Resyncs(threshold float64) bool {
+	return threshold > 0 && d.ChangedFraction() > threshold
 }
 
 // RowModification represents a modified row
 type RowModification struct {
 	OldRow schema.Row
 	NewRow schema.Row
+	// Key holds the values of the columns identifying the row: its primary
+	// key, or the columns of the table's identity expression
+	Key schema.Row
+	// ChangedColumns lists the columns whose values differ, in sorted order
+	ChangedColumns []string
 }
 
 // compareData compares data between two tables
-func compareData(tableName string, oldData, newData []schema.Row, tableSchema *schema.TableSchema) *DataDiff {
+func compareData(tableName string, oldData, newData []schema.Row, tableSchema *schema.TableSchema, opts Options) *DataDiff {
 	diff := &DataDiff{
 		TableName:    tableName,
+		Schema:       tableSchema,
 		RowsAdded:    []schema.Row{},
 		RowsDeleted:  []schema.Row{},
 		RowsModified: []RowModification{},
+		OldRowCount:  len(oldData),
+		NewRowCount:  len(newData),
+		NewData:      newData,
 	}
 
-	// Find primary key columns
-	pkColumns := getPrimaryKeyColumns(tableSchema)
-	if len(pkColumns) == 0 {
+	if opts.CountOnly {
+		diff.NewData = nil
+		diff.Counts = &RowCounts{}
+	}
+
+	// Set before the fallback for tables without a key, whose DELETE
+	// statements match every column but the ignored ones
+	diff.IgnoredColumns = ignoredColumns(tableName, opts.IgnoreColumns)
+
+	// Rows are identified by the table's identity expression if it has one,
+	// or else by their primary key
+	pkColumns := tableSchema.PrimaryKeyColumns()
+	key := func(row schema.Row) string { return rowKey(row, pkColumns) }
+	keyColumns := pkColumns
+	if id, ok := opts.Identities[tableName]; ok {
+		key = id.Key
+		keyColumns = id.Columns
+	} else if len(pkColumns) == 0 {
 		// No primary key - cannot reliably compare data
 		// Fall back to treating all rows as different
 		if len(oldData) != len(newData) {
-			diff.RowsDeleted = oldData
-			diff.RowsAdded = newData
+			if diff.Counts != nil {
+				diff.Counts.Deleted = len(oldData)
+				diff.Counts.Added = len(newData)
+			} else {
+				diff.RowsDeleted = oldData
+				diff.RowsAdded = newData
+			}
 		}
 		return diff
 	}
 
-	// Create maps keyed by primary key
-	oldRows := make(map[string]schema.Row)
-	for _, row := range oldData {
-		key := rowKey(row, pkColumns)
-		oldRows[key] = row
+	var timeColumns map[string]bool
+	if opts.TimeTolerance > 0 {
+		timeColumns = getTimeColumns(tableSchema)
 	}
-
-	newRows := make(map[string]schema.Row)
-	for _, row := range newData {
-		key := rowKey(row, pkColumns)
-		newRows[key] = row
+	var collatedColumns map[string]*collate.Collator
+	if opts.CollationAware {
+		collatedColumns = getCollatedColumns(tableSchema)
 	}
 
+	// Create maps keyed by row identity, keeping the order in which the
+	// snapshots list the keys so that changes are reported in a stable order
+	oldRows, oldKeys := keyRows(oldData, key)
+	newRows, newKeys := keyRows(newData, key)
+
 	// Find added and modified rows
-	for key, newRow := range newRows {
+	for _, key := range newKeys {
+		newRow := newRows[key]
 		if oldRow, exists := oldRows[key]; exists {
-			if !rowsEqual(oldRow, newRow) {
+			if changed := changedColumns(oldRow, newRow, diff.IgnoredColumns, timeColumns, opts.TimeTolerance, collatedColumns); len(changed) > 0 {
+				if diff.Counts != nil {
+					diff.Counts.Modified++
+					continue
+				}
+				keyValues := make(schema.Row, len(keyColumns))
+				for _, col := range keyColumns {
+					keyValues[col] = newRow[col]
+				}
 				diff.RowsModified = append(diff.RowsModified, RowModification{
-					OldRow: oldRow,
-					NewRow: newRow,
+					OldRow:         oldRow,
+					NewRow:         newRow,
+					Key:            keyValues,
+					ChangedColumns: changed,
 				})
 			}
+		} else if diff.Counts != nil {
+			diff.Counts.Added++
 		} else {
 			diff.RowsAdded = append(diff.RowsAdded, newRow)
 		}
 	}
 
 	// Find deleted rows
-	for key, oldRow := range oldRows {
+	for _, key := range oldKeys {
 		if _, exists := newRows[key]; !exists {
-			diff.RowsDeleted = append(diff.RowsDeleted, oldRow)
+			oldRow := oldRows[key]
+			if diff.Counts != nil {
+				diff.Counts.Deleted++
+			} else {
+				diff.RowsDeleted = append(diff.RowsDeleted, oldRow)
+			}
 		}
 	}
 
 	// Return nil if no changes
-	if len(diff.RowsAdded) == 0 && len(diff.RowsDeleted) == 0 && len(diff.RowsModified) == 0 {
+	if diff.ChangedRows().Total() == 0 {
 		return nil
 	}
 
 	return diff
 }
 
-// getPrimaryKeyColumns returns the primary key column names
-func getPrimaryKeyColumns(tableSchema *schema.TableSchema) []string {
-	var pkColumns []string
-
-	for _, index := range tableSchema.Indexes {
-		if index.Primary {
-			pkColumns = index.Columns
-			break
+// keyRows maps rows by key and returns the keys in the order of their
+// first row. A later row with the same key replaces an earlier one.
+func keyRows(rows []schema.Row, rowKey func(schema.Row) string) (map[string]schema.Row, []string) {
+	byKey := make(map[string]schema.Row, len(rows))
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		key := rowKey(row)
+		if _, exists := byKey[key]; !exists {
+			keys = append(keys, key)
 		}
+		byKey[key] = row
 	}
+	return byKey, keys
+}
 
-	return pkColumns
+// ChangedFraction returns the share of rows that differ between the two
+// snapshots, relative to the larger of the two tables
+func (d *DataDiff) ChangedFraction() float64 {
+	total := d.OldRowCount
+	if d.NewRowCount > total {
+		total = d.NewRowCount
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(d.ChangedRows().Total()) / float64(total)
 }
 
 // rowKey generates a unique key for a row based on primary key columns
@@ -114,16 +228,70 @@ func rowKey(row schema.Row, pkColumns []string) string {
 	return string(keyJSON)
 }
 
-// rowsEqual checks if two rows are equal
-func rowsEqual(a, b schema.Row) bool {
-	if len(a) != len(b) {
+// getTimeColumns returns the names of columns with a date or time type
+func getTimeColumns(tableSchema *schema.TableSchema) map[string]bool {
+	columns := make(map[string]bool)
+	for _, col := range tableSchema.Columns {
+		t := strings.ToLower(col.Type)
+		if strings.HasPrefix(t, "date") || strings.HasPrefix(t, "time") {
+			columns[col.Name] = true
+		}
+	}
+	return columns
+}
+
+// timeLayouts are the formats date and time values take in a snapshot:
+// RFC 3339 for values read as time.Time, and the databases' own text forms
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+
+func parseTime(val interface{}) (time.Time, bool) {
+	s, ok := val.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timesWithin reports whether two date or time values are no more than
+// tolerance apart
+func timesWithin(a, b interface{}, tolerance time.Duration) bool {
+	ta, okA := parseTime(a)
+	tb, okB := parseTime(b)
+	if !okA || !okB {
 		return false
 	}
+	d := ta.Sub(tb)
+	if d < 0 {
+		d = -d
+	}
+	return d <= tolerance
+}
 
+// changedColumns returns the columns whose values differ between two rows,
+// in sorted order, including columns only one of them has and leaving out
+// ignored columns. Values of timeColumns are equal when they are within
+// tolerance of each other, and values of collatedColumns when the column's
+// collator considers them equal.
+func changedColumns(a, b schema.Row, ignored, timeColumns map[string]bool, tolerance time.Duration, collatedColumns map[string]*collate.Collator) []string {
+	var changed []string
 	for key, valA := range a {
+		if ignored[key] {
+			continue
+		}
 		valB, exists := b[key]
 		if !exists {
-			return false
+			changed = append(changed, key)
+			continue
 		}
 
 		// Use JSON comparison for consistent equality check
@@ -131,9 +299,21 @@ func rowsEqual(a, b schema.Row) bool {
 		jsonB, _ := json.Marshal(valB)
 
 		if string(jsonA) != string(jsonB) {
-			return false
+			if timeColumns[key] && timesWithin(valA, valB, tolerance) {
+				continue
+			}
+			if c := collatedColumns[key]; c != nil && collatedEqual(valA, valB, c) {
+				continue
+			}
+			changed = append(changed, key)
+		}
+	}
+	for key := range b {
+		if _, exists := a[key]; !exists && !ignored[key] {
+			changed = append(changed, key)
 		}
 	}
 
-	return true
+	sort.Strings(changed)
+	return changed
 }
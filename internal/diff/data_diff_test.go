@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestCompareDataIgnoredColumns(t *testing.T) {
+	withPK := &schema.TableSchema{Name: "events", Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}
+	withoutPK := &schema.TableSchema{Name: "events"}
+	tests := []struct {
+		name   string
+		table  *schema.TableSchema
+		ignore []string
+		want   map[string]bool
+	}{
+		{name: "primary key", table: withPK, ignore: []string{"seen_at"}, want: map[string]bool{"seen_at": true}},
+		{name: "no primary key", table: withoutPK, ignore: []string{"seen_at"}, want: map[string]bool{"seen_at": true}},
+		{name: "other table", table: withoutPK, ignore: []string{"orders.seen_at"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldData := []schema.Row{{"id": 1, "seen_at": "2024-01-01"}}
+			newData := []schema.Row{{"id": 1, "seen_at": "2024-01-02"}, {"id": 2, "seen_at": "2024-01-02"}}
+			d := compareData("events", oldData, newData, tt.table, Options{IgnoreColumns: tt.ignore})
+			if !reflect.DeepEqual(d.IgnoredColumns, tt.want) {
+				t.Errorf("IgnoredColumns = %v, want %v", d.IgnoredColumns, tt.want)
+			}
+		})
+	}
+}
+
+func TestResyncs(t *testing.T) {
+	// 4 of 5 rows changed
+	d := &DataDiff{OldRowCount: 5, NewRowCount: 5, RowsModified: make([]RowModification, 4)}
+	tests := []struct {
+		name       string
+		threshold  float64
+		referenced bool
+		want       bool
+	}{
+		{name: "disabled", threshold: 0},
+		{name: "threshold under fraction", threshold: 0.79, want: true},
+		{name: "threshold at fraction", threshold: 0.8},
+		{name: "threshold over fraction", threshold: 0.81},
+		{name: "referenced", threshold: 0.5, referenced: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d.Referenced = tt.referenced
+			if got := d.Resyncs(tt.threshold); got != tt.want {
+				t.Errorf("Resyncs(%v) = %v, want %v", tt.threshold, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareDataTimeTolerance(t *testing.T) {
+	events := &schema.TableSchema{
+		Name:    "events",
+		Columns: []schema.Column{{Name: "id", Type: "int"}, {Name: "seen_at", Type: "timestamp"}, {Name: "label", Type: "varchar(32)"}},
+		Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}},
+	}
+	tests := []struct {
+		name      string
+		old, new  schema.Row
+		tolerance time.Duration
+		want      int
+	}{
+		{name: "below tolerance", old: schema.Row{"id": 1, "seen_at": "2024-01-01 10:00:00"}, new: schema.Row{"id": 1, "seen_at": "2024-01-01 10:00:02"}, tolerance: 5 * time.Second},
+		{name: "at tolerance", old: schema.Row{"id": 1, "seen_at": "2024-01-01T10:00:00Z"}, new: schema.Row{"id": 1, "seen_at": "2024-01-01T10:00:05Z"}, tolerance: 5 * time.Second},
+		{name: "above tolerance", old: schema.Row{"id": 1, "seen_at": "2024-01-01 10:00:00"}, new: schema.Row{"id": 1, "seen_at": "2024-01-01 10:00:06"}, tolerance: 5 * time.Second, want: 1},
+		{name: "no tolerance", old: schema.Row{"id": 1, "seen_at": "2024-01-01 10:00:00"}, new: schema.Row{"id": 1, "seen_at": "2024-01-01 10:00:02"}, want: 1},
+		{name: "not a time column", old: schema.Row{"id": 1, "label": "2024-01-01 10:00:00"}, new: schema.Row{"id": 1, "label": "2024-01-01 10:00:02"}, tolerance: 5 * time.Second, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := compareData("events", []schema.Row{tt.old}, []schema.Row{tt.new}, events, Options{TimeTolerance: tt.tolerance})
+			got := 0
+			if d != nil {
+				got = len(d.RowsModified)
+			}
+			if got != tt.want {
+				t.Errorf("modified rows = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOnlyTablesWithData(t *testing.T) {
+	table := func(columnType string, rows ...schema.Row) *schema.Table {
+		return &schema.Table{Schema: schema.TableSchema{Columns: []schema.Column{{Name: "id", Type: columnType, Position: 1}},
+			Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}, Data: rows}
+	}
+	snap1 := &snapshot.Snapshot{Metadata: map[string]string{}, Tables: map[string]*schema.Table{
+		"archive": table("int"),
+		"users":   table("int"),
+	}}
+	snap2 := &snapshot.Snapshot{Metadata: map[string]string{}, Tables: map[string]*schema.Table{
+		"archive": table("bigint"),
+		"users":   table("int", schema.Row{"id": 1}),
+	}}
+
+	result := Compare(snap1, snap2, Options{OnlyTablesWithData: true})
+	if got := SortedKeys(result.DataDiffs); !reflect.DeepEqual(got, []string{"users"}) {
+		t.Errorf("data diffs = %v, want [users]", got)
+	}
+	if _, ok := result.SchemaDiffs["archive"]; !ok {
+		t.Errorf("schema diffs = %v, want the archive schema compared", SortedKeys(result.SchemaDiffs))
+	}
+}
+
+func TestCompareDataRowOrder(t *testing.T) {
+	events := &schema.TableSchema{Name: "events", Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}
+	// Rows are reported in snapshot order, which is not key order
+	ids := []int{42, 7, 19, 3, 88, 61, 25, 14}
+	var oldData, newData []schema.Row
+	for _, id := range ids {
+		oldData = append(oldData, schema.Row{"id": id, "v": "old"}, schema.Row{"id": id + 1000, "v": "gone"})
+		newData = append(newData, schema.Row{"id": id, "v": "new"}, schema.Row{"id": id + 2000, "v": "added"})
+	}
+	var wantModified, wantDeleted, wantAdded []int
+	for _, id := range ids {
+		wantModified = append(wantModified, id)
+		wantDeleted = append(wantDeleted, id+1000)
+		wantAdded = append(wantAdded, id+2000)
+	}
+	keys := func(rows []schema.Row) []int {
+		var out []int
+		for _, row := range rows {
+			out = append(out, row["id"].(int))
+		}
+		return out
+	}
+
+	for run := 0; run < 20; run++ {
+		d := compareData("events", oldData, newData, events, Options{})
+		var modified []int
+		for _, mod := range d.RowsModified {
+			modified = append(modified, mod.NewRow["id"].(int))
+		}
+		if !reflect.DeepEqual(modified, wantModified) {
+			t.Fatalf("run %d: modified = %v, want %v", run, modified, wantModified)
+		}
+		if got := keys(d.RowsDeleted); !reflect.DeepEqual(got, wantDeleted) {
+			t.Fatalf("run %d: deleted = %v, want %v", run, got, wantDeleted)
+		}
+		if got := keys(d.RowsAdded); !reflect.DeepEqual(got, wantAdded) {
+			t.Fatalf("run %d: added = %v, want %v", run, got, wantAdded)
+		}
+	}
+}
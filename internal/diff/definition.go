@@ -0,0 +1,57 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// definitionsEqual compares two view or rule definitions, either as captured
+// or, with Options.NormalizeDefinitions, after canonicalDefinition
+func definitionsEqual(a, b string, opts Options) bool {
+	if opts.NormalizeDefinitions {
+		return canonicalDefinition(a) == canonicalDefinition(b)
+	}
+	return a == b
+}
+
+// canonicalDefinition rewrites an SQL definition so that formatting the
+// server may change between versions does not matter: whitespace runs
+// become one space and disappear next to punctuation, text outside quotes is
+// lower-cased, and a trailing semicolon is dropped. Quoted literals and
+// identifiers are kept as they are.
+func canonicalDefinition(definition string) string {
+	var b strings.Builder
+	pendingSpace := false
+	var quote rune
+	for _, r := range strings.TrimSuffix(strings.TrimSpace(definition), ";") {
+		if quote != 0 {
+			b.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case unicode.IsSpace(r):
+			pendingSpace = true
+			continue
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		}
+		if pendingSpace && b.Len() > 0 && !isDefinitionPunct(r) && !isDefinitionPunct(lastRune(b.String())) {
+			b.WriteByte(' ')
+		}
+		pendingSpace = false
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func isDefinitionPunct(r rune) bool {
+	return strings.ContainsRune("(),;=<>+-*/", r)
+}
+
+func lastRune(s string) rune {
+	r := []rune(s)
+	return r[len(r)-1]
+}
@@ -0,0 +1,51 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestDefinitionsEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{name: "whitespace", a: " SELECT id,\n    name\n   FROM users;", b: "SELECT id, name FROM users", want: true},
+		{name: "punctuation spacing", a: "SELECT count( * ) FROM users WHERE (age >= 18)", b: "SELECT count(*) FROM users WHERE(age>=18)", want: true},
+		{name: "keyword case", a: "select id from users", b: "SELECT id FROM users", want: true},
+		{name: "quoted literal case", a: "SELECT id FROM users WHERE name = 'Alice'", b: "SELECT id FROM users WHERE name = 'alice'"},
+		{name: "quoted whitespace", a: "SELECT 'a  b'", b: "SELECT 'a b'"},
+		{name: "different query", a: "SELECT id FROM users", b: "SELECT id FROM accounts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := definitionsEqual(tt.a, tt.b, Options{NormalizeDefinitions: true}); got != tt.want {
+				t.Errorf("definitionsEqual(%q, %q) = %v, want %v (canonical %q and %q)", tt.a, tt.b, got, tt.want, canonicalDefinition(tt.a), canonicalDefinition(tt.b))
+			}
+		})
+	}
+}
+
+func TestCompareNormalizedViewDefinitions(t *testing.T) {
+	view := func(definition string) *snapshot.Snapshot {
+		return &snapshot.Snapshot{
+			Metadata: map[string]string{"db_type": "postgres"},
+			Tables:   map[string]*schema.Table{},
+			MaterializedViews: map[string]*schema.MaterializedView{
+				"active_users": {Name: "active_users", Definition: definition},
+			},
+		}
+	}
+	snap1 := view(" SELECT users.id,\n    users.name\n   FROM users\n  WHERE (users.active = true);")
+	snap2 := view("select users.id, users.name from users where (users.active = true)")
+
+	if got := Compare(snap1, snap2, Options{NormalizeDefinitions: true}).MaterializedViewDiffs; len(got) != 0 {
+		t.Errorf("MaterializedViewDiffs = %v, want none with NormalizeDefinitions", got)
+	}
+	if got := Compare(snap1, snap2, Options{}).MaterializedViewDiffs; len(got) != 1 {
+		t.Errorf("MaterializedViewDiffs = %v, want the view without NormalizeDefinitions", got)
+	}
+}
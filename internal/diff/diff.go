@@ -1,8 +1,16 @@
 package diff
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/koba/db-diff/internal/schema"
 	"github.com/koba/db-diff/internal/snapshot"
 )
 
@@ -10,13 +18,94 @@ import (
 type DiffResult struct {
 	SchemaDiffs map[string]*SchemaDiff
 	DataDiffs   map[string]*DataDiff
+
+	// TableOrder is the creation order of the tables recorded in the
+	// snapshots (or their dependency order, see CompareFromEmpty), used for
+	// display and generated SQL instead of name order when set
+	TableOrder []string
+
+	// MaterializedViewDiffs are the changed materialized views, by name, and
+	// MaterializedViews the names of all views of the second snapshot
+	MaterializedViewDiffs map[string]*MaterializedViewDiff
+	MaterializedViews     []string
+
+	// ShowRows is the number of modified rows of each table the text
+	// display details with their changed columns (0: none, negative: all)
+	ShowRows int
+
+	// HintSplits adds the SplitHints to the text, Markdown and HTML displays
+	HintSplits bool
+}
+
+// Options controls how snapshots are compared
+type Options struct {
+	// TimeTolerance treats values of date and time columns as equal when
+	// they are no more than this far apart (0: exact comparison)
+	TimeTolerance time.Duration
+	// MatchIndexesByColumns pairs indexes by their columns, uniqueness and
+	// primary flag instead of by name, so renamed but otherwise identical
+	// indexes are not reported
+	MatchIndexesByColumns bool
+	// MatchConstraintsByDefinition pairs a dropped foreign key or CHECK
+	// constraint with an added one of the same definition as a rename
+	MatchConstraintsByDefinition bool
+	// OnlyTablesWithData skips the data comparison of tables that have no
+	// rows in either snapshot
+	OnlyTablesWithData bool
+	// IncludeAutoIncrement reports differing next auto-increment values as
+	// schema changes
+	IncludeAutoIncrement bool
+	// CollationAware compares values of columns with a case-insensitive
+	// collation (e.g. utf8mb4_general_ci) the way the database does,
+	// ignoring case and, unless the collation is accent-sensitive, accents
+	CollationAware bool
+	// RowFilters limits the data comparison of a table to the rows of both
+	// snapshots that match its filter
+	RowFilters map[string]*RowFilter
+	// CountOnly counts the changed rows of each table without keeping them,
+	// for large tables where only the numbers matter. The resulting data
+	// diffs cannot be used to generate SQL.
+	CountOnly bool
+	// NormalizeDefinitions compares materialized view and rule definitions
+	// ignoring whitespace and the case of text outside quotes, which differ
+	// between server versions for the same definition
+	NormalizeDefinitions bool
+	// CheckColumnOrder reports tables whose common columns are in a
+	// different order
+	CheckColumnOrder bool
+	// ColumnMaps pairs columns renamed between the snapshots, by table and
+	// then first-snapshot name, with their second-snapshot names. Mapped
+	// columns are compared as the same column.
+	ColumnMaps map[string]map[string]string
+	// Identities identifies the rows of a table by an expression over its
+	// columns instead of by its primary key, so rows whose computed keys
+	// are equal are compared as the same row
+	Identities map[string]*Identity
+	// ShowRows is recorded in the DiffResult for the text display
+	ShowRows int
+	// HintSplits is recorded in the DiffResult for the displays
+	HintSplits bool
+	// ResyncThreshold keeps the second snapshot's rows of the tables that
+	// are rewritten as a whole at this threshold (see DataDiff.Resyncs)
+	ResyncThreshold float64
+	// IgnoreColumns lists columns left out of the data comparison and of
+	// the WHERE and SET clauses of generated DML, as column names for every
+	// table or as table.column. They are still snapshotted and inserted.
+	IgnoreColumns []string
+
+	// legacyCollations is set when either snapshot did not capture column
+	// collations, so a missing one is not compared
+	legacyCollations bool
 }
 
 // Compare compares two snapshots and returns the differences
-func Compare(snap1, snap2 *snapshot.Snapshot) *DiffResult {
+func Compare(snap1, snap2 *snapshot.Snapshot, opts Options) *DiffResult {
 	result := &DiffResult{
 		SchemaDiffs: make(map[string]*SchemaDiff),
 		DataDiffs:   make(map[string]*DataDiff),
+		TableOrder:  tableOrder(snap1, snap2),
+		ShowRows:    opts.ShowRows,
+		HintSplits:  opts.HintSplits,
 	}
 
 	// Find all unique table names
@@ -30,109 +119,476 @@ func Compare(snap1, snap2 *snapshot.Snapshot) *DiffResult {
 
 	// Compare each table
 	for tableName := range tableNames {
-		table1, exists1 := snap1.Tables[tableName]
-		table2, exists2 := snap2.Tables[tableName]
-
-		if !exists1 {
-			// Table added in snapshot2
-			result.SchemaDiffs[tableName] = &SchemaDiff{
-				TableName: tableName,
-				Action:    ActionAdd,
-				NewSchema: &table2.Schema,
-			}
-			continue
+		compareTable(result, snap1, snap2, tableName, opts)
+	}
+
+	result.MaterializedViewDiffs = compareMaterializedViews(snap1.MaterializedViews, snap2.MaterializedViews, opts)
+	result.MaterializedViews = SortedKeys(snap2.MaterializedViews)
+
+	return result
+}
+
+// CompareFromEmpty compares an empty snapshot against snap, so that every
+// table is created and every row inserted. Tables are ordered so that the
+// tables a foreign key references come before it.
+func CompareFromEmpty(snap *snapshot.Snapshot, opts Options) *DiffResult {
+	empty := &snapshot.Snapshot{Metadata: map[string]string{}, Tables: map[string]*schema.Table{}}
+	result := Compare(empty, snap, opts)
+
+	// An added table has no data diff, so its rows are compared against the
+	// same table without rows
+	schemaOnly := &snapshot.Snapshot{Metadata: map[string]string{}, Tables: make(map[string]*schema.Table, len(snap.Tables))}
+	for name, table := range snap.Tables {
+		schemaOnly.Tables[name] = &schema.Table{Schema: table.Schema}
+	}
+	result.DataDiffs = Compare(schemaOnly, snap, opts).DataDiffs
+	result.TableOrder = DependencyOrder(snap)
+
+	return result
+}
+
+// DependencyOrder returns the snapshot's tables with each table after the
+// tables its foreign keys reference, in name order otherwise. Tables in a
+// reference cycle are left in the order they are reached.
+func DependencyOrder(snap *snapshot.Snapshot) []string {
+	order := make([]string, 0, len(snap.Tables))
+	visited := make(map[string]bool, len(snap.Tables))
+	var visit func(tableName string)
+	visit = func(tableName string) {
+		table, ok := snap.Tables[tableName]
+		if !ok || visited[tableName] {
+			return
 		}
+		visited[tableName] = true
 
-		if !exists2 {
-			// Table removed in snapshot2
-			result.SchemaDiffs[tableName] = &SchemaDiff{
-				TableName: tableName,
-				Action:    ActionDrop,
-				OldSchema: &table1.Schema,
-			}
-			continue
+		var referenced []string
+		for _, fk := range table.Schema.ForeignKeys {
+			referenced = append(referenced, fk.ReferencedTable)
+		}
+		sort.Strings(referenced)
+		for _, name := range referenced {
+			visit(name)
+		}
+		order = append(order, tableName)
+	}
+	for _, tableName := range SortedKeys(snap.Tables) {
+		visit(tableName)
+	}
+	return order
+}
+
+// CompareTable compares a single table between two snapshots
+func CompareTable(snap1, snap2 *snapshot.Snapshot, tableName string, opts Options) (*DiffResult, error) {
+	_, exists1 := snap1.Tables[tableName]
+	_, exists2 := snap2.Tables[tableName]
+	if !exists1 && !exists2 {
+		return nil, fmt.Errorf("table %s not found in either snapshot", tableName)
+	}
+
+	result := &DiffResult{
+		SchemaDiffs: make(map[string]*SchemaDiff),
+		DataDiffs:   make(map[string]*DataDiff),
+		ShowRows:    opts.ShowRows,
+	}
+	compareTable(result, snap1, snap2, tableName, opts)
+	return result, nil
+}
+
+// compareTable adds the differences of one table to result
+func compareTable(result *DiffResult, snap1, snap2 *snapshot.Snapshot, tableName string, opts Options) {
+	table1, exists1 := snap1.Tables[tableName]
+	table2, exists2 := snap2.Tables[tableName]
+
+	if !exists1 {
+		// Table added in snapshot2
+		result.SchemaDiffs[tableName] = &SchemaDiff{
+			TableName: tableName,
+			Action:    ActionAdd,
+			NewSchema: &table2.Schema,
 		}
+		return
+	}
 
-		// Table exists in both snapshots - compare schema
-		schemaDiff := compareSchemas(&table1.Schema, &table2.Schema)
-		if schemaDiff != nil {
-			result.SchemaDiffs[tableName] = schemaDiff
+	if !exists2 {
+		// Table removed in snapshot2
+		result.SchemaDiffs[tableName] = &SchemaDiff{
+			TableName: tableName,
+			Action:    ActionDrop,
+			OldSchema: &table1.Schema,
 		}
+		return
+	}
+
+	// Table exists in both snapshots - compare schema, with the first
+	// snapshot's mapped columns under their new names
+	schema1, data1 := &table1.Schema, table1.Data
+	if len(opts.ColumnMaps) > 0 {
+		schema1 = mapSchema(schema1, opts.ColumnMaps)
+		data1 = mapRows(data1, opts.ColumnMaps[tableName])
+	}
+	opts.legacyCollations = !snap1.CollationsCaptured() || !snap2.CollationsCaptured()
+	schemaDiff := compareSchemas(schema1, &table2.Schema, opts)
+	if schemaDiff != nil {
+		result.SchemaDiffs[tableName] = schemaDiff
+	}
 
-		// Compare data
-		dataDiff := compareData(tableName, table1.Data, table2.Data, &table2.Schema)
-		if dataDiff != nil {
-			result.DataDiffs[tableName] = dataDiff
+	if opts.OnlyTablesWithData && len(data1) == 0 && len(table2.Data) == 0 {
+		return
+	}
+
+	// Compare data
+	data2 := table2.Data
+	if f, ok := opts.RowFilters[tableName]; ok {
+		data1, data2 = filterRows(data1, f), filterRows(data2, f)
+	}
+	dataDiff := compareData(tableName, data1, data2, &table2.Schema, opts)
+	if dataDiff != nil {
+		dataDiff.Referenced = isReferenced(snap2, tableName)
+		if !dataDiff.Resyncs(opts.ResyncThreshold) {
+			dataDiff.NewData = nil
 		}
+		result.DataDiffs[tableName] = dataDiff
 	}
+}
 
-	return result
+// tableOrder combines the creation orders recorded in two snapshots: the
+// second snapshot's order, followed by tables only the first one has
+func tableOrder(snap1, snap2 *snapshot.Snapshot) []string {
+	order1, order2 := snap1.TableOrder(), snap2.TableOrder()
+	if order1 == nil && order2 == nil {
+		return nil
+	}
+	order := append([]string(nil), order2...)
+	seen := make(map[string]bool, len(order))
+	for _, tableName := range order {
+		seen[tableName] = true
+	}
+	for _, tableName := range order1 {
+		if !seen[tableName] {
+			order = append(order, tableName)
+		}
+	}
+	return order
+}
+
+// isReferenced reports whether any other table in the snapshot has a
+// foreign key to tableName
+func isReferenced(snap *snapshot.Snapshot, tableName string) bool {
+	for name, table := range snap.Tables {
+		if name == tableName {
+			continue
+		}
+		for _, fk := range table.Schema.ForeignKeys {
+			if fk.ReferencedTable == tableName {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-// Display prints the diff result in a human-readable format
+// Display prints the diff result in a human-readable format to stdout
 func Display(result *DiffResult) {
-	if len(result.SchemaDiffs) == 0 && len(result.DataDiffs) == 0 {
-		fmt.Println("No differences found.")
+	DisplayTo(result, os.Stdout)
+}
+
+// DisplayTo writes the diff result in a human-readable format to w.
+// Tables and changes are written in sorted order so the output is stable
+// between runs.
+func DisplayTo(result *DiffResult, w io.Writer) {
+	displayTo(result, w, nil)
+}
+
+// DisplayVerbose writes the diff result like DisplayTo, adding the full
+// definition of added and dropped tables as rendered by createTable, and the
+// old and new values of changed column attributes side by side. createTable
+// is supplied by the caller since SQL generation lives outside this package.
+func DisplayVerbose(result *DiffResult, w io.Writer, createTable func(*schema.TableSchema) string) {
+	displayTo(result, w, createTable)
+}
+
+func displayTo(result *DiffResult, w io.Writer, createTable func(*schema.TableSchema) string) {
+	if !result.HasDifferences() {
+		fmt.Fprintln(w, "No differences found.")
 		return
 	}
 
 	// Display schema differences
 	if len(result.SchemaDiffs) > 0 {
-		fmt.Println("=== Schema Differences ===")
-		fmt.Println()
-		for tableName, schemaDiff := range result.SchemaDiffs {
-			displaySchemaDiff(tableName, schemaDiff)
+		fmt.Fprintln(w, "=== Schema Differences ===")
+		fmt.Fprintln(w)
+		for _, tableName := range OrderedKeys(result.SchemaDiffs, result.TableOrder) {
+			displaySchemaDiff(w, tableName, result.SchemaDiffs[tableName], createTable)
+		}
+		for _, hint := range SplitHints(result) {
+			fmt.Fprintf(w, "-- HINT: %s\n", hint)
+		}
+	}
+
+	if len(result.MaterializedViewDiffs) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "=== Materialized View Differences ===")
+		fmt.Fprintln(w)
+		for _, name := range SortedKeys(result.MaterializedViewDiffs) {
+			displayMaterializedViewDiff(w, result.MaterializedViewDiffs[name])
 		}
 	}
 
 	// Display data differences
 	if len(result.DataDiffs) > 0 {
-		fmt.Println()
-		fmt.Println("=== Data Differences ===")
-		fmt.Println()
-		for tableName, dataDiff := range result.DataDiffs {
-			displayDataDiff(tableName, dataDiff)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "=== Data Differences ===")
+		fmt.Fprintln(w)
+		for _, tableName := range OrderedKeys(result.DataDiffs, result.TableOrder) {
+			displayDataDiff(w, tableName, result.DataDiffs[tableName], result.ShowRows)
 		}
 	}
 }
 
-func displaySchemaDiff(tableName string, diff *SchemaDiff) {
-	fmt.Printf("Table: %s\n", tableName)
+// DisplayExpected writes differences that were allowed by an allowlist
+func DisplayExpected(expected *DiffResult, w io.Writer) {
+	if len(expected.SchemaDiffs) == 0 && len(expected.DataDiffs) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "=== Expected Differences (allowed) ===")
+	fmt.Fprintln(w)
+	for _, tableName := range OrderedKeys(expected.SchemaDiffs, expected.TableOrder) {
+		displaySchemaDiff(w, tableName, expected.SchemaDiffs[tableName], nil)
+	}
+	for _, tableName := range OrderedKeys(expected.DataDiffs, expected.TableOrder) {
+		displayDataDiff(w, tableName, expected.DataDiffs[tableName], expected.ShowRows)
+	}
+}
+
+// HasDifferences reports whether the result contains any difference
+func (r *DiffResult) HasDifferences() bool {
+	return len(r.SchemaDiffs) > 0 || len(r.DataDiffs) > 0 || len(r.MaterializedViewDiffs) > 0
+}
+
+// displaySchemaDiff writes one table's schema changes. A non-nil createTable
+// selects the verbose form.
+func displaySchemaDiff(w io.Writer, tableName string, diff *SchemaDiff, createTable func(*schema.TableSchema) string) {
+	fmt.Fprintf(w, "Table: %s\n", tableName)
 
 	switch diff.Action {
 	case ActionAdd:
-		fmt.Printf("  Action: ADD (new table)\n")
-		fmt.Printf("  Columns: %d\n", len(diff.NewSchema.Columns))
+		fmt.Fprintf(w, "  Action: ADD (new table)\n")
+		fmt.Fprintf(w, "  Columns: %d\n", len(diff.NewSchema.Columns))
+		if createTable != nil {
+			writeIndented(w, createTable(diff.NewSchema))
+		}
 	case ActionDrop:
-		fmt.Printf("  Action: DROP (removed table)\n")
+		fmt.Fprintf(w, "  Action: DROP (removed table)\n")
+		if createTable != nil {
+			fmt.Fprintf(w, "  Previous definition:\n")
+			writeIndented(w, createTable(diff.OldSchema))
+		}
 	case ActionModify:
-		fmt.Printf("  Action: MODIFY\n")
+		fmt.Fprintf(w, "  Action: MODIFY\n")
+		if diff.AutoIncrementChanged {
+			fmt.Fprintf(w, "  Auto increment changed from %d to %d\n", diff.OldSchema.AutoIncrement, diff.NewSchema.AutoIncrement)
+		}
+		if diff.SystemVersioningChanged {
+			fmt.Fprintf(w, "  System versioning %s\n", versioningChange(diff))
+		}
+		if diff.PartitioningChanged {
+			fmt.Fprintf(w, "  Partitioning changed from %s to %s\n", partitioningKey(diff.OldSchema), partitioningKey(diff.NewSchema))
+		}
+		if diff.ColumnOrderChanged {
+			fmt.Fprintf(w, "  Column order changed from (%s) to (%s)\n",
+				strings.Join(CommonColumnOrder(diff.OldSchema, diff.NewSchema), ", "), strings.Join(CommonColumnOrder(diff.NewSchema, diff.OldSchema), ", "))
+		}
 		if len(diff.ColumnChanges) > 0 {
-			fmt.Printf("  Column changes:\n")
+			// Column changes are already in column position order
+			fmt.Fprintf(w, "  Column changes:\n")
 			for _, change := range diff.ColumnChanges {
-				fmt.Printf("    - %s: %s\n", change.ColumnName, change.Action)
+				fmt.Fprintf(w, "    - %s: %s\n", change.ColumnName, change.Action)
+				if createTable != nil && len(change.ChangedAttributes) > 0 {
+					writeAttributeTable(w, change)
+					continue
+				}
+				for _, attr := range change.ChangedAttributes {
+					fmt.Fprintf(w, "        %s changed from %s to %s\n", attr,
+						ColumnAttribute(change.OldColumn, attr), ColumnAttribute(change.NewColumn, attr))
+				}
 			}
 		}
 		if len(diff.IndexChanges) > 0 {
-			fmt.Printf("  Index changes:\n")
-			for _, change := range diff.IndexChanges {
-				fmt.Printf("    - %s: %s\n", change.IndexName, change.Action)
+			changes := append([]IndexChange(nil), diff.IndexChanges...)
+			sort.Slice(changes, func(i, j int) bool { return changes[i].IndexName < changes[j].IndexName })
+			fmt.Fprintf(w, "  Index changes:\n")
+			for _, change := range changes {
+				fmt.Fprintf(w, "    - %s: %s\n", change.IndexName, change.Action)
 			}
 		}
 		if len(diff.ForeignKeyChanges) > 0 {
-			fmt.Printf("  Foreign key changes:\n")
-			for _, change := range diff.ForeignKeyChanges {
-				fmt.Printf("    - %s: %s\n", change.FKName, change.Action)
+			changes := append([]ForeignKeyChange(nil), diff.ForeignKeyChanges...)
+			sort.Slice(changes, func(i, j int) bool { return changes[i].FKName < changes[j].FKName })
+			fmt.Fprintf(w, "  Foreign key changes:\n")
+			for _, change := range changes {
+				fmt.Fprintf(w, "    - %s: %s\n", change.FKName, change.Action)
+				if change.RenameOnly() {
+					fmt.Fprintf(w, "        renamed from %s\n", change.OldForeignKey.Name)
+				}
+				if change.Action == ActionModify && deferrability(change.OldForeignKey) != deferrability(change.NewForeignKey) {
+					fmt.Fprintf(w, "        %s → %s\n", deferrability(change.OldForeignKey), deferrability(change.NewForeignKey))
+				}
+				if change.Action == ActionModify && change.OldForeignKey.NotValid != change.NewForeignKey.NotValid {
+					fmt.Fprintf(w, "        %s → %s\n", validity(change.OldForeignKey.NotValid), validity(change.NewForeignKey.NotValid))
+				}
+			}
+		}
+		if len(diff.RuleChanges) > 0 {
+			changes := append([]RuleChange(nil), diff.RuleChanges...)
+			sort.Slice(changes, func(i, j int) bool { return changes[i].RuleName < changes[j].RuleName })
+			fmt.Fprintf(w, "  Rule changes:\n")
+			for _, change := range changes {
+				fmt.Fprintf(w, "    - %s: %s\n", change.RuleName, change.Action)
+			}
+		}
+		if len(diff.CheckChanges) > 0 {
+			changes := append([]CheckChange(nil), diff.CheckChanges...)
+			sort.Slice(changes, func(i, j int) bool { return changes[i].CheckName < changes[j].CheckName })
+			fmt.Fprintf(w, "  Check constraint changes:\n")
+			for _, change := range changes {
+				fmt.Fprintf(w, "    - %s: %s\n", change.CheckName, change.Action)
+				if change.RenameOnly() {
+					fmt.Fprintf(w, "        renamed from %s\n", change.OldCheck.Name)
+				}
+				if change.Action == ActionModify && change.expressionChanged() {
+					fmt.Fprintf(w, "        %s → %s\n", change.OldCheck.Expression, change.NewCheck.Expression)
+				}
+				if change.Action == ActionModify && change.OldCheck.NotValid != change.NewCheck.NotValid {
+					fmt.Fprintf(w, "        %s → %s\n", validity(change.OldCheck.NotValid), validity(change.NewCheck.NotValid))
+				}
+				if change.Action == ActionModify && change.OldCheck.NotEnforced != change.NewCheck.NotEnforced {
+					fmt.Fprintf(w, "        %s → %s\n", enforcement(change.OldCheck.NotEnforced), enforcement(change.NewCheck.NotEnforced))
+				}
+			}
+		}
+		if len(diff.PartitionChanges) > 0 {
+			changes := append([]PartitionChange(nil), diff.PartitionChanges...)
+			sort.Slice(changes, func(i, j int) bool { return changes[i].PartitionName < changes[j].PartitionName })
+			fmt.Fprintf(w, "  Partition changes:\n")
+			for _, change := range changes {
+				fmt.Fprintf(w, "    - %s: %s\n", change.PartitionName, change.Action)
+				if change.Action == ActionModify {
+					fmt.Fprintf(w, "        bound changed from %s to %s\n", change.OldPartition.Bound, change.NewPartition.Bound)
+				}
 			}
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 }
 
-func displayDataDiff(tableName string, diff *DataDiff) {
-	fmt.Printf("Table: %s\n", tableName)
-	fmt.Printf("  Rows added: %d\n", len(diff.RowsAdded))
-	fmt.Printf("  Rows deleted: %d\n", len(diff.RowsDeleted))
-	fmt.Printf("  Rows modified: %d\n", len(diff.RowsModified))
-	fmt.Println()
+// versioningChange describes a SystemVersioningChanged diff
+func versioningChange(diff *SchemaDiff) string {
+	if diff.NewSchema.SystemVersioning != nil {
+		return "added"
+	}
+	return "removed"
+}
+
+// partitioningKey describes how a table is partitioned, e.g. "RANGE (id)"
+func partitioningKey(tableSchema *schema.TableSchema) string {
+	if tableSchema.Partitioning == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s (%s)", tableSchema.Partitioning.Method, tableSchema.Partitioning.Expression)
+}
+
+// writeAttributeTable writes a column's changed attributes with their old and
+// new values side by side
+func writeAttributeTable(w io.Writer, change ColumnChange) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "        attribute\told\tnew")
+	for _, attr := range change.ChangedAttributes {
+		fmt.Fprintf(tw, "        %s\t%s\t%s\n", attr,
+			ColumnAttribute(change.OldColumn, attr), ColumnAttribute(change.NewColumn, attr))
+	}
+	tw.Flush()
+}
+
+// writeIndented writes multi-line text indented under a table entry
+func writeIndented(w io.Writer, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
+
+// displayDataDiff writes one table's changed row counts, and the key and
+// changed columns of up to showRows modified rows (0: none, negative: all)
+func displayDataDiff(w io.Writer, tableName string, diff *DataDiff, showRows int) {
+	counts := diff.ChangedRows()
+	fmt.Fprintf(w, "Table: %s\n", tableName)
+	fmt.Fprintf(w, "  Rows added: %d\n", counts.Added)
+	fmt.Fprintf(w, "  Rows deleted: %d\n", counts.Deleted)
+	fmt.Fprintf(w, "  Rows modified: %d\n", counts.Modified)
+	for i, mod := range diff.RowsModified {
+		if showRows >= 0 && i >= showRows {
+			if i > 0 {
+				fmt.Fprintf(w, "    ... %d more modified rows\n", len(diff.RowsModified)-i)
+			}
+			break
+		}
+		fmt.Fprintf(w, "    %s\n", formatRowKey(mod.Key))
+		for _, col := range mod.ChangedColumns {
+			fmt.Fprintf(w, "      %s: %s → %s\n", col, formatValue(mod.OldRow[col]), formatValue(mod.NewRow[col]))
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// formatRowKey writes a modified row's key as col=value pairs
+func formatRowKey(key schema.Row) string {
+	parts := make([]string, 0, len(key))
+	for _, col := range SortedKeys(key) {
+		parts = append(parts, fmt.Sprintf("%s=%s", col, formatValue(key[col])))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatValue writes a value as JSON, which quotes strings and shows NULL
+// as null
+func formatValue(val interface{}) string {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%v", val)
+	}
+	return string(data)
+}
+
+// OrderedKeys returns the keys of a table-name keyed map in the given table
+// order, with tables missing from it last in sorted order. Without an order
+// the keys are sorted.
+func OrderedKeys[T any](m map[string]T, order []string) []string {
+	keys := SortedKeys(m)
+	if order == nil {
+		return keys
+	}
+	position := make(map[string]int, len(order))
+	for i, tableName := range order {
+		position[tableName] = i
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		pi, okI := position[keys[i]]
+		pj, okJ := position[keys[j]]
+		if okI != okJ {
+			return okI
+		}
+		return okI && pi < pj
+	})
+	return keys
+}
+
+// SortedKeys returns the keys of a table-name keyed map in sorted order
+func SortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,122 @@
+package diff
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestDisplayToGolden(t *testing.T) {
+	pk := schema.Index{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true}
+	users := func(columns []schema.Column, indexes []schema.Index, rows []schema.Row) *schema.Table {
+		return &schema.Table{Schema: schema.TableSchema{Name: "users", Columns: columns, Indexes: indexes}, Data: rows}
+	}
+	snap1 := &snapshot.Snapshot{Metadata: map[string]string{"db_type": "mysql", "collations": "true"}, Tables: map[string]*schema.Table{
+		"users": users([]schema.Column{
+			{Name: "id", Type: "int", Position: 1},
+			{Name: "name", Type: "varchar(50)", Position: 2},
+			{Name: "email", Type: "varchar(255)", Position: 3},
+		}, []schema.Index{pk}, []schema.Row{
+			{"id": 1, "name": "alice", "email": "a@example.com"},
+			{"id": 2, "name": "bob", "email": "b@example.com"},
+		}),
+		"sessions": {Schema: schema.TableSchema{Name: "sessions", Columns: []schema.Column{{Name: "id", Type: "int", Position: 1}}, Indexes: []schema.Index{pk}}},
+	}}
+	snap2 := &snapshot.Snapshot{Metadata: map[string]string{"db_type": "mysql", "collations": "true"}, Tables: map[string]*schema.Table{
+		"users": users([]schema.Column{
+			{Name: "id", Type: "int", Position: 1},
+			{Name: "name", Type: "varchar(100)", Position: 2},
+			{Name: "email", Type: "varchar(255)", Nullable: true, Position: 3},
+			{Name: "active", Type: "tinyint(1)", Position: 4},
+		}, []schema.Index{pk, {Name: "idx_email", Columns: []string{"email"}, Unique: true}}, []schema.Row{
+			{"id": 1, "name": "alice", "email": "alice@example.com", "active": 1},
+			{"id": 3, "name": "carol", "email": "c@example.com", "active": 1},
+		}),
+		"orders": {Schema: schema.TableSchema{Name: "orders", Columns: []schema.Column{{Name: "id", Type: "int", Position: 1}}, Indexes: []schema.Index{pk}}},
+	}}
+
+	var buf bytes.Buffer
+	DisplayTo(Compare(snap1, snap2, Options{IgnoreColumns: []string{"active"}}), &buf)
+
+	golden := filepath.Join("testdata", "display.golden")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("DisplayTo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDisplayTableOrder(t *testing.T) {
+	table := func(name string) *schema.Table {
+		return &schema.Table{Schema: schema.TableSchema{Name: name, Columns: []schema.Column{{Name: "id", Type: "int", Position: 1}}}}
+	}
+	snap := func(order string, names ...string) *snapshot.Snapshot {
+		s := &snapshot.Snapshot{Metadata: map[string]string{"db_type": "mysql"}, Tables: make(map[string]*schema.Table)}
+		if order != "" {
+			s.Metadata["table_order"] = order
+		}
+		for _, name := range names {
+			s.Tables[name] = table(name)
+		}
+		return s
+	}
+	tests := []struct {
+		name       string
+		snap1      *snapshot.Snapshot
+		snap2      *snapshot.Snapshot
+		wantOrder  []string
+		wantTables []string
+	}{
+		{
+			name:       "recorded order",
+			snap1:      snap("legacy", "legacy"),
+			snap2:      snap("zones,accounts,bookings", "zones", "accounts", "bookings"),
+			wantOrder:  []string{"zones", "accounts", "bookings", "legacy"},
+			wantTables: []string{"zones", "accounts", "bookings", "legacy"},
+		},
+		{
+			name:       "name order",
+			snap1:      snap("", "legacy"),
+			snap2:      snap("", "zones", "accounts", "bookings"),
+			wantTables: []string{"accounts", "bookings", "legacy", "zones"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Compare(tt.snap1, tt.snap2, Options{})
+			if !reflect.DeepEqual(result.TableOrder, tt.wantOrder) {
+				t.Errorf("TableOrder = %v, want %v", result.TableOrder, tt.wantOrder)
+			}
+
+			var text, markdown bytes.Buffer
+			DisplayTo(result, &text)
+			DisplayMarkdown(result, &markdown)
+			for format, out := range map[string]string{"text": text.String(), "markdown": markdown.String()} {
+				last := -1
+				for _, name := range tt.wantTables {
+					i := strings.Index(out, name)
+					if i < 0 || i < last {
+						t.Errorf("%s output lists %s out of order %v:\n%s", format, name, tt.wantTables, out)
+					}
+					last = i
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// RowFilter restricts the data comparison of a table to rows matching a
+// simple predicate on one column, such as status = 'active' or id >= 100
+type RowFilter struct {
+	Column string
+	Op     string // =, !=, <, <=, > or >=
+	Value  string
+	quoted bool // the value was a quoted string, compared as text
+	null   bool // the value was NULL: = and != test for NULL
+}
+
+var rowFilterPattern = regexp.MustCompile(`^\s*(\w+)\s*(<=|>=|!=|<>|=|<|>)\s*(.*?)\s*$`)
+
+// ParseRowFilter parses a "table:column op value" filter specification. The
+// value is a number, a 'quoted' string or NULL.
+func ParseRowFilter(spec string) (string, *RowFilter, error) {
+	tableName, expr, ok := strings.Cut(spec, ":")
+	if !ok || tableName == "" {
+		return "", nil, fmt.Errorf("invalid row filter %q (expected table:column op value)", spec)
+	}
+	m := rowFilterPattern.FindStringSubmatch(expr)
+	if m == nil || m[3] == "" {
+		return "", nil, fmt.Errorf("invalid row filter %q (expected table:column op value)", spec)
+	}
+
+	f := &RowFilter{Column: m[1], Op: m[2], Value: m[3]}
+	if f.Op == "<>" {
+		f.Op = "!="
+	}
+	switch {
+	case len(f.Value) >= 2 && strings.HasPrefix(f.Value, "'") && strings.HasSuffix(f.Value, "'"):
+		f.Value = strings.ReplaceAll(f.Value[1:len(f.Value)-1], "''", "'")
+		f.quoted = true
+	case strings.EqualFold(f.Value, "NULL"):
+		if f.Op != "=" && f.Op != "!=" {
+			return "", nil, fmt.Errorf("invalid row filter %q: NULL can only be compared with = or !=", spec)
+		}
+		f.null = true
+	}
+	return tableName, f, nil
+}
+
+// Match reports whether a row satisfies the filter. As in SQL, a NULL value
+// only matches a NULL comparison.
+func (f *RowFilter) Match(row schema.Row) bool {
+	val := row[f.Column]
+	if f.null {
+		return (val == nil) == (f.Op == "=")
+	}
+	if val == nil {
+		return false
+	}
+
+	var cmp int
+	a, aErr := strconv.ParseFloat(fmt.Sprint(val), 64)
+	b, bErr := strconv.ParseFloat(f.Value, 64)
+	if !f.quoted && aErr == nil && bErr == nil {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(fmt.Sprint(val), f.Value)
+	}
+
+	switch f.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// filterRows returns the rows matching the filter
+func filterRows(rows []schema.Row, f *RowFilter) []schema.Row {
+	var matched []schema.Row
+	for _, row := range rows {
+		if f.Match(row) {
+			matched = append(matched, row)
+		}
+	}
+	return matched
+}
+
+// CheckRowFilters verifies that each filter refers to a table present in
+// either snapshot and to a column that table has
+func CheckRowFilters(snap1, snap2 *snapshot.Snapshot, filters map[string]*RowFilter) error {
+	for tableName, f := range filters {
+		found := false
+		for _, snap := range []*snapshot.Snapshot{snap1, snap2} {
+			table, ok := snap.Tables[tableName]
+			if !ok {
+				continue
+			}
+			found = true
+			if !hasColumn(&table.Schema, f.Column) {
+				return fmt.Errorf("row filter column %s does not exist in table %s", f.Column, tableName)
+			}
+		}
+		if !found {
+			return fmt.Errorf("row filter table %s not found in either snapshot", tableName)
+		}
+	}
+	return nil
+}
+
+func hasColumn(tableSchema *schema.TableSchema, name string) bool {
+	for _, col := range tableSchema.Columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestParseRowFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		wantTable string
+		want      *RowFilter
+		wantErr   bool
+	}{
+		{name: "number", spec: "users:id >= 100", wantTable: "users", want: &RowFilter{Column: "id", Op: ">=", Value: "100"}},
+		{name: "quoted", spec: "users:status='it''s'", wantTable: "users", want: &RowFilter{Column: "status", Op: "=", Value: "it's", quoted: true}},
+		{name: "not equal", spec: "users:status <> 'x'", wantTable: "users", want: &RowFilter{Column: "status", Op: "!=", Value: "x", quoted: true}},
+		{name: "null", spec: "users:deleted_at = NULL", wantTable: "users", want: &RowFilter{Column: "deleted_at", Op: "=", Value: "NULL", null: true}},
+		{name: "no table", spec: "id = 1", wantErr: true},
+		{name: "empty table", spec: ":id = 1", wantErr: true},
+		{name: "no operator", spec: "users:id", wantErr: true},
+		{name: "no value", spec: "users:id =", wantErr: true},
+		{name: "no column", spec: "users:= 1", wantErr: true},
+		{name: "null ordered", spec: "users:deleted_at < NULL", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tableName, got, err := ParseRowFilter(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRowFilter(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tableName != tt.wantTable || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRowFilter(%q) = %q, %+v, want %q, %+v", tt.spec, tableName, got, tt.wantTable, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowFilterMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		row  schema.Row
+		want bool
+	}{
+		{name: "equal string", spec: "t:status = 'active'", row: schema.Row{"status": "active"}, want: true},
+		{name: "other string", spec: "t:status = 'active'", row: schema.Row{"status": "inactive"}},
+		{name: "numeric not text order", spec: "t:id >= 9", row: schema.Row{"id": int64(10)}, want: true},
+		{name: "quoted number compared as text", spec: "t:id >= '9'", row: schema.Row{"id": int64(10)}},
+		{name: "less than", spec: "t:score < 1.5", row: schema.Row{"score": 1.25}, want: true},
+		{name: "null value", spec: "t:id != 1", row: schema.Row{"id": nil}},
+		{name: "is null", spec: "t:deleted_at = NULL", row: schema.Row{"deleted_at": nil}, want: true},
+		{name: "is not null", spec: "t:deleted_at != NULL", row: schema.Row{"deleted_at": "2024-01-01"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, f, err := ParseRowFilter(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Match(tt.row); got != tt.want {
+				t.Errorf("Match(%v) = %v, want %v", tt.row, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRowFilters(t *testing.T) {
+	snap := &snapshot.Snapshot{Tables: map[string]*schema.Table{
+		"users": {Schema: schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "status"}}}},
+	}}
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "existing column", spec: "users:status = 'active'"},
+		{name: "missing column", spec: "users:state = 'active'", wantErr: true},
+		{name: "missing table", spec: "accounts:status = 'active'", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tableName, f, err := ParseRowFilter(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckRowFilters(snap, snap, map[string]*RowFilter{tableName: f})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckRowFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompareRowFilter(t *testing.T) {
+	snap := func(rows ...schema.Row) *snapshot.Snapshot {
+		return &snapshot.Snapshot{Tables: map[string]*schema.Table{"users": {
+			Schema: schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id"}, {Name: "status"}, {Name: "name"}},
+				Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}},
+			Data: rows,
+		}}}
+	}
+	snap1 := snap(schema.Row{"id": 1, "status": "active", "name": "a"}, schema.Row{"id": 2, "status": "inactive", "name": "b"})
+	snap2 := snap(schema.Row{"id": 1, "status": "active", "name": "A"}, schema.Row{"id": 2, "status": "inactive", "name": "B"})
+	_, f, err := ParseRowFilter("users:status = 'active'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := Compare(snap1, snap2, Options{RowFilters: map[string]*RowFilter{"users": f}})
+	d := result.DataDiffs["users"]
+	if d == nil || len(d.RowsModified) != 1 || d.RowsModified[0].NewRow["id"] != 1 {
+		t.Fatalf("data diff = %+v, want only the active row modified", d)
+	}
+}
@@ -0,0 +1,116 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// WriteGitHubAnnotations writes the differences as GitHub Actions workflow
+// commands: a ::warning:: per table that differs unexpectedly and a
+// ::notice:: per table whose differences were allowed
+func WriteGitHubAnnotations(result, expected *DiffResult, w io.Writer) {
+	if !result.HasDifferences() && !expected.HasDifferences() {
+		fmt.Fprintln(w, githubCommand("notice", "db-diff", "No differences found."))
+		return
+	}
+	writeGitHubAnnotations(w, result, "warning", "")
+	writeGitHubAnnotations(w, expected, "notice", " (allowed)")
+}
+
+func writeGitHubAnnotations(w io.Writer, result *DiffResult, level, suffix string) {
+	for _, tableName := range OrderedKeys(result.SchemaDiffs, result.TableOrder) {
+		schemaDiff := result.SchemaDiffs[tableName]
+		message := fmt.Sprintf("%s: %s", tableName, strings.Join(schemaChangeSummary(schemaDiff), ", "))
+		fmt.Fprintln(w, githubCommand(level, "Schema difference"+suffix, message))
+	}
+	for _, name := range SortedKeys(result.MaterializedViewDiffs) {
+		viewDiff := result.MaterializedViewDiffs[name]
+		message := fmt.Sprintf("%s: %s", name, strings.Join(viewDiff.changes(), ", "))
+		fmt.Fprintln(w, githubCommand(level, "Materialized view difference"+suffix, message))
+	}
+	for _, tableName := range OrderedKeys(result.DataDiffs, result.TableOrder) {
+		counts := result.DataDiffs[tableName].ChangedRows()
+		message := fmt.Sprintf("%s: %d added, %d deleted, %d modified", tableName,
+			counts.Added, counts.Deleted, counts.Modified)
+		fmt.Fprintln(w, githubCommand(level, "Data difference"+suffix, message))
+	}
+}
+
+// schemaChangeSummary describes a table's schema changes in one line each,
+// without Markdown
+func schemaChangeSummary(schemaDiff *SchemaDiff) []string {
+	switch schemaDiff.Action {
+	case ActionAdd:
+		return []string{"table added"}
+	case ActionDrop:
+		return []string{"table dropped"}
+	}
+
+	var changes []string
+	if schemaDiff.AutoIncrementChanged {
+		changes = append(changes, "auto increment changed")
+	}
+	if schemaDiff.SystemVersioningChanged {
+		changes = append(changes, "system versioning "+versioningChange(schemaDiff))
+	}
+	for _, change := range schemaDiff.ColumnChanges {
+		changes = append(changes, fmt.Sprintf("column %s %s", change.ColumnName, change.Action))
+	}
+	for _, change := range schemaDiff.IndexChanges {
+		changes = append(changes, fmt.Sprintf("index %s %s", change.IndexName, change.Action))
+	}
+	for _, change := range schemaDiff.ForeignKeyChanges {
+		changes = append(changes, fmt.Sprintf("foreign key %s %s", change.FKName, change.Action))
+	}
+	for _, change := range schemaDiff.RuleChanges {
+		changes = append(changes, fmt.Sprintf("rule %s %s", change.RuleName, change.Action))
+	}
+	for _, change := range schemaDiff.CheckChanges {
+		changes = append(changes, fmt.Sprintf("check %s %s", change.CheckName, change.Action))
+	}
+	if schemaDiff.PartitioningChanged {
+		changes = append(changes, "partitioning changed")
+	}
+	if schemaDiff.ColumnOrderChanged {
+		changes = append(changes, "column order changed")
+	}
+	for _, change := range schemaDiff.PartitionChanges {
+		changes = append(changes, fmt.Sprintf("partition %s %s", change.PartitionName, change.Action))
+	}
+	return changes
+}
+
+// githubCommand formats a workflow command, escaping the title and message
+// the way the Actions runner expects
+func githubCommand(level, title, message string) string {
+	return fmt.Sprintf("::%s title=%s::%s", level, githubEscapeProperty(title), githubEscapeData(message))
+}
+
+func githubEscapeData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+func githubEscapeProperty(s string) string {
+	s = githubEscapeData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, ",", "%2C")
+}
+
+// AppendStepSummary appends the Markdown report to a GitHub Actions step
+// summary file (the path in $GITHUB_STEP_SUMMARY)
+func AppendStepSummary(result, expected *DiffResult, path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open step summary: %w", err)
+	}
+	DisplayMarkdown(result, f)
+	DisplayMarkdownExpected(expected, f)
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write step summary: %w", err)
+	}
+	return nil
+}
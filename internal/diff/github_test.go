@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestWriteGitHubAnnotations(t *testing.T) {
+	empty := &DiffResult{}
+	result := &DiffResult{
+		SchemaDiffs: map[string]*SchemaDiff{
+			"orders": {TableName: "orders", Action: ActionAdd, NewSchema: &schema.TableSchema{Name: "orders"}},
+			"users": {TableName: "users", Action: ActionModify, ColumnChanges: []ColumnChange{
+				{ColumnName: "email", Action: ActionModify},
+				{ColumnName: "nick:name", Action: ActionAdd},
+			}},
+		},
+		DataDiffs: map[string]*DataDiff{
+			"users": {TableName: "users", RowsAdded: []schema.Row{{"id": 3}}, RowsModified: []RowModification{{}, {}}},
+		},
+	}
+	expected := &DiffResult{
+		DataDiffs: map[string]*DataDiff{"audit_log": {TableName: "audit_log", RowsDeleted: []schema.Row{{"id": 1}}}},
+	}
+	tests := []struct {
+		name             string
+		result, expected *DiffResult
+		want             string
+	}{
+		{name: "no differences", result: empty, expected: empty, want: "::notice title=db-diff::No differences found.\n"},
+		{name: "differences", result: result, expected: expected, want: "" +
+			"::warning title=Schema difference::orders: table added\n" +
+			"::warning title=Schema difference::users: column email MODIFY, column nick:name ADD\n" +
+			"::warning title=Data difference::users: 1 added, 0 deleted, 2 modified\n" +
+			"::notice title=Data difference (allowed)::audit_log: 0 added, 1 deleted, 0 modified\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			WriteGitHubAnnotations(tt.result, tt.expected, &buf)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("WriteGitHubAnnotations() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHubCommandEscaping(t *testing.T) {
+	got := githubCommand("warning", "a: b, c", "100% done\r\nnext")
+	want := "::warning title=a%3A b%2C c::100%25 done%0D%0Anext"
+	if got != want {
+		t.Errorf("githubCommand() = %q, want %q", got, want)
+	}
+}
+
+func TestAppendStepSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.md")
+	if err := os.WriteFile(path, []byte("# Earlier step\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result := &DiffResult{SchemaDiffs: map[string]*SchemaDiff{"orders": {TableName: "orders", Action: ActionAdd, NewSchema: &schema.TableSchema{Name: "orders"}}}}
+	for i := 0; i < 2; i++ {
+		if err := AppendStepSummary(result, &DiffResult{}, path); err != nil {
+			t.Fatalf("AppendStepSummary() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report bytes.Buffer
+	DisplayMarkdown(result, &report)
+	DisplayMarkdownExpected(&DiffResult{}, &report)
+	want := "# Earlier step\n" + strings.Repeat(report.String(), 2)
+	if got := string(data); got != want {
+		t.Errorf("step summary =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// SplitHints looks for dropped tables whose columns all reappear spread over
+// two or more added tables that each repeat the dropped table's primary
+// key, which suggests the table was split vertically. Requiring the key
+// keeps columns many tables have, such as created_at, from pairing
+// unrelated tables; a dropped table without a primary key gets no hint.
+// Hints are only given when result.HintSplits is set, and are
+// informational only; no SQL is generated from them.
+func SplitHints(result *DiffResult) []string {
+	if !result.HintSplits {
+		return nil
+	}
+	var dropped, added []*schema.TableSchema
+	for _, tableName := range SortedKeys(result.SchemaDiffs) {
+		schemaDiff := result.SchemaDiffs[tableName]
+		switch schemaDiff.Action {
+		case ActionDrop:
+			dropped = append(dropped, schemaDiff.OldSchema)
+		case ActionAdd:
+			added = append(added, schemaDiff.NewSchema)
+		}
+	}
+	if len(dropped) == 0 || len(added) < 2 {
+		return nil
+	}
+
+	var hints []string
+	for _, old := range dropped {
+		pkColumns := old.PrimaryKeyColumns()
+		if len(pkColumns) == 0 {
+			continue
+		}
+		pk := make(map[string]bool)
+		for _, col := range pkColumns {
+			pk[col] = true
+		}
+
+		remaining := make(map[string]bool)
+		for _, col := range old.Columns {
+			if !pk[col.Name] {
+				remaining[col.Name] = true
+			}
+		}
+		if len(remaining) == 0 {
+			continue
+		}
+
+		var targets []string
+		covered := make(map[string]bool)
+		for _, candidate := range added {
+			if !hasColumns(candidate, pkColumns) {
+				continue
+			}
+			overlap := false
+			for _, col := range candidate.Columns {
+				if remaining[col.Name] {
+					covered[col.Name] = true
+					overlap = true
+				}
+			}
+			if overlap {
+				targets = append(targets, candidate.Name)
+			}
+		}
+
+		if len(targets) < 2 || len(covered) != len(remaining) {
+			continue
+		}
+		hints = append(hints, fmt.Sprintf("table %s may have been split into %s",
+			old.Name, strings.Join(targets, ", ")))
+	}
+
+	sort.Strings(hints)
+	return hints
+}
+
+// hasColumns reports whether a table has every one of the named columns
+func hasColumns(tableSchema *schema.TableSchema, names []string) bool {
+	for _, name := range names {
+		if !hasColumn(tableSchema, name) {
+			return false
+		}
+	}
+	return true
+}
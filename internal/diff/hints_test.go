@@ -0,0 +1,55 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestSplitHints(t *testing.T) {
+	table := func(name string, pk []string, columns ...string) *schema.TableSchema {
+		ts := &schema.TableSchema{Name: name}
+		for _, col := range columns {
+			ts.Columns = append(ts.Columns, schema.Column{Name: col})
+		}
+		if pk != nil {
+			ts.Indexes = []schema.Index{{Name: "PRIMARY", Columns: pk, Primary: true}}
+		}
+		return ts
+	}
+	id := []string{"id"}
+	users := table("users", id, "id", "email", "bio", "created_at")
+	tests := []struct {
+		name       string
+		hintSplits bool
+		dropped    *schema.TableSchema
+		added      []*schema.TableSchema
+		want       []string
+	}{
+		{name: "split", hintSplits: true, dropped: users,
+			added: []*schema.TableSchema{table("accounts", id, "id", "email", "created_at"), table("profiles", id, "id", "bio")},
+			want:  []string{"table users may have been split into accounts, profiles"}},
+		{name: "not requested", dropped: users,
+			added: []*schema.TableSchema{table("accounts", id, "id", "email", "created_at"), table("profiles", id, "id", "bio")}},
+		{name: "no match", hintSplits: true, dropped: users,
+			added: []*schema.TableSchema{table("orders", id, "id", "total"), table("items", id, "id", "sku")}},
+		{name: "only a shared timestamp", hintSplits: true, dropped: users,
+			added: []*schema.TableSchema{table("accounts", id, "id", "email", "bio"), table("audit_log", []string{"log_id"}, "log_id", "created_at")}},
+		{name: "dropped table without a key", hintSplits: true, dropped: table("users", nil, "id", "email", "bio"),
+			added: []*schema.TableSchema{table("accounts", id, "id", "email"), table("profiles", id, "id", "bio")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &DiffResult{SchemaDiffs: map[string]*SchemaDiff{
+				tt.dropped.Name: {TableName: tt.dropped.Name, Action: ActionDrop, OldSchema: tt.dropped},
+			}, HintSplits: tt.hintSplits}
+			for _, ts := range tt.added {
+				result.SchemaDiffs[ts.Name] = &SchemaDiff{TableName: ts.Name, Action: ActionAdd, NewSchema: ts}
+			}
+			if got := SplitHints(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitHints() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package diff
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// htmlPage is the data of the HTML report: the differences, followed by the
+// differences an allowlist allowed
+type htmlPage struct {
+	HasDifferences bool
+	Sections       []htmlSection
+}
+
+type htmlSection struct {
+	Title  string
+	Tables []htmlTable
+	Views  []htmlView
+	Hints  []string
+	Totals RowCounts
+}
+
+// htmlTable is a changed table with its schema changes and changed rows
+type htmlTable struct {
+	Name          string
+	Anchor        string
+	SchemaAction  Action
+	SchemaChanges []string
+	HasData       bool
+	CountOnly     bool
+	Counts        RowCounts
+	Added         *htmlRows
+	Deleted       *htmlRows
+	Modified      *htmlRows
+}
+
+type htmlView struct {
+	Name    string
+	Action  Action
+	Changes []string
+}
+
+// htmlRows is a table of added, deleted or modified rows (Class). Cells of
+// modified rows keep the old value when it differs.
+type htmlRows struct {
+	Class   string
+	Columns []string
+	Rows    [][]htmlCell
+}
+
+type htmlCell struct {
+	Value   string
+	Old     string
+	Null    bool
+	Changed bool
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Database Differences</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; margin: 0.5em 0 1em; }
+th, td { border: 1px solid #d0d7de; padding: 0.25em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+td.num { text-align: right; }
+details { border: 1px solid #d0d7de; border-radius: 6px; margin: 0.5em 0; padding: 0.5em 1em; }
+summary { cursor: pointer; font-weight: 600; }
+.counts { font-weight: normal; color: #57606a; }
+.added { background: #dafbe1; }
+.deleted { background: #ffebe9; }
+.modified { background: #fff8c5; }
+td.changed { background: #ffd8b5; }
+.null { color: #8c959f; font-style: italic; }
+.hint { background: #ddf4ff; padding: 0.5em 1em; border-radius: 6px; }
+del { color: #cf222e; }
+ins { color: #1a7f37; text-decoration: none; }
+</style>
+</head>
+<body>
+<h1>Database Differences</h1>
+{{- if not .HasDifferences}}
+<p>No differences found.</p>
+{{- end}}
+{{- range .Sections}}
+<h2>{{.Title}}</h2>
+{{- if .Tables}}
+<table>
+<thead><tr><th>Table</th><th>Schema</th><th>Added</th><th>Deleted</th><th>Modified</th></tr></thead>
+<tbody>
+{{- range .Tables}}
+<tr><td><a href="#{{.Anchor}}">{{.Name}}</a></td><td>{{.SchemaAction}}</td>
+{{- if .HasData}}<td class="num added">{{.Counts.Added}}</td><td class="num deleted">{{.Counts.Deleted}}</td><td class="num modified">{{.Counts.Modified}}</td>
+{{- else}}<td></td><td></td><td></td>{{end}}</tr>
+{{- end}}
+</tbody>
+<tfoot><tr><th>Total</th><th></th><th class="num">{{.Totals.Added}}</th><th class="num">{{.Totals.Deleted}}</th><th class="num">{{.Totals.Modified}}</th></tr></tfoot>
+</table>
+{{- end}}
+{{- range .Hints}}
+<p class="hint"><strong>Hint:</strong> {{.}}</p>
+{{- end}}
+{{- if .Views}}
+<h3>Materialized Views</h3>
+<table>
+<thead><tr><th>View</th><th>Action</th><th>Changes</th></tr></thead>
+<tbody>
+{{- range .Views}}
+<tr><td>{{.Name}}</td><td>{{.Action}}</td><td>{{range $i, $c := .Changes}}{{if $i}}<br>{{end}}{{$c}}{{end}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+{{- range .Tables}}
+<details id="{{.Anchor}}">
+<summary>{{.Name}}{{if .HasData}} <span class="counts">(+{{.Counts.Added}} −{{.Counts.Deleted}} ~{{.Counts.Modified}})</span>{{end}}</summary>
+{{- if .SchemaChanges}}
+<h4>Schema: {{.SchemaAction}}</h4>
+<ul>
+{{- range .SchemaChanges}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .CountOnly}}
+<p>Only the numbers of changed rows were compared.</p>
+{{- end}}
+{{- with .Added}}
+<h4>Added</h4>
+{{template "rows" .}}
+{{- end}}
+{{- with .Deleted}}
+<h4>Deleted</h4>
+{{template "rows" .}}
+{{- end}}
+{{- with .Modified}}
+<h4>Modified</h4>
+{{template "rows" .}}
+{{- end}}
+</details>
+{{- end}}
+{{- end}}
+</body>
+</html>
+{{define "rows"}}<table class="{{.Class}}">
+<thead><tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{- range .Rows}}
+<tr>{{range .}}{{if .Changed}}<td class="changed"><del>{{.Old}}</del> → <ins>{{.Value}}</ins></td>{{else if .Null}}<td class="null">NULL</td>{{else}}<td>{{.Value}}</td>{{end}}{{end}}</tr>
+{{- end}}
+</tbody>
+</table>{{end}}
+`))
+
+// RenderHTML writes the diff result as a self-contained HTML page for
+// sharing with people who do not read SQL: a summary table of the changed
+// rows, then a collapsible section per table with its schema changes and
+// its added, deleted and modified rows. The differences allowed by an
+// allowlist follow when expected has any. All names and values are escaped.
+func RenderHTML(result, expected *DiffResult, w io.Writer) error {
+	page := htmlPage{HasDifferences: result.HasDifferences()}
+	if page.HasDifferences {
+		page.Sections = append(page.Sections, newHTMLSection("Differences", "table", result))
+	}
+	if expected != nil && expected.HasDifferences() {
+		page.Sections = append(page.Sections, newHTMLSection("Expected Differences (allowed)", "expected", expected))
+	}
+	if err := htmlReport.Execute(w, page); err != nil {
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	return nil
+}
+
+func newHTMLSection(title, anchorPrefix string, result *DiffResult) htmlSection {
+	section := htmlSection{Title: title, Hints: SplitHints(result)}
+
+	tableNames := make(map[string]bool)
+	for tableName := range result.SchemaDiffs {
+		tableNames[tableName] = true
+	}
+	for tableName := range result.DataDiffs {
+		tableNames[tableName] = true
+	}
+	for i, tableName := range OrderedKeys(tableNames, result.TableOrder) {
+		table := htmlTable{Name: tableName, Anchor: fmt.Sprintf("%s-%d", anchorPrefix, i+1)}
+		if schemaDiff, ok := result.SchemaDiffs[tableName]; ok {
+			table.SchemaAction = schemaDiff.Action
+			table.SchemaChanges = schemaChangeSummary(schemaDiff)
+		}
+		if dataDiff, ok := result.DataDiffs[tableName]; ok {
+			table.HasData = true
+			table.Counts = dataDiff.ChangedRows()
+			table.CountOnly = dataDiff.Counts != nil
+			section.Totals.Added += table.Counts.Added
+			section.Totals.Deleted += table.Counts.Deleted
+			section.Totals.Modified += table.Counts.Modified
+			table.Added = newHTMLRows("added", dataDiff.RowsAdded, nil)
+			table.Deleted = newHTMLRows("deleted", dataDiff.RowsDeleted, nil)
+			if len(dataDiff.RowsModified) > 0 {
+				rows := make([]schema.Row, len(dataDiff.RowsModified))
+				old := make([]schema.Row, len(dataDiff.RowsModified))
+				for i, mod := range dataDiff.RowsModified {
+					rows[i] = mod.NewRow
+					old[i] = mod.OldRow
+				}
+				table.Modified = newHTMLRows("modified", rows, old)
+			}
+		}
+		section.Tables = append(section.Tables, table)
+	}
+
+	for _, viewName := range SortedKeys(result.MaterializedViewDiffs) {
+		viewDiff := result.MaterializedViewDiffs[viewName]
+		section.Views = append(section.Views, htmlView{Name: viewName, Action: viewDiff.Action, Changes: viewDiff.changes()})
+	}
+	return section
+}
+
+// newHTMLRows lays out rows by the union of their columns. When old is
+// given, cells whose value differs from the old row are marked changed.
+func newHTMLRows(class string, rows, old []schema.Row) *htmlRows {
+	if len(rows) == 0 {
+		return nil
+	}
+	columnSet := make(map[string]bool)
+	for _, row := range rows {
+		for col := range row {
+			columnSet[col] = true
+		}
+	}
+	t := &htmlRows{Class: class, Columns: SortedKeys(columnSet)}
+	for i, row := range rows {
+		cells := make([]htmlCell, len(t.Columns))
+		for j, col := range t.Columns {
+			cells[j] = htmlCell{Value: htmlValue(row[col]), Null: row[col] == nil}
+			if old != nil {
+				if oldVal := htmlValue(old[i][col]); oldVal != cells[j].Value {
+					cells[j].Old = oldVal
+					cells[j].Changed = true
+				}
+			}
+		}
+		t.Rows = append(t.Rows, cells)
+	}
+	return t
+}
+
+func htmlValue(val interface{}) string {
+	if val == nil {
+		return "NULL"
+	}
+	return fmt.Sprintf("%v", val)
+}
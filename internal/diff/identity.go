@@ -0,0 +1,335 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// Identity is an expression over a row's columns that identifies the row
+// in the data comparison of a table instead of its primary key, such as
+// lower(email) or concat(a, '-', b). Expressions consist of column names,
+// numbers, 'quoted' strings, NULL, the operators + - * / with parentheses,
+// and the functions lower, upper, trim and concat.
+type Identity struct {
+	Expr    string
+	Columns []string // the columns the expression refers to
+	eval    func(row schema.Row) interface{}
+}
+
+// ParseIdentity parses a "table:expression" identity specification
+func ParseIdentity(spec string) (string, *Identity, error) {
+	tableName, expr, ok := strings.Cut(spec, ":")
+	tableName, expr = strings.TrimSpace(tableName), strings.TrimSpace(expr)
+	if !ok || tableName == "" || expr == "" {
+		return "", nil, fmt.Errorf("invalid identity %q (expected table:expression)", spec)
+	}
+
+	tokens, err := tokenizeIdentity(expr)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid identity %q: %w", spec, err)
+	}
+	p := &identityParser{tokens: tokens, columns: make(map[string]bool)}
+	eval, err := p.parseSum()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid identity %q: %w", spec, err)
+	}
+
+	id := &Identity{Expr: expr, eval: eval}
+	for _, name := range tokens {
+		if p.columns[name] {
+			id.Columns = append(id.Columns, name)
+			delete(p.columns, name)
+		}
+	}
+	return tableName, id, nil
+}
+
+// Value evaluates the expression for a row. As in SQL, arithmetic and
+// functions of NULL are NULL, except concat, which skips NULL arguments as
+// PostgreSQL does; arithmetic on a value that is not a number is NULL too.
+func (id *Identity) Value(row schema.Row) interface{} {
+	return id.eval(row)
+}
+
+// Key returns the comparison key of a row
+func (id *Identity) Key(row schema.Row) string {
+	keyJSON, err := json.Marshal(id.Value(row))
+	if err != nil {
+		return fmt.Sprintf("%v", id.Value(row))
+	}
+	return string(keyJSON)
+}
+
+// CheckIdentities verifies that each identity refers to a table present in
+// either snapshot and only to columns that table has
+func CheckIdentities(snap1, snap2 *snapshot.Snapshot, identities map[string]*Identity) error {
+	for tableName, id := range identities {
+		found := false
+		for _, snap := range []*snapshot.Snapshot{snap1, snap2} {
+			table, ok := snap.Tables[tableName]
+			if !ok {
+				continue
+			}
+			found = true
+			for _, name := range id.Columns {
+				if !hasColumn(&table.Schema, name) {
+					return fmt.Errorf("identity column %s does not exist in table %s", name, tableName)
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("identity table %s not found in either snapshot", tableName)
+		}
+	}
+	return nil
+}
+
+// tokenizeIdentity splits an identity expression into names, numbers,
+// quoted strings (kept with their quotes) and single-character operators
+func tokenizeIdentity(expr string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == '\'' {
+					if j+1 < len(runes) && runes[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (runes[j] == '_' || runes[j] == '.' || unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case strings.ContainsRune("+-*/(),", r):
+			tokens = append(tokens, string(r))
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+// identityParser parses the tokens of an identity expression by recursive
+// descent into a function evaluating it
+type identityParser struct {
+	tokens  []string
+	pos     int
+	columns map[string]bool
+}
+
+func (p *identityParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *identityParser) expect(token string) error {
+	if p.peek() != token {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected %q at end of expression", token)
+		}
+		return fmt.Errorf("expected %q, found %q", token, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+// parseSum parses terms joined by + and -
+func (p *identityParser) parseSum() (func(schema.Row) interface{}, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.tokens[p.pos]
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic(op, left, right)
+	}
+	return left, nil
+}
+
+// parseProduct parses factors joined by * and /
+func (p *identityParser) parseProduct() (func(schema.Row) interface{}, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" || p.peek() == "/" {
+		op := p.tokens[p.pos]
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic(op, left, right)
+	}
+	return left, nil
+}
+
+// parseFactor parses a negation, a parenthesized expression, a literal, a
+// function call or a column
+func (p *identityParser) parseFactor() (func(schema.Row) interface{}, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "-":
+		p.pos++
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic("-", func(schema.Row) interface{} { return 0.0 }, operand), nil
+	case token == "(":
+		p.pos++
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case strings.HasPrefix(token, "'"):
+		p.pos++
+		s := strings.ReplaceAll(token[1:len(token)-1], "''", "'")
+		return func(schema.Row) interface{} { return s }, nil
+	case strings.ContainsRune("+*/),", rune(token[0])):
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+
+	p.pos++
+	if n, err := strconv.ParseFloat(token, 64); err == nil {
+		return func(schema.Row) interface{} { return n }, nil
+	}
+	if strings.EqualFold(token, "NULL") {
+		return func(schema.Row) interface{} { return nil }, nil
+	}
+	if p.peek() == "(" {
+		return p.parseCall(token)
+	}
+	p.columns[token] = true
+	return func(row schema.Row) interface{} { return row[token] }, nil
+}
+
+// parseCall parses the arguments of a function call
+func (p *identityParser) parseCall(name string) (func(schema.Row) interface{}, error) {
+	p.pos++ // (
+	var args []func(schema.Row) interface{}
+	if p.peek() != ")" {
+		for {
+			arg, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek() != "," {
+				break
+			}
+			p.pos++
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	var fn func(string) string
+	switch strings.ToLower(name) {
+	case "concat":
+		return func(row schema.Row) interface{} {
+			var b strings.Builder
+			for _, arg := range args {
+				if val := arg(row); val != nil {
+					b.WriteString(identityText(val))
+				}
+			}
+			return b.String()
+		}, nil
+	case "lower":
+		fn = strings.ToLower
+	case "upper":
+		fn = strings.ToUpper
+	case "trim":
+		fn = strings.TrimSpace
+	default:
+		return nil, fmt.Errorf("unknown function %s (expected lower, upper, trim or concat)", name)
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s takes one argument", name)
+	}
+	return func(row schema.Row) interface{} {
+		val := args[0](row)
+		if val == nil {
+			return nil
+		}
+		return fn(identityText(val))
+	}, nil
+}
+
+// arithmetic applies an arithmetic operator to two operands
+func arithmetic(op string, left, right func(schema.Row) interface{}) func(schema.Row) interface{} {
+	return func(row schema.Row) interface{} {
+		a, okA := identityNumber(left(row))
+		b, okB := identityNumber(right(row))
+		if !okA || !okB {
+			return nil
+		}
+		switch op {
+		case "+":
+			return a + b
+		case "-":
+			return a - b
+		case "*":
+			return a * b
+		default:
+			if b == 0 {
+				return nil
+			}
+			return a / b
+		}
+	}
+}
+
+func identityNumber(val interface{}) (float64, bool) {
+	if val == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(identityText(val), 64)
+	return n, err == nil
+}
+
+func identityText(val interface{}) string {
+	if n, ok := val.(float64); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return fmt.Sprint(val)
+}
@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestIdentityValue(t *testing.T) {
+	row := schema.Row{"email": " Alice@Example.com ", "a": "x", "b": int64(7), "price": 2.5, "qty": int64(4), "note": nil}
+	tests := []struct {
+		expr        string
+		want        interface{}
+		wantColumns []string
+	}{
+		{expr: "lower(trim(email))", want: "alice@example.com", wantColumns: []string{"email"}},
+		{expr: "upper(a)", want: "X", wantColumns: []string{"a"}},
+		{expr: "concat(a, '-', b)", want: "x-7", wantColumns: []string{"a", "b"}},
+		{expr: "concat(a, note)", want: "x", wantColumns: []string{"a", "note"}},
+		{expr: "price * qty + 1", want: 11.0, wantColumns: []string{"price", "qty"}},
+		{expr: "price * (qty + 1)", want: 12.5, wantColumns: []string{"price", "qty"}},
+		{expr: "-b / 2", want: -3.5, wantColumns: []string{"b"}},
+		{expr: "b / 0", want: nil, wantColumns: []string{"b"}},
+		{expr: "lower(note)", want: nil, wantColumns: []string{"note"}},
+		{expr: "a + 1", want: nil, wantColumns: []string{"a"}},
+		{expr: "'it''s'", want: "it's"},
+		{expr: "concat(b, b)", want: "77", wantColumns: []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, id, err := ParseIdentity("t:" + tt.expr)
+			if err != nil {
+				t.Fatalf("ParseIdentity() error = %v", err)
+			}
+			if got := id.Value(row); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Value() = %#v, want %#v", got, tt.want)
+			}
+			if !reflect.DeepEqual(id.Columns, tt.wantColumns) {
+				t.Errorf("Columns = %v, want %v", id.Columns, tt.wantColumns)
+			}
+		})
+	}
+}
+
+func TestParseIdentityErrors(t *testing.T) {
+	tests := []string{
+		"lower(email)",
+		"t:",
+		"t:lower(email",
+		"t:concat(a,)",
+		"t:a +",
+		"t:a b",
+		"t:'open",
+		"t:a % b",
+		"t:md5(a)",
+		"t:lower(a, b)",
+		"t:)",
+	}
+	for _, spec := range tests {
+		t.Run(spec, func(t *testing.T) {
+			if _, _, err := ParseIdentity(spec); err == nil {
+				t.Errorf("ParseIdentity(%q) error = nil, want an error", spec)
+			}
+		})
+	}
+}
+
+func TestCompareDataIdentity(t *testing.T) {
+	table := &schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id"}, {Name: "email"}},
+		Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}
+	oldData := []schema.Row{{"id": 1, "email": "Alice@Example.com"}, {"id": 2, "email": "bob@example.com"}}
+	newData := []schema.Row{{"id": 10, "email": "alice@example.com"}, {"id": 20, "email": "carol@example.com"}}
+	_, id, err := ParseIdentity("users:lower(email)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := compareData("users", oldData, newData, table, Options{Identities: map[string]*Identity{"users": id}})
+	// Alice's row is the same row under the identity, with id and email changed
+	if len(d.RowsModified) != 1 || d.RowsModified[0].NewRow["id"] != 10 {
+		t.Errorf("modified = %+v, want alice's row", d.RowsModified)
+	}
+	if len(d.RowsAdded) != 1 || d.RowsAdded[0]["email"] != "carol@example.com" {
+		t.Errorf("added = %+v, want carol's row", d.RowsAdded)
+	}
+	if len(d.RowsDeleted) != 1 || d.RowsDeleted[0]["email"] != "bob@example.com" {
+		t.Errorf("deleted = %+v, want bob's row", d.RowsDeleted)
+	}
+}
@@ -0,0 +1,64 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// splitIgnoreColumn splits an ignored column entry into its table, empty
+// for a column name that applies to every table, and its column
+func splitIgnoreColumn(spec string) (tableName, column string) {
+	if i := strings.LastIndex(spec, "."); i >= 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return "", spec
+}
+
+// ignoredColumns returns the columns of a table that the entries leave out
+// of the data comparison: a column name applies to every table, and a
+// table.column entry to that table only
+func ignoredColumns(tableName string, specs []string) map[string]bool {
+	var ignored map[string]bool
+	for _, spec := range specs {
+		table, column := splitIgnoreColumn(spec)
+		if table != "" && table != tableName {
+			continue
+		}
+		if ignored == nil {
+			ignored = make(map[string]bool)
+		}
+		ignored[column] = true
+	}
+	return ignored
+}
+
+// CheckIgnoreColumns verifies that each table.column entry names a table
+// present in either snapshot and a column that table has
+func CheckIgnoreColumns(snap1, snap2 *snapshot.Snapshot, specs []string) error {
+	for _, spec := range specs {
+		tableName, column := splitIgnoreColumn(spec)
+		if column == "" {
+			return fmt.Errorf("invalid ignored column %q (expected column or table.column)", spec)
+		}
+		if tableName == "" {
+			continue
+		}
+		found := false
+		for _, snap := range []*snapshot.Snapshot{snap1, snap2} {
+			table, ok := snap.Tables[tableName]
+			if !ok {
+				continue
+			}
+			found = true
+			if !hasColumn(&table.Schema, column) {
+				return fmt.Errorf("ignored column %s does not exist in table %s", column, tableName)
+			}
+		}
+		if !found {
+			return fmt.Errorf("ignored column table %s not found in either snapshot", tableName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// JSONReport is the document of the JSON output: every changed table with
+// its schema and data differences, the changed materialized views, and the
+// differences allowed by an allowlist
+type JSONReport struct {
+	Tables            []JSONTable `json:"tables"`
+	MaterializedViews []JSONView  `json:"materialized_views,omitempty"`
+	Expected          *JSONReport `json:"expected,omitempty"`
+}
+
+// JSONTable holds the differences of one table
+type JSONTable struct {
+	Table  string      `json:"table"`
+	Schema *JSONSchema `json:"schema,omitempty"`
+	Data   *JSONData   `json:"data,omitempty"`
+}
+
+// JSONSchema is a table's schema change
+type JSONSchema struct {
+	Action      Action                               `json:"action"`
+	Columns     []JSONChange[schema.Column]          `json:"columns,omitempty"`
+	Indexes     []JSONChange[schema.Index]           `json:"indexes,omitempty"`
+	ForeignKeys []JSONChange[schema.ForeignKey]      `json:"foreign_keys,omitempty"`
+	Rules       []JSONChange[schema.Rule]            `json:"rules,omitempty"`
+	Checks      []JSONChange[schema.CheckConstraint] `json:"checks,omitempty"`
+	Partitions  []JSONChange[schema.Partition]       `json:"partitions,omitempty"`
+
+	AutoIncrementChanged    bool `json:"auto_increment_changed,omitempty"`
+	SystemVersioningChanged bool `json:"system_versioning_changed,omitempty"`
+	PartitioningChanged     bool `json:"partitioning_changed,omitempty"`
+	ColumnOrderChanged      bool `json:"column_order_changed,omitempty"`
+
+	// Old and New are the complete schemas of a dropped or added table
+	Old *schema.TableSchema `json:"old,omitempty"`
+	New *schema.TableSchema `json:"new,omitempty"`
+}
+
+// JSONChange is an added, dropped or modified column, index, foreign key,
+// rule, check constraint or partition, with its old and new definitions
+type JSONChange[T any] struct {
+	Name   string `json:"name"`
+	Action Action `json:"action"`
+	Old    *T     `json:"old,omitempty"`
+	New    *T     `json:"new,omitempty"`
+	// ChangedAttributes lists the attributes of a modified column that differ
+	ChangedAttributes []string `json:"changed_attributes,omitempty"`
+}
+
+// JSONData is a table's changed rows, or only their counts for a
+// count-only comparison
+type JSONData struct {
+	RowsAdded    []schema.Row       `json:"rows_added,omitempty"`
+	RowsDeleted  []schema.Row       `json:"rows_deleted,omitempty"`
+	RowsModified []JSONModification `json:"rows_modified,omitempty"`
+	Counts       *RowCounts         `json:"counts,omitempty"`
+}
+
+// JSONModification is a modified row before and after the change, with
+// the values identifying it and the old and new values of each changed
+// column
+type JSONModification struct {
+	Key     schema.Row        `json:"key,omitempty"`
+	Changes []JSONValueChange `json:"changes,omitempty"`
+	OldRow  schema.Row        `json:"old_row"`
+	NewRow  schema.Row        `json:"new_row"`
+}
+
+// JSONValueChange is a changed column of a modified row
+type JSONValueChange struct {
+	Column string      `json:"column"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+}
+
+// JSONView is a changed materialized view
+type JSONView struct {
+	View              string                     `json:"view"`
+	Action            Action                     `json:"action"`
+	DefinitionChanged bool                       `json:"definition_changed,omitempty"`
+	Indexes           []JSONChange[schema.Index] `json:"indexes,omitempty"`
+}
+
+// MarshalJSON encodes the diff result, followed by the differences an
+// allowlist allowed when expected has any, as a JSONReport
+func MarshalJSON(result, expected *DiffResult) ([]byte, error) {
+	report := newJSONReport(result)
+	if expected != nil && expected.HasDifferences() {
+		report.Expected = newJSONReport(expected)
+	}
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// WriteJSON writes the diff result as an indented JSONReport
+func WriteJSON(result, expected *DiffResult, w io.Writer) error {
+	data, err := MarshalJSON(result, expected)
+	if err != nil {
+		return fmt.Errorf("failed to encode diff: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+func newJSONReport(result *DiffResult) *JSONReport {
+	report := &JSONReport{Tables: []JSONTable{}}
+
+	tableNames := make(map[string]bool)
+	for tableName := range result.SchemaDiffs {
+		tableNames[tableName] = true
+	}
+	for tableName := range result.DataDiffs {
+		tableNames[tableName] = true
+	}
+	for _, tableName := range OrderedKeys(tableNames, result.TableOrder) {
+		table := JSONTable{Table: tableName}
+		if schemaDiff, ok := result.SchemaDiffs[tableName]; ok {
+			table.Schema = newJSONSchema(schemaDiff)
+		}
+		if dataDiff, ok := result.DataDiffs[tableName]; ok {
+			table.Data = &JSONData{RowsAdded: dataDiff.RowsAdded, RowsDeleted: dataDiff.RowsDeleted, Counts: dataDiff.Counts}
+			for _, mod := range dataDiff.RowsModified {
+				m := JSONModification{Key: mod.Key, OldRow: mod.OldRow, NewRow: mod.NewRow}
+				for _, col := range mod.ChangedColumns {
+					m.Changes = append(m.Changes, JSONValueChange{Column: col, Old: mod.OldRow[col], New: mod.NewRow[col]})
+				}
+				table.Data.RowsModified = append(table.Data.RowsModified, m)
+			}
+		}
+		report.Tables = append(report.Tables, table)
+	}
+
+	for _, viewName := range SortedKeys(result.MaterializedViewDiffs) {
+		viewDiff := result.MaterializedViewDiffs[viewName]
+		view := JSONView{View: viewName, Action: viewDiff.Action, DefinitionChanged: viewDiff.DefinitionChanged}
+		for _, change := range viewDiff.IndexChanges {
+			view.Indexes = append(view.Indexes, JSONChange[schema.Index]{Name: change.IndexName, Action: change.Action, Old: change.OldIndex, New: change.NewIndex})
+		}
+		report.MaterializedViews = append(report.MaterializedViews, view)
+	}
+	return report
+}
+
+func newJSONSchema(schemaDiff *SchemaDiff) *JSONSchema {
+	s := &JSONSchema{
+		Action:                  schemaDiff.Action,
+		AutoIncrementChanged:    schemaDiff.AutoIncrementChanged,
+		SystemVersioningChanged: schemaDiff.SystemVersioningChanged,
+		PartitioningChanged:     schemaDiff.PartitioningChanged,
+		ColumnOrderChanged:      schemaDiff.ColumnOrderChanged,
+	}
+	switch schemaDiff.Action {
+	case ActionAdd:
+		s.New = schemaDiff.NewSchema
+		return s
+	case ActionDrop:
+		s.Old = schemaDiff.OldSchema
+		return s
+	}
+
+	for _, change := range schemaDiff.ColumnChanges {
+		s.Columns = append(s.Columns, JSONChange[schema.Column]{Name: change.ColumnName, Action: change.Action, Old: change.OldColumn, New: change.NewColumn, ChangedAttributes: change.ChangedAttributes})
+	}
+	for _, change := range schemaDiff.IndexChanges {
+		s.Indexes = append(s.Indexes, JSONChange[schema.Index]{Name: change.IndexName, Action: change.Action, Old: change.OldIndex, New: change.NewIndex})
+	}
+	for _, change := range schemaDiff.ForeignKeyChanges {
+		s.ForeignKeys = append(s.ForeignKeys, JSONChange[schema.ForeignKey]{Name: change.FKName, Action: change.Action, Old: change.OldForeignKey, New: change.NewForeignKey})
+	}
+	for _, change := range schemaDiff.RuleChanges {
+		s.Rules = append(s.Rules, JSONChange[schema.Rule]{Name: change.RuleName, Action: change.Action, Old: change.OldRule, New: change.NewRule})
+	}
+	for _, change := range schemaDiff.CheckChanges {
+		s.Checks = append(s.Checks, JSONChange[schema.CheckConstraint]{Name: change.CheckName, Action: change.Action, Old: change.OldCheck, New: change.NewCheck})
+	}
+	for _, change := range schemaDiff.PartitionChanges {
+		s.Partitions = append(s.Partitions, JSONChange[schema.Partition]{Name: change.PartitionName, Action: change.Action, Old: change.OldPartition, New: change.NewPartition})
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// Event types of the JSON Lines output
+const (
+	EventSchema           = "schema"
+	EventRowAdded         = "row_added"
+	EventRowDeleted       = "row_deleted"
+	EventRowModified      = "row_modified"
+	EventRowCounts        = "row_counts"
+	EventMaterializedView = "materialized_view"
+)
+
+// JSONLEvent is one line of the JSON Lines output: a table's schema change,
+// one changed row, the row counts of a count-only comparison, or a changed
+// materialized view
+type JSONLEvent struct {
+	Event    string     `json:"event"`
+	Table    string     `json:"table,omitempty"`
+	View     string     `json:"view,omitempty"`
+	Action   Action     `json:"action,omitempty"`
+	Changes  []string   `json:"changes,omitempty"` // schema changes, or a modified row's changed columns
+	Row      schema.Row `json:"row,omitempty"`
+	OldRow   schema.Row `json:"old_row,omitempty"`
+	NewRow   schema.Row `json:"new_row,omitempty"`
+	Counts   *RowCounts `json:"counts,omitempty"`
+	Expected bool       `json:"expected,omitempty"` // allowed by the allowlist
+}
+
+// WriteJSONLines writes the diff result as JSON Lines, one JSONLEvent per
+// line, for log processors. Each event is written as soon as it is encoded,
+// so no document holding the whole result is built. Differences allowed by
+// an allowlist follow with "expected": true.
+func WriteJSONLines(result, expected *DiffResult, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := writeJSONLEvents(enc, result, false); err != nil {
+		return err
+	}
+	if expected != nil && expected.HasDifferences() {
+		return writeJSONLEvents(enc, expected, true)
+	}
+	return nil
+}
+
+func writeJSONLEvents(enc *json.Encoder, result *DiffResult, expected bool) error {
+	emit := func(event JSONLEvent) error {
+		event.Expected = expected
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
+		}
+		return nil
+	}
+
+	for _, tableName := range OrderedKeys(result.SchemaDiffs, result.TableOrder) {
+		schemaDiff := result.SchemaDiffs[tableName]
+		if err := emit(JSONLEvent{Event: EventSchema, Table: tableName, Action: schemaDiff.Action, Changes: schemaChangeSummary(schemaDiff)}); err != nil {
+			return err
+		}
+	}
+
+	for _, tableName := range OrderedKeys(result.DataDiffs, result.TableOrder) {
+		dataDiff := result.DataDiffs[tableName]
+		if dataDiff.Counts != nil {
+			if err := emit(JSONLEvent{Event: EventRowCounts, Table: tableName, Counts: dataDiff.Counts}); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, row := range dataDiff.RowsAdded {
+			if err := emit(JSONLEvent{Event: EventRowAdded, Table: tableName, Row: row}); err != nil {
+				return err
+			}
+		}
+		for _, row := range dataDiff.RowsDeleted {
+			if err := emit(JSONLEvent{Event: EventRowDeleted, Table: tableName, Row: row}); err != nil {
+				return err
+			}
+		}
+		for _, mod := range dataDiff.RowsModified {
+			if err := emit(JSONLEvent{Event: EventRowModified, Table: tableName, Changes: mod.ChangedColumns, OldRow: mod.OldRow, NewRow: mod.NewRow}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, viewName := range SortedKeys(result.MaterializedViewDiffs) {
+		viewDiff := result.MaterializedViewDiffs[viewName]
+		if err := emit(JSONLEvent{Event: EventMaterializedView, View: viewName, Action: viewDiff.Action, Changes: viewDiff.changes()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestWriteJSONLines(t *testing.T) {
+	pk := schema.Index{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true}
+	users := func(columns []schema.Column, rows []schema.Row) *snapshot.Snapshot {
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": "mysql"}, Tables: map[string]*schema.Table{
+			"users": {Schema: schema.TableSchema{Name: "users", Columns: columns, Indexes: []schema.Index{pk}}, Data: rows},
+		}}
+	}
+	id := schema.Column{Name: "id", Type: "int", Position: 1}
+	name := schema.Column{Name: "name", Type: "varchar(50)", Position: 2}
+	snap1 := users([]schema.Column{id, name}, []schema.Row{
+		{"id": 1, "name": "alice"},
+		{"id": 2, "name": "bob"},
+	})
+	name.Type = "varchar(100)"
+	snap2 := users([]schema.Column{id, name}, []schema.Row{
+		{"id": 1, "name": "alicia"},
+		{"id": 3, "name": "carol"},
+	})
+	expected := &DiffResult{DataDiffs: map[string]*DataDiff{
+		"audit_log": {TableName: "audit_log", RowsAdded: []schema.Row{{"id": 7}}},
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteJSONLines(Compare(snap1, snap2, Options{}), expected, &buf); err != nil {
+		t.Fatalf("WriteJSONLines() error = %v", err)
+	}
+
+	var got []JSONLEvent
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !json.Valid(line) {
+			t.Fatalf("line is not valid JSON: %s", line)
+		}
+		var event JSONLEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, event)
+	}
+
+	want := []JSONLEvent{
+		{Event: EventSchema, Table: "users", Action: ActionModify, Changes: []string{"column name MODIFY"}},
+		{Event: EventRowAdded, Table: "users", Row: schema.Row{"id": float64(3), "name": "carol"}},
+		{Event: EventRowDeleted, Table: "users", Row: schema.Row{"id": float64(2), "name": "bob"}},
+		{Event: EventRowModified, Table: "users", Changes: []string{"name"},
+			OldRow: schema.Row{"id": float64(1), "name": "alice"}, NewRow: schema.Row{"id": float64(1), "name": "alicia"}},
+		{Event: EventRowAdded, Table: "audit_log", Row: schema.Row{"id": float64(7)}, Expected: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events =\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,227 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// DisplayMarkdown writes the diff result as a Markdown report for pull
+// requests and wikis: tables of schema changes and data change counts, with
+// the changed rows of each table in a collapsible <details> section
+func DisplayMarkdown(result *DiffResult, w io.Writer) {
+	fmt.Fprintln(w, "# Database Differences")
+	fmt.Fprintln(w)
+	if !result.HasDifferences() {
+		fmt.Fprintln(w, "No differences found.")
+		return
+	}
+	writeMarkdownSections(w, result, "##")
+}
+
+// DisplayMarkdownExpected writes differences that were allowed by an
+// allowlist as a Markdown section
+func DisplayMarkdownExpected(expected *DiffResult, w io.Writer) {
+	if !expected.HasDifferences() {
+		return
+	}
+	fmt.Fprintln(w, "## Expected Differences (allowed)")
+	fmt.Fprintln(w)
+	writeMarkdownSections(w, expected, "###")
+}
+
+func writeMarkdownSections(w io.Writer, result *DiffResult, heading string) {
+	if len(result.SchemaDiffs) > 0 {
+		fmt.Fprintf(w, "%s Schema Differences\n\n", heading)
+		fmt.Fprintln(w, "| Table | Action | Changes |")
+		fmt.Fprintln(w, "| --- | --- | --- |")
+		for _, tableName := range OrderedKeys(result.SchemaDiffs, result.TableOrder) {
+			schemaDiff := result.SchemaDiffs[tableName]
+			fmt.Fprintf(w, "| %s | %s | %s |\n", markdownEscape(tableName), schemaDiff.Action,
+				strings.Join(markdownSchemaChanges(schemaDiff), "<br>"))
+		}
+		fmt.Fprintln(w)
+		for _, hint := range SplitHints(result) {
+			fmt.Fprintf(w, "> **Hint:** %s\n\n", markdownEscape(hint))
+		}
+	}
+
+	if len(result.MaterializedViewDiffs) > 0 {
+		fmt.Fprintf(w, "%s Materialized View Differences\n\n", heading)
+		fmt.Fprintln(w, "| View | Action | Changes |")
+		fmt.Fprintln(w, "| --- | --- | --- |")
+		for _, name := range SortedKeys(result.MaterializedViewDiffs) {
+			viewDiff := result.MaterializedViewDiffs[name]
+			fmt.Fprintf(w, "| %s | %s | %s |\n", markdownEscape(name), viewDiff.Action,
+				markdownEscape(strings.Join(viewDiff.changes(), ", ")))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(result.DataDiffs) > 0 {
+		fmt.Fprintf(w, "%s Data Differences\n\n", heading)
+		fmt.Fprintln(w, "| Table | Added | Deleted | Modified |")
+		fmt.Fprintln(w, "| --- | ---: | ---: | ---: |")
+		for _, tableName := range OrderedKeys(result.DataDiffs, result.TableOrder) {
+			counts := result.DataDiffs[tableName].ChangedRows()
+			fmt.Fprintf(w, "| %s | %d | %d | %d |\n", markdownEscape(tableName),
+				counts.Added, counts.Deleted, counts.Modified)
+		}
+		fmt.Fprintln(w)
+		for _, tableName := range OrderedKeys(result.DataDiffs, result.TableOrder) {
+			// Count-only comparisons have no rows to show
+			if dataDiff := result.DataDiffs[tableName]; dataDiff.Counts == nil {
+				writeMarkdownRows(w, tableName, dataDiff)
+			}
+		}
+	}
+}
+
+// markdownSchemaChanges describes each change of a table, one per line
+func markdownSchemaChanges(schemaDiff *SchemaDiff) []string {
+	switch schemaDiff.Action {
+	case ActionAdd:
+		return []string{fmt.Sprintf("new table, %d columns", len(schemaDiff.NewSchema.Columns))}
+	case ActionDrop:
+		return []string{"removed table"}
+	}
+
+	var changes []string
+	if schemaDiff.AutoIncrementChanged {
+		changes = append(changes, fmt.Sprintf("auto increment: %d → %d",
+			schemaDiff.OldSchema.AutoIncrement, schemaDiff.NewSchema.AutoIncrement))
+	}
+	if schemaDiff.SystemVersioningChanged {
+		changes = append(changes, "system versioning "+versioningChange(schemaDiff))
+	}
+	for _, change := range schemaDiff.ColumnChanges {
+		line := fmt.Sprintf("column `%s`: %s", markdownEscape(change.ColumnName), change.Action)
+		var attrs []string
+		for _, attr := range change.ChangedAttributes {
+			attrs = append(attrs, fmt.Sprintf("%s %s → %s", attr,
+				markdownEscape(ColumnAttribute(change.OldColumn, attr)), markdownEscape(ColumnAttribute(change.NewColumn, attr))))
+		}
+		if len(attrs) > 0 {
+			line += " (" + strings.Join(attrs, ", ") + ")"
+		}
+		changes = append(changes, line)
+	}
+	indexes := append([]IndexChange(nil), schemaDiff.IndexChanges...)
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].IndexName < indexes[j].IndexName })
+	for _, change := range indexes {
+		changes = append(changes, fmt.Sprintf("index `%s`: %s", markdownEscape(change.IndexName), change.Action))
+	}
+	fks := append([]ForeignKeyChange(nil), schemaDiff.ForeignKeyChanges...)
+	sort.Slice(fks, func(i, j int) bool { return fks[i].FKName < fks[j].FKName })
+	for _, change := range fks {
+		changes = append(changes, fmt.Sprintf("foreign key `%s`: %s", markdownEscape(change.FKName), change.Action))
+	}
+	rules := append([]RuleChange(nil), schemaDiff.RuleChanges...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].RuleName < rules[j].RuleName })
+	for _, change := range rules {
+		changes = append(changes, fmt.Sprintf("rule `%s`: %s", markdownEscape(change.RuleName), change.Action))
+	}
+	checks := append([]CheckChange(nil), schemaDiff.CheckChanges...)
+	sort.Slice(checks, func(i, j int) bool { return checks[i].CheckName < checks[j].CheckName })
+	for _, change := range checks {
+		changes = append(changes, fmt.Sprintf("check `%s`: %s", markdownEscape(change.CheckName), change.Action))
+	}
+	if schemaDiff.PartitioningChanged {
+		changes = append(changes, fmt.Sprintf("partitioning: %s → %s",
+			markdownEscape(partitioningKey(schemaDiff.OldSchema)), markdownEscape(partitioningKey(schemaDiff.NewSchema))))
+	}
+	if schemaDiff.ColumnOrderChanged {
+		changes = append(changes, fmt.Sprintf("column order: %s → %s",
+			markdownEscape(strings.Join(CommonColumnOrder(schemaDiff.OldSchema, schemaDiff.NewSchema), ", ")),
+			markdownEscape(strings.Join(CommonColumnOrder(schemaDiff.NewSchema, schemaDiff.OldSchema), ", "))))
+	}
+	partitions := append([]PartitionChange(nil), schemaDiff.PartitionChanges...)
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].PartitionName < partitions[j].PartitionName })
+	for _, change := range partitions {
+		changes = append(changes, fmt.Sprintf("partition `%s`: %s", markdownEscape(change.PartitionName), change.Action))
+	}
+	return changes
+}
+
+// writeMarkdownRows writes a table's changed rows in a <details> section.
+// Modified rows show "old → new" in the columns that changed.
+func writeMarkdownRows(w io.Writer, tableName string, dataDiff *DataDiff) {
+	fmt.Fprintf(w, "<details>\n<summary>%s: changed rows</summary>\n\n", markdownEscape(tableName))
+
+	if len(dataDiff.RowsAdded) > 0 {
+		fmt.Fprintln(w, "**Added**")
+		fmt.Fprintln(w)
+		writeMarkdownRowTable(w, dataDiff.RowsAdded, nil)
+	}
+	if len(dataDiff.RowsDeleted) > 0 {
+		fmt.Fprintln(w, "**Deleted**")
+		fmt.Fprintln(w)
+		writeMarkdownRowTable(w, dataDiff.RowsDeleted, nil)
+	}
+	if len(dataDiff.RowsModified) > 0 {
+		fmt.Fprintln(w, "**Modified**")
+		fmt.Fprintln(w)
+		rows := make([]schema.Row, len(dataDiff.RowsModified))
+		old := make([]schema.Row, len(dataDiff.RowsModified))
+		for i, mod := range dataDiff.RowsModified {
+			rows[i] = mod.NewRow
+			old[i] = mod.OldRow
+		}
+		writeMarkdownRowTable(w, rows, old)
+	}
+
+	fmt.Fprintln(w, "</details>")
+	fmt.Fprintln(w)
+}
+
+// writeMarkdownRowTable writes rows as a Markdown table. When old is given,
+// cells whose value differs from the old row show both values.
+func writeMarkdownRowTable(w io.Writer, rows, old []schema.Row) {
+	columnSet := make(map[string]bool)
+	for _, row := range rows {
+		for col := range row {
+			columnSet[col] = true
+		}
+	}
+	columns := SortedKeys(columnSet)
+
+	escaped := make([]string, len(columns))
+	for i, col := range columns {
+		escaped[i] = markdownEscape(col)
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(escaped, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(columns)))
+
+	for i, row := range rows {
+		cells := make([]string, len(columns))
+		for j, col := range columns {
+			cells[j] = markdownValue(row[col])
+			if old != nil {
+				if oldVal := markdownValue(old[i][col]); oldVal != cells[j] {
+					cells[j] = oldVal + " → " + cells[j]
+				}
+			}
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+	}
+	fmt.Fprintln(w)
+}
+
+func markdownValue(val interface{}) string {
+	if val == nil {
+		return "NULL"
+	}
+	return markdownEscape(fmt.Sprintf("%v", val))
+}
+
+// markdownEscape keeps a value inside its table cell: pipes are escaped and
+// line breaks become <br>
+func markdownEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.ReplaceAll(s, "\r\n", "<br>")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
@@ -0,0 +1,78 @@
+package diff
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+var (
+	// unescapedPipe matches a cell separator: a pipe not escaped with a backslash
+	unescapedPipe = regexp.MustCompile(`(^|[^\\])\|`)
+	// separatorRow matches the row separating a table's header from its rows
+	separatorRow = regexp.MustCompile(`^\|( -{3,}:? \|)+$`)
+)
+
+func TestDisplayMarkdownTables(t *testing.T) {
+	users := &schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id", Type: "int"}, {Name: "bio", Type: "text"}},
+		Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}
+	oldBio, newBio := schema.Column{Name: "bio", Type: "varchar(50)"}, schema.Column{Name: "bio", Type: "text"}
+	result := &DiffResult{
+		SchemaDiffs: map[string]*SchemaDiff{
+			"users": {TableName: "users", Action: ActionModify, OldSchema: users, NewSchema: users, ColumnChanges: []ColumnChange{
+				{ColumnName: "bio", Action: ActionModify, OldColumn: &oldBio, NewColumn: &newBio, ChangedAttributes: []string{"type"}},
+			}},
+		},
+		DataDiffs: map[string]*DataDiff{
+			"users": {TableName: "users", Schema: users,
+				RowsAdded: []schema.Row{{"id": 2, "bio": "cats | dogs"}},
+				RowsModified: []RowModification{{
+					OldRow: schema.Row{"id": 1, "bio": "line one\nline two"},
+					NewRow: schema.Row{"id": 1, "bio": nil},
+				}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	DisplayMarkdown(result, &buf)
+	out := buf.String()
+
+	// Every row of a table has as many cells as its header, and the header
+	// is followed by a separator row
+	tables := 0
+	lines := strings.Split(out, "\n")
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "|") {
+			continue
+		}
+		tables++
+		cells := len(unescapedPipe.FindAllString(lines[i], -1))
+		if i+1 >= len(lines) || !separatorRow.MatchString(lines[i+1]) {
+			t.Errorf("table header %q is not followed by a separator row", lines[i])
+		}
+		for ; i < len(lines) && strings.HasPrefix(lines[i], "|"); i++ {
+			if got := len(unescapedPipe.FindAllString(lines[i], -1)); got != cells {
+				t.Errorf("row %q has %d separators, want %d", lines[i], got, cells)
+			}
+		}
+	}
+	if tables != 4 {
+		t.Errorf("found %d tables, want 4:\n%s", tables, out)
+	}
+
+	for _, want := range []string{
+		"| users | MODIFY | column `bio`: MODIFY (type varchar(50) → text) |",
+		"| users | 1 | 0 | 1 |",
+		`| cats \| dogs | 2 |`,
+		"| line one<br>line two → NULL | 1 |",
+		"<details>\n<summary>users: changed rows</summary>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("DisplayMarkdown() is missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// MaterializedViewDiff represents a materialized view that was added,
+// dropped or changed
+type MaterializedViewDiff struct {
+	ViewName string
+	Action   Action
+	OldView  *schema.MaterializedView
+	NewView  *schema.MaterializedView
+
+	// DefinitionChanged is set for a MODIFY whose query differs, which
+	// requires recreating the view; otherwise only IndexChanges differ
+	DefinitionChanged bool
+	IndexChanges      []IndexChange
+}
+
+// compareMaterializedViews compares the materialized views of two snapshots
+func compareMaterializedViews(old, new map[string]*schema.MaterializedView, opts Options) map[string]*MaterializedViewDiff {
+	diffs := make(map[string]*MaterializedViewDiff)
+	for name, newView := range new {
+		oldView, exists := old[name]
+		if !exists {
+			diffs[name] = &MaterializedViewDiff{ViewName: name, Action: ActionAdd, NewView: newView}
+			continue
+		}
+
+		viewDiff := &MaterializedViewDiff{
+			ViewName:          name,
+			Action:            ActionModify,
+			OldView:           oldView,
+			NewView:           newView,
+			DefinitionChanged: !definitionsEqual(normalizeDefinition(oldView.Definition), normalizeDefinition(newView.Definition), opts),
+			IndexChanges:      compareViewIndexes(oldView.Indexes, newView.Indexes),
+		}
+		if viewDiff.DefinitionChanged || len(viewDiff.IndexChanges) > 0 {
+			diffs[name] = viewDiff
+		}
+	}
+	for name, oldView := range old {
+		if _, exists := new[name]; !exists {
+			diffs[name] = &MaterializedViewDiff{ViewName: name, Action: ActionDrop, OldView: oldView}
+		}
+	}
+	return diffs
+}
+
+// normalizeDefinition collapses whitespace, which pg_get_viewdef output may
+// lay out differently between server versions
+func normalizeDefinition(definition string) string {
+	return strings.Join(strings.Fields(definition), " ")
+}
+
+// compareViewIndexes matches a view's indexes by name
+func compareViewIndexes(old, new []schema.Index) []IndexChange {
+	oldIndexes := indexMap(old, false)
+	newIndexes := indexMap(new, false)
+
+	var changes []IndexChange
+	for key, newIdx := range newIndexes {
+		oldIdx, exists := oldIndexes[key]
+		switch {
+		case !exists:
+			changes = append(changes, IndexChange{IndexName: newIdx.Name, Action: ActionAdd, NewIndex: newIdx})
+		case !indexesEqual(oldIdx, newIdx, false):
+			changes = append(changes, IndexChange{IndexName: newIdx.Name, Action: ActionModify, OldIndex: oldIdx, NewIndex: newIdx})
+		}
+	}
+	for key, oldIdx := range oldIndexes {
+		if _, exists := newIndexes[key]; !exists {
+			changes = append(changes, IndexChange{IndexName: oldIdx.Name, Action: ActionDrop, OldIndex: oldIdx})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].IndexName < changes[j].IndexName })
+	return changes
+}
+
+// changes describes what differs in a MODIFY, one entry per change
+func (d *MaterializedViewDiff) changes() []string {
+	switch d.Action {
+	case ActionAdd:
+		return []string{"new view"}
+	case ActionDrop:
+		return []string{"removed view"}
+	}
+
+	var changes []string
+	if d.DefinitionChanged {
+		changes = append(changes, "definition changed")
+	}
+	for _, change := range d.IndexChanges {
+		changes = append(changes, fmt.Sprintf("index %s %s", change.IndexName, change.Action))
+	}
+	return changes
+}
+
+func displayMaterializedViewDiff(w io.Writer, d *MaterializedViewDiff) {
+	fmt.Fprintf(w, "Materialized view: %s\n", d.ViewName)
+	fmt.Fprintf(w, "  Action: %s\n", d.Action)
+	if d.Action == ActionModify {
+		for _, change := range d.changes() {
+			fmt.Fprintf(w, "    - %s\n", change)
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,40 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// PKRangeWarnings describes the tables of both snapshots whose rows were
+// captured with different --pk-range ranges. Rows inside one range but not
+// the other show up as added or deleted although they may exist in both
+// databases.
+func PKRangeWarnings(snap1, snap2 *snapshot.Snapshot) []string {
+	var names []string
+	for name := range snap1.Tables {
+		if _, ok := snap2.Tables[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		range1, range2 := snap1.PKRange(name), snap2.PKRange(name)
+		if range1 == range2 {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("WARNING: table %s was captured with primary key range %s in one snapshot and %s in the other; rows outside either range show as added or deleted",
+			name, describePKRange(range1), describePKRange(range2)))
+	}
+	return warnings
+}
+
+func describePKRange(r string) string {
+	if r == "" {
+		return "(all rows)"
+	}
+	return r
+}
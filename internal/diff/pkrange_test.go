@@ -0,0 +1,35 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestPKRangeWarnings(t *testing.T) {
+	snap := func(metadata map[string]string) *snapshot.Snapshot {
+		return &snapshot.Snapshot{Metadata: metadata, Tables: map[string]*schema.Table{"events": {}, "users": {}}}
+	}
+	tests := []struct {
+		name  string
+		meta1 map[string]string
+		meta2 map[string]string
+		want  []string
+	}{
+		{name: "no ranges", meta1: map[string]string{}, meta2: map[string]string{}},
+		{name: "same range", meta1: map[string]string{"pk_range.events": "id:1:10"}, meta2: map[string]string{"pk_range.events": "id:1:10"}},
+		{name: "different ranges", meta1: map[string]string{"pk_range.events": "id:1:10"}, meta2: map[string]string{"pk_range.events": "id:1:20"},
+			want: []string{"WARNING: table events was captured with primary key range id:1:10 in one snapshot and id:1:20 in the other; rows outside either range show as added or deleted"}},
+		{name: "range on one side", meta1: map[string]string{}, meta2: map[string]string{"pk_range.users": "id:5:6"},
+			want: []string{"WARNING: table users was captured with primary key range (all rows) in one snapshot and id:5:6 in the other; rows outside either range show as added or deleted"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PKRangeWarnings(snap(tt.meta1), snap(tt.meta2)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PKRangeWarnings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Lines enclosing the JSON block of a report file
+const (
+	ReportJSONBegin = "```json"
+	ReportJSONEnd   = "```"
+)
+
+// WriteReport writes a report for archival that serves both people and
+// tools: a summary of the changes, the text report with the allowed
+// differences, and the JSON report fenced between ReportJSONBegin and
+// ReportJSONEnd lines, which ExtractReportJSON returns
+func WriteReport(result, expected *DiffResult, w io.Writer) error {
+	fmt.Fprintln(w, "=== Summary ===")
+	fmt.Fprintln(w)
+	writeSummary(w, result)
+	fmt.Fprintln(w)
+
+	DisplayTo(result, w)
+	if expected != nil {
+		DisplayExpected(expected, w)
+	}
+
+	data, err := MarshalJSON(result, expected)
+	if err != nil {
+		return fmt.Errorf("failed to encode diff: %w", err)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "=== JSON ===")
+	fmt.Fprintln(w)
+	_, err = fmt.Fprintf(w, "%s\n%s\n%s\n", ReportJSONBegin, data, ReportJSONEnd)
+	return err
+}
+
+// writeSummary writes the numbers of changed tables, rows and materialized
+// views
+func writeSummary(w io.Writer, result *DiffResult) {
+	var rows RowCounts
+	for _, dataDiff := range result.DataDiffs {
+		counts := dataDiff.ChangedRows()
+		rows.Added += counts.Added
+		rows.Deleted += counts.Deleted
+		rows.Modified += counts.Modified
+	}
+	fmt.Fprintf(w, "Tables with schema changes: %d\n", len(result.SchemaDiffs))
+	fmt.Fprintf(w, "Tables with data changes: %d (%d added, %d deleted, %d modified rows)\n",
+		len(result.DataDiffs), rows.Added, rows.Deleted, rows.Modified)
+	fmt.Fprintf(w, "Materialized views changed: %d\n", len(result.MaterializedViewDiffs))
+}
+
+// ExtractReportJSON returns the JSON report embedded in a report file
+func ExtractReportJSON(report []byte) ([]byte, error) {
+	begin := []byte("\n" + ReportJSONBegin + "\n")
+	start := bytes.Index(report, begin)
+	if start < 0 {
+		return nil, fmt.Errorf("report has no JSON block")
+	}
+	body := report[start+len(begin):]
+	end := bytes.Index(body, []byte("\n"+ReportJSONEnd+"\n"))
+	if end < 0 {
+		return nil, fmt.Errorf("report JSON block is not terminated")
+	}
+	return body[:end+1], nil
+}
@@ -0,0 +1,65 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestWriteReport(t *testing.T) {
+	pk := schema.Index{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true}
+	users := func(rows ...schema.Row) *snapshot.Snapshot {
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": "mysql"}, Tables: map[string]*schema.Table{
+			"users": {Schema: schema.TableSchema{Name: "users", Columns: []schema.Column{
+				{Name: "id", Type: "int", Position: 1},
+				{Name: "note", Type: "text", Position: 2},
+			}, Indexes: []schema.Index{pk}}, Data: rows},
+		}}
+	}
+	// The note holds the fence, which must not end the JSON block early
+	result := Compare(users(schema.Row{"id": 1, "note": "a"}), users(schema.Row{"id": 1, "note": "```\nb"}, schema.Row{"id": 2, "note": "c"}), Options{})
+
+	var buf bytes.Buffer
+	if err := WriteReport(result, nil, &buf); err != nil {
+		t.Fatalf("WriteReport() error = %v", err)
+	}
+	report := buf.String()
+
+	for _, want := range []string{
+		"=== Summary ===",
+		"Tables with data changes: 1 (1 added, 0 deleted, 1 modified rows)",
+		"Table: users",
+		"=== JSON ===",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report is missing %q:\n%s", want, report)
+		}
+	}
+
+	data, err := ExtractReportJSON(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ExtractReportJSON() error = %v", err)
+	}
+	var parsed JSONReport
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("JSON block does not parse: %v\n%s", err, data)
+	}
+	if len(parsed.Tables) != 1 || parsed.Tables[0].Table != "users" || parsed.Tables[0].Data == nil {
+		t.Errorf("JSON tables = %+v, want the data changes of users", parsed.Tables)
+	}
+}
+
+func TestExtractReportJSONErrors(t *testing.T) {
+	for name, report := range map[string]string{
+		"no block":       "=== Summary ===\n",
+		"not terminated": "=== JSON ===\n\n```json\n{}\n",
+	} {
+		if _, err := ExtractReportJSON([]byte(report)); err == nil {
+			t.Errorf("ExtractReportJSON(%s) error = nil, want an error", name)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package diff
 
 import (
+	"fmt"
+	"slices"
+	"sort"
+
 	"github.com/koba/db-diff/internal/schema"
 )
 
@@ -22,6 +26,26 @@ type SchemaDiff struct {
 	ColumnChanges     []ColumnChange
 	IndexChanges      []IndexChange
 	ForeignKeyChanges []ForeignKeyChange
+	RuleChanges       []RuleChange
+	CheckChanges      []CheckChange
+	PartitionChanges  []PartitionChange
+
+	// AutoIncrementChanged is set when the next auto-increment values differ
+	// and Options.IncludeAutoIncrement is set
+	AutoIncrementChanged bool
+
+	// SystemVersioningChanged is set when system versioning was added to or
+	// removed from the table
+	SystemVersioningChanged bool
+
+	// PartitioningChanged is set when the table became or stopped being
+	// partitioned, or its partitioning method or key changed. Partition
+	// changes are only compared when the partitioning is unchanged.
+	PartitioningChanged bool
+
+	// ColumnOrderChanged is set when the columns of both schemas are in a
+	// different order and Options.CheckColumnOrder is set
+	ColumnOrderChanged bool
 }
 
 // ColumnChange represents a change to a column
@@ -30,6 +54,18 @@ type ColumnChange struct {
 	Action     Action
 	OldColumn  *schema.Column
 	NewColumn  *schema.Column
+	// ChangedAttributes lists the attributes that differ for a MODIFY,
+	// e.g. "type", "nullable", "default"
+	ChangedAttributes []string
+}
+
+// Position returns the ordinal position of the changed column: its position
+// in the second snapshot, or in the first for a dropped column
+func (c ColumnChange) Position() int {
+	if c.NewColumn != nil {
+		return c.NewColumn.Position
+	}
+	return c.OldColumn.Position
 }
 
 // IndexChange represents a change to an index
@@ -48,8 +84,37 @@ type ForeignKeyChange struct {
 	NewForeignKey *schema.ForeignKey
 }
 
+// RuleChange represents a change to a rewrite rule
+type RuleChange struct {
+	RuleName string
+	Action   Action
+	OldRule  *schema.Rule
+	NewRule  *schema.Rule
+}
+
+// CheckChange represents a change to a CHECK constraint
+type CheckChange struct {
+	CheckName string
+	Action    Action
+	OldCheck  *schema.CheckConstraint
+	NewCheck  *schema.CheckConstraint
+
+	// sameExpression is set when the expressions are equal as compared by
+	// definitionsEqual, which may ignore their formatting
+	sameExpression bool
+}
+
+// PartitionChange represents a partition added, removed or given a new
+// boundary
+type PartitionChange struct {
+	PartitionName string
+	Action        Action
+	OldPartition  *schema.Partition
+	NewPartition  *schema.Partition
+}
+
 // compareSchemas compares two table schemas
-func compareSchemas(old, new *schema.TableSchema) *SchemaDiff {
+func compareSchemas(old, new *schema.TableSchema, opts Options) *SchemaDiff {
 	diff := &SchemaDiff{
 		TableName:         new.Name,
 		Action:            ActionModify,
@@ -74,12 +139,13 @@ func compareSchemas(old, new *schema.TableSchema) *SchemaDiff {
 	// Find added and modified columns
 	for name, newCol := range newColumns {
 		if oldCol, exists := oldColumns[name]; exists {
-			if !columnsEqual(oldCol, newCol) {
+			if changed := changedAttributes(oldCol, newCol, opts); len(changed) > 0 {
 				diff.ColumnChanges = append(diff.ColumnChanges, ColumnChange{
-					ColumnName: name,
-					Action:     ActionModify,
-					OldColumn:  oldCol,
-					NewColumn:  newCol,
+					ColumnName:        name,
+					Action:            ActionModify,
+					OldColumn:         oldCol,
+					NewColumn:         newCol,
+					ChangedAttributes: changed,
 				})
 			}
 		} else {
@@ -101,23 +167,25 @@ func compareSchemas(old, new *schema.TableSchema) *SchemaDiff {
 			})
 		}
 	}
+	// Order the changes by column position, so that added columns are added
+	// in the order the second snapshot has them
+	sort.Slice(diff.ColumnChanges, func(i, j int) bool {
+		a, b := diff.ColumnChanges[i], diff.ColumnChanges[j]
+		if a.Position() != b.Position() {
+			return a.Position() < b.Position()
+		}
+		return a.ColumnName < b.ColumnName
+	})
 
-	// Compare indexes
-	oldIndexes := make(map[string]*schema.Index)
-	for i := range old.Indexes {
-		oldIndexes[old.Indexes[i].Name] = &old.Indexes[i]
-	}
+	// Compare indexes, matched by name or by what they index
+	oldIndexes := indexMap(old.Indexes, opts.MatchIndexesByColumns)
+	newIndexes := indexMap(new.Indexes, opts.MatchIndexesByColumns)
 
-	newIndexes := make(map[string]*schema.Index)
-	for i := range new.Indexes {
-		newIndexes[new.Indexes[i].Name] = &new.Indexes[i]
-	}
-
-	for name, newIdx := range newIndexes {
-		if oldIdx, exists := oldIndexes[name]; exists {
-			if !indexesEqual(oldIdx, newIdx) {
+	for key, newIdx := range newIndexes {
+		if oldIdx, exists := oldIndexes[key]; exists {
+			if !indexesEqual(oldIdx, newIdx, opts.MatchIndexesByColumns) {
 				diff.IndexChanges = append(diff.IndexChanges, IndexChange{
-					IndexName: name,
+					IndexName: newIdx.Name,
 					Action:    ActionModify,
 					OldIndex:  oldIdx,
 					NewIndex:  newIdx,
@@ -125,22 +193,30 @@ func compareSchemas(old, new *schema.TableSchema) *SchemaDiff {
 			}
 		} else {
 			diff.IndexChanges = append(diff.IndexChanges, IndexChange{
-				IndexName: name,
+				IndexName: newIdx.Name,
 				Action:    ActionAdd,
 				NewIndex:  newIdx,
 			})
 		}
 	}
 
-	for name, oldIdx := range oldIndexes {
-		if _, exists := newIndexes[name]; !exists {
+	for key, oldIdx := range oldIndexes {
+		if _, exists := newIndexes[key]; !exists {
 			diff.IndexChanges = append(diff.IndexChanges, IndexChange{
-				IndexName: name,
+				IndexName: oldIdx.Name,
 				Action:    ActionDrop,
 				OldIndex:  oldIdx,
 			})
 		}
 	}
+	// Matched by columns, a dropped and an added index can share a name
+	sort.Slice(diff.IndexChanges, func(i, j int) bool {
+		a, b := diff.IndexChanges[i], diff.IndexChanges[j]
+		if a.IndexName != b.IndexName {
+			return a.IndexName < b.IndexName
+		}
+		return a.Action < b.Action
+	})
 
 	// Compare foreign keys
 	oldFKs := make(map[string]*schema.ForeignKey)
@@ -182,32 +258,167 @@ func compareSchemas(old, new *schema.TableSchema) *SchemaDiff {
 		}
 	}
 
+	if opts.MatchConstraintsByDefinition {
+		diff.ForeignKeyChanges = matchRenamedForeignKeys(diff.ForeignKeyChanges)
+	}
+	sort.Slice(diff.ForeignKeyChanges, func(i, j int) bool {
+		return diff.ForeignKeyChanges[i].FKName < diff.ForeignKeyChanges[j].FKName
+	})
+
+	// The next auto-increment value differs between almost any two
+	// databases, so it is only compared on request
+	if opts.IncludeAutoIncrement && old.AutoIncrement != new.AutoIncrement {
+		diff.AutoIncrementChanged = true
+	}
+
+	if (old.SystemVersioning == nil) != (new.SystemVersioning == nil) {
+		diff.SystemVersioningChanged = true
+	}
+
+	diff.RuleChanges = compareRules(old.Rules, new.Rules, opts)
+	diff.CheckChanges = compareChecks(old.Checks, new.Checks, opts)
+	if opts.MatchConstraintsByDefinition {
+		diff.CheckChanges = matchRenamedChecks(diff.CheckChanges, opts)
+	}
+
+	if !partitioningKeysEqual(old.Partitioning, new.Partitioning) {
+		diff.PartitioningChanged = true
+	} else if new.Partitioning != nil {
+		diff.PartitionChanges = comparePartitions(old.Partitioning.Partitions, new.Partitioning.Partitions)
+	}
+
+	// Column order rarely matters to queries and is only compared on request
+	if opts.CheckColumnOrder && !slices.Equal(CommonColumnOrder(old, new), CommonColumnOrder(new, old)) {
+		diff.ColumnOrderChanged = true
+	}
+
 	// Return nil if no changes
-	if len(diff.ColumnChanges) == 0 && len(diff.IndexChanges) == 0 && len(diff.ForeignKeyChanges) == 0 {
+	if len(diff.ColumnChanges) == 0 && len(diff.IndexChanges) == 0 && len(diff.ForeignKeyChanges) == 0 && len(diff.RuleChanges) == 0 && len(diff.CheckChanges) == 0 && len(diff.PartitionChanges) == 0 && !diff.AutoIncrementChanged && !diff.SystemVersioningChanged && !diff.PartitioningChanged && !diff.ColumnOrderChanged {
 		return nil
 	}
 
 	return diff
 }
 
-func columnsEqual(a, b *schema.Column) bool {
-	if a.Name != b.Name || a.Type != b.Type || a.Nullable != b.Nullable || a.AutoIncrement != b.AutoIncrement {
-		return false
+// CommonColumnOrder returns the names of the columns of tableSchema that
+// other also has, in tableSchema's column order. Added and dropped columns
+// are left out, so they do not count as a change of order.
+func CommonColumnOrder(tableSchema, other *schema.TableSchema) []string {
+	inOther := make(map[string]bool, len(other.Columns))
+	for _, col := range other.Columns {
+		inOther[col.Name] = true
+	}
+	columns := append([]schema.Column(nil), tableSchema.Columns...)
+	sort.SliceStable(columns, func(i, j int) bool { return columns[i].Position < columns[j].Position })
+	var names []string
+	for _, col := range columns {
+		if inOther[col.Name] {
+			names = append(names, col.Name)
+		}
 	}
+	return names
+}
 
-	// Compare default values
-	if (a.DefaultValue == nil) != (b.DefaultValue == nil) {
-		return false
+// changedAttributes returns the names of the column attributes that differ
+func changedAttributes(a, b *schema.Column, opts Options) []string {
+	var changed []string
+
+	if a.Type != b.Type {
+		changed = append(changed, "type")
 	}
-	if a.DefaultValue != nil && b.DefaultValue != nil && *a.DefaultValue != *b.DefaultValue {
-		return false
+	if a.Nullable != b.Nullable {
+		changed = append(changed, "nullable")
+	}
+	if !schema.DefaultsEqual(a.DefaultValue, b.DefaultValue) {
+		changed = append(changed, "default")
+	}
+	if a.AutoIncrement != b.AutoIncrement {
+		changed = append(changed, "auto_increment")
+	}
+	if !schema.CollationsEqual(a.Collation, b.Collation, opts.legacyCollations) {
+		changed = append(changed, "collation")
+	}
+	if a.Identity != b.Identity {
+		changed = append(changed, "identity")
+	}
+	if a.Generated != b.Generated || a.Stored != b.Stored {
+		changed = append(changed, "generated")
 	}
 
-	return true
+	return changed
+}
+
+// ColumnAttribute returns a printable value of the named column attribute
+func ColumnAttribute(col *schema.Column, attribute string) string {
+	switch attribute {
+	case "type":
+		return col.Type
+	case "nullable":
+		return fmt.Sprintf("%t", col.Nullable)
+	case "default":
+		if col.DefaultValue == nil {
+			return "(none)"
+		}
+		return *col.DefaultValue
+	case "auto_increment":
+		return fmt.Sprintf("%t", col.AutoIncrement)
+	case "collation":
+		if col.Collation == "" {
+			return "(default)"
+		}
+		return col.Collation
+	case "identity":
+		if col.Identity == "" {
+			return "(none)"
+		}
+		return col.Identity
+	case "generated":
+		if col.Generated == "" {
+			return "(none)"
+		}
+		if col.Stored {
+			return col.Generated + " STORED"
+		}
+		return col.Generated + " VIRTUAL"
+	default:
+		return ""
+	}
+}
+
+// indexMap keys indexes by name, or by their signature when byColumns is
+// set. Identical indexes under different names get distinct keys so both
+// are kept.
+func indexMap(indexes []schema.Index, byColumns bool) map[string]*schema.Index {
+	m := make(map[string]*schema.Index)
+	for i := range indexes {
+		key := indexes[i].Name
+		if byColumns {
+			key = indexSignature(&indexes[i])
+			for n := 2; m[key] != nil; n++ {
+				key = fmt.Sprintf("%s#%d", indexSignature(&indexes[i]), n)
+			}
+		}
+		m[key] = &indexes[i]
+	}
+	return m
 }
 
-func indexesEqual(a, b *schema.Index) bool {
-	if a.Name != b.Name || a.Unique != b.Unique || a.Primary != b.Primary {
+// indexSignature identifies an index by its columns, their directions and
+// whether it is unique or primary
+func indexSignature(idx *schema.Index) string {
+	columns := make([]string, len(idx.Columns))
+	for i, col := range idx.Columns {
+		columns[i] = col
+		if idx.IsDescending(i) {
+			columns[i] += " DESC"
+		}
+	}
+	return fmt.Sprintf("%v|%t|%t", columns, idx.Unique, idx.Primary)
+}
+
+// indexesEqual compares two indexes, ignoring their names when ignoreName is set
+func indexesEqual(a, b *schema.Index, ignoreName bool) bool {
+	if (!ignoreName && a.Name != b.Name) || a.Unique != b.Unique || a.Primary != b.Primary || a.Clustered != b.Clustered || a.Comment != b.Comment {
 		return false
 	}
 
@@ -216,7 +427,7 @@ func indexesEqual(a, b *schema.Index) bool {
 	}
 
 	for i := range a.Columns {
-		if a.Columns[i] != b.Columns[i] {
+		if a.Columns[i] != b.Columns[i] || a.IsDescending(i) != b.IsDescending(i) {
 			return false
 		}
 	}
@@ -224,11 +435,296 @@ func indexesEqual(a, b *schema.Index) bool {
 	return true
 }
 
+// compareRules matches rules by name and compares their definitions
+func compareRules(old, new []schema.Rule, opts Options) []RuleChange {
+	oldRules := make(map[string]*schema.Rule)
+	for i := range old {
+		oldRules[old[i].Name] = &old[i]
+	}
+
+	var changes []RuleChange
+	for i := range new {
+		newRule := &new[i]
+		oldRule, exists := oldRules[newRule.Name]
+		switch {
+		case !exists:
+			changes = append(changes, RuleChange{RuleName: newRule.Name, Action: ActionAdd, NewRule: newRule})
+		case !definitionsEqual(oldRule.Definition, newRule.Definition, opts):
+			changes = append(changes, RuleChange{RuleName: newRule.Name, Action: ActionModify, OldRule: oldRule, NewRule: newRule})
+		}
+		delete(oldRules, newRule.Name)
+	}
+	for i := range old {
+		if _, dropped := oldRules[old[i].Name]; dropped {
+			changes = append(changes, RuleChange{RuleName: old[i].Name, Action: ActionDrop, OldRule: &old[i]})
+		}
+	}
+	return changes
+}
+
+// compareChecks matches CHECK constraints by name and compares their
+// expressions
+func compareChecks(old, new []schema.CheckConstraint, opts Options) []CheckChange {
+	oldChecks := make(map[string]*schema.CheckConstraint)
+	for i := range old {
+		oldChecks[old[i].Name] = &old[i]
+	}
+
+	var changes []CheckChange
+	for i := range new {
+		newCheck := &new[i]
+		oldCheck, exists := oldChecks[newCheck.Name]
+		switch {
+		case !exists:
+			changes = append(changes, CheckChange{CheckName: newCheck.Name, Action: ActionAdd, NewCheck: newCheck})
+		case !definitionsEqual(oldCheck.Expression, newCheck.Expression, opts) || oldCheck.NotValid != newCheck.NotValid || oldCheck.NotEnforced != newCheck.NotEnforced:
+			changes = append(changes, CheckChange{CheckName: newCheck.Name, Action: ActionModify, OldCheck: oldCheck, NewCheck: newCheck,
+				sameExpression: definitionsEqual(oldCheck.Expression, newCheck.Expression, opts)})
+		}
+		delete(oldChecks, newCheck.Name)
+	}
+	for i := range old {
+		if _, dropped := oldChecks[old[i].Name]; dropped {
+			changes = append(changes, CheckChange{CheckName: old[i].Name, Action: ActionDrop, OldCheck: &old[i]})
+		}
+	}
+	return changes
+}
+
+// matchRenamedForeignKeys turns each dropped foreign key and an added one
+// that is identical apart from its name into a rename (see RenameOnly)
+func matchRenamedForeignKeys(changes []ForeignKeyChange) []ForeignKeyChange {
+	return matchRenames(changes,
+		func(c ForeignKeyChange) (Action, string) { return c.Action, c.FKName },
+		func(dropped, added ForeignKeyChange) (ForeignKeyChange, bool) {
+			renamed := *dropped.OldForeignKey
+			renamed.Name = added.NewForeignKey.Name
+			if !foreignKeysEqual(&renamed, added.NewForeignKey) {
+				return ForeignKeyChange{}, false
+			}
+			return ForeignKeyChange{FKName: added.FKName, Action: ActionModify, OldForeignKey: dropped.OldForeignKey, NewForeignKey: added.NewForeignKey}, true
+		})
+}
+
+// matchRenamedChecks turns each dropped CHECK constraint and an added one
+// with the same expression into a rename (see RenameOnly)
+func matchRenamedChecks(changes []CheckChange, opts Options) []CheckChange {
+	return matchRenames(changes,
+		func(c CheckChange) (Action, string) { return c.Action, c.CheckName },
+		func(dropped, added CheckChange) (CheckChange, bool) {
+			if !definitionsEqual(dropped.OldCheck.Expression, added.NewCheck.Expression, opts) || dropped.OldCheck.NotValid != added.NewCheck.NotValid || dropped.OldCheck.NotEnforced != added.NewCheck.NotEnforced {
+				return CheckChange{}, false
+			}
+			return CheckChange{CheckName: added.CheckName, Action: ActionModify, OldCheck: dropped.OldCheck, NewCheck: added.NewCheck, sameExpression: true}, true
+		})
+}
+
+// matchRenames pairs dropped and added changes, both in name order, that
+// rename returns a rename for, and replaces each pair with its rename
+func matchRenames[C any](changes []C, key func(C) (Action, string), rename func(dropped, added C) (C, bool)) []C {
+	var dropped, added, kept []C
+	for _, change := range changes {
+		switch action, _ := key(change); action {
+		case ActionDrop:
+			dropped = append(dropped, change)
+		case ActionAdd:
+			added = append(added, change)
+		default:
+			kept = append(kept, change)
+		}
+	}
+	byName := func(list []C) {
+		sort.Slice(list, func(i, j int) bool {
+			_, a := key(list[i])
+			_, b := key(list[j])
+			return a < b
+		})
+	}
+	byName(dropped)
+	byName(added)
+
+	matched := make([]bool, len(added))
+	for _, d := range dropped {
+		found := false
+		for i, a := range added {
+			if matched[i] {
+				continue
+			}
+			if r, ok := rename(d, a); ok {
+				kept = append(kept, r)
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			kept = append(kept, d)
+		}
+	}
+	for i, a := range added {
+		if !matched[i] {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// RenameOnly reports whether a modified foreign key was matched by
+// definition and differs only in its name
+func (c ForeignKeyChange) RenameOnly() bool {
+	return c.Action == ActionModify && c.OldForeignKey.Name != c.NewForeignKey.Name
+}
+
+// RenameOnly reports whether a modified CHECK constraint was matched by
+// definition and differs only in its name
+func (c CheckChange) RenameOnly() bool {
+	return c.Action == ActionModify && c.OldCheck.Name != c.NewCheck.Name
+}
+
+// partitioningKeysEqual reports whether two tables are partitioned the same
+// way, regardless of their partitions
+func partitioningKeysEqual(a, b *schema.Partitioning) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Method == b.Method && a.Expression == b.Expression
+}
+
+// comparePartitions matches partitions by name and compares their bounds
+func comparePartitions(old, new []schema.Partition) []PartitionChange {
+	oldPartitions := make(map[string]*schema.Partition)
+	for i := range old {
+		oldPartitions[old[i].Name] = &old[i]
+	}
+
+	var changes []PartitionChange
+	for i := range new {
+		newPartition := &new[i]
+		oldPartition, exists := oldPartitions[newPartition.Name]
+		switch {
+		case !exists:
+			changes = append(changes, PartitionChange{PartitionName: newPartition.Name, Action: ActionAdd, NewPartition: newPartition})
+		case oldPartition.Bound != newPartition.Bound:
+			changes = append(changes, PartitionChange{PartitionName: newPartition.Name, Action: ActionModify, OldPartition: oldPartition, NewPartition: newPartition})
+		}
+		delete(oldPartitions, newPartition.Name)
+	}
+	for i := range old {
+		if _, dropped := oldPartitions[old[i].Name]; dropped {
+			changes = append(changes, PartitionChange{PartitionName: old[i].Name, Action: ActionDrop, OldPartition: &old[i]})
+		}
+	}
+	return changes
+}
+
 func foreignKeysEqual(a, b *schema.ForeignKey) bool {
 	return a.Name == b.Name &&
 		a.Column == b.Column &&
 		a.ReferencedTable == b.ReferencedTable &&
 		a.ReferencedColumn == b.ReferencedColumn &&
 		a.OnDelete == b.OnDelete &&
-		a.OnUpdate == b.OnUpdate
+		a.OnUpdate == b.OnUpdate &&
+		a.Comment == b.Comment &&
+		a.Deferrable == b.Deferrable &&
+		a.InitiallyDeferred == b.InitiallyDeferred &&
+		a.NotValid == b.NotValid
+}
+
+// CommentOnly reports whether a modified index differs only in its comment,
+// so it can be updated without being rebuilt
+func (c IndexChange) CommentOnly() bool {
+	if c.Action != ActionModify || c.OldIndex.Comment == c.NewIndex.Comment {
+		return false
+	}
+	oldIdx := *c.OldIndex
+	oldIdx.Comment = c.NewIndex.Comment
+	return indexesEqual(&oldIdx, c.NewIndex, false)
+}
+
+// ClusterOnly reports whether a modified index differs only in whether the
+// table is clustered on it, so it can be marked without being recreated
+func (c IndexChange) ClusterOnly() bool {
+	if c.Action != ActionModify || c.OldIndex.Clustered == c.NewIndex.Clustered {
+		return false
+	}
+	oldIdx := *c.OldIndex
+	oldIdx.Clustered = c.NewIndex.Clustered
+	return indexesEqual(&oldIdx, c.NewIndex, false)
+}
+
+// CommentOnly reports whether a modified foreign key differs only in its
+// comment, so it can be updated without being recreated
+func (c ForeignKeyChange) CommentOnly() bool {
+	if c.Action != ActionModify || c.OldForeignKey.Comment == c.NewForeignKey.Comment {
+		return false
+	}
+	oldFK := *c.OldForeignKey
+	oldFK.Comment = c.NewForeignKey.Comment
+	return foreignKeysEqual(&oldFK, c.NewForeignKey)
+}
+
+// ValidationOnly reports whether a modified foreign key differs only in
+// having been validated, so VALIDATE CONSTRAINT can check the existing rows
+// without recreating it. A constraint going back to NOT VALID is recreated.
+func (c ForeignKeyChange) ValidationOnly() bool {
+	if c.Action != ActionModify || !c.OldForeignKey.NotValid || c.NewForeignKey.NotValid {
+		return false
+	}
+	oldFK := *c.OldForeignKey
+	oldFK.NotValid = false
+	return foreignKeysEqual(&oldFK, c.NewForeignKey)
+}
+
+// ValidationOnly reports whether a modified CHECK constraint differs only in
+// having been validated, as for ForeignKeyChange.ValidationOnly
+func (c CheckChange) ValidationOnly() bool {
+	return c.Action == ActionModify && c.OldCheck.NotValid && !c.NewCheck.NotValid &&
+		!c.expressionChanged() && c.OldCheck.NotEnforced == c.NewCheck.NotEnforced
+}
+
+// expressionChanged reports whether a modified CHECK constraint tests
+// something else, under Options.NormalizeDefinitions ignoring formatting
+func (c CheckChange) expressionChanged() bool {
+	return !c.sameExpression && c.OldCheck.Expression != c.NewCheck.Expression
+}
+
+// enforcement describes whether a CHECK constraint is enforced
+func enforcement(notEnforced bool) string {
+	if notEnforced {
+		return "NOT ENFORCED"
+	}
+	return "ENFORCED"
+}
+
+// validity describes whether a constraint has been validated
+func validity(notValid bool) string {
+	if notValid {
+		return "NOT VALID"
+	}
+	return "VALID"
+}
+
+// deferrability describes when a foreign key is checked
+func deferrability(fk *schema.ForeignKey) string {
+	switch {
+	case fk.Deferrable && fk.InitiallyDeferred:
+		return "DEFERRABLE INITIALLY DEFERRED"
+	case fk.Deferrable:
+		return "DEFERRABLE INITIALLY IMMEDIATE"
+	default:
+		return "NOT DEFERRABLE"
+	}
+}
+
+// TimingOnly reports whether a modified foreign key stays deferrable and
+// differs only in INITIALLY DEFERRED/IMMEDIATE, so it can be altered in
+// place. Making a constraint deferrable or not recreates it.
+func (c ForeignKeyChange) TimingOnly() bool {
+	if c.Action != ActionModify || !c.OldForeignKey.Deferrable || !c.NewForeignKey.Deferrable ||
+		c.OldForeignKey.InitiallyDeferred == c.NewForeignKey.InitiallyDeferred {
+		return false
+	}
+	oldFK := *c.OldForeignKey
+	oldFK.InitiallyDeferred = c.NewForeignKey.InitiallyDeferred
+	return foreignKeysEqual(&oldFK, c.NewForeignKey)
 }
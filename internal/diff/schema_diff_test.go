@@ -0,0 +1,319 @@
+package diff
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestCompareChecks(t *testing.T) {
+	check := func(expression string, notValid, notEnforced bool) schema.CheckConstraint {
+		return schema.CheckConstraint{Name: "chk_price", Expression: expression, NotValid: notValid, NotEnforced: notEnforced}
+	}
+	tests := []struct {
+		name           string
+		old, new       []schema.CheckConstraint
+		normalize      bool
+		wantAction     Action
+		wantValidation bool
+	}{
+		{name: "unchanged", old: []schema.CheckConstraint{check("price > 0", false, false)}, new: []schema.CheckConstraint{check("price > 0", false, false)}},
+		{name: "expression", old: []schema.CheckConstraint{check("price > 0", false, false)}, new: []schema.CheckConstraint{check("price >= 0", false, false)}, wantAction: ActionModify},
+		{name: "no longer enforced", old: []schema.CheckConstraint{check("price > 0", false, false)}, new: []schema.CheckConstraint{check("price > 0", false, true)}, wantAction: ActionModify},
+		{name: "validated", old: []schema.CheckConstraint{check("price > 0", true, false)}, new: []schema.CheckConstraint{check("price > 0", false, false)}, wantAction: ActionModify, wantValidation: true},
+		{name: "validated, reformatted", old: []schema.CheckConstraint{check("price > 0", true, false)}, new: []schema.CheckConstraint{check("(PRICE > 0)", false, false)}, wantAction: ActionModify},
+		{name: "validated, reformatted and normalized", old: []schema.CheckConstraint{check("price  >  0", true, false)}, new: []schema.CheckConstraint{check("PRICE > 0", false, false)}, normalize: true, wantAction: ActionModify, wantValidation: true},
+		{name: "reformatted and normalized", old: []schema.CheckConstraint{check("price  >  0", false, false)}, new: []schema.CheckConstraint{check("PRICE > 0", false, false)}, normalize: true},
+		{name: "validated and enforced", old: []schema.CheckConstraint{check("price > 0", true, true)}, new: []schema.CheckConstraint{check("price > 0", false, false)}, wantAction: ActionModify},
+		{name: "added", new: []schema.CheckConstraint{check("price > 0", false, false)}, wantAction: ActionAdd},
+		{name: "dropped", old: []schema.CheckConstraint{check("price > 0", false, false)}, wantAction: ActionDrop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := compareChecks(tt.old, tt.new, Options{NormalizeDefinitions: tt.normalize})
+			if tt.wantAction == "" {
+				if len(changes) != 0 {
+					t.Fatalf("compareChecks() = %+v, want no changes", changes)
+				}
+				return
+			}
+			if len(changes) != 1 {
+				t.Fatalf("compareChecks() = %+v, want one change", changes)
+			}
+			if changes[0].Action != tt.wantAction {
+				t.Errorf("action = %s, want %s", changes[0].Action, tt.wantAction)
+			}
+			if got := changes[0].ValidationOnly(); got != tt.wantValidation {
+				t.Errorf("ValidationOnly() = %v, want %v", got, tt.wantValidation)
+			}
+		})
+	}
+}
+
+func TestCompareSchemasColumnType(t *testing.T) {
+	table := func(columnType string) *schema.TableSchema {
+		return &schema.TableSchema{Name: "items", Columns: []schema.Column{{Name: "code", Type: columnType, Position: 1}}}
+	}
+	tests := []struct {
+		name     string
+		old, new string
+		changed  bool
+	}{
+		{name: "unchanged", old: "varchar(10)", new: "varchar(10)"},
+		{name: "char to varchar", old: "char(10)", new: "varchar(10)", changed: true},
+		{name: "varchar to char", old: "varchar(10)", new: "char(10)", changed: true},
+		{name: "binary to varbinary", old: "binary(16)", new: "varbinary(16)", changed: true},
+		{name: "binary length", old: "binary(16)", new: "binary(32)", changed: true},
+		{name: "varchar length", old: "varchar(50)", new: "varchar(100)", changed: true},
+		{name: "char length", old: "char(10)", new: "char(20)", changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := compareSchemas(table(tt.old), table(tt.new), Options{})
+			if !tt.changed {
+				if diff != nil {
+					t.Fatalf("compareSchemas() = %+v, want no changes", diff)
+				}
+				return
+			}
+			if diff == nil {
+				t.Fatal("compareSchemas() = nil, want a column change")
+			}
+			changes := diff.ColumnChanges
+			if len(changes) != 1 {
+				t.Fatalf("compareSchemas() = %+v, want one column change", changes)
+			}
+			change := changes[0]
+			if change.Action != ActionModify {
+				t.Errorf("action = %s, want %s", change.Action, ActionModify)
+			}
+			if len(change.ChangedAttributes) != 1 || change.ChangedAttributes[0] != "type" {
+				t.Errorf("changed attributes = %v, want [type]", change.ChangedAttributes)
+			}
+		})
+	}
+}
+
+func TestChangedAttributes(t *testing.T) {
+	base := func(change func(col *schema.Column)) *schema.TableSchema {
+		zero := "0"
+		col := schema.Column{Name: "count", Type: "int", DefaultValue: &zero, Position: 1}
+		change(&col)
+		return &schema.TableSchema{Name: "items", Columns: []schema.Column{col}}
+	}
+	one := "1"
+	tests := []struct {
+		name   string
+		change func(col *schema.Column)
+		want   []string
+	}{
+		{"type", func(col *schema.Column) { col.Type = "bigint" }, []string{"type"}},
+		{"nullable", func(col *schema.Column) { col.Nullable = true }, []string{"nullable"}},
+		{"default", func(col *schema.Column) { col.DefaultValue = &one }, []string{"default"}},
+		{"default dropped", func(col *schema.Column) { col.DefaultValue = nil }, []string{"default"}},
+		{"auto_increment", func(col *schema.Column) { col.AutoIncrement = true }, []string{"auto_increment"}},
+		{"collation", func(col *schema.Column) { col.Collation = "C" }, []string{"collation"}},
+		{"identity", func(col *schema.Column) { col.Identity = "ALWAYS" }, []string{"identity"}},
+		{"generated", func(col *schema.Column) { col.Generated = "price * 2" }, []string{"generated"}},
+		{"type and default", func(col *schema.Column) { col.Type, col.DefaultValue = "bigint", &one }, []string{"type", "default"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := compareSchemas(base(func(*schema.Column) {}), base(tt.change), Options{})
+			if diff == nil || len(diff.ColumnChanges) != 1 {
+				t.Fatalf("compareSchemas() = %+v, want one column change", diff)
+			}
+			if got := diff.ColumnChanges[0].ChangedAttributes; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changed attributes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangedAttributesCollation(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		legacy   bool
+		want     bool
+	}{
+		{name: "same", old: "utf8mb4_general_ci", new: "utf8mb4_general_ci"},
+		{name: "changed", old: "utf8mb4_general_ci", new: "utf8mb4_bin", want: true},
+		{name: "explicit to default", old: "C", new: "", want: true},
+		{name: "default to explicit", old: "", new: "C", want: true},
+		{name: "not captured before", old: "", new: "utf8mb4_general_ci", legacy: true},
+		{name: "not captured after", old: "utf8mb4_general_ci", new: "", legacy: true},
+		{name: "legacy changed", old: "utf8mb4_general_ci", new: "utf8mb4_bin", legacy: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &schema.Column{Name: "name", Type: "varchar(50)", Collation: tt.old}
+			b := &schema.Column{Name: "name", Type: "varchar(50)", Collation: tt.new}
+			changed := changedAttributes(a, b, Options{legacyCollations: tt.legacy})
+			if got := len(changed) == 1 && changed[0] == "collation"; got != tt.want {
+				t.Errorf("changedAttributes() = %v, want collation change %v", changed, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareCollationMetadata(t *testing.T) {
+	snap := func(metadata map[string]string, collation string) *snapshot.Snapshot {
+		return &snapshot.Snapshot{Metadata: metadata, Tables: map[string]*schema.Table{
+			"users": {Schema: schema.TableSchema{Name: "users", Columns: []schema.Column{
+				{Name: "name", Type: "varchar(50)", Collation: collation},
+			}}},
+		}}
+	}
+	captured := map[string]string{"db_type": "mysql", "collations": "true"}
+	tests := []struct {
+		name     string
+		old, new map[string]string
+		want     bool
+	}{
+		{name: "captured", old: captured, new: captured, want: true},
+		{name: "postgres", old: map[string]string{"db_type": "postgres"}, new: map[string]string{"db_type": "postgres"}, want: true},
+		{name: "legacy mysql", old: map[string]string{"db_type": "mysql"}, new: captured},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Compare(snap(tt.old, "C"), snap(tt.new, ""), Options{})
+			if got := result.SchemaDiffs["users"] != nil; got != tt.want {
+				t.Errorf("schema changed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexesEqualDirection(t *testing.T) {
+	index := func(name string, descending ...bool) *schema.Index {
+		return &schema.Index{Name: name, Columns: []string{"user_id", "created_at"}, Descending: descending}
+	}
+	tests := []struct {
+		name       string
+		a, b       *schema.Index
+		ignoreName bool
+		want       bool
+	}{
+		{name: "same directions", a: index("idx", false, true), b: index("idx", false, true), want: true},
+		{name: "all ascending", a: index("idx"), b: index("idx", false, false), want: true},
+		{name: "direction changed", a: index("idx", false, true), b: index("idx", true, false)},
+		{name: "descending added", a: index("idx"), b: index("idx", false, true)},
+		{name: "by columns", a: index("idx_a", false, true), b: index("idx_b", false, true), ignoreName: true, want: true},
+		{name: "by columns, direction changed", a: index("idx_a", false, true), b: index("idx_b"), ignoreName: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := indexesEqual(tt.a, tt.b, tt.ignoreName); got != tt.want {
+				t.Errorf("indexesEqual() = %v, want %v", got, tt.want)
+			}
+			if tt.ignoreName {
+				if got := indexSignature(tt.a) == indexSignature(tt.b); got != tt.want {
+					t.Errorf("signatures equal = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareSchemasMatchIndexesByColumns(t *testing.T) {
+	table := func(indexes ...schema.Index) *schema.TableSchema {
+		return &schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "email", Type: "varchar(255)", Position: 1}}, Indexes: indexes}
+	}
+	tests := []struct {
+		name        string
+		old, new    *schema.TableSchema
+		byColumns   bool
+		wantChanges int
+	}{
+		{name: "renamed", old: table(schema.Index{Name: "idx_abc123", Columns: []string{"email"}}), new: table(schema.Index{Name: "idx_def456", Columns: []string{"email"}}),
+			byColumns: true},
+		{name: "renamed, by name", old: table(schema.Index{Name: "idx_abc123", Columns: []string{"email"}}), new: table(schema.Index{Name: "idx_def456", Columns: []string{"email"}}),
+			wantChanges: 2},
+		{name: "made unique", old: table(schema.Index{Name: "idx_abc123", Columns: []string{"email"}}), new: table(schema.Index{Name: "idx_def456", Columns: []string{"email"}, Unique: true}),
+			byColumns: true, wantChanges: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := compareSchemas(tt.old, tt.new, Options{MatchIndexesByColumns: tt.byColumns})
+			got := 0
+			if diff != nil {
+				got = len(diff.IndexChanges)
+			}
+			if got != tt.wantChanges {
+				t.Errorf("index changes = %d, want %d", got, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestIndexChangeClusterOnly(t *testing.T) {
+	index := func(clustered bool, comment string, columns ...string) *schema.Index {
+		return &schema.Index{Name: "idx", Columns: columns, Clustered: clustered, Comment: comment}
+	}
+	tests := []struct {
+		name     string
+		old, new *schema.Index
+		want     bool
+	}{
+		{name: "clustered", old: index(false, "", "a"), new: index(true, "", "a"), want: true},
+		{name: "unclustered", old: index(true, "", "a"), new: index(false, "", "a"), want: true},
+		{name: "columns too", old: index(false, "", "a"), new: index(true, "", "a", "b")},
+		{name: "comment too", old: index(false, "", "a"), new: index(true, "rows by a", "a")},
+		{name: "unchanged", old: index(true, "", "a"), new: index(true, "", "a")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := IndexChange{IndexName: "idx", Action: ActionModify, OldIndex: tt.old, NewIndex: tt.new}
+			if got := change.ClusterOnly(); got != tt.want {
+				t.Errorf("ClusterOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareSchemasOrder(t *testing.T) {
+	var oldCols, newCols []schema.Column
+	var oldIdx, newIdx []schema.Index
+	var oldFKs, newFKs []schema.ForeignKey
+	names := []string{"zeta", "alpha", "mu", "beta", "omega", "kappa"}
+	for i, name := range names {
+		oldCols = append(oldCols, schema.Column{Name: name, Type: "int", Position: i + 1})
+		newCols = append(newCols, schema.Column{Name: name, Type: "bigint", Position: i + 1})
+		oldIdx = append(oldIdx, schema.Index{Name: "idx_" + name, Columns: []string{name}})
+		newIdx = append(newIdx, schema.Index{Name: "idx_" + name, Columns: []string{name}, Unique: true})
+		oldFKs = append(oldFKs, schema.ForeignKey{Name: "fk_" + name, Column: name, ReferencedTable: "other", ReferencedColumn: "id"})
+		newFKs = append(newFKs, schema.ForeignKey{Name: "fk_" + name, Column: name, ReferencedTable: "other", ReferencedColumn: "id", OnDelete: "CASCADE"})
+	}
+	old := &schema.TableSchema{Name: "t", Columns: oldCols, Indexes: oldIdx, ForeignKeys: oldFKs}
+	new := &schema.TableSchema{Name: "t", Columns: newCols, Indexes: newIdx, ForeignKeys: newFKs}
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	for run := 0; run < 20; run++ {
+		diff := compareSchemas(old, new, Options{})
+		var columns, indexes, fks []string
+		for _, c := range diff.ColumnChanges {
+			columns = append(columns, c.ColumnName)
+		}
+		for _, c := range diff.IndexChanges {
+			indexes = append(indexes, strings.TrimPrefix(c.IndexName, "idx_"))
+		}
+		for _, c := range diff.ForeignKeyChanges {
+			fks = append(fks, strings.TrimPrefix(c.FKName, "fk_"))
+		}
+		// Columns follow their position, indexes and foreign keys their name
+		if !reflect.DeepEqual(columns, names) {
+			t.Fatalf("run %d: column changes = %v, want %v", run, columns, names)
+		}
+		for kind, got := range map[string][]string{"index": indexes, "foreign key": fks} {
+			if !reflect.DeepEqual(got, sorted) {
+				t.Fatalf("run %d: %s changes = %v, want %v", run, kind, got, sorted)
+			}
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// Options controls how data diffs are exported
+type Options struct {
+	// NullAs is written for SQL NULL values, e.g. `\N` or "NULL". The
+	// default empty string makes NULL indistinguishable from an empty string.
+	NullAs string
+	// RowsPerFile splits each table's rows into part files of at most this
+	// many rows, listed in a manifest (0: one file per table)
+	RowsPerFile int
+}
+
+// ManifestFile is the name of the manifest listing the part files of a
+// split export
+const ManifestFile = "manifest.json"
+
+// Manifest lists the part files of each table of a split export, in table
+// name order
+type Manifest struct {
+	RowsPerFile int             `json:"rows_per_file"`
+	Tables      []ManifestTable `json:"tables"`
+}
+
+// ManifestTable lists a table's part files in row order
+type ManifestTable struct {
+	Table   string         `json:"table"`
+	Columns []string       `json:"columns"`
+	Rows    int            `json:"rows"`
+	Parts   []ManifestPart `json:"parts"`
+}
+
+// ManifestPart is one part file, named relative to the export directory
+type ManifestPart struct {
+	File string `json:"file"`
+	Rows int    `json:"rows"`
+}
+
+// WriteCSVFiles writes each table's data diff to <dir>/<table>.csv, or with
+// Options.RowsPerFile to <dir>/<table>.partNNN.csv files and a manifest, and
+// returns the paths written, ordered by table name
+func WriteCSVFiles(dir string, result *diff.DiffResult, opts Options) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	tableNames := make([]string, 0, len(result.DataDiffs))
+	for name := range result.DataDiffs {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+
+	if opts.RowsPerFile > 0 {
+		return writeCSVParts(dir, tableNames, result, opts)
+	}
+
+	var paths []string
+	for _, tableName := range tableNames {
+		path := filepath.Join(dir, tableName+".csv")
+		if err := writeCSVFile(path, result.DataDiffs[tableName], opts); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// writeCSVParts writes each table's rows to part files of at most
+// Options.RowsPerFile rows, each with the header row, and the manifest
+// listing them. A table is written to a single header-only part when it has
+// no rows.
+func writeCSVParts(dir string, tableNames []string, result *diff.DiffResult, opts Options) ([]string, error) {
+	manifest := Manifest{RowsPerFile: opts.RowsPerFile, Tables: []ManifestTable{}}
+	var paths []string
+	for _, tableName := range tableNames {
+		dataDiff := result.DataDiffs[tableName]
+		columns := csvColumns(dataDiff)
+		rows := changedRows(dataDiff)
+		table := ManifestTable{Table: tableName, Columns: columns, Rows: len(rows)}
+
+		for start := 0; start == 0 || start < len(rows); start += opts.RowsPerFile {
+			end := min(start+opts.RowsPerFile, len(rows))
+			name := fmt.Sprintf("%s.part%03d.csv", tableName, len(table.Parts)+1)
+			path := filepath.Join(dir, name)
+			err := writeFile(path, func(w io.Writer) error {
+				return writeCSVRows(w, columns, rows[start:end], opts)
+			})
+			if err != nil {
+				return nil, err
+			}
+			table.Parts = append(table.Parts, ManifestPart{File: name, Rows: end - start})
+			paths = append(paths, path)
+		}
+		manifest.Tables = append(manifest.Tables, table)
+	}
+
+	path := filepath.Join(dir, ManifestFile)
+	err := writeFile(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(manifest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(paths, path), nil
+}
+
+func writeCSVFile(path string, dataDiff *diff.DataDiff, opts Options) error {
+	return writeFile(path, func(w io.Writer) error {
+		return WriteCSV(w, dataDiff, opts)
+	})
+}
+
+// writeFile creates path and writes its content with write
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// WriteCSV writes a table's changed rows as CSV. The first column is the
+// change (added, deleted or modified); modified rows are written with their
+// new values.
+func WriteCSV(w io.Writer, dataDiff *diff.DataDiff, opts Options) error {
+	return writeCSVRows(w, csvColumns(dataDiff), changedRows(dataDiff), opts)
+}
+
+// changedRow is a row to export and its change
+type changedRow struct {
+	change string
+	row    schema.Row
+}
+
+// changedRows returns the added, deleted and modified rows of a table in
+// export order
+func changedRows(dataDiff *diff.DataDiff) []changedRow {
+	rows := make([]changedRow, 0, len(dataDiff.RowsAdded)+len(dataDiff.RowsDeleted)+len(dataDiff.RowsModified))
+	for _, row := range dataDiff.RowsAdded {
+		rows = append(rows, changedRow{"added", row})
+	}
+	for _, row := range dataDiff.RowsDeleted {
+		rows = append(rows, changedRow{"deleted", row})
+	}
+	for _, mod := range dataDiff.RowsModified {
+		rows = append(rows, changedRow{"modified", mod.NewRow})
+	}
+	return rows
+}
+
+// writeCSVRows writes the header row and the rows' values in column order
+func writeCSVRows(w io.Writer, columns []string, rows []changedRow, opts Options) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"change"}, columns...)); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		record := []string{r.change}
+		for _, col := range columns {
+			record = append(record, formatCSVValue(r.row[col], opts))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvColumns returns the table's columns in schema order, falling back to
+// the sorted keys of the changed rows when no schema is available
+func csvColumns(dataDiff *diff.DataDiff) []string {
+	var columns []string
+	if dataDiff.Schema != nil && len(dataDiff.Schema.Columns) > 0 {
+		cols := make([]schema.Column, len(dataDiff.Schema.Columns))
+		copy(cols, dataDiff.Schema.Columns)
+		sort.SliceStable(cols, func(i, j int) bool { return cols[i].Position < cols[j].Position })
+		for _, col := range cols {
+			columns = append(columns, col.Name)
+		}
+		return columns
+	}
+
+	seen := make(map[string]bool)
+	addKeys := func(row schema.Row) {
+		for col := range row {
+			if !seen[col] {
+				seen[col] = true
+				columns = append(columns, col)
+			}
+		}
+	}
+	for _, row := range dataDiff.RowsAdded {
+		addKeys(row)
+	}
+	for _, row := range dataDiff.RowsDeleted {
+		addKeys(row)
+	}
+	for _, mod := range dataDiff.RowsModified {
+		addKeys(mod.NewRow)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func formatCSVValue(val interface{}, opts Options) string {
+	switch v := val.(type) {
+	case nil:
+		return opts.NullAs
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		// Nested JSON values (arrays, objects) keep their JSON form
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(b)
+	}
+}
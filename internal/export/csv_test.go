@@ -0,0 +1,107 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestWriteCSVNullAs(t *testing.T) {
+	dataDiff := &diff.DataDiff{
+		TableName: "users",
+		Schema:    &schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id", Position: 1}, {Name: "nickname", Position: 2}}},
+		RowsAdded: []schema.Row{{"id": float64(1), "nickname": nil}, {"id": float64(2), "nickname": ""}},
+	}
+	tests := []struct {
+		name   string
+		nullAs string
+		want   string
+	}{
+		// Without a token, NULL is written like an empty string
+		{name: "default", want: "change,id,nickname\nadded,1,\nadded,2,\n"},
+		{name: "backslash N", nullAs: `\N`, want: "change,id,nickname\nadded,1,\\N\nadded,2,\n"},
+		{name: "NULL", nullAs: "NULL", want: "change,id,nickname\nadded,1,NULL\nadded,2,\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteCSV(&buf, dataDiff, Options{NullAs: tt.nullAs}); err != nil {
+				t.Fatalf("WriteCSV() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("WriteCSV() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCSVFilesRowsPerFile(t *testing.T) {
+	users := &schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id", Position: 1}}}
+	dataDiff := func(n int) *diff.DataDiff {
+		d := &diff.DataDiff{TableName: "users", Schema: users}
+		for i := 1; i <= n; i++ {
+			d.RowsAdded = append(d.RowsAdded, schema.Row{"id": float64(i)})
+		}
+		return d
+	}
+	tests := []struct {
+		name      string
+		rows      int
+		wantParts []ManifestPart
+	}{
+		{name: "exactly full", rows: 4, wantParts: []ManifestPart{{File: "users.part001.csv", Rows: 2}, {File: "users.part002.csv", Rows: 2}}},
+		{name: "one over", rows: 5, wantParts: []ManifestPart{{File: "users.part001.csv", Rows: 2}, {File: "users.part002.csv", Rows: 2}, {File: "users.part003.csv", Rows: 1}}},
+		{name: "one under", rows: 1, wantParts: []ManifestPart{{File: "users.part001.csv", Rows: 1}}},
+		{name: "no rows", rows: 0, wantParts: []ManifestPart{{File: "users.part001.csv", Rows: 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			result := &diff.DiffResult{DataDiffs: map[string]*diff.DataDiff{"users": dataDiff(tt.rows)}}
+			paths, err := WriteCSVFiles(dir, result, Options{RowsPerFile: 2})
+			if err != nil {
+				t.Fatalf("WriteCSVFiles() error = %v", err)
+			}
+			if len(paths) != len(tt.wantParts)+1 {
+				t.Errorf("paths = %v, want %d parts and the manifest", paths, len(tt.wantParts))
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var manifest Manifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("manifest is not valid JSON: %v", err)
+			}
+			want := Manifest{RowsPerFile: 2, Tables: []ManifestTable{{Table: "users", Columns: []string{"id"}, Rows: tt.rows, Parts: tt.wantParts}}}
+			if !reflect.DeepEqual(manifest, want) {
+				t.Errorf("manifest = %+v, want %+v", manifest, want)
+			}
+
+			// Each part has the header row and its share of the rows, in order
+			next := 1
+			for _, part := range tt.wantParts {
+				data, err := os.ReadFile(filepath.Join(dir, part.File))
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := "change,id\n"
+				for i := 0; i < part.Rows; i++ {
+					want += fmt.Sprintf("added,%d\n", next)
+					next++
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", part.File, data, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// copied reports whether a table's added rows are copied from
+// Options.CopySource instead of being written as literals
+func (g *DMLGenerator) copied(tableName string) bool {
+	return g.opts.CopySource != "" && g.opts.CopyTables[tableName]
+}
+
+// generateCopy copies a table's added rows from the same table in
+// Options.CopySource with a single INSERT ... SELECT. When every row of the
+// second snapshot is added the whole source table is copied; otherwise rows
+// are selected by primary key. It returns "" when the rows cannot be
+// selected, so that they are inserted as literals instead.
+func (g *DMLGenerator) generateCopy(dataDiff *diff.DataDiff, rows []schema.Row, all bool) string {
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := sortedColumns(rows[0])
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = g.quoteIdentifier(col)
+	}
+	columnList := strings.Join(quoted, ", ")
+
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s.%s",
+		g.quoteIdentifier(dataDiff.TableName),
+		columnList,
+		columnList,
+		g.quoteIdentifier(g.opts.CopySource),
+		g.quoteIdentifier(dataDiff.TableName),
+	)
+	if !all {
+		where := g.copyKeyFilter(dataDiff.Schema, rows)
+		if where == "" {
+			return ""
+		}
+		stmt += " WHERE " + where
+	}
+	if g.opts.Upsert {
+		stmt += g.upsertClause(dataDiff.TableName, dataDiff.Schema, columns)
+	}
+	return stmt + ";"
+}
+
+// copyKeyFilter returns the condition selecting rows by primary key, e.g.
+// "id" IN (1, 2) or ("a", "b") IN ((1, 2), (3, 4)), or "" when the table has
+// no primary key
+func (g *DMLGenerator) copyKeyFilter(tableSchema *schema.TableSchema, rows []schema.Row) string {
+	pkColumns := tableSchema.PrimaryKeyColumns()
+	if len(pkColumns) == 0 {
+		return ""
+	}
+
+	types := columnTypes(tableSchema)
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		values := make([]string, len(pkColumns))
+		for j, col := range pkColumns {
+			values[j] = g.formatColumnValue(types[col], row[col])
+		}
+		keys[i] = strings.Join(values, ", ")
+	}
+
+	if len(pkColumns) == 1 {
+		return fmt.Sprintf("%s IN (%s)", g.quoteIdentifier(pkColumns[0]), strings.Join(keys, ", "))
+	}
+	quoted := make([]string, len(pkColumns))
+	for i, col := range pkColumns {
+		quoted[i] = g.quoteIdentifier(col)
+	}
+	return fmt.Sprintf("(%s) IN ((%s))", strings.Join(quoted, ", "), strings.Join(keys, "), ("))
+}
@@ -0,0 +1,63 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestCopyTables(t *testing.T) {
+	table := func(name string, pk ...string) *schema.TableSchema {
+		ts := &schema.TableSchema{Name: name, Columns: []schema.Column{
+			{Name: "code", Type: "varchar(2)", Position: 1},
+			{Name: "name", Type: "varchar(50)", Position: 2},
+		}}
+		if len(pk) > 0 {
+			ts.Indexes = []schema.Index{{Name: "PRIMARY", Columns: pk, Primary: true, Unique: true}}
+		}
+		return ts
+	}
+	rows := []schema.Row{{"code": "JP", "name": "Japan"}, {"code": "FR", "name": "France"}}
+	tests := []struct {
+		name     string
+		dataDiff *diff.DataDiff
+		want     []string
+	}{
+		{
+			name:     "whole table",
+			dataDiff: &diff.DataDiff{TableName: "countries", Schema: table("countries", "code"), RowsAdded: rows, NewRowCount: 2},
+			want:     []string{"INSERT INTO `countries` (`code`, `name`) SELECT `code`, `name` FROM `reference`.`countries`;"},
+		},
+		{
+			name:     "by primary key",
+			dataDiff: &diff.DataDiff{TableName: "countries", Schema: table("countries", "code"), RowsAdded: rows, NewRowCount: 5},
+			want:     []string{"INSERT INTO `countries` (`code`, `name`) SELECT `code`, `name` FROM `reference`.`countries` WHERE `code` IN ('JP', 'FR');"},
+		},
+		{
+			name:     "without primary key",
+			dataDiff: &diff.DataDiff{TableName: "countries", Schema: table("countries"), RowsAdded: rows, NewRowCount: 5},
+			want: []string{
+				"INSERT INTO `countries` (`code`, `name`) VALUES ('JP', 'Japan');",
+				"INSERT INTO `countries` (`code`, `name`) VALUES ('FR', 'France');",
+			},
+		},
+		{
+			name:     "table not flagged",
+			dataDiff: &diff.DataDiff{TableName: "regions", Schema: table("regions", "code"), RowsAdded: rows, NewRowCount: 2},
+			want: []string{
+				"INSERT INTO `regions` (`code`, `name`) VALUES ('JP', 'Japan');",
+				"INSERT INTO `regions` (`code`, `name`) VALUES ('FR', 'France');",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewDMLGenerator(Options{Dialect: "mysql", CopySource: "reference", CopyTables: map[string]bool{"countries": true}})
+			if got := g.Statements(tt.dataDiff); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package generator
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/koba/db-diff/internal/diff"
@@ -11,92 +13,333 @@ import (
 // DDLGenerator generates DDL statements
 type DDLGenerator struct {
 	dbType string
+	opts   Options
 }
 
 // NewDDLGenerator creates a new DDL generator
-func NewDDLGenerator(dbType string) *DDLGenerator {
-	return &DDLGenerator{dbType: dbType}
+func NewDDLGenerator(opts Options) *DDLGenerator {
+	return &DDLGenerator{dbType: opts.Dialect, opts: opts}
 }
 
 // Generate generates DDL for a schema diff
 func (g *DDLGenerator) Generate(schemaDiff *diff.SchemaDiff) string {
+	return strings.Join(g.Statements(schemaDiff), "\n")
+}
+
+// Statements generates the individual DDL statements for a schema diff
+func (g *DDLGenerator) Statements(schemaDiff *diff.SchemaDiff) []string {
 	var statements []string
+	for _, stmt := range g.statements(schemaDiff) {
+		statements = append(statements, stmt.sql)
+	}
+	return statements
+}
+
+// Split generates the DDL statements for a schema diff separated into
+// destructive ones, which drop tables, columns, indexes or foreign keys,
+// and the rest, each in generation order. Running all destructive
+// statements first reorders the migration and is not always safe: a drop
+// can fail on an object the other statements would have detached first,
+// such as a column still used by a view or a key another table's foreign
+// key references, and dropped data is gone before anything later can read
+// it. Review the destructive statements before running them ahead of the
+// rest.
+func (g *DDLGenerator) Split(schemaDiff *diff.SchemaDiff) (destructive, other []string) {
+	for _, stmt := range g.statements(schemaDiff) {
+		if stmt.destructive {
+			destructive = append(destructive, stmt.sql)
+		} else {
+			other = append(other, stmt.sql)
+		}
+	}
+	return destructive, other
+}
+
+// ddlStatement is a generated statement, whether it drops something and
+// whether it must wait until every table of the migration is created
+type ddlStatement struct {
+	sql         string
+	destructive bool
+	deferred    bool
+}
+
+func (g *DDLGenerator) statements(schemaDiff *diff.SchemaDiff) []ddlStatement {
+	var statements []ddlStatement
+	add := func(destructive bool, stmts ...string) {
+		for _, stmt := range stmts {
+			// Skip statements the dialect has no equivalent for
+			if stmt != "" {
+				statements = append(statements, ddlStatement{sql: g.opts.terminate(stmt), destructive: destructive})
+			}
+		}
+	}
 
 	switch schemaDiff.Action {
 	case diff.ActionAdd:
-		// Generate CREATE TABLE
-		stmt := g.generateCreateTable(schemaDiff.NewSchema)
-		statements = append(statements, stmt)
+		// Generate CREATE TABLE with its indexes, comments and rules
+		add(false, g.createTableStatements(schemaDiff.NewSchema)...)
+		if g.opts.IncludeAutoIncrement && schemaDiff.NewSchema.AutoIncrement > 0 {
+			add(false, g.generateSetAutoIncrement(schemaDiff.NewSchema))
+		}
 
 	case diff.ActionDrop:
 		// Generate DROP TABLE
 		stmt := g.generateDropTable(schemaDiff.TableName)
-		statements = append(statements, stmt)
+		add(true, stmt)
 
 	case diff.ActionModify:
 		// Generate ALTER TABLE statements
 
 		// Drop foreign keys first
 		for _, fkChange := range schemaDiff.ForeignKeyChanges {
-			if fkChange.Action == diff.ActionDrop || fkChange.Action == diff.ActionModify {
+			if fkChange.RenameOnly() && g.renamesConstraints() {
+				continue
+			}
+			if fkChange.Action == diff.ActionDrop || (fkChange.Action == diff.ActionModify && !fkChange.CommentOnly() && !fkChange.TimingOnly() && !fkChange.ValidationOnly()) {
 				stmt := g.generateDropForeignKey(schemaDiff.TableName, fkChange.OldForeignKey.Name)
-				statements = append(statements, stmt)
+				add(true, stmt)
+			}
+		}
+
+		// Drop rules, which may refer to columns about to change
+		for _, ruleChange := range schemaDiff.RuleChanges {
+			if ruleChange.Action == diff.ActionDrop {
+				add(true, g.generateDropRule(schemaDiff.TableName, ruleChange.RuleName))
+			}
+		}
+
+		// Drop check constraints before the columns they test change
+		for _, checkChange := range schemaDiff.CheckChanges {
+			if checkChange.RenameOnly() && g.renamesConstraints() {
+				continue
+			}
+			if checkChange.Action != diff.ActionAdd && !checkChange.ValidationOnly() {
+				add(true, g.generateDropCheck(schemaDiff.TableName, checkChange.OldCheck.Name))
+			}
+		}
+
+		// Remove dropped partitions and detach those whose bound changed
+		for _, partitionChange := range schemaDiff.PartitionChanges {
+			if partitionChange.Action != diff.ActionAdd {
+				add(true, g.generateDropPartition(schemaDiff.NewSchema, partitionChange))
 			}
 		}
 
 		// Drop indexes
 		for _, idxChange := range schemaDiff.IndexChanges {
-			if idxChange.Action == diff.ActionDrop || idxChange.Action == diff.ActionModify {
+			if idxChange.Action == diff.ActionDrop || (idxChange.Action == diff.ActionModify && !idxChange.CommentOnly() && !idxChange.ClusterOnly()) {
 				if !idxChange.OldIndex.Primary { // Don't drop primary key index directly
 					stmt := g.generateDropIndex(schemaDiff.TableName, idxChange.OldIndex.Name)
-					statements = append(statements, stmt)
+					add(true, stmt)
 				}
 			}
 		}
 
+		// Removing system versioning discards the row history and must
+		// happen before the period columns can be dropped
+		versioning := schemaDiff.NewSchema.SystemVersioning
+		if schemaDiff.SystemVersioningChanged && versioning == nil {
+			add(true, g.generateDropSystemVersioning(schemaDiff.TableName))
+		}
+
 		// Modify/drop/add columns
 		for _, colChange := range schemaDiff.ColumnChanges {
 			switch colChange.Action {
 			case diff.ActionAdd:
-				stmt := g.generateAddColumn(schemaDiff.TableName, colChange.NewColumn)
-				statements = append(statements, stmt)
+				if schemaDiff.SystemVersioningChanged && versioning.IsPeriodColumn(colChange.ColumnName) && g.supportsSystemVersioning() {
+					// Added together with the period below
+					continue
+				}
+				stmt := g.generateAddColumn(schemaDiff.NewSchema, colChange.NewColumn)
+				add(false, stmt)
 			case diff.ActionDrop:
 				stmt := g.generateDropColumn(schemaDiff.TableName, colChange.ColumnName)
-				statements = append(statements, stmt)
+				add(true, stmt)
 			case diff.ActionModify:
-				stmt := g.generateModifyColumn(schemaDiff.TableName, colChange.NewColumn)
-				statements = append(statements, stmt)
+				stmts := g.generateModifyColumn(schemaDiff.TableName, colChange)
+				add(false, stmts...)
 			}
 		}
 
+		if schemaDiff.SystemVersioningChanged && versioning != nil {
+			add(false, g.generateAddSystemVersioning(schemaDiff.NewSchema))
+		}
+
 		// Add indexes
 		for _, idxChange := range schemaDiff.IndexChanges {
+			if idxChange.CommentOnly() {
+				add(false, g.generateIndexComment(idxChange.NewIndex))
+				continue
+			}
+			if idxChange.ClusterOnly() {
+				add(false, g.generateCluster(schemaDiff.NewSchema, idxChange.NewIndex))
+				continue
+			}
 			if idxChange.Action == diff.ActionAdd || idxChange.Action == diff.ActionModify {
 				if !idxChange.NewIndex.Primary { // Primary key is part of CREATE TABLE
 					stmt := g.generateCreateIndex(schemaDiff.TableName, idxChange.NewIndex)
-					statements = append(statements, stmt)
+					if idxChange.NewIndex.Clustered {
+						stmt = withWarnings(stmt, clusteredConflict(schemaDiff.NewSchema))
+					}
+					add(false, stmt)
+					if idxChange.NewIndex.Clustered {
+						add(false, g.generateCluster(schemaDiff.NewSchema, idxChange.NewIndex))
+					}
+				}
+				if idxChange.NewIndex.Comment != "" {
+					add(false, g.generateIndexComment(idxChange.NewIndex))
 				}
 			}
 		}
 
 		// Add foreign keys
 		for _, fkChange := range schemaDiff.ForeignKeyChanges {
+			if fkChange.CommentOnly() {
+				add(false, g.generateForeignKeyComment(schemaDiff.TableName, fkChange.NewForeignKey))
+				continue
+			}
+			if fkChange.TimingOnly() {
+				add(false, g.generateAlterForeignKeyTiming(schemaDiff.TableName, fkChange.NewForeignKey))
+				continue
+			}
+			if fkChange.ValidationOnly() {
+				add(false, g.generateValidateConstraint(schemaDiff.TableName, fkChange.FKName))
+				continue
+			}
+			if fkChange.RenameOnly() && g.renamesConstraints() {
+				add(false, g.generateRenameConstraint(schemaDiff.TableName, fkChange.OldForeignKey.Name, fkChange.NewForeignKey.Name))
+				continue
+			}
 			if fkChange.Action == diff.ActionAdd || fkChange.Action == diff.ActionModify {
 				stmt := g.generateAddForeignKey(schemaDiff.TableName, fkChange.NewForeignKey)
-				statements = append(statements, stmt)
+				add(false, stmt)
+				if fkChange.NewForeignKey.Comment != "" {
+					add(false, g.generateForeignKeyComment(schemaDiff.TableName, fkChange.NewForeignKey))
+				}
+			}
+		}
+
+		// Add new and redefined check constraints
+		for _, checkChange := range schemaDiff.CheckChanges {
+			if checkChange.ValidationOnly() {
+				add(false, g.generateValidateConstraint(schemaDiff.TableName, checkChange.CheckName))
+			} else if checkChange.RenameOnly() && g.renamesConstraints() {
+				add(false, g.generateRenameConstraint(schemaDiff.TableName, checkChange.OldCheck.Name, checkChange.NewCheck.Name))
+			} else if checkChange.Action != diff.ActionDrop {
+				add(false, g.generateAddCheck(schemaDiff.TableName, checkChange.NewCheck))
+			}
+		}
+
+		if schemaDiff.AutoIncrementChanged && g.opts.IncludeAutoIncrement {
+			add(false, g.generateSetAutoIncrement(schemaDiff.NewSchema))
+		}
+
+		// Add or replace rules
+		for _, ruleChange := range schemaDiff.RuleChanges {
+			if ruleChange.Action != diff.ActionDrop {
+				add(false, g.generateCreateRule(schemaDiff.TableName, ruleChange.NewRule, ruleChange.Action == diff.ActionModify))
+			}
+		}
+
+		if schemaDiff.PartitioningChanged {
+			add(false, fmt.Sprintf("-- WARNING: partitioning of %s changed from %s to %s; repartition the table manually",
+				schemaDiff.TableName, partitioningKey(schemaDiff.OldSchema), partitioningKey(schemaDiff.NewSchema)))
+		}
+
+		// Add new partitions and re-bound changed ones. A PostgreSQL
+		// partition is a table of its own that the migration may create
+		// after its parent, so it is attached once every table exists.
+		for _, partitionChange := range schemaDiff.PartitionChanges {
+			if partitionChange.Action == diff.ActionDrop {
+				continue
+			}
+			if stmt := g.generateAddPartition(schemaDiff.NewSchema, partitionChange); stmt != "" {
+				statements = append(statements, ddlStatement{
+					sql:      g.opts.terminate(stmt),
+					deferred: g.dbType == "postgres" || g.dbType == "PostgreSQL",
+				})
+			}
+		}
+
+		// Reorder columns last, since a PostgreSQL rebuild copies the table
+		// as every other change left it
+		if schemaDiff.ColumnOrderChanged {
+			for _, stmt := range g.generateColumnReorder(schemaDiff) {
+				add(stmt.destructive, stmt.sql)
 			}
 		}
 	}
 
-	return strings.Join(statements, "\n")
+	return statements
+}
+
+// CreateTableStatements generates CREATE TABLE and CREATE INDEX statements
+// that build a table from scratch
+func (g *DDLGenerator) CreateTableStatements(tableSchema *schema.TableSchema) []string {
+	statements := g.createTableStatements(tableSchema)
+	for i, stmt := range statements {
+		statements[i] = g.opts.terminate(stmt)
+	}
+	return statements
+}
+
+// createTableStatements is CreateTableStatements without the terminator
+func (g *DDLGenerator) createTableStatements(tableSchema *schema.TableSchema) []string {
+	statements := []string{g.generateCreateTable(tableSchema)}
+	var comments []string
+	for i := range tableSchema.Indexes {
+		if !tableSchema.Indexes[i].Primary {
+			statements = append(statements, g.generateCreateIndex(tableSchema.Name, &tableSchema.Indexes[i]))
+		}
+		if tableSchema.Indexes[i].Clustered {
+			if stmt := g.generateCluster(tableSchema, &tableSchema.Indexes[i]); stmt != "" {
+				statements = append(statements, stmt)
+			}
+		}
+		if tableSchema.Indexes[i].Comment != "" {
+			comments = append(comments, g.generateIndexComment(&tableSchema.Indexes[i]))
+		}
+	}
+	for i := range tableSchema.ForeignKeys {
+		if tableSchema.ForeignKeys[i].Comment != "" {
+			comments = append(comments, g.generateForeignKeyComment(tableSchema.Name, &tableSchema.ForeignKeys[i]))
+		}
+	}
+	for _, comment := range comments {
+		if comment != "" {
+			statements = append(statements, comment)
+		}
+	}
+	for i := range tableSchema.Rules {
+		if stmt := g.generateCreateRule(tableSchema.Name, &tableSchema.Rules[i], false); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
 }
 
 func (g *DDLGenerator) generateCreateTable(tableSchema *schema.TableSchema) string {
 	var parts []string
 
 	// Column definitions
+	var warnings []string
+	versioning := tableSchema.SystemVersioning
+	if versioning != nil && !g.supportsSystemVersioning() {
+		warnings = append(warnings, fmt.Sprintf("WARNING: %s does not support system versioning, %s is created as a regular table", g.dbType, tableSchema.Name))
+		versioning = nil
+	}
 	for _, col := range tableSchema.Columns {
+		if versioning.IsPeriodColumn(col.Name) {
+			parts = append(parts, g.periodColumnDefinition(&col, col.Name == versioning.PeriodStart))
+			continue
+		}
 		parts = append(parts, g.columnDefinition(&col))
+		if warning := g.typeWarning(tableSchema.Name, &col); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	if versioning != nil {
+		parts = append(parts, g.periodDefinition(versioning))
 	}
 
 	// Primary key
@@ -122,44 +365,322 @@ func (g *DDLGenerator) generateCreateTable(tableSchema *schema.TableSchema) stri
 		if fk.OnUpdate != "" {
 			fkDef += fmt.Sprintf(" ON UPDATE %s", fk.OnUpdate)
 		}
+		fkDef += g.deferrableClause(&fk)
 		parts = append(parts, fkDef)
 	}
 
+	// Check constraints
+	for i := range tableSchema.Checks {
+		parts = append(parts, g.checkDefinition(&tableSchema.Checks[i]))
+		warnings = append(warnings, g.checkWarning(tableSchema.Name, &tableSchema.Checks[i]))
+	}
+
 	tableName := g.quoteIdentifier(tableSchema.Name)
-	return fmt.Sprintf("CREATE TABLE %s (\n  %s\n);", tableName, strings.Join(parts, ",\n  "))
+	options := ""
+	if versioning != nil {
+		options = " WITH SYSTEM VERSIONING"
+	}
+	create := "CREATE TABLE"
+	if g.opts.IfExists {
+		create += " IF NOT EXISTS"
+	}
+	stmt := fmt.Sprintf("%s %s (\n  %s\n)%s;", create, tableName, strings.Join(parts, ",\n  "), options)
+	return withWarnings(stmt, warnings...)
+}
+
+// supportsSystemVersioning reports whether the dialect has system-versioned
+// tables; of the supported databases only MariaDB, through the MySQL
+// dialect, does
+func (g *DDLGenerator) supportsSystemVersioning() bool {
+	return g.dbType != "postgres" && g.dbType != "PostgreSQL"
+}
+
+// periodColumnDefinition defines a ROW START or ROW END column, which the
+// database fills in itself
+func (g *DDLGenerator) periodColumnDefinition(col *schema.Column, start bool) string {
+	bound := "END"
+	if start {
+		bound = "START"
+	}
+	return fmt.Sprintf("%s %s GENERATED ALWAYS AS ROW %s", g.quoteIdentifier(col.Name), col.Type, bound)
+}
+
+func (g *DDLGenerator) periodDefinition(versioning *schema.SystemVersioning) string {
+	return fmt.Sprintf("PERIOD FOR SYSTEM_TIME(%s, %s)",
+		g.quoteIdentifier(versioning.PeriodStart), g.quoteIdentifier(versioning.PeriodEnd))
+}
+
+// generateAddSystemVersioning adds the period columns and system versioning
+// in one statement, as MariaDB requires
+func (g *DDLGenerator) generateAddSystemVersioning(tableSchema *schema.TableSchema) string {
+	if !g.supportsSystemVersioning() {
+		return fmt.Sprintf("-- WARNING: %s does not support system versioning, not added to %s", g.dbType, tableSchema.Name)
+	}
+
+	versioning := tableSchema.SystemVersioning
+	var clauses []string
+	for i := range tableSchema.Columns {
+		col := &tableSchema.Columns[i]
+		if versioning.IsPeriodColumn(col.Name) {
+			clauses = append(clauses, "ADD COLUMN "+g.periodColumnDefinition(col, col.Name == versioning.PeriodStart))
+		}
+	}
+	clauses = append(clauses, "ADD "+g.periodDefinition(versioning), "ADD SYSTEM VERSIONING")
+	return fmt.Sprintf("ALTER TABLE %s %s;", g.quoteIdentifier(tableSchema.Name), strings.Join(clauses, ", "))
+}
+
+// generateCreateRule creates a rule from its captured definition, or with
+// replace redefines an existing one. Rules are PostgreSQL-only, so other
+// dialects get a warning instead.
+func (g *DDLGenerator) generateCreateRule(tableName string, rule *schema.Rule, replace bool) string {
+	if g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		return fmt.Sprintf("-- WARNING: %s does not support rules, rule %s on %s not created", g.dbType, rule.Name, tableName)
+	}
+	stmt := strings.TrimSpace(rule.Definition)
+	if replace {
+		stmt = strings.Replace(stmt, "CREATE RULE", "CREATE OR REPLACE RULE", 1)
+	}
+	if !strings.HasSuffix(stmt, ";") {
+		stmt += ";"
+	}
+	return stmt
+}
+
+func (g *DDLGenerator) generateDropRule(tableName, ruleName string) string {
+	if g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		return ""
+	}
+	return fmt.Sprintf("DROP RULE %s ON %s;", g.quoteIdentifier(ruleName), g.quoteIdentifier(tableName))
+}
+
+// generateAddPartition attaches a partition (PostgreSQL) or adds it to the
+// table's partition list (MySQL). MySQL changes a partition's bound in place
+// with REORGANIZE PARTITION.
+func (g *DDLGenerator) generateAddPartition(tableSchema *schema.TableSchema, change diff.PartitionChange) string {
+	partition := change.NewPartition
+	switch {
+	case g.dbType == "postgres" || g.dbType == "PostgreSQL":
+		return fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s %s;",
+			g.quoteIdentifier(tableSchema.Name), g.quoteIdentifier(partition.Name), partition.Bound)
+	case change.Action == diff.ActionModify:
+		return fmt.Sprintf("ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s);",
+			g.quoteIdentifier(tableSchema.Name), g.quoteIdentifier(partition.Name), g.partitionDefinition(partition))
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD PARTITION (%s);", g.quoteIdentifier(tableSchema.Name), g.partitionDefinition(partition))
+}
+
+// generateDropPartition detaches a partition (PostgreSQL), leaving it as a
+// standalone table, or drops it with its rows (MySQL). MySQL HASH and KEY
+// partitions cannot be dropped by name, so the partition count is reduced
+// instead.
+func (g *DDLGenerator) generateDropPartition(tableSchema *schema.TableSchema, change diff.PartitionChange) string {
+	switch {
+	case g.dbType == "postgres" || g.dbType == "PostgreSQL":
+		return fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s;",
+			g.quoteIdentifier(tableSchema.Name), g.quoteIdentifier(change.PartitionName))
+	case change.Action == diff.ActionModify:
+		// Re-bound in place by generateAddPartition
+		return ""
+	case change.OldPartition.Bound == "":
+		return fmt.Sprintf("ALTER TABLE %s COALESCE PARTITION 1;", g.quoteIdentifier(tableSchema.Name))
+	}
+	return fmt.Sprintf("ALTER TABLE %s DROP PARTITION %s;",
+		g.quoteIdentifier(tableSchema.Name), g.quoteIdentifier(change.PartitionName))
+}
+
+// partitionDefinition formats a MySQL partition definition
+func (g *DDLGenerator) partitionDefinition(partition *schema.Partition) string {
+	if partition.Bound == "" {
+		return "PARTITION " + g.quoteIdentifier(partition.Name)
+	}
+	return fmt.Sprintf("PARTITION %s %s", g.quoteIdentifier(partition.Name), partition.Bound)
+}
+
+// partitioningKey describes how a table is partitioned, e.g. "RANGE (id)"
+func partitioningKey(tableSchema *schema.TableSchema) string {
+	if tableSchema.Partitioning == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s (%s)", tableSchema.Partitioning.Method, tableSchema.Partitioning.Expression)
+}
+
+func (g *DDLGenerator) generateDropSystemVersioning(tableName string) string {
+	if !g.supportsSystemVersioning() {
+		return ""
+	}
+	return fmt.Sprintf("ALTER TABLE %s DROP SYSTEM VERSIONING;", g.quoteIdentifier(tableName))
+}
+
+// generateSetAutoIncrement sets the next auto-increment value of a table
+func (g *DDLGenerator) generateSetAutoIncrement(tableSchema *schema.TableSchema) string {
+	switch {
+	case g.dbType == "postgres" || g.dbType == "PostgreSQL":
+		// The value belongs to the sequence of the auto-increment column
+		for _, col := range tableSchema.Columns {
+			if col.AutoIncrement {
+				return fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, %s), %d, false);",
+					quoteLiteral(g.quoteIdentifier(tableSchema.Name)),
+					quoteLiteral(col.Name),
+					tableSchema.AutoIncrement,
+				)
+			}
+		}
+		return ""
+	}
+	// MySQL
+	return fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d;", g.quoteIdentifier(tableSchema.Name), tableSchema.AutoIncrement)
 }
 
 func (g *DDLGenerator) generateDropTable(tableName string) string {
+	if g.opts.IfExists {
+		return fmt.Sprintf("DROP TABLE IF EXISTS %s;", g.quoteIdentifier(tableName))
+	}
 	return fmt.Sprintf("DROP TABLE %s;", g.quoteIdentifier(tableName))
 }
 
-func (g *DDLGenerator) generateAddColumn(tableName string, col *schema.Column) string {
-	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;",
+// generateAddColumn adds a column of tableSchema. MySQL places it after the
+// column that precedes it in tableSchema; other dialects append it.
+func (g *DDLGenerator) generateAddColumn(tableSchema *schema.TableSchema, col *schema.Column) string {
+	tableName := tableSchema.Name
+	position := ""
+	if g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		position = g.columnPosition(tableSchema, col.Name)
+	}
+	stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s%s;",
 		g.quoteIdentifier(tableName),
 		g.columnDefinition(col),
+		position,
 	)
+	if g.opts.IfExists {
+		switch {
+		case g.dbType == "postgres" || g.dbType == "PostgreSQL":
+			stmt = strings.Replace(stmt, " ADD COLUMN ", " ADD COLUMN IF NOT EXISTS ", 1)
+		default:
+			stmt = g.mysqlColumnGuard(stmt, tableName, col.Name, false)
+		}
+	}
+	return withWarnings(stmt, g.typeWarning(tableName, col))
+}
+
+// columnPosition returns the FIRST or AFTER clause putting a column where
+// tableSchema has it, by column position
+func (g *DDLGenerator) columnPosition(tableSchema *schema.TableSchema, name string) string {
+	columns := append([]schema.Column(nil), tableSchema.Columns...)
+	sort.SliceStable(columns, func(i, j int) bool { return columns[i].Position < columns[j].Position })
+	for i, col := range columns {
+		if col.Name != name {
+			continue
+		}
+		if i == 0 {
+			return " FIRST"
+		}
+		return " AFTER " + g.quoteIdentifier(columns[i-1].Name)
+	}
+	return ""
 }
 
 func (g *DDLGenerator) generateDropColumn(tableName, columnName string) string {
-	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;",
+	stmt := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;",
 		g.quoteIdentifier(tableName),
 		g.quoteIdentifier(columnName),
 	)
+	if g.opts.IfExists {
+		switch {
+		case g.dbType == "postgres" || g.dbType == "PostgreSQL":
+			stmt = strings.Replace(stmt, " DROP COLUMN ", " DROP COLUMN IF EXISTS ", 1)
+		default:
+			stmt = g.mysqlColumnGuard(stmt, tableName, columnName, true)
+		}
+	}
+	return stmt
 }
 
-func (g *DDLGenerator) generateModifyColumn(tableName string, col *schema.Column) string {
+// mysqlColumnGuard makes a column statement conditional on whether the
+// column exists. MySQL has no ADD/DROP COLUMN IF [NOT] EXISTS (MariaDB
+// does, but the target is not known), so information_schema is checked and
+// a prepared statement runs either stmt or a no-op. The guard is several
+// statements that must run in sequence on one session: the mysql
+// command-line client does, and dbdiff apply runs them one by one in the
+// same transaction.
+func (g *DDLGenerator) mysqlColumnGuard(stmt, tableName, columnName string, mustExist bool) string {
+	want := 0
+	if mustExist {
+		want = 1
+	}
+	escaped := quoteLiteral(strings.ReplaceAll(strings.TrimSuffix(stmt, ";"), `\`, `\\`))
+	// The last statement's terminator is applied with the others'
+	return strings.Join([]string{
+		g.opts.terminate(fmt.Sprintf("SET @dbdiff_ddl = IF((SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = %s AND COLUMN_NAME = %s) = %d, %s, 'DO 0');",
+			quoteLiteral(tableName), quoteLiteral(columnName), want, escaped)),
+		g.opts.terminate("PREPARE dbdiff_stmt FROM @dbdiff_ddl;"),
+		g.opts.terminate("EXECUTE dbdiff_stmt;"),
+		"DEALLOCATE PREPARE dbdiff_stmt;",
+	}, "\n")
+}
+
+func (g *DDLGenerator) generateModifyColumn(tableName string, change diff.ColumnChange) []string {
+	oldCol, col := change.OldColumn, change.NewColumn
 	if g.dbType == "postgres" || g.dbType == "PostgreSQL" {
-		return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s;",
-			g.quoteIdentifier(tableName),
-			g.quoteIdentifier(col.Name),
-			col.Type,
-		)
+		var statements []string
+		table := g.quoteIdentifier(tableName)
+		column := g.quoteIdentifier(col.Name)
+
+		if oldCol.Type != col.Type || slices.Contains(change.ChangedAttributes, "collation") {
+			statements = append(statements, g.alterColumnType(tableName, col))
+		}
+
+		// Default changes
+		if !schema.DefaultsEqual(oldCol.DefaultValue, col.DefaultValue) {
+			if col.DefaultValue == nil {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT;", table, column))
+			} else {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;", table, column, formatDefault(col)))
+			}
+		}
+
+		// Generation expression changes: SET EXPRESSION needs PostgreSQL 17,
+		// DROP EXPRESSION 13, and an existing column can't become generated
+		switch {
+		case oldCol.Generated == col.Generated:
+		case col.Generated == "":
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP EXPRESSION;", table, column))
+		case oldCol.Generated == "":
+			statements = append(statements, fmt.Sprintf("-- WARNING: PostgreSQL cannot make the existing column %s.%s generated; drop and add it again", tableName, col.Name))
+		default:
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET EXPRESSION AS (%s);", table, column, col.Generated))
+		}
+
+		// Identity changes
+		switch {
+		case oldCol.Identity == "" && col.Identity != "":
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ADD GENERATED %s AS IDENTITY;", table, column, col.Identity))
+		case oldCol.Identity != "" && col.Identity == "":
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP IDENTITY;", table, column))
+		case oldCol.Identity != col.Identity:
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET GENERATED %s;", table, column, col.Identity))
+		}
+
+		if len(statements) == 0 {
+			statements = append(statements, g.alterColumnType(tableName, col))
+		}
+		return statements
 	}
 	// MySQL
-	return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s;",
+	stmt := fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s;",
 		g.quoteIdentifier(tableName),
 		g.columnDefinition(col),
 	)
+	return []string{withWarnings(stmt, g.typeWarning(tableName, col))}
+}
+
+func (g *DDLGenerator) alterColumnType(tableName string, col *schema.Column) string {
+	stmt := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s%s;",
+		g.quoteIdentifier(tableName),
+		g.quoteIdentifier(col.Name),
+		g.columnType(col),
+		g.collateClause(col),
+	)
+	return withWarnings(stmt, g.typeWarning(tableName, col))
 }
 
 func (g *DDLGenerator) generateCreateIndex(tableName string, idx *schema.Index) string {
@@ -168,7 +689,13 @@ func (g *DDLGenerator) generateCreateIndex(tableName string, idx *schema.Index)
 		indexType = "UNIQUE "
 	}
 
-	columns := strings.Join(g.quoteIdentifiers(idx.Columns), ", ")
+	columnDefs := g.quoteIdentifiers(idx.Columns)
+	for i := range columnDefs {
+		if idx.IsDescending(i) {
+			columnDefs[i] += " DESC"
+		}
+	}
+	columns := strings.Join(columnDefs, ", ")
 	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s);",
 		indexType,
 		g.quoteIdentifier(idx.Name),
@@ -177,6 +704,42 @@ func (g *DDLGenerator) generateCreateIndex(tableName string, idx *schema.Index)
 	)
 }
 
+// generateCluster marks the index PostgreSQL's CLUSTER command orders the
+// table by, or removes the mark when no index of the table has it any more.
+// MySQL has no such mark: InnoDB always clusters on the primary key.
+func (g *DDLGenerator) generateCluster(tableSchema *schema.TableSchema, idx *schema.Index) string {
+	if g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		return ""
+	}
+	table := g.quoteIdentifier(tableSchema.Name)
+	if idx.Clustered {
+		return fmt.Sprintf("ALTER TABLE %s CLUSTER ON %s;", table, g.quoteIdentifier(idx.Name))
+	}
+	for _, other := range tableSchema.Indexes {
+		if other.Clustered {
+			// Marking the other index moves the mark
+			return ""
+		}
+	}
+	return fmt.Sprintf("ALTER TABLE %s SET WITHOUT CLUSTER;", table)
+}
+
+// clusteredConflict warns when a table has more than one clustered index,
+// which no database allows
+func clusteredConflict(tableSchema *schema.TableSchema) string {
+	var clustered []string
+	for _, idx := range tableSchema.Indexes {
+		if idx.Clustered {
+			clustered = append(clustered, idx.Name)
+		}
+	}
+	if len(clustered) <= 1 {
+		return ""
+	}
+	sort.Strings(clustered)
+	return fmt.Sprintf("WARNING: table %s has multiple clustered indexes: %s", tableSchema.Name, strings.Join(clustered, ", "))
+}
+
 func (g *DDLGenerator) generateDropIndex(tableName, indexName string) string {
 	if g.dbType == "postgres" || g.dbType == "PostgreSQL" {
 		return fmt.Sprintf("DROP INDEX %s;", g.quoteIdentifier(indexName))
@@ -202,7 +765,71 @@ func (g *DDLGenerator) generateAddForeignKey(tableName string, fk *schema.Foreig
 	if fk.OnUpdate != "" {
 		fkDef += fmt.Sprintf(" ON UPDATE %s", fk.OnUpdate)
 	}
-	return fkDef + ";"
+	return fkDef + g.deferrableClause(fk) + g.notValidClause(fk.NotValid) + ";"
+}
+
+// notValidClause adds a PostgreSQL constraint without checking the existing
+// rows, as it was captured. CREATE TABLE constraints are always valid.
+func (g *DDLGenerator) notValidClause(notValid bool) string {
+	if !notValid || (g.dbType != "postgres" && g.dbType != "PostgreSQL") {
+		return ""
+	}
+	return " NOT VALID"
+}
+
+// renamesConstraints reports whether the dialect can rename a constraint in
+// place; MySQL drops and re-adds a renamed one
+func (g *DDLGenerator) renamesConstraints() bool {
+	return g.dbType == "postgres" || g.dbType == "PostgreSQL"
+}
+
+func (g *DDLGenerator) generateRenameConstraint(tableName, oldName, newName string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME CONSTRAINT %s TO %s;",
+		g.quoteIdentifier(tableName),
+		g.quoteIdentifier(oldName),
+		g.quoteIdentifier(newName),
+	)
+}
+
+// generateValidateConstraint checks the existing rows of a NOT VALID
+// constraint, which takes a lighter lock than recreating it
+func (g *DDLGenerator) generateValidateConstraint(tableName, constraintName string) string {
+	if g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		return ""
+	}
+	return fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s;",
+		g.quoteIdentifier(tableName),
+		g.quoteIdentifier(constraintName),
+	)
+}
+
+// deferrableClause returns the DEFERRABLE clause of a foreign key definition.
+// Only PostgreSQL constraints are deferrable.
+func (g *DDLGenerator) deferrableClause(fk *schema.ForeignKey) string {
+	if !fk.Deferrable || (g.dbType != "postgres" && g.dbType != "PostgreSQL") {
+		return ""
+	}
+	if fk.InitiallyDeferred {
+		return " DEFERRABLE INITIALLY DEFERRED"
+	}
+	return " DEFERRABLE"
+}
+
+// generateAlterForeignKeyTiming switches a deferrable foreign key between
+// INITIALLY DEFERRED and INITIALLY IMMEDIATE without recreating it
+func (g *DDLGenerator) generateAlterForeignKeyTiming(tableName string, fk *schema.ForeignKey) string {
+	if g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		return ""
+	}
+	timing := "IMMEDIATE"
+	if fk.InitiallyDeferred {
+		timing = "DEFERRED"
+	}
+	return fmt.Sprintf("ALTER TABLE %s ALTER CONSTRAINT %s INITIALLY %s;",
+		g.quoteIdentifier(tableName),
+		g.quoteIdentifier(fk.Name),
+		timing,
+	)
 }
 
 func (g *DDLGenerator) generateDropForeignKey(tableName, fkName string) string {
@@ -219,20 +846,97 @@ func (g *DDLGenerator) generateDropForeignKey(tableName, fkName string) string {
 	)
 }
 
+// checkDefinition returns the table constraint clause of a CHECK constraint.
+// Only MySQL can declare one NOT ENFORCED.
+func (g *DDLGenerator) checkDefinition(check *schema.CheckConstraint) string {
+	definition := fmt.Sprintf("CONSTRAINT %s CHECK (%s)", g.quoteIdentifier(check.Name), check.Expression)
+	if check.NotEnforced && g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		definition += " NOT ENFORCED"
+	}
+	return definition
+}
+
+func (g *DDLGenerator) generateAddCheck(tableName string, check *schema.CheckConstraint) string {
+	stmt := fmt.Sprintf("ALTER TABLE %s ADD %s%s;", g.quoteIdentifier(tableName), g.checkDefinition(check), g.notValidClause(check.NotValid))
+	return withWarnings(stmt, g.checkWarning(tableName, check))
+}
+
+// generateDropCheck drops a CHECK constraint. MySQL accepts DROP CONSTRAINT
+// from 8.0.19 on.
+func (g *DDLGenerator) generateDropCheck(tableName, checkName string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;",
+		g.quoteIdentifier(tableName),
+		g.quoteIdentifier(checkName),
+	)
+}
+
+// checkWarning flags check expressions copied from another dialect, which
+// are not translated
+func (g *DDLGenerator) checkWarning(tableName string, check *schema.CheckConstraint) string {
+	if !g.translating() {
+		return ""
+	}
+	return fmt.Sprintf("WARNING: check %s on %s is copied from %s unchanged; review its expression", check.Name, tableName, g.opts.SourceDialect)
+}
+
+// generateIndexComment sets or clears an index comment. Only PostgreSQL
+// comments are captured, so other dialects get no statement.
+func (g *DDLGenerator) generateIndexComment(idx *schema.Index) string {
+	if g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		return ""
+	}
+	return fmt.Sprintf("COMMENT ON INDEX %s IS %s;", g.quoteIdentifier(idx.Name), commentLiteral(idx.Comment))
+}
+
+// generateForeignKeyComment sets or clears a foreign key constraint comment
+// (PostgreSQL only)
+func (g *DDLGenerator) generateForeignKeyComment(tableName string, fk *schema.ForeignKey) string {
+	if g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		return ""
+	}
+	return fmt.Sprintf("COMMENT ON CONSTRAINT %s ON %s IS %s;",
+		g.quoteIdentifier(fk.Name), g.quoteIdentifier(tableName), commentLiteral(fk.Comment))
+}
+
+// commentLiteral quotes a comment, with NULL removing it
+func commentLiteral(comment string) string {
+	if comment == "" {
+		return "NULL"
+	}
+	return quoteLiteral(comment)
+}
+
 func (g *DDLGenerator) columnDefinition(col *schema.Column) string {
-	def := g.quoteIdentifier(col.Name) + " " + col.Type
+	def := g.quoteIdentifier(col.Name) + " " + g.columnType(col) + g.collateClause(col)
+
+	// A generated column has neither a default nor an auto-increment value
+	if col.Generated != "" {
+		def += " " + g.generatedClause(col)
+		if !col.Nullable {
+			def += " NOT NULL"
+		}
+		return def
+	}
 
 	if !col.Nullable {
 		def += " NOT NULL"
 	}
 
-	if col.DefaultValue != nil {
-		def += fmt.Sprintf(" DEFAULT %s", *col.DefaultValue)
+	// A sequence default only makes sense in the dialect it was captured from
+	if col.DefaultValue != nil && !(g.translating() && isSequenceDefault(*col.DefaultValue)) {
+		def += fmt.Sprintf(" DEFAULT %s", formatDefault(col))
 	}
 
 	if col.AutoIncrement {
 		if g.dbType == "postgres" || g.dbType == "PostgreSQL" {
-			// PostgreSQL uses SERIAL or IDENTITY
+			// PostgreSQL uses SERIAL (via the nextval default) or IDENTITY
+			identity := col.Identity
+			if identity == "" && g.translating() {
+				identity = "BY DEFAULT"
+			}
+			if identity != "" {
+				def += fmt.Sprintf(" GENERATED %s AS IDENTITY", identity)
+			}
 		} else {
 			// MySQL
 			def += " AUTO_INCREMENT"
@@ -242,6 +946,64 @@ func (g *DDLGenerator) columnDefinition(col *schema.Column) string {
 	return def
 }
 
+// generatedClause returns the GENERATED ALWAYS AS clause of a generated
+// column. PostgreSQL only has stored generated columns.
+func (g *DDLGenerator) generatedClause(col *schema.Column) string {
+	kind := "VIRTUAL"
+	if col.Stored || g.dbType == "postgres" || g.dbType == "PostgreSQL" {
+		kind = "STORED"
+	}
+	return fmt.Sprintf("GENERATED ALWAYS AS (%s) %s", col.Generated, kind)
+}
+
+// columnType returns the column's type in the target dialect
+func (g *DDLGenerator) columnType(col *schema.Column) string {
+	if !g.translating() {
+		return col.Type
+	}
+	translated, _ := TranslateType(col.Type, g.opts.SourceDialect, g.dbType)
+	return translated
+}
+
+// typeWarning describes a column type that has no clean mapping to the target dialect
+func (g *DDLGenerator) typeWarning(tableName string, col *schema.Column) string {
+	if !g.translating() {
+		return ""
+	}
+	translated, ok := TranslateType(col.Type, g.opts.SourceDialect, g.dbType)
+	if ok {
+		return ""
+	}
+	return fmt.Sprintf("WARNING: no clean %s mapping for %s.%s type %s, using %s", g.dbType, tableName, col.Name, col.Type, translated)
+}
+
+func (g *DDLGenerator) translating() bool {
+	return g.opts.SourceDialect != "" && g.opts.SourceDialect != g.dbType
+}
+
+// withWarnings prefixes a statement with its warnings as SQL comments
+func withWarnings(stmt string, warnings ...string) string {
+	var lines []string
+	for _, warning := range warnings {
+		if warning != "" {
+			lines = append(lines, "-- "+warning)
+		}
+	}
+	return strings.Join(append(lines, stmt), "\n")
+}
+
+func (g *DDLGenerator) collateClause(col *schema.Column) string {
+	if col.Collation == "" || g.translating() {
+		return ""
+	}
+	if g.dbType == "postgres" || g.dbType == "PostgreSQL" {
+		// PostgreSQL collation names are identifiers and may contain dots or dashes
+		return " COLLATE " + g.quoteIdentifier(col.Collation)
+	}
+	// MySQL
+	return " COLLATE " + col.Collation
+}
+
 func (g *DDLGenerator) quoteIdentifier(name string) string {
 	if g.dbType == "postgres" || g.dbType == "PostgreSQL" {
 		return fmt.Sprintf("\"%s\"", name)
@@ -0,0 +1,472 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestCheckDefinition(t *testing.T) {
+	tests := []struct {
+		dialect     string
+		notEnforced bool
+		want        string
+	}{
+		{"mysql", false, "CONSTRAINT `chk` CHECK (price > 0)"},
+		{"mysql", true, "CONSTRAINT `chk` CHECK (price > 0) NOT ENFORCED"},
+		{"postgres", true, `CONSTRAINT "chk" CHECK (price > 0)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			g := NewDDLGenerator(Options{Dialect: tt.dialect})
+			check := &schema.CheckConstraint{Name: "chk", Expression: "price > 0", NotEnforced: tt.notEnforced}
+			if got := g.checkDefinition(check); got != tt.want {
+				t.Errorf("checkDefinition() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateDropColumnIfExists(t *testing.T) {
+	tests := []struct {
+		dialect string
+		want    string
+	}{
+		{"postgres", `ALTER TABLE "users" DROP COLUMN IF EXISTS "nickname";`},
+		{"mysql", "SET @dbdiff_ddl = IF((SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND COLUMN_NAME = 'nickname') = 1, 'ALTER TABLE `users` DROP COLUMN `nickname`', 'DO 0');\n" +
+			"PREPARE dbdiff_stmt FROM @dbdiff_ddl;\n" +
+			"EXECUTE dbdiff_stmt;\n" +
+			"DEALLOCATE PREPARE dbdiff_stmt;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			g := NewDDLGenerator(Options{Dialect: tt.dialect, IfExists: true})
+			if got := g.generateDropColumn("users", "nickname"); got != tt.want {
+				t.Errorf("generateDropColumn() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterToggle(t *testing.T) {
+	pkey := func(clustered bool) schema.Index {
+		return schema.Index{Name: "users_pkey", Columns: []string{"id"}, Primary: true, Unique: true, Clustered: clustered}
+	}
+	email := func(clustered bool) schema.Index {
+		return schema.Index{Name: "idx_email", Columns: []string{"email"}, Clustered: clustered}
+	}
+	change := func(old, new schema.Index) diff.IndexChange {
+		return diff.IndexChange{IndexName: new.Name, Action: diff.ActionModify, OldIndex: &old, NewIndex: &new}
+	}
+	tests := []struct {
+		name    string
+		dialect string
+		indexes []schema.Index
+		changes []diff.IndexChange
+		want    []string
+	}{
+		{
+			name:    "cluster on primary key",
+			dialect: "postgres",
+			indexes: []schema.Index{pkey(true), email(false)},
+			changes: []diff.IndexChange{change(pkey(false), pkey(true))},
+			want:    []string{`ALTER TABLE "users" CLUSTER ON "users_pkey";`},
+		},
+		{
+			name:    "no longer clustered",
+			dialect: "postgres",
+			indexes: []schema.Index{pkey(false), email(false)},
+			changes: []diff.IndexChange{change(email(true), email(false))},
+			want:    []string{`ALTER TABLE "users" SET WITHOUT CLUSTER;`},
+		},
+		{
+			name:    "clustered on another index",
+			dialect: "postgres",
+			indexes: []schema.Index{pkey(true), email(false)},
+			changes: []diff.IndexChange{change(email(true), email(false)), change(pkey(false), pkey(true))},
+			want:    []string{`ALTER TABLE "users" CLUSTER ON "users_pkey";`},
+		},
+		{
+			name:    "mysql has no cluster mark",
+			dialect: "mysql",
+			indexes: []schema.Index{pkey(false), email(true)},
+			changes: []diff.IndexChange{change(email(false), email(true))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &schema.TableSchema{Name: "users", Indexes: tt.indexes}
+			schemaDiff := &diff.SchemaDiff{TableName: "users", Action: diff.ActionModify, OldSchema: users, NewSchema: users, IndexChanges: tt.changes}
+			got := NewDDLGenerator(Options{Dialect: tt.dialect}).Statements(schemaDiff)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// ordersStatements compares two versions of an orders table and returns
+// the statements migrating the first to the second
+func ordersStatements(t *testing.T, dialect string, old, new schema.TableSchema, opts diff.Options) []string {
+	t.Helper()
+	snap := func(tableSchema schema.TableSchema) *snapshot.Snapshot {
+		tableSchema.Name = "orders"
+		tableSchema.Columns = []schema.Column{{Name: "id", Type: "integer", Position: 1}, {Name: "user_id", Type: "integer", Position: 2}}
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": dialect}, Tables: map[string]*schema.Table{"orders": {Schema: tableSchema}}}
+	}
+	schemaDiff := diff.Compare(snap(old), snap(new), opts).SchemaDiffs["orders"]
+	if schemaDiff == nil {
+		t.Fatal("Compare() found no schema change")
+	}
+	return NewDDLGenerator(Options{Dialect: dialect}).Statements(schemaDiff)
+}
+
+func TestForeignKeyDeferrableChange(t *testing.T) {
+	fk := func(deferrable, deferred bool) schema.TableSchema {
+		return schema.TableSchema{ForeignKeys: []schema.ForeignKey{{Name: "fk_user", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id",
+			Deferrable: deferrable, InitiallyDeferred: deferred}}}
+	}
+	tests := []struct {
+		name     string
+		old, new schema.TableSchema
+		want     []string
+	}{
+		{name: "deferred", old: fk(true, false), new: fk(true, true),
+			want: []string{`ALTER TABLE "orders" ALTER CONSTRAINT "fk_user" INITIALLY DEFERRED;`}},
+		{name: "immediate", old: fk(true, true), new: fk(true, false),
+			want: []string{`ALTER TABLE "orders" ALTER CONSTRAINT "fk_user" INITIALLY IMMEDIATE;`}},
+		{name: "made deferrable", old: fk(false, false), new: fk(true, true), want: []string{
+			`ALTER TABLE "orders" DROP CONSTRAINT "fk_user";`,
+			`ALTER TABLE "orders" ADD CONSTRAINT "fk_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") DEFERRABLE INITIALLY DEFERRED;`,
+		}},
+		{name: "no longer deferrable", old: fk(true, false), new: fk(false, false), want: []string{
+			`ALTER TABLE "orders" DROP CONSTRAINT "fk_user";`,
+			`ALTER TABLE "orders" ADD CONSTRAINT "fk_user" FOREIGN KEY ("user_id") REFERENCES "users"("id");`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ordersStatements(t, "postgres", tt.old, tt.new, diff.Options{}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameConstraintMatchedByDefinition(t *testing.T) {
+	constraints := func(fkName, checkName string) schema.TableSchema {
+		return schema.TableSchema{
+			ForeignKeys: []schema.ForeignKey{{Name: fkName, Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"}},
+			Checks:      []schema.CheckConstraint{{Name: checkName, Expression: "user_id > 0"}},
+		}
+	}
+	old, new := constraints("orders_user_id_fkey", "orders_user_id_check"), constraints("fk_orders_user", "chk_orders_user")
+	tests := []struct {
+		name    string
+		dialect string
+		match   bool
+		want    []string
+	}{
+		{name: "postgres", dialect: "postgres", match: true, want: []string{
+			`ALTER TABLE "orders" RENAME CONSTRAINT "orders_user_id_fkey" TO "fk_orders_user";`,
+			`ALTER TABLE "orders" RENAME CONSTRAINT "orders_user_id_check" TO "chk_orders_user";`,
+		}},
+		{name: "mysql", dialect: "mysql", match: true, want: []string{
+			"ALTER TABLE `orders` DROP FOREIGN KEY `orders_user_id_fkey`;",
+			"ALTER TABLE `orders` DROP CONSTRAINT `orders_user_id_check`;",
+			"ALTER TABLE `orders` ADD CONSTRAINT `fk_orders_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`);",
+			"ALTER TABLE `orders` ADD CONSTRAINT `chk_orders_user` CHECK (user_id > 0);",
+		}},
+		{name: "postgres without matching", dialect: "postgres", want: []string{
+			`ALTER TABLE "orders" DROP CONSTRAINT "orders_user_id_fkey";`,
+			`ALTER TABLE "orders" DROP CONSTRAINT "orders_user_id_check";`,
+			`ALTER TABLE "orders" ADD CONSTRAINT "fk_orders_user" FOREIGN KEY ("user_id") REFERENCES "users"("id");`,
+			`ALTER TABLE "orders" ADD CONSTRAINT "chk_orders_user" CHECK (user_id > 0);`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ordersStatements(t, tt.dialect, old, new, diff.Options{MatchConstraintsByDefinition: tt.match})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// columnStatements compares two versions of a column of a users table,
+// named email unless it has a name, and returns the statements migrating
+// the first to the second
+func columnStatements(t *testing.T, dialect string, old, new schema.Column) []string {
+	t.Helper()
+	snap := func(col schema.Column) *snapshot.Snapshot {
+		if col.Name == "" {
+			col.Name = "email"
+		}
+		col.Position = 2
+		users := schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id", Type: "integer", Position: 1}, col}}
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": dialect}, Tables: map[string]*schema.Table{"users": {Schema: users}}}
+	}
+	schemaDiff := diff.Compare(snap(old), snap(new), diff.Options{}).SchemaDiffs["users"]
+	if schemaDiff == nil {
+		t.Fatal("Compare() found no schema change")
+	}
+	return NewDDLGenerator(Options{Dialect: dialect}).Statements(schemaDiff)
+}
+
+func TestModifyColumnCollation(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new schema.Column
+		want     []string
+	}{
+		{name: "changed", old: schema.Column{Type: "text", Collation: "C"}, new: schema.Column{Type: "text", Collation: "en_US"},
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "email" TYPE text COLLATE "en_US";`}},
+		{name: "set", old: schema.Column{Type: "text"}, new: schema.Column{Type: "text", Collation: "en-x-icu"},
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "email" TYPE text COLLATE "en-x-icu";`}},
+		{name: "with type", old: schema.Column{Type: "varchar(50)", Collation: "C"}, new: schema.Column{Type: "varchar(100)", Collation: "en_US"},
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "email" TYPE varchar(100) COLLATE "en_US";`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := columnStatements(t, "postgres", tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityColumn(t *testing.T) {
+	identity := func(kind string) schema.Column {
+		return schema.Column{Name: "ticket_no", Type: "bigint", AutoIncrement: kind != "", Identity: kind}
+	}
+	g := NewDDLGenerator(Options{Dialect: "postgres"})
+	for kind, want := range map[string]string{
+		"ALWAYS":     `"ticket_no" bigint NOT NULL GENERATED ALWAYS AS IDENTITY`,
+		"BY DEFAULT": `"ticket_no" bigint NOT NULL GENERATED BY DEFAULT AS IDENTITY`,
+	} {
+		col := identity(kind)
+		if got := g.columnDefinition(&col); got != want {
+			t.Errorf("columnDefinition(%s) = %q, want %q", kind, got, want)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		old, new schema.Column
+		want     []string
+	}{
+		{name: "always to by default", old: identity("ALWAYS"), new: identity("BY DEFAULT"),
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "ticket_no" SET GENERATED BY DEFAULT;`}},
+		{name: "by default to always", old: identity("BY DEFAULT"), new: identity("ALWAYS"),
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "ticket_no" SET GENERATED ALWAYS;`}},
+		{name: "added", old: identity(""), new: identity("ALWAYS"),
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "ticket_no" ADD GENERATED ALWAYS AS IDENTITY;`}},
+		{name: "dropped", old: identity("BY DEFAULT"), new: identity(""),
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "ticket_no" DROP IDENTITY;`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := columnStatements(t, "postgres", tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateCreateIndexDescending(t *testing.T) {
+	idx := &schema.Index{Name: "idx_recent", Columns: []string{"user_id", "created_at", "id"}, Descending: []bool{false, true, false}}
+	tests := []struct {
+		dialect string
+		want    string
+	}{
+		{"mysql", "CREATE INDEX `idx_recent` ON `events` (`user_id`, `created_at` DESC, `id`);"},
+		{"postgres", `CREATE INDEX "idx_recent" ON "events" ("user_id", "created_at" DESC, "id");`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			if got := NewDDLGenerator(Options{Dialect: tt.dialect}).generateCreateIndex("events", idx); got != tt.want {
+				t.Errorf("generateCreateIndex() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoIncrementMode(t *testing.T) {
+	snap := func(dialect string, next int64) *snapshot.Snapshot {
+		orders := schema.TableSchema{Name: "orders", AutoIncrement: next, Columns: []schema.Column{{Name: "id", Type: "integer", AutoIncrement: true, Position: 1}}}
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": dialect}, Tables: map[string]*schema.Table{"orders": {Schema: orders}}}
+	}
+	tests := []struct {
+		name    string
+		dialect string
+		include bool
+		want    []string
+	}{
+		{name: "mysql include", dialect: "mysql", include: true, want: []string{"ALTER TABLE `orders` AUTO_INCREMENT = 500;"}},
+		{name: "postgres include", dialect: "postgres", include: true, want: []string{`SELECT setval(pg_get_serial_sequence('"orders"', 'id'), 500, false);`}},
+		{name: "mysql ignore", dialect: "mysql"},
+		{name: "postgres ignore", dialect: "postgres"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := diff.Compare(snap(tt.dialect, 100), snap(tt.dialect, 500), diff.Options{IncludeAutoIncrement: tt.include})
+			schemaDiff := result.SchemaDiffs["orders"]
+			if (schemaDiff != nil) != tt.include {
+				t.Fatalf("schema diff = %+v, want one %v", schemaDiff, tt.include)
+			}
+			if schemaDiff == nil {
+				return
+			}
+			got := NewDDLGenerator(Options{Dialect: tt.dialect, IncludeAutoIncrement: tt.include}).Statements(schemaDiff)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModifyColumnTimePrecision(t *testing.T) {
+	tests := []struct {
+		dialect  string
+		old, new schema.Column
+		want     []string
+	}{
+		{dialect: "postgres", old: schema.Column{Type: "timestamp(0) without time zone"}, new: schema.Column{Type: "timestamp without time zone"},
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "email" TYPE timestamp without time zone;`}},
+		{dialect: "mysql", old: schema.Column{Type: "datetime"}, new: schema.Column{Type: "datetime(6)"},
+			want: []string{"ALTER TABLE `users` MODIFY COLUMN `email` datetime(6) NOT NULL;"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			if got := columnStatements(t, tt.dialect, tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemVersioning(t *testing.T) {
+	history := func(versioned bool) *snapshot.Snapshot {
+		prices := schema.TableSchema{Name: "prices", Columns: []schema.Column{
+			{Name: "id", Type: "int", Position: 1},
+			{Name: "row_start", Type: "timestamp(6)", Position: 2},
+			{Name: "row_end", Type: "timestamp(6)", Position: 3},
+		}}
+		if versioned {
+			prices.SystemVersioning = &schema.SystemVersioning{PeriodStart: "row_start", PeriodEnd: "row_end"}
+		} else {
+			prices.Columns = prices.Columns[:1]
+		}
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": "mysql"}, Tables: map[string]*schema.Table{"prices": {Schema: prices}}}
+	}
+
+	g := NewDDLGenerator(Options{Dialect: "mysql"})
+	want := "CREATE TABLE `prices` (\n" +
+		"  `id` int NOT NULL,\n" +
+		"  `row_start` timestamp(6) GENERATED ALWAYS AS ROW START,\n" +
+		"  `row_end` timestamp(6) GENERATED ALWAYS AS ROW END,\n" +
+		"  PERIOD FOR SYSTEM_TIME(`row_start`, `row_end`)\n" +
+		") WITH SYSTEM VERSIONING;"
+	if got := g.generateCreateTable(&history(true).Tables["prices"].Schema); got != want {
+		t.Errorf("generateCreateTable() = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name     string
+		old, new bool
+		want     []string
+	}{
+		{name: "added", old: false, new: true, want: []string{
+			"ALTER TABLE `prices` ADD COLUMN `row_start` timestamp(6) GENERATED ALWAYS AS ROW START, ADD COLUMN `row_end` timestamp(6) GENERATED ALWAYS AS ROW END, ADD PERIOD FOR SYSTEM_TIME(`row_start`, `row_end`), ADD SYSTEM VERSIONING;",
+		}},
+		{name: "dropped", old: true, new: false, want: []string{
+			"ALTER TABLE `prices` DROP SYSTEM VERSIONING;",
+			"ALTER TABLE `prices` DROP COLUMN `row_start`;",
+			"ALTER TABLE `prices` DROP COLUMN `row_end`;",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemaDiff := diff.Compare(history(tt.old), history(tt.new), diff.Options{}).SchemaDiffs["prices"]
+			if schemaDiff == nil || !schemaDiff.SystemVersioningChanged {
+				t.Fatalf("schema diff = %+v, want a system versioning change", schemaDiff)
+			}
+			if got := g.Statements(schemaDiff); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommentChange(t *testing.T) {
+	commented := func(indexComment, fkComment string) schema.TableSchema {
+		return schema.TableSchema{
+			Indexes:     []schema.Index{{Name: "idx_user", Columns: []string{"user_id"}, Comment: indexComment}},
+			ForeignKeys: []schema.ForeignKey{{Name: "fk_user", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id", Comment: fkComment}},
+		}
+	}
+	tests := []struct {
+		name     string
+		dialect  string
+		old, new schema.TableSchema
+		want     []string
+	}{
+		{name: "index comment set", dialect: "postgres", old: commented("", ""), new: commented("lookup by owner", ""),
+			want: []string{`COMMENT ON INDEX "idx_user" IS 'lookup by owner';`}},
+		{name: "index comment changed", dialect: "postgres", old: commented("lookup by owner", ""), new: commented("owner's orders", ""),
+			want: []string{`COMMENT ON INDEX "idx_user" IS 'owner''s orders';`}},
+		{name: "index comment cleared", dialect: "postgres", old: commented("lookup by owner", ""), new: commented("", ""),
+			want: []string{`COMMENT ON INDEX "idx_user" IS NULL;`}},
+		{name: "foreign key comment set", dialect: "postgres", old: commented("", ""), new: commented("", "ordering user"),
+			want: []string{`COMMENT ON CONSTRAINT "fk_user" ON "orders" IS 'ordering user';`}},
+		{name: "mysql", dialect: "mysql", old: commented("", ""), new: commented("lookup by owner", "ordering user")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ordersStatements(t, tt.dialect, tt.old, tt.new, diff.Options{}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddColumnPosition(t *testing.T) {
+	snap := func(dialect string, names ...string) *snapshot.Snapshot {
+		users := schema.TableSchema{Name: "users"}
+		for i, name := range names {
+			users.Columns = append(users.Columns, schema.Column{Name: name, Type: "integer", Position: i + 1})
+		}
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": dialect}, Tables: map[string]*schema.Table{"users": {Schema: users}}}
+	}
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{dialect: "mysql", want: []string{
+			"ALTER TABLE `users` ADD COLUMN `tenant` integer NOT NULL FIRST;",
+			"ALTER TABLE `users` ADD COLUMN `name` integer NOT NULL AFTER `id`;",
+			"ALTER TABLE `users` ADD COLUMN `age` integer NOT NULL AFTER `email`;",
+		}},
+		{dialect: "postgres", want: []string{
+			`ALTER TABLE "users" ADD COLUMN "tenant" integer NOT NULL;`,
+			`ALTER TABLE "users" ADD COLUMN "name" integer NOT NULL;`,
+			`ALTER TABLE "users" ADD COLUMN "age" integer NOT NULL;`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			old := snap(tt.dialect, "id", "email")
+			new := snap(tt.dialect, "tenant", "id", "name", "email", "age")
+			for run := 0; run < 20; run++ {
+				schemaDiff := diff.Compare(old, new, diff.Options{}).SchemaDiffs["users"]
+				if got := NewDDLGenerator(Options{Dialect: tt.dialect}).Statements(schemaDiff); !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("run %d: Statements() = %q, want %q", run, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package generator
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/koba/db-diff/internal/diff"
@@ -11,70 +13,198 @@ import (
 // DMLGenerator generates DML statements
 type DMLGenerator struct {
 	dbType string
+	opts   Options
+
+	// warnings collected while formatting the values of the current
+	// statement, and whether one of them was too long to write
+	valueWarnings []string
+	oversized     bool
+
+	// skipped counts the statements left commented out for a value longer
+	// than Options.MaxValueLength
+	skipped int
 }
 
 // NewDMLGenerator creates a new DML generator
-func NewDMLGenerator(dbType string) *DMLGenerator {
-	return &DMLGenerator{dbType: dbType}
+func NewDMLGenerator(opts Options) *DMLGenerator {
+	return &DMLGenerator{dbType: opts.Dialect, opts: opts}
 }
 
 // Generate generates DML for a data diff
 func (g *DMLGenerator) Generate(dataDiff *diff.DataDiff) string {
+	return strings.Join(g.Statements(dataDiff), "\n")
+}
+
+// Statements generates the individual DML statements for a data diff
+func (g *DMLGenerator) Statements(dataDiff *diff.DataDiff) []string {
+	statements := g.statements(dataDiff)
+	for i, stmt := range statements {
+		statements[i] = g.opts.terminate(stmt)
+	}
+	return statements
+}
+
+func (g *DMLGenerator) statements(dataDiff *diff.DataDiff) []string {
+	if g.opts.resyncs(dataDiff) {
+		return g.resyncStatements(dataDiff)
+	}
+
 	var statements []string
+	types := columnTypes(dataDiff.Schema)
+	generated := generatedColumns(dataDiff.Schema)
+	rowsAdded := withoutColumns(dataDiff.RowsAdded, generated)
 
-	// Generate DELETE statements
-	for _, row := range dataDiff.RowsDeleted {
-		stmt := g.generateDelete(dataDiff.TableName, row)
+	// Generate DELETE statements, identifying rows without the ignored
+	// columns, whose values in the database may differ
+	for _, row := range withoutColumns(dataDiff.RowsDeleted, dataDiff.IgnoredColumns) {
+		stmt := g.generateDelete(dataDiff.TableName, dataDiff.Schema, types, row)
 		statements = append(statements, stmt)
 	}
 
 	// Generate INSERT statements
-	for _, row := range dataDiff.RowsAdded {
-		stmt := g.generateInsert(dataDiff.TableName, row)
-		statements = append(statements, stmt)
+	copyStmt := ""
+	if g.copied(dataDiff.TableName) {
+		copyStmt = g.generateCopy(dataDiff, rowsAdded, len(rowsAdded) == dataDiff.NewRowCount)
+	}
+	if copyStmt != "" {
+		statements = append(statements, copyStmt)
+	} else if g.templated() {
+		if stmt := g.generateTemplate(dataDiff.TableName, rowsAdded); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	} else {
+		statements = append(statements, g.generateInserts(dataDiff, types, rowsAdded, g.opts.Upsert)...)
 	}
 
-	// Generate UPDATE statements
+	// Generate UPDATE statements, which only set the columns the database
+	// doesn't compute, and neither set nor match the ignored columns
+	unset := generated
+	if len(dataDiff.IgnoredColumns) > 0 {
+		unset = make(map[string]bool, len(generated)+len(dataDiff.IgnoredColumns))
+		for col := range generated {
+			unset[col] = true
+		}
+		for col := range dataDiff.IgnoredColumns {
+			unset[col] = true
+		}
+	}
 	for _, mod := range dataDiff.RowsModified {
-		stmt := g.generateUpdate(dataDiff.TableName, mod.OldRow, mod.NewRow)
-		statements = append(statements, stmt)
+		oldRow := withoutColumns([]schema.Row{mod.OldRow}, dataDiff.IgnoredColumns)[0]
+		newRow := withoutColumns([]schema.Row{mod.NewRow}, unset)[0]
+		stmt := g.generateUpdate(dataDiff.TableName, dataDiff.Schema, types, oldRow, newRow)
+		if stmt != "" {
+			statements = append(statements, stmt)
+		}
 	}
 
-	return strings.Join(statements, "\n")
+	return statements
 }
 
-func (g *DMLGenerator) generateInsert(tableName string, row schema.Row) string {
-	var columns []string
-	var values []string
+// resyncStatements empties the table and inserts every row of the second
+// snapshot, which is cheaper than row-level changes for a mostly-changed
+// table. Both MySQL and PostgreSQL refuse to TRUNCATE a table other tables
+// reference, so a referenced table is emptied with DELETE, which the foreign
+// keys check row by row.
+func (g *DMLGenerator) resyncStatements(dataDiff *diff.DataDiff) []string {
+	empty := fmt.Sprintf("TRUNCATE TABLE %s;", g.quoteIdentifier(dataDiff.TableName))
+	if dataDiff.Referenced {
+		empty = fmt.Sprintf("DELETE FROM %s;", g.quoteIdentifier(dataDiff.TableName))
+	}
+	statements := []string{empty}
 
-	for col, val := range row {
-		columns = append(columns, g.quoteIdentifier(col))
-		values = append(values, g.formatValue(val))
+	newData := withoutColumns(dataDiff.NewData, generatedColumns(dataDiff.Schema))
+	if g.copied(dataDiff.TableName) {
+		if stmt := g.generateCopy(dataDiff, newData, true); stmt != "" {
+			return append(statements, stmt)
+		}
 	}
 
-	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
+	if g.templated() {
+		if stmt := g.generateTemplate(dataDiff.TableName, newData); stmt != "" {
+			statements = append(statements, stmt)
+		}
+		return statements
+	}
+
+	types := columnTypes(dataDiff.Schema)
+	return append(statements, g.generateInserts(dataDiff, types, newData, false)...)
+}
+
+// generateInserts generates the INSERTs, or upserts, of a table's added
+// rows. Up to Options.InsertBatchSize consecutive rows with the same columns
+// share one multi-row INSERT; a row with other columns starts a new one.
+func (g *DMLGenerator) generateInserts(dataDiff *diff.DataDiff, types map[string]string, rows []schema.Row, upsert bool) []string {
+	var statements []string
+	for _, batch := range insertBatches(rows, g.opts.InsertBatchSize) {
+		columns := sortedColumns(batch[0])
+		suffix := ""
+		if upsert {
+			suffix = g.upsertClause(dataDiff.TableName, dataDiff.Schema, columns)
+		}
+		statements = append(statements, g.generateInsert(dataDiff.TableName, types, columns, batch, suffix))
+	}
+	return statements
+}
+
+// insertBatches splits rows into the groups written as one INSERT each: up
+// to size consecutive rows with the same columns
+func insertBatches(rows []schema.Row, size int) [][]schema.Row {
+	var batches [][]schema.Row
+	for start := 0; start < len(rows); {
+		columns := sortedColumns(rows[start])
+		end := start + 1
+		for end < len(rows) && end-start < size && sameColumns(rows[end], columns) {
+			end++
+		}
+		batches = append(batches, rows[start:end])
+		start = end
+	}
+	return batches
+}
+
+// generateInsert generates an INSERT of rows having the given columns, one
+// parenthesized list of values per row, followed by suffix
+func (g *DMLGenerator) generateInsert(tableName string, types map[string]string, columns []string, rows []schema.Row, suffix string) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = g.quoteIdentifier(col)
+	}
+	tuples := make([]string, len(rows))
+	for i, row := range rows {
+		values := make([]string, len(columns))
+		for j, col := range columns {
+			values[j] = g.columnValue(types, col, row[col])
+		}
+		tuples[i] = "(" + strings.Join(values, ", ") + ")"
+	}
+
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s;",
 		g.quoteIdentifier(tableName),
-		strings.Join(columns, ", "),
-		strings.Join(values, ", "),
+		strings.Join(quoted, ", "),
+		strings.Join(tuples, ",\n  "),
+		suffix,
 	)
+	return g.withValueWarnings(stmt)
 }
 
-func (g *DMLGenerator) generateDelete(tableName string, row schema.Row) string {
-	whereClauses := g.buildWhereClause(row)
-	return fmt.Sprintf("DELETE FROM %s WHERE %s;",
+func (g *DMLGenerator) generateDelete(tableName string, tableSchema *schema.TableSchema, types map[string]string, row schema.Row) string {
+	whereClauses := g.buildWhereClause(tableSchema, types, row)
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s;",
 		g.quoteIdentifier(tableName),
 		whereClauses,
 	)
+	return g.withValueWarnings(stmt)
 }
 
-func (g *DMLGenerator) generateUpdate(tableName string, oldRow, newRow schema.Row) string {
+func (g *DMLGenerator) generateUpdate(tableName string, tableSchema *schema.TableSchema, types map[string]string, oldRow, newRow schema.Row) string {
 	var setClauses []string
 
-	for col, newVal := range newRow {
+	for _, col := range sortedColumns(newRow) {
+		newVal := newRow[col]
 		oldVal, exists := oldRow[col]
 		if !exists || !valuesEqual(oldVal, newVal) {
 			setClauses = append(setClauses,
-				fmt.Sprintf("%s = %s", g.quoteIdentifier(col), g.formatValue(newVal)),
+				fmt.Sprintf("%s = %s", g.quoteIdentifier(col), g.columnValue(types, col, newVal)),
 			)
 		}
 	}
@@ -83,26 +213,51 @@ func (g *DMLGenerator) generateUpdate(tableName string, oldRow, newRow schema.Ro
 		return ""
 	}
 
-	whereClauses := g.buildWhereClause(oldRow)
+	whereClauses := g.buildWhereClause(tableSchema, types, oldRow)
 
-	return fmt.Sprintf("UPDATE %s SET %s WHERE %s;",
+	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s;",
 		g.quoteIdentifier(tableName),
 		strings.Join(setClauses, ", "),
 		whereClauses,
 	)
+	return g.withValueWarnings(stmt)
 }
 
-func (g *DMLGenerator) buildWhereClause(row schema.Row) string {
-	var conditions []string
+// buildWhereClause identifies a row by its primary key. A row of a table
+// without one, or whose key columns are left out of the row, is matched on
+// all of its columns instead, with a warning since that can match other
+// identical rows or miss a row whose values have drifted.
+func (g *DMLGenerator) buildWhereClause(tableSchema *schema.TableSchema, types map[string]string, row schema.Row) string {
+	pkColumns := tableSchema.PrimaryKeyColumns()
+	if len(pkColumns) > 0 && hasColumns(row, pkColumns) {
+		conditions := make([]string, len(pkColumns))
+		for i, col := range pkColumns {
+			if row[col] == nil {
+				conditions[i] = fmt.Sprintf("%s IS NULL", g.quoteIdentifier(col))
+			} else {
+				conditions[i] = fmt.Sprintf("%s = %s", g.quoteIdentifier(col), g.formatColumnValue(types[col], row[col]))
+			}
+		}
+		return strings.Join(conditions, " AND ")
+	}
 
-	for col, val := range row {
+	if len(pkColumns) > 0 {
+		g.valueWarnings = append(g.valueWarnings, fmt.Sprintf("WARNING: row has no value for primary key column(s) %s; WHERE clause matches every column of the row", strings.Join(pkColumns, ", ")))
+	} else {
+		g.valueWarnings = append(g.valueWarnings, "WARNING: no primary key; WHERE clause matches every column of the row")
+	}
+	var conditions []string
+	for _, col := range sortedColumns(row) {
+		val := row[col]
 		if val == nil {
 			conditions = append(conditions,
 				fmt.Sprintf("%s IS NULL", g.quoteIdentifier(col)),
 			)
 		} else {
+			// Leaving a condition out would match more rows, so a value too
+			// long to write skips the statement
 			conditions = append(conditions,
-				fmt.Sprintf("%s = %s", g.quoteIdentifier(col), g.formatValue(val)),
+				fmt.Sprintf("%s = %s", g.quoteIdentifier(col), g.columnValue(types, col, val)),
 			)
 		}
 	}
@@ -110,6 +265,71 @@ func (g *DMLGenerator) buildWhereClause(row schema.Row) string {
 	return strings.Join(conditions, " AND ")
 }
 
+// columnValue formats a value of a column. A literal longer than
+// Options.MaxValueLength is replaced with a placeholder that is not valid
+// SQL, and the statement is left commented out.
+func (g *DMLGenerator) columnValue(types map[string]string, col string, val interface{}) string {
+	literal := g.formatColumnValue(types[col], val)
+	if !g.tooLong(literal) {
+		return literal
+	}
+	g.oversized = true
+	g.valueWarnings = append(g.valueWarnings,
+		fmt.Sprintf("WARNING: value of column %s is %d bytes, longer than the maximum of %d", col, len(literal), g.opts.MaxValueLength))
+	return fmt.Sprintf("<value of %d bytes>", len(literal))
+}
+
+func (g *DMLGenerator) tooLong(literal string) bool {
+	return g.opts.MaxValueLength > 0 && len(literal) > g.opts.MaxValueLength
+}
+
+// withValueWarnings prefixes a statement with the warnings collected while
+// formatting its values
+func (g *DMLGenerator) withValueWarnings(stmt string) string {
+	warnings := g.valueWarnings
+	g.valueWarnings = nil
+	if g.oversized {
+		g.oversized = false
+		g.skipped++
+		warnings = append(warnings, "SKIPPED: the statement holds a value too long to write")
+		lines := strings.Split(stmt, "\n")
+		for i, line := range lines {
+			lines[i] = "-- " + line
+		}
+		stmt = strings.Join(lines, "\n")
+	}
+	return withWarnings(stmt, warnings...)
+}
+
+// CheckValueLengths returns an error when a data change needs a value
+// longer than opts.MaxValueLength, whose statement GenerateSQL would leave
+// commented out instead of running
+func CheckValueLengths(result *diff.DiffResult, opts Options) error {
+	if opts.MaxValueLength <= 0 {
+		return nil
+	}
+	opts.TemplateValues = nil
+	g := NewDMLGenerator(opts)
+	for _, tableName := range diff.SortedKeys(result.DataDiffs) {
+		g.statements(result.DataDiffs[tableName])
+		if g.skipped > 0 {
+			return fmt.Errorf("%d statement(s) of table %s have values longer than %d bytes", g.skipped, tableName, opts.MaxValueLength)
+		}
+	}
+	return nil
+}
+
+// formatColumnValue formats a value of a column of the given type, using a
+// formatter registered for the type if there is one
+func (g *DMLGenerator) formatColumnValue(columnType string, val interface{}) string {
+	if val != nil {
+		if format := lookupTypeFormatter(columnType); format != nil {
+			return format(val)
+		}
+	}
+	return g.formatValue(val)
+}
+
 func (g *DMLGenerator) formatValue(val interface{}) string {
 	if val == nil {
 		return "NULL"
@@ -117,21 +337,54 @@ func (g *DMLGenerator) formatValue(val interface{}) string {
 
 	switch v := val.(type) {
 	case string:
-		// Escape single quotes
-		escaped := strings.ReplaceAll(v, "'", "''")
-		return fmt.Sprintf("'%s'", escaped)
+		return quoteLiteral(v)
 	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
 		return fmt.Sprintf("%d", v)
-	case float32, float64:
+	case float32:
+		if g.opts.NumericLocale == NumericLocaleC {
+			return strconv.FormatFloat(float64(v), 'f', -1, 32)
+		}
+		return fmt.Sprintf("%f", v)
+	case float64:
+		if g.opts.NumericLocale == NumericLocaleC {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
 		return fmt.Sprintf("%f", v)
 	case bool:
+		return g.formatBool(v)
+	default:
+		// Fallback to string representation
+		return fmt.Sprintf("'%v'", v)
+	}
+}
+
+// NumericLocaleC is the Options.NumericLocale writing floats in the C locale
+const NumericLocaleC = "C"
+
+// Boolean literal styles for Options.BoolFormat
+const (
+	BoolKeyword = "keyword" // TRUE / FALSE
+	BoolNumeric = "numeric" // 1 / 0
+	BoolChar    = "char"    // 't' / 'f'
+)
+
+func (g *DMLGenerator) formatBool(v bool) string {
+	switch g.opts.BoolFormat {
+	case BoolNumeric:
+		if v {
+			return "1"
+		}
+		return "0"
+	case BoolChar:
+		if v {
+			return "'t'"
+		}
+		return "'f'"
+	default:
 		if v {
 			return "TRUE"
 		}
 		return "FALSE"
-	default:
-		// Fallback to string representation
-		return fmt.Sprintf("'%v'", v)
 	}
 }
 
@@ -143,6 +396,32 @@ func (g *DMLGenerator) quoteIdentifier(name string) string {
 	return fmt.Sprintf("`%s`", name)
 }
 
+// sortedColumns returns the row's column names in sorted order so generated
+// statements are identical between runs
+func sortedColumns(row schema.Row) []string {
+	columns := make([]string, 0, len(row))
+	for col := range row {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// hasColumns reports whether a row has all of the given columns
+func hasColumns(row schema.Row, columns []string) bool {
+	for _, col := range columns {
+		if _, ok := row[col]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sameColumns reports whether a row has exactly the given columns
+func sameColumns(row schema.Row, columns []string) bool {
+	return len(row) == len(columns) && hasColumns(row, columns)
+}
+
 func valuesEqual(a, b interface{}) bool {
 	if a == nil && b == nil {
 		return true
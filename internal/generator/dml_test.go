@@ -0,0 +1,164 @@
+package generator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestBuildWhereClause(t *testing.T) {
+	withPK := &schema.TableSchema{Name: "users", Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}
+	withoutPK := &schema.TableSchema{Name: "users"}
+	tests := []struct {
+		name         string
+		table        *schema.TableSchema
+		row          schema.Row
+		want         string
+		wantWarnings []string
+	}{
+		{name: "primary key", table: withPK, row: schema.Row{"id": 1, "name": "a"}, want: "`id` = 1"},
+		{name: "no primary key", table: withoutPK, row: schema.Row{"id": 1, "name": "a"}, want: "`id` = 1 AND `name` = 'a'",
+			wantWarnings: []string{"WARNING: no primary key; WHERE clause matches every column of the row"}},
+		{name: "key column left out", table: withPK, row: schema.Row{"name": "a"}, want: "`name` = 'a'",
+			wantWarnings: []string{"WARNING: row has no value for primary key column(s) id; WHERE clause matches every column of the row"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewDMLGenerator(Options{Dialect: "mysql"})
+			if got := g.buildWhereClause(tt.table, nil, tt.row); got != tt.want {
+				t.Errorf("buildWhereClause() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(g.valueWarnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", g.valueWarnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		val  interface{}
+		want string
+	}{
+		{name: "bool keyword", opts: Options{BoolFormat: BoolKeyword}, val: true, want: "TRUE"},
+		{name: "bool default", val: false, want: "FALSE"},
+		{name: "bool numeric", opts: Options{BoolFormat: BoolNumeric}, val: true, want: "1"},
+		{name: "bool numeric false", opts: Options{BoolFormat: BoolNumeric}, val: false, want: "0"},
+		{name: "bool char", opts: Options{BoolFormat: BoolChar}, val: true, want: "'t'"},
+		{name: "bool char false", opts: Options{BoolFormat: BoolChar}, val: false, want: "'f'"},
+		{name: "float default", val: 1.5, want: "1.500000"},
+		{name: "float32 default", val: float32(0.25), want: "0.250000"},
+		{name: "float C locale", opts: Options{NumericLocale: NumericLocaleC}, val: 1.5, want: "1.5"},
+		{name: "float C locale precise", opts: Options{NumericLocale: NumericLocaleC}, val: 0.1234567, want: "0.1234567"},
+		{name: "float32 C locale", opts: Options{NumericLocale: NumericLocaleC}, val: float32(0.25), want: "0.25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewDMLGenerator(tt.opts)
+			if got := g.formatValue(tt.val); got != tt.want {
+				t.Errorf("formatValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResyncStatements(t *testing.T) {
+	table := &schema.TableSchema{Name: "users", Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}
+	newData := []schema.Row{{"id": 1}, {"id": 2}}
+	// Both rows are new, or one of two
+	allChanged := []schema.Row{{"id": 1}, {"id": 2}}
+	halfChanged := []schema.Row{{"id": 2}}
+	tests := []struct {
+		name       string
+		dialect    string
+		threshold  float64
+		added      []schema.Row
+		referenced bool
+		want       []string
+	}{
+		{name: "truncate", dialect: "mysql", threshold: 0.5, added: allChanged,
+			want: []string{"TRUNCATE TABLE `users`;", "INSERT INTO `users` (`id`) VALUES (1);", "INSERT INTO `users` (`id`) VALUES (2);"}},
+		{name: "referenced mysql", dialect: "mysql", threshold: 0.5, added: allChanged, referenced: true,
+			want: []string{"DELETE FROM `users`;", "INSERT INTO `users` (`id`) VALUES (1);", "INSERT INTO `users` (`id`) VALUES (2);"}},
+		{name: "referenced postgres", dialect: "postgres", threshold: 0.5, added: allChanged, referenced: true,
+			want: []string{`DELETE FROM "users";`, `INSERT INTO "users" ("id") VALUES (1);`, `INSERT INTO "users" ("id") VALUES (2);`}},
+		{name: "at threshold", dialect: "mysql", threshold: 0.5, added: halfChanged,
+			want: []string{"INSERT INTO `users` (`id`) VALUES (2);"}},
+		{name: "disabled", dialect: "mysql", added: halfChanged,
+			want: []string{"INSERT INTO `users` (`id`) VALUES (2);"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &diff.DataDiff{TableName: "users", Schema: table, RowsAdded: tt.added, OldRowCount: 2 - len(tt.added),
+				NewRowCount: 2, NewData: newData, Referenced: tt.referenced}
+			g := NewDMLGenerator(Options{Dialect: tt.dialect, ResyncThreshold: tt.threshold})
+			if got := g.statements(d); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterTypeFormatter(t *testing.T) {
+	RegisterTypeFormatter("GEOMETRY", func(val interface{}) string {
+		return fmt.Sprintf("ST_GeomFromText('%v')", val)
+	})
+	defer func() {
+		typeFormattersMu.Lock()
+		delete(typeFormatters, "geometry")
+		typeFormattersMu.Unlock()
+	}()
+
+	places := &schema.TableSchema{Name: "places", Columns: []schema.Column{
+		{Name: "id", Type: "int", Position: 1},
+		{Name: "location", Type: "geometry(Point,4326)", Position: 2},
+		{Name: "name", Type: "varchar(50)", Position: 3},
+	}}
+	dataDiff := &diff.DataDiff{TableName: "places", Schema: places, RowsAdded: []schema.Row{
+		{"id": 1, "location": "POINT(1 2)", "name": "POINT(1 2)"},
+		{"id": 2, "location": nil, "name": "nowhere"},
+	}}
+	want := []string{
+		"INSERT INTO `places` (`id`, `location`, `name`) VALUES (1, ST_GeomFromText('POINT(1 2)'), 'POINT(1 2)');",
+		"INSERT INTO `places` (`id`, `location`, `name`) VALUES (2, NULL, 'nowhere');",
+	}
+	if got := NewDMLGenerator(Options{Dialect: "mysql"}).Statements(dataDiff); !reflect.DeepEqual(got, want) {
+		t.Errorf("Statements() = %q, want %q", got, want)
+	}
+}
+
+func TestMaxValueLength(t *testing.T) {
+	docs := &schema.TableSchema{Name: "docs", Columns: []schema.Column{{Name: "id", Type: "int", Position: 1}, {Name: "body", Type: "text", Position: 2}}}
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "under the limit", body: "short", want: []string{"INSERT INTO `docs` (`body`, `id`) VALUES ('short', 1);"}},
+		{name: "over the limit", body: strings.Repeat("x", 30), wantErr: true, want: []string{
+			"-- WARNING: value of column body is 32 bytes, longer than the maximum of 16\n" +
+				"-- SKIPPED: the statement holds a value too long to write\n" +
+				"-- INSERT INTO `docs` (`body`, `id`) VALUES (<value of 32 bytes>, 1);",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Dialect: "mysql", MaxValueLength: 16}
+			dataDiff := &diff.DataDiff{TableName: "docs", Schema: docs, RowsAdded: []schema.Row{{"id": 1, "body": tt.body}}}
+			if got := NewDMLGenerator(opts).Statements(dataDiff); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+			result := &diff.DiffResult{DataDiffs: map[string]*diff.DataDiff{"docs": dataDiff}}
+			if err := CheckValueLengths(result, opts); (err != nil) != tt.wantErr {
+				t.Errorf("CheckValueLengths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"strings"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// Estimate counts the statements a migration would contain, by type
+type Estimate struct {
+	Creates int // CREATE TABLE and CREATE INDEX
+	Drops   int // dropped tables, columns, indexes and foreign keys
+	Alters  int // other ALTER TABLE statements
+	Inserts int
+	Updates int
+	Deletes int // row deletes, plus one per table emptied by a resync
+}
+
+// Total returns the number of statements
+func (e Estimate) Total() int {
+	return e.Creates + e.Drops + e.Alters + e.Inserts + e.Updates + e.Deletes
+}
+
+// Destructive returns the number of statements that remove schema objects or rows
+func (e Estimate) Destructive() int {
+	return e.Drops + e.Deletes
+}
+
+// Risk rates the migration: "high" when it drops objects or deletes rows,
+// "medium" when it alters tables or updates rows, "low" otherwise
+func (e Estimate) Risk() string {
+	switch {
+	case e.Destructive() > 0:
+		return "high"
+	case e.Alters > 0 || e.Updates > 0:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// EstimateStatements counts the statements GenerateSQL would produce without
+// building the DML text, which can be very large for big data diffs
+func EstimateStatements(result *diff.DiffResult, opts Options) Estimate {
+	var e Estimate
+
+	// DDL is small, so it is generated and classified exactly
+	ddlGen := NewDDLGenerator(opts)
+	for _, schemaDiff := range result.SchemaDiffs {
+		for _, stmt := range ddlGen.statements(schemaDiff) {
+			switch {
+			case stmt.destructive:
+				e.Drops++
+			case strings.HasPrefix(stripComments(stmt.sql), "CREATE "):
+				e.Creates++
+			default:
+				e.Alters++
+			}
+		}
+	}
+
+	// DML is counted from the row changes
+	for _, dataDiff := range result.DataDiffs {
+		if opts.resyncs(dataDiff) {
+			e.Deletes++
+			e.Inserts += len(insertBatches(dataDiff.NewData, opts.InsertBatchSize))
+			continue
+		}
+
+		e.Deletes += len(dataDiff.RowsDeleted)
+		e.Inserts += len(insertBatches(dataDiff.RowsAdded, opts.InsertBatchSize))
+		for _, mod := range dataDiff.RowsModified {
+			if hasChangedColumns(mod.OldRow, mod.NewRow) {
+				e.Updates++
+			}
+		}
+	}
+
+	return e
+}
+
+// stripComments removes the leading "-- " warning lines of a statement
+func stripComments(stmt string) string {
+	for strings.HasPrefix(stmt, "--") {
+		i := strings.IndexByte(stmt, '\n')
+		if i < 0 {
+			return ""
+		}
+		stmt = stmt[i+1:]
+	}
+	return stmt
+}
+
+// hasChangedColumns reports whether generateUpdate would set any column
+func hasChangedColumns(oldRow, newRow schema.Row) bool {
+	for col, newVal := range newRow {
+		oldVal, exists := oldRow[col]
+		if !exists || !valuesEqual(oldVal, newVal) {
+			return true
+		}
+	}
+	return false
+}
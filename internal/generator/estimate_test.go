@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestEstimateStatementsInsertBatches(t *testing.T) {
+	var rows []schema.Row
+	for i := 1; i <= 5; i++ {
+		rows = append(rows, schema.Row{"id": i, "name": "a"})
+	}
+	rows = append(rows, schema.Row{"id": 6})
+	rows = append(rows, schema.Row{"id": 7, "name": "b"}, schema.Row{"id": 8, "name": "c"})
+
+	tests := []struct {
+		batchSize int
+		want      int
+	}{
+		{0, 8},
+		{1, 8},
+		{2, 5},
+		{500, 3},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("batch size %d", tt.batchSize), func(t *testing.T) {
+			dataDiff := &diff.DataDiff{TableName: "users", Schema: &schema.TableSchema{Name: "users"}, RowsAdded: rows}
+			result := &diff.DiffResult{DataDiffs: map[string]*diff.DataDiff{"users": dataDiff}}
+			opts := Options{Dialect: "mysql", InsertBatchSize: tt.batchSize}
+
+			if got := EstimateStatements(result, opts).Inserts; got != tt.want {
+				t.Errorf("Inserts = %d, want %d", got, tt.want)
+			}
+			if generated := len(NewDMLGenerator(opts).Statements(dataDiff)); generated != tt.want {
+				t.Errorf("generated %d statements, want %d", generated, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateStatements(t *testing.T) {
+	id := schema.Column{Name: "id", Type: "int", Position: 1}
+	pk := schema.Index{Name: "PRIMARY", Columns: []string{"id"}, Primary: true, Unique: true}
+	email := schema.Column{Name: "email", Type: "varchar(255)", Nullable: true, Position: 2}
+	nickname := schema.Column{Name: "nickname", Type: "varchar(50)", Nullable: true, Position: 3}
+	users := &schema.TableSchema{Name: "users", Columns: []schema.Column{id, email}, Indexes: []schema.Index{pk}}
+	tags := &schema.TableSchema{Name: "tags", Columns: []schema.Column{id}, Indexes: []schema.Index{pk, {Name: "idx_id", Columns: []string{"id"}}}}
+	result := &diff.DiffResult{
+		SchemaDiffs: map[string]*diff.SchemaDiff{
+			"tags":     {TableName: "tags", Action: diff.ActionAdd, NewSchema: tags},
+			"sessions": {TableName: "sessions", Action: diff.ActionDrop, OldSchema: &schema.TableSchema{Name: "sessions"}},
+			"users": {TableName: "users", Action: diff.ActionModify, OldSchema: users, NewSchema: users, ColumnChanges: []diff.ColumnChange{
+				{ColumnName: "email", Action: diff.ActionAdd, NewColumn: &email},
+				{ColumnName: "nickname", Action: diff.ActionDrop, OldColumn: &nickname},
+			}},
+		},
+		DataDiffs: map[string]*diff.DataDiff{
+			"users": {
+				TableName:    "users",
+				Schema:       users,
+				RowsAdded:    []schema.Row{{"id": 3, "email": "c@example.com"}, {"id": 4, "email": "d@example.com"}},
+				RowsDeleted:  []schema.Row{{"id": 1}},
+				RowsModified: []diff.RowModification{{OldRow: schema.Row{"id": 2, "email": "b@example.com"}, NewRow: schema.Row{"id": 2, "email": "b@example.org"}}},
+			},
+		},
+	}
+
+	got := EstimateStatements(result, Options{Dialect: "mysql"})
+	want := Estimate{Creates: 2, Drops: 2, Alters: 1, Inserts: 2, Updates: 1, Deletes: 1}
+	if got != want {
+		t.Errorf("EstimateStatements() = %+v, want %+v", got, want)
+	}
+	if got.Total() != 9 || got.Destructive() != 3 || got.Risk() != "high" {
+		t.Errorf("Total, Destructive, Risk = %d, %d, %s, want 9, 3, high", got.Total(), got.Destructive(), got.Risk())
+	}
+}
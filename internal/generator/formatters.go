@@ -0,0 +1,78 @@
+package generator
+
+import (
+	"sync"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+var (
+	typeFormattersMu sync.RWMutex
+	typeFormatters   = make(map[string]func(interface{}) string)
+)
+
+// RegisterTypeFormatter sets how values of a column type are written as SQL
+// literals in generated DML, for vendor types such as geometry or hstore.
+// typeName matches the column type without parameters, case-insensitively;
+// the formatter returns the complete literal, including any quoting.
+// NULL values are never passed to it.
+func RegisterTypeFormatter(typeName string, fn func(interface{}) string) {
+	typeFormattersMu.Lock()
+	defer typeFormattersMu.Unlock()
+	typeFormatters[schema.BaseType(typeName)] = fn
+}
+
+func lookupTypeFormatter(columnType string) func(interface{}) string {
+	if columnType == "" {
+		return nil
+	}
+	typeFormattersMu.RLock()
+	defer typeFormattersMu.RUnlock()
+	return typeFormatters[schema.BaseType(columnType)]
+}
+
+// columnTypes maps a table's column names to their types
+func columnTypes(tableSchema *schema.TableSchema) map[string]string {
+	types := make(map[string]string)
+	if tableSchema == nil {
+		return types
+	}
+	for _, col := range tableSchema.Columns {
+		types[col.Name] = col.Type
+	}
+	return types
+}
+
+// generatedColumns returns the generated columns of a table, whose values
+// the database computes, so INSERT and UPDATE must leave them out
+func generatedColumns(tableSchema *schema.TableSchema) map[string]bool {
+	generated := make(map[string]bool)
+	if tableSchema == nil {
+		return generated
+	}
+	for _, col := range tableSchema.Columns {
+		if col.Generated != "" {
+			generated[col.Name] = true
+		}
+	}
+	return generated
+}
+
+// withoutColumns returns copies of the rows without the given columns, or
+// the rows themselves when there are none to leave out
+func withoutColumns(rows []schema.Row, columns map[string]bool) []schema.Row {
+	if len(columns) == 0 {
+		return rows
+	}
+	result := make([]schema.Row, len(rows))
+	for i, row := range rows {
+		copied := make(schema.Row, len(row))
+		for col, val := range row {
+			if !columns[col] {
+				copied[col] = val
+			}
+		}
+		result[i] = copied
+	}
+	return result
+}
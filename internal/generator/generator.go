@@ -1,32 +1,301 @@
 package generator
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/koba/db-diff/internal/diff"
 )
 
+// Options controls SQL generation
+type Options struct {
+	// Dialect is the target dialect of the generated SQL ("mysql" or "postgres")
+	Dialect string
+	// SourceDialect is the dialect the snapshots were taken from. When set and
+	// different from Dialect, column types are translated to the target.
+	SourceDialect string
+	// ResyncThreshold rewrites a table's data with a full delete and re-insert
+	// when the fraction of changed rows exceeds it, unless other tables
+	// reference the table (0 disables). The diff must have been compared
+	// with the same diff.Options.ResyncThreshold, which keeps the rows.
+	ResyncThreshold float64
+	// GroupByTable emits each table's DDL immediately followed by its DML
+	// under a per-table header, instead of all DDL followed by all DML
+	GroupByTable bool
+	// IncludeAutoIncrement sets the next auto-increment value of created
+	// tables and of tables whose value changed
+	IncludeAutoIncrement bool
+	// BoolFormat is the literal style for boolean values: BoolKeyword
+	// (default), BoolNumeric or BoolChar
+	BoolFormat string
+	// NumericLocale is NumericLocaleC to write float values in the C
+	// locale: '.' as the decimal separator and the shortest digits that
+	// read back as the same value. Unset writes six fixed decimals.
+	NumericLocale string
+	// MaxValueLength leaves statements with a value literal longer than
+	// this many bytes commented out, with the value replaced by a
+	// placeholder and a warning (0: no limit). CheckValueLengths reports
+	// them.
+	MaxValueLength int
+	// IfExists makes table and column DDL safe to re-run: IF [NOT] EXISTS
+	// where the dialect has it, and an information_schema guard for MySQL
+	// column changes
+	IfExists bool
+	// Terminator ends each statement instead of ";"
+	Terminator string
+	// DelimiterSwitch surrounds the script with MySQL client DELIMITER
+	// commands so that it accepts Terminator
+	DelimiterSwitch bool
+	// Upsert generates added rows as inserts that update the existing row on
+	// a key conflict, conflicting on the primary key unless ConflictColumns
+	// names other columns for the table
+	Upsert          bool
+	ConflictColumns map[string][]string
+	// InsertBatchSize groups up to this many consecutive added rows of a
+	// table into one multi-row INSERT when they have the same columns
+	// (0 or 1: one row per INSERT)
+	InsertBatchSize int
+	// CopyTables names reference tables whose added rows are copied with
+	// INSERT ... SELECT from the same table in CopySource, a schema (or MySQL
+	// database) on the target server, instead of being written as literals
+	CopyTables map[string]bool
+	CopySource string
+	// AllowTableRebuild reorders the columns of a PostgreSQL table, which
+	// ALTER TABLE cannot do, by copying it into a new table that replaces it
+	AllowTableRebuild bool
+	// Placeholders generates each table's added rows as one INSERT template
+	// with PlaceholderNamed or PlaceholderPositional parameters instead of
+	// literals. The rows are stored in TemplateValues, when set, for writing
+	// to the per-table files of ValuesFile that the templates name.
+	Placeholders   string
+	TemplateValues map[string]*TableValues
+	ValuesFile     string
+}
+
+// resyncs reports whether a table's data is rewritten as a whole. Without
+// the second snapshot's rows, which the diff keeps for such tables only, the
+// table gets row-level changes.
+func (o Options) resyncs(dataDiff *diff.DataDiff) bool {
+	return dataDiff.Resyncs(o.ResyncThreshold) && len(dataDiff.NewData) == dataDiff.NewRowCount
+}
+
+// terminate replaces the ";" ending a generated statement with the
+// configured terminator
+func (o Options) terminate(stmt string) string {
+	if o.Terminator == "" || o.Terminator == ";" || !strings.HasSuffix(stmt, ";") {
+		return stmt
+	}
+	return strings.TrimSuffix(stmt, ";") + o.Terminator
+}
+
+// withDelimiter wraps a script in DELIMITER commands when requested
+func (o Options) withDelimiter(sql string) string {
+	if !o.DelimiterSwitch || o.Terminator == "" || o.Terminator == ";" || sql == "" {
+		return sql
+	}
+	return fmt.Sprintf("DELIMITER %s\n%s\nDELIMITER ;", o.Terminator, sql)
+}
+
 // GenerateSQL generates migration SQL from a diff result
-func GenerateSQL(result *diff.DiffResult, dbType string) string {
+func GenerateSQL(result *diff.DiffResult, opts Options) string {
+	if opts.GroupByTable {
+		return generateGroupedSQL(result, opts)
+	}
+
 	var sqlStatements []string
+	viewsBefore, viewsAfter := materializedViewStatements(result, opts)
+	if len(viewsBefore) > 0 {
+		sqlStatements = append(sqlStatements, strings.Join(viewsBefore, "\n"))
+	}
 
 	// Generate DDL statements
-	ddlGen := NewDDLGenerator(dbType)
-	for _, schemaDiff := range result.SchemaDiffs {
-		sql := ddlGen.Generate(schemaDiff)
-		if sql != "" {
-			sqlStatements = append(sqlStatements, sql)
+	tables, deferred := tableDDL(result, opts)
+	for _, table := range tables {
+		if len(table.statements) > 0 {
+			sqlStatements = append(sqlStatements, strings.Join(table.sql(), "\n"))
 		}
 	}
+	if len(deferred) > 0 {
+		sqlStatements = append(sqlStatements, strings.Join(deferred, "\n"))
+	}
 
 	// Generate DML statements
-	dmlGen := NewDMLGenerator(dbType)
-	for _, dataDiff := range result.DataDiffs {
-		sql := dmlGen.Generate(dataDiff)
+	dmlGen := NewDMLGenerator(opts)
+	for _, tableName := range diff.OrderedKeys(result.DataDiffs, result.TableOrder) {
+		sql := dmlGen.Generate(result.DataDiffs[tableName])
 		if sql != "" {
 			sqlStatements = append(sqlStatements, sql)
 		}
 	}
 
-	return strings.Join(sqlStatements, "\n\n")
+	if len(viewsAfter) > 0 {
+		sqlStatements = append(sqlStatements, strings.Join(viewsAfter, "\n"))
+	}
+
+	return opts.withDelimiter(strings.Join(sqlStatements, "\n\n"))
+}
+
+// generateGroupedSQL generates migration SQL one table at a time
+func generateGroupedSQL(result *diff.DiffResult, opts Options) string {
+	var blocks []string
+	viewsBefore, viewsAfter := materializedViewStatements(result, opts)
+	if len(viewsBefore) > 0 {
+		blocks = append(blocks, "-- === materialized views ===\n"+strings.Join(viewsBefore, "\n"))
+	}
+
+	tables, deferred := tableDDL(result, opts)
+	ddl := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		ddl[table.name] = table.sql()
+	}
+	dmlGen := NewDMLGenerator(opts)
+	for _, tableName := range changedTableNames(result) {
+		var parts []string
+		if len(ddl[tableName]) > 0 {
+			parts = append(parts, strings.Join(ddl[tableName], "\n"))
+		}
+		if dataDiff, ok := result.DataDiffs[tableName]; ok {
+			if sql := dmlGen.Generate(dataDiff); sql != "" {
+				parts = append(parts, sql)
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		header := fmt.Sprintf("-- === table: %s ===", tableName)
+		blocks = append(blocks, header+"\n"+strings.Join(parts, "\n"))
+	}
+	if len(deferred) > 0 {
+		blocks = append(blocks, "-- === partitions ===\n"+strings.Join(deferred, "\n"))
+	}
+	if len(viewsAfter) > 0 {
+		blocks = append(blocks, "-- === materialized views ===\n"+strings.Join(viewsAfter, "\n"))
+	}
+
+	return opts.withDelimiter(strings.Join(blocks, "\n\n"))
+}
+
+// SplitSQL is migration SQL divided into phases that are run separately, in
+// the order Drops, DDL, DML. Unlike GenerateSQL, this runs every drop
+// before any other DDL; see DDLGenerator.Split for when that fails.
+type SplitSQL struct {
+	Drops string // destructive DDL: dropped tables, columns, indexes and foreign keys
+	DDL   string // remaining DDL
+	DML   string
+}
+
+// GenerateSplitSQL generates migration SQL with destructive DDL, other DDL
+// and DML kept apart
+func GenerateSplitSQL(result *diff.DiffResult, opts Options) SplitSQL {
+	var drops, ddl, dml []string
+	viewsBefore, viewsAfter := materializedViewStatements(result, opts)
+	if len(viewsBefore) > 0 {
+		drops = append(drops, strings.Join(viewsBefore, "\n"))
+	}
+
+	tables, deferred := tableDDL(result, opts)
+	for _, table := range tables {
+		var destructive, other []string
+		for _, stmt := range table.statements {
+			if stmt.destructive {
+				destructive = append(destructive, stmt.sql)
+			} else {
+				other = append(other, stmt.sql)
+			}
+		}
+		if len(destructive) > 0 {
+			drops = append(drops, strings.Join(destructive, "\n"))
+		}
+		if len(other) > 0 {
+			ddl = append(ddl, strings.Join(other, "\n"))
+		}
+	}
+	if len(deferred) > 0 {
+		ddl = append(ddl, strings.Join(deferred, "\n"))
+	}
+
+	dmlGen := NewDMLGenerator(opts)
+	for _, tableName := range diff.OrderedKeys(result.DataDiffs, result.TableOrder) {
+		if sql := dmlGen.Generate(result.DataDiffs[tableName]); sql != "" {
+			dml = append(dml, sql)
+		}
+	}
+	// Views are created and refreshed once the data is in place
+	if len(viewsAfter) > 0 {
+		dml = append(dml, strings.Join(viewsAfter, "\n"))
+	}
+
+	return SplitSQL{
+		Drops: opts.withDelimiter(strings.Join(drops, "\n\n")),
+		DDL:   opts.withDelimiter(strings.Join(ddl, "\n\n")),
+		DML:   opts.withDelimiter(strings.Join(dml, "\n\n")),
+	}
+}
+
+// GenerateStatements generates migration SQL as a list of individual
+// statements, all DDL followed by all DML as in GenerateSQL
+func GenerateStatements(result *diff.DiffResult, opts Options) []string {
+	viewsBefore, viewsAfter := materializedViewStatements(result, opts)
+	statements := viewsBefore
+
+	tables, deferred := tableDDL(result, opts)
+	for _, table := range tables {
+		statements = append(statements, table.sql()...)
+	}
+	statements = append(statements, deferred...)
+
+	dmlGen := NewDMLGenerator(opts)
+	for _, tableName := range diff.OrderedKeys(result.DataDiffs, result.TableOrder) {
+		statements = append(statements, dmlGen.Statements(result.DataDiffs[tableName])...)
+	}
+
+	return append(statements, viewsAfter...)
+}
+
+// tableStatements is the DDL of one table
+type tableStatements struct {
+	name       string
+	statements []ddlStatement
+}
+
+func (t tableStatements) sql() []string {
+	sql := make([]string, len(t.statements))
+	for i, stmt := range t.statements {
+		sql[i] = stmt.sql
+	}
+	return sql
+}
+
+// tableDDL generates the DDL of every table with schema differences, in the
+// result's table order. Statements that must wait until every table is
+// created are returned apart, to follow all the others.
+func tableDDL(result *diff.DiffResult, opts Options) ([]tableStatements, []string) {
+	var tables []tableStatements
+	var deferred []string
+	ddlGen := NewDDLGenerator(opts)
+	for _, tableName := range diff.OrderedKeys(result.SchemaDiffs, result.TableOrder) {
+		table := tableStatements{name: tableName}
+		for _, stmt := range ddlGen.statements(result.SchemaDiffs[tableName]) {
+			if stmt.deferred {
+				deferred = append(deferred, stmt.sql)
+			} else {
+				table.statements = append(table.statements, stmt)
+			}
+		}
+		tables = append(tables, table)
+	}
+	return tables, deferred
+}
+
+// changedTableNames returns the names of tables with schema or data
+// differences, in the result's table order
+func changedTableNames(result *diff.DiffResult) []string {
+	seen := make(map[string]bool)
+	for name := range result.SchemaDiffs {
+		seen[name] = true
+	}
+	for name := range result.DataDiffs {
+		seen[name] = true
+	}
+	return diff.OrderedKeys(seen, result.TableOrder)
 }
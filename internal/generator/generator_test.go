@@ -0,0 +1,163 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// partitionResult adds the partition events_2024 to events, with the
+// partition created as a table of its own after its parent
+func partitionResult() *diff.DiffResult {
+	partition := &schema.Partition{Name: "events_2024", Bound: "FOR VALUES FROM (2024) TO (2025)"}
+	parent := &schema.TableSchema{
+		Name:         "events",
+		Columns:      []schema.Column{{Name: "year", Type: "integer"}},
+		Partitioning: &schema.Partitioning{Method: "RANGE", Expression: "year", Partitions: []schema.Partition{*partition}},
+	}
+	child := &schema.TableSchema{Name: "events_2024", Columns: []schema.Column{{Name: "year", Type: "integer"}}}
+	return &diff.DiffResult{
+		SchemaDiffs: map[string]*diff.SchemaDiff{
+			"events": {
+				TableName: "events", Action: diff.ActionModify, OldSchema: parent, NewSchema: parent,
+				PartitionChanges: []diff.PartitionChange{{PartitionName: partition.Name, Action: diff.ActionAdd, NewPartition: partition}},
+			},
+			"events_2024": {TableName: "events_2024", Action: diff.ActionAdd, NewSchema: child},
+		},
+		DataDiffs:  map[string]*diff.DataDiff{},
+		TableOrder: []string{"events", "events_2024"},
+	}
+}
+
+func TestPartitionAttachedAfterCreate(t *testing.T) {
+	opts := Options{Dialect: "postgres"}
+	tests := []struct {
+		name string
+		sql  func() string
+	}{
+		{"GenerateSQL", func() string { return GenerateSQL(partitionResult(), opts) }},
+		{"grouped", func() string {
+			grouped := opts
+			grouped.GroupByTable = true
+			return GenerateSQL(partitionResult(), grouped)
+		}},
+		{"GenerateSplitSQL", func() string { return GenerateSplitSQL(partitionResult(), opts).DDL }},
+		{"GenerateStatements", func() string { return strings.Join(GenerateStatements(partitionResult(), opts), "\n") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := tt.sql()
+			create := strings.Index(sql, `CREATE TABLE "events_2024"`)
+			attach := strings.Index(sql, "ATTACH PARTITION")
+			if create < 0 || attach < 0 {
+				t.Fatalf("missing CREATE TABLE or ATTACH PARTITION in:\n%s", sql)
+			}
+			if attach < create {
+				t.Errorf("partition attached before it is created:\n%s", sql)
+			}
+		})
+	}
+}
+
+func TestGenerateSQLGroupByTable(t *testing.T) {
+	users := &schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id", Type: "int"}, {Name: "email", Type: "text", Nullable: true}},
+		Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}
+	orders := &schema.TableSchema{Name: "orders", Columns: []schema.Column{{Name: "id", Type: "int"}, {Name: "total", Type: "int", Nullable: true}},
+		Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}
+	email, total := users.Columns[1], orders.Columns[1]
+	result := &diff.DiffResult{
+		SchemaDiffs: map[string]*diff.SchemaDiff{
+			"users": {TableName: "users", Action: diff.ActionModify, OldSchema: users, NewSchema: users,
+				ColumnChanges: []diff.ColumnChange{{ColumnName: "email", Action: diff.ActionAdd, NewColumn: &email}}},
+			"orders": {TableName: "orders", Action: diff.ActionModify, OldSchema: orders, NewSchema: orders,
+				ColumnChanges: []diff.ColumnChange{{ColumnName: "total", Action: diff.ActionAdd, NewColumn: &total}}},
+		},
+		DataDiffs: map[string]*diff.DataDiff{
+			"users":  {TableName: "users", Schema: users, RowsAdded: []schema.Row{{"id": 1, "email": "a@example.com"}}},
+			"orders": {TableName: "orders", Schema: orders, RowsDeleted: []schema.Row{{"id": 10}}},
+		},
+		TableOrder: []string{"users", "orders"},
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{name: "grouped", opts: Options{GroupByTable: true}, want: []string{
+			"-- === table: users ===", "ALTER TABLE `users` ADD COLUMN", "INSERT INTO `users`",
+			"-- === table: orders ===", "ALTER TABLE `orders` ADD COLUMN", "DELETE FROM `orders`",
+		}},
+		{name: "ungrouped", want: []string{
+			"ALTER TABLE `users` ADD COLUMN", "ALTER TABLE `orders` ADD COLUMN", "INSERT INTO `users`", "DELETE FROM `orders`",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Dialect = "mysql"
+			sql := GenerateSQL(result, tt.opts)
+			last := -1
+			for _, want := range tt.want {
+				i := strings.Index(sql, want)
+				if i < 0 {
+					t.Fatalf("missing %q in:\n%s", want, sql)
+				}
+				if i < last {
+					t.Errorf("%q out of order in:\n%s", want, sql)
+				}
+				last = i
+			}
+			if !tt.opts.GroupByTable && strings.Contains(sql, "-- === table:") {
+				t.Errorf("ungrouped SQL has table headers:\n%s", sql)
+			}
+		})
+	}
+}
+
+func TestTerminatorAndDelimiter(t *testing.T) {
+	result := func() *diff.DiffResult {
+		users := &schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id", Type: "int"}}}
+		return &diff.DiffResult{
+			SchemaDiffs: map[string]*diff.SchemaDiff{"users": {TableName: "users", Action: diff.ActionAdd, NewSchema: users}},
+			DataDiffs:   map[string]*diff.DataDiff{"users": {TableName: "users", Schema: users, RowsAdded: []schema.Row{{"id": int64(1)}}}},
+		}
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{name: "default", opts: Options{Dialect: "mysql"}, want: []string{
+			"CREATE TABLE `users` (\n  `id` int NOT NULL\n);",
+			"INSERT INTO `users` (`id`) VALUES (1);",
+		}},
+		{name: "terminator", opts: Options{Dialect: "mysql", Terminator: "//"}, want: []string{
+			"CREATE TABLE `users` (\n  `id` int NOT NULL\n)//",
+			"INSERT INTO `users` (`id`) VALUES (1)//",
+		}},
+		{name: "delimiter switch", opts: Options{Dialect: "mysql", Terminator: "//", DelimiterSwitch: true}, want: []string{
+			"DELIMITER //\n",
+			"CREATE TABLE `users` (\n  `id` int NOT NULL\n)//",
+			"INSERT INTO `users` (`id`) VALUES (1)//",
+			"\nDELIMITER ;",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := GenerateSQL(result(), tt.opts)
+			last := -1
+			for _, want := range tt.want {
+				i := strings.Index(sql, want)
+				if i < 0 || i < last {
+					t.Fatalf("GenerateSQL() missing %q in order:\n%s", want, sql)
+				}
+				last = i
+			}
+			if !tt.opts.DelimiterSwitch && strings.Contains(sql, "DELIMITER") {
+				t.Errorf("GenerateSQL() switches the delimiter without DelimiterSwitch:\n%s", sql)
+			}
+		})
+	}
+}
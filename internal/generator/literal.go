@@ -0,0 +1,133 @@
+package generator
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// quoteLiteral quotes a string as a SQL string literal
+func quoteLiteral(s string) string {
+	// Escape single quotes
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+var (
+	numericLiteral = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+	// castLiteral matches PostgreSQL typed literals such as 'active'::text
+	// or '{}'::jsonb, and casted expressions like (0)::numeric
+	castLiteral = regexp.MustCompile(`^.+::[a-zA-Z_][a-zA-Z0-9_ ]*(\[\])?(\([0-9, ]+\))?$`)
+)
+
+// defaultKeywords are default expressions that must not be quoted
+var defaultKeywords = map[string]bool{
+	"NULL":              true,
+	"TRUE":              true,
+	"FALSE":             true,
+	"CURRENT_TIMESTAMP": true,
+	"CURRENT_DATE":      true,
+	"CURRENT_TIME":      true,
+	"LOCALTIMESTAMP":    true,
+	"LOCALTIME":         true,
+	"CURRENT_USER":      true,
+}
+
+// Literal kinds of column types, which decide how formatDefault quotes a default
+const (
+	kindOther = iota
+	kindNumeric
+	kindString
+	kindTemporal
+)
+
+// literalKinds maps base column types to the kind of their literals.
+// Booleans are numeric: neither true nor MySQL's 1 is quoted.
+var literalKinds = map[string]int{
+	"tinyint": kindNumeric, "smallint": kindNumeric, "mediumint": kindNumeric,
+	"int": kindNumeric, "integer": kindNumeric, "bigint": kindNumeric,
+	"int2": kindNumeric, "int4": kindNumeric, "int8": kindNumeric,
+	"serial": kindNumeric, "smallserial": kindNumeric, "bigserial": kindNumeric,
+	"decimal": kindNumeric, "numeric": kindNumeric, "dec": kindNumeric,
+	"float": kindNumeric, "double": kindNumeric, "double precision": kindNumeric,
+	"real": kindNumeric, "float4": kindNumeric, "float8": kindNumeric,
+	"bool": kindNumeric, "boolean": kindNumeric,
+
+	"char": kindString, "varchar": kindString, "character": kindString,
+	"character varying": kindString, "bpchar": kindString, "citext": kindString,
+	"text": kindString, "tinytext": kindString, "mediumtext": kindString,
+	"longtext": kindString, "enum": kindString, "set": kindString,
+
+	"date": kindTemporal, "time": kindTemporal, "datetime": kindTemporal,
+	"timestamp": kindTemporal, "timestamptz": kindTemporal, "timetz": kindTemporal,
+	"time with time zone": kindTemporal, "time without time zone": kindTemporal,
+	"timestamp with time zone": kindTemporal, "timestamp without time zone": kindTemporal,
+}
+
+// literalKind returns the literal kind of a column type
+func literalKind(columnType string) int {
+	t := schema.BaseType(columnType)
+	for _, attribute := range []string{" zerofill", " unsigned", " signed"} {
+		t = strings.TrimSuffix(t, attribute)
+	}
+	return literalKinds[t]
+}
+
+// formatDefault renders a column's captured default as SQL, quoted
+// according to the column type. PostgreSQL reports defaults as expressions
+// ('active'::text, 0, true, now()) that are emitted as-is; MySQL reports
+// string and date defaults unquoted. Numeric and boolean defaults are never
+// quoted, string defaults are unless already a quoted or cast literal, and
+// date and time defaults are unless they are an expression such as
+// CURRENT_TIMESTAMP. Other types are quoted unless the value looks like a
+// number or an expression.
+func formatDefault(col *schema.Column) string {
+	value := *col.DefaultValue
+	v := strings.TrimSpace(value)
+
+	switch literalKind(col.Type) {
+	case kindNumeric:
+		return v
+	case kindString:
+		if isQuotedLiteral(v) || castLiteral.MatchString(v) || strings.HasPrefix(v, "(") {
+			return v
+		}
+	case kindTemporal:
+		if isExpression(v) {
+			return v
+		}
+	default:
+		if numericLiteral.MatchString(v) || isExpression(v) {
+			return v
+		}
+	}
+
+	return quoteLiteral(value)
+}
+
+// isExpression reports whether a default is a keyword, function call,
+// parenthesized expression or literal that must not be quoted again
+func isExpression(v string) bool {
+	upper := strings.ToUpper(v)
+	switch {
+	case defaultKeywords[upper]:
+		return true
+	case strings.HasPrefix(upper, "CURRENT_TIMESTAMP(") || strings.HasPrefix(v, "(") || isFunctionCall(v):
+		return true
+	case isQuotedLiteral(v) || castLiteral.MatchString(v):
+		return true
+	case strings.HasPrefix(upper, "B'") || strings.HasPrefix(upper, "X'"):
+		return true // bit and hex literals
+	}
+	return false
+}
+
+func isQuotedLiteral(v string) bool {
+	return strings.HasPrefix(v, "'") && strings.HasSuffix(v, "'") && len(v) >= 2
+}
+
+var functionCall = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*\(.*\)$`)
+
+func isFunctionCall(v string) bool {
+	return functionCall.MatchString(v)
+}
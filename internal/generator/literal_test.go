@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestFormatDefault(t *testing.T) {
+	tests := []struct {
+		name       string
+		columnType string
+		value      string
+		want       string
+	}{
+		{name: "integer", columnType: "int(11) unsigned", value: "0", want: "0"},
+		{name: "numeric cast", columnType: "numeric(10,2)", value: "0.00", want: "0.00"},
+		{name: "boolean", columnType: "boolean", value: "true", want: "true"},
+		{name: "mysql boolean", columnType: "tinyint(1)", value: "1", want: "1"},
+		{name: "sequence", columnType: "integer", value: "nextval('users_id_seq'::regclass)", want: "nextval('users_id_seq'::regclass)"},
+		{name: "mysql string", columnType: "varchar(20)", value: "active", want: "'active'"},
+		{name: "numeric string", columnType: "varchar(20)", value: "123", want: "'123'"},
+		{name: "keyword string", columnType: "varchar(20)", value: "TRUE", want: "'TRUE'"},
+		{name: "string with quote", columnType: "text", value: "it's", want: "'it''s'"},
+		{name: "postgres string", columnType: "character varying(20)", value: "'active'::character varying", want: "'active'::character varying"},
+		{name: "timestamp keyword", columnType: "timestamp", value: "CURRENT_TIMESTAMP", want: "CURRENT_TIMESTAMP"},
+		{name: "timestamp function", columnType: "timestamp with time zone", value: "now()", want: "now()"},
+		{name: "mysql date", columnType: "date", value: "2020-01-01", want: "'2020-01-01'"},
+		{name: "other type literal", columnType: "uuid", value: "gen_random_uuid()", want: "gen_random_uuid()"},
+		{name: "other type value", columnType: "json", value: "{}", want: "'{}'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := tt.value
+			col := &schema.Column{Name: "c", Type: tt.columnType, DefaultValue: &value}
+			if got := formatDefault(col); got != tt.want {
+				t.Errorf("formatDefault() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateModifyColumnDefault(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name       string
+		columnType string
+		old, new   *string
+		want       []string
+	}{
+		{name: "string", columnType: "text", old: str("'new'::text"), new: str("'active'::text"),
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "c" SET DEFAULT 'active'::text;`}},
+		{name: "numeric", columnType: "integer", old: str("0"), new: str("1"),
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "c" SET DEFAULT 1;`}},
+		{name: "boolean", columnType: "boolean", old: str("false"), new: str("true"),
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "c" SET DEFAULT true;`}},
+		{name: "function", columnType: "timestamp with time zone", new: str("now()"),
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "c" SET DEFAULT now();`}},
+		{name: "dropped", columnType: "integer", old: str("0"),
+			want: []string{`ALTER TABLE "users" ALTER COLUMN "c" DROP DEFAULT;`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewDDLGenerator(Options{Dialect: "postgres"})
+			oldCol := &schema.Column{Name: "c", Type: tt.columnType, Nullable: true, DefaultValue: tt.old}
+			col := &schema.Column{Name: "c", Type: tt.columnType, Nullable: true, DefaultValue: tt.new}
+			change := diff.ColumnChange{ColumnName: "c", Action: diff.ActionModify, OldColumn: oldCol, NewColumn: col, ChangedAttributes: []string{"default"}}
+			if got := g.generateModifyColumn("users", change); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("generateModifyColumn() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
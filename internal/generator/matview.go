@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/koba/db-diff/internal/diff"
+)
+
+// materializedViewStatements generates the statements for materialized
+// views. before holds the drops, which precede the table DDL since a view
+// blocks changes to the tables it reads; after holds the creations and
+// refreshes, which follow the data changes so the views are populated from
+// the migrated data.
+func materializedViewStatements(result *diff.DiffResult, opts Options) (before, after []string) {
+	if len(result.MaterializedViewDiffs) == 0 && len(result.DataDiffs) == 0 {
+		return nil, nil
+	}
+	g := NewDDLGenerator(opts)
+
+	names := make([]string, 0, len(result.MaterializedViewDiffs))
+	for name := range result.MaterializedViewDiffs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if g.dbType != "postgres" && g.dbType != "PostgreSQL" {
+		for _, name := range names {
+			after = append(after, fmt.Sprintf("-- WARNING: %s does not support materialized views, %s not migrated", g.dbType, name))
+		}
+		return nil, after
+	}
+
+	rebuilt := make(map[string]bool)
+	for _, name := range names {
+		viewDiff := result.MaterializedViewDiffs[name]
+		switch {
+		case viewDiff.Action == diff.ActionDrop:
+			before = append(before, g.generateDropMaterializedView(name))
+		case viewDiff.Action == diff.ActionAdd:
+			after = append(after, g.createMaterializedView(viewDiff)...)
+			rebuilt[name] = true
+		case viewDiff.DefinitionChanged:
+			// The query of a materialized view can't be altered
+			before = append(before, g.generateDropMaterializedView(name))
+			after = append(after, g.createMaterializedView(viewDiff)...)
+			rebuilt[name] = true
+		default:
+			for _, change := range viewDiff.IndexChanges {
+				if change.Action != diff.ActionAdd {
+					before = append(before, g.generateDropIndex(name, change.OldIndex.Name))
+				}
+				if change.Action != diff.ActionDrop {
+					after = append(after, g.generateCreateIndex(name, change.NewIndex))
+				}
+			}
+		}
+	}
+
+	// Views over changed data hold stale rows until refreshed. Which tables
+	// a view reads isn't captured, so every view is refreshed.
+	if len(result.DataDiffs) > 0 {
+		for _, name := range result.MaterializedViews {
+			if !rebuilt[name] {
+				after = append(after, fmt.Sprintf("REFRESH MATERIALIZED VIEW %s;", g.quoteIdentifier(name)))
+			}
+		}
+	}
+
+	for i := range before {
+		before[i] = opts.terminate(before[i])
+	}
+	for i := range after {
+		after[i] = opts.terminate(after[i])
+	}
+	return before, after
+}
+
+// createMaterializedView creates a view populated with data, and its indexes
+func (g *DDLGenerator) createMaterializedView(viewDiff *diff.MaterializedViewDiff) []string {
+	view := viewDiff.NewView
+	statements := []string{fmt.Sprintf("CREATE MATERIALIZED VIEW %s AS\n%s\nWITH DATA;",
+		g.quoteIdentifier(view.Name), strings.TrimSuffix(strings.TrimSpace(view.Definition), ";"))}
+	for i := range view.Indexes {
+		statements = append(statements, g.generateCreateIndex(view.Name, &view.Indexes[i]))
+	}
+	return statements
+}
+
+func (g *DDLGenerator) generateDropMaterializedView(name string) string {
+	return fmt.Sprintf("DROP MATERIALIZED VIEW %s;", g.quoteIdentifier(name))
+}
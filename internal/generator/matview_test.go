@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestMaterializedViewStatements(t *testing.T) {
+	idx := schema.Index{Name: "idx_sales_day", Columns: []string{"day"}, Unique: true}
+	view := func(definition string, indexes ...schema.Index) *snapshot.Snapshot {
+		return &snapshot.Snapshot{
+			Metadata: map[string]string{"db_type": "postgres"},
+			Tables:   map[string]*schema.Table{},
+			MaterializedViews: map[string]*schema.MaterializedView{
+				"daily_sales": {Name: "daily_sales", Definition: definition, Indexes: indexes},
+			},
+		}
+	}
+	byDay := " SELECT day, sum(total) AS total FROM orders GROUP BY day;"
+	byDayAndRegion := " SELECT day, region, sum(total) AS total FROM orders GROUP BY day, region;"
+	tests := []struct {
+		name       string
+		old, new   *snapshot.Snapshot
+		wantBefore []string
+		wantAfter  []string
+	}{
+		{
+			name:       "definition changed",
+			old:        view(byDay, idx),
+			new:        view(byDayAndRegion, idx),
+			wantBefore: []string{`DROP MATERIALIZED VIEW "daily_sales";`},
+			wantAfter: []string{
+				"CREATE MATERIALIZED VIEW \"daily_sales\" AS\nSELECT day, region, sum(total) AS total FROM orders GROUP BY day, region\nWITH DATA;",
+				`CREATE UNIQUE INDEX "idx_sales_day" ON "daily_sales" ("day");`,
+			},
+		},
+		{
+			name:      "index added",
+			old:       view(byDay),
+			new:       view(byDay, idx),
+			wantAfter: []string{`CREATE UNIQUE INDEX "idx_sales_day" ON "daily_sales" ("day");`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := diff.Compare(tt.old, tt.new, diff.Options{})
+			before, after := materializedViewStatements(result, Options{Dialect: "postgres"})
+			if !reflect.DeepEqual(before, tt.wantBefore) {
+				t.Errorf("before = %q, want %q", before, tt.wantBefore)
+			}
+			if !reflect.DeepEqual(after, tt.wantAfter) {
+				t.Errorf("after = %q, want %q", after, tt.wantAfter)
+			}
+		})
+	}
+}
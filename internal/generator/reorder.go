@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// rebuildSuffix names the table a PostgreSQL table is rebuilt into
+const rebuildSuffix = "_dbdiff_rebuild"
+
+// sequenceDefault matches a serial column's default and captures its sequence
+var sequenceDefault = regexp.MustCompile(`(?i)^nextval\('([^']+)'`)
+
+// generateColumnReorder puts the columns of a table in the order of the
+// second snapshot. MySQL moves columns with MODIFY ... AFTER; PostgreSQL
+// cannot reorder columns, so the table is rebuilt when
+// Options.AllowTableRebuild is set and a warning is emitted otherwise.
+func (g *DDLGenerator) generateColumnReorder(schemaDiff *diff.SchemaDiff) []ddlStatement {
+	switch {
+	case g.dbType == "postgres" || g.dbType == "PostgreSQL":
+		if !g.opts.AllowTableRebuild {
+			return []ddlStatement{{sql: fmt.Sprintf("-- WARNING: PostgreSQL cannot reorder the columns of %s; rebuild the table manually or use --allow-table-rebuild",
+				schemaDiff.TableName)}}
+		}
+		return g.generateRebuildTable(schemaDiff.NewSchema)
+	}
+
+	oldOrder := diff.CommonColumnOrder(schemaDiff.OldSchema, schemaDiff.NewSchema)
+	newOrder := diff.CommonColumnOrder(schemaDiff.NewSchema, schemaDiff.OldSchema)
+	moved := movedColumns(oldOrder, newOrder)
+
+	columns := make(map[string]*schema.Column, len(schemaDiff.NewSchema.Columns))
+	for i := range schemaDiff.NewSchema.Columns {
+		columns[schemaDiff.NewSchema.Columns[i].Name] = &schemaDiff.NewSchema.Columns[i]
+	}
+
+	// Each moved column follows the column before it in the new order, which
+	// has either stayed in place or already been moved
+	var statements []ddlStatement
+	for i, name := range newOrder {
+		if !moved[name] {
+			continue
+		}
+		position := " FIRST"
+		if i > 0 {
+			position = " AFTER " + g.quoteIdentifier(newOrder[i-1])
+		}
+		statements = append(statements, ddlStatement{sql: fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s%s;",
+			g.quoteIdentifier(schemaDiff.TableName),
+			g.columnDefinition(columns[name]),
+			position,
+		)})
+	}
+	return statements
+}
+
+// movedColumns returns the columns that have to move to turn oldOrder into
+// newOrder: all but a longest sequence of columns whose relative order is
+// the same in both
+func movedColumns(oldOrder, newOrder []string) map[string]bool {
+	oldIndex := make(map[string]int, len(oldOrder))
+	for i, name := range oldOrder {
+		oldIndex[name] = i
+	}
+
+	// Longest increasing subsequence of the old positions, in new order
+	length := make([]int, len(newOrder))
+	prev := make([]int, len(newOrder))
+	best := -1
+	for i, name := range newOrder {
+		length[i], prev[i] = 1, -1
+		for j := 0; j < i; j++ {
+			if oldIndex[newOrder[j]] < oldIndex[name] && length[j]+1 > length[i] {
+				length[i], prev[i] = length[j]+1, j
+			}
+		}
+		if best < 0 || length[i] > length[best] {
+			best = i
+		}
+	}
+
+	moved := make(map[string]bool, len(newOrder))
+	for _, name := range newOrder {
+		moved[name] = true
+	}
+	for i := best; i >= 0; i = prev[i] {
+		delete(moved, newOrder[i])
+	}
+	return moved
+}
+
+// generateRebuildTable recreates a PostgreSQL table with its columns in
+// schema order: the rows are copied into a new table, which replaces the
+// old one and gets its indexes, comments and rules back. Dropping the old
+// table fails while other objects such as foreign keys or views depend on
+// it.
+func (g *DDLGenerator) generateRebuildTable(tableSchema *schema.TableSchema) []ddlStatement {
+	tableName := tableSchema.Name
+	rebuildName := tableName + rebuildSuffix
+	table := g.quoteIdentifier(tableName)
+	rebuild := g.quoteIdentifier(rebuildName)
+
+	rebuildSchema := *tableSchema
+	rebuildSchema.Name = rebuildName
+
+	columns := append([]schema.Column(nil), tableSchema.Columns...)
+	sort.SliceStable(columns, func(i, j int) bool { return columns[i].Position < columns[j].Position })
+	// Generated columns are computed again by the new table
+	var names []string
+	overriding := ""
+	for _, col := range columns {
+		if col.Generated != "" {
+			continue
+		}
+		names = append(names, g.quoteIdentifier(col.Name))
+		if col.Identity == "ALWAYS" {
+			overriding = " OVERRIDING SYSTEM VALUE"
+		}
+	}
+	columnList := strings.Join(names, ", ")
+
+	statements := []ddlStatement{
+		{sql: fmt.Sprintf("-- Rebuilding %s to reorder its columns", tableName)},
+		{sql: g.generateCreateTable(&rebuildSchema)},
+		{sql: fmt.Sprintf("INSERT INTO %s (%s)%s SELECT %s FROM %s;", rebuild, columnList, overriding, columnList, table)},
+	}
+
+	// Serial sequences are owned by the old table's columns and would be
+	// dropped with it
+	for _, col := range columns {
+		if col.DefaultValue == nil {
+			continue
+		}
+		if m := sequenceDefault.FindStringSubmatch(*col.DefaultValue); m != nil {
+			statements = append(statements, ddlStatement{sql: fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s;", m[1], rebuild, g.quoteIdentifier(col.Name))})
+		}
+	}
+
+	statements = append(statements,
+		ddlStatement{sql: fmt.Sprintf("DROP TABLE %s;", table), destructive: true},
+		ddlStatement{sql: fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", rebuild, table)},
+	)
+
+	// The primary key was named after the rebuild table
+	for _, idx := range tableSchema.Indexes {
+		if idx.Primary {
+			statements = append(statements, ddlStatement{sql: fmt.Sprintf("ALTER INDEX %s RENAME TO %s;",
+				g.quoteIdentifier(rebuildName+"_pkey"), g.quoteIdentifier(idx.Name))})
+			break
+		}
+	}
+
+	// Identity columns start over in the new table
+	for _, col := range columns {
+		if col.Identity != "" {
+			statements = append(statements, ddlStatement{sql: fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, %s), COALESCE(MAX(%s), 0) + 1, false) FROM %s;",
+				quoteLiteral(table), quoteLiteral(col.Name), g.quoteIdentifier(col.Name), table)})
+		}
+	}
+
+	for _, stmt := range g.CreateTableStatements(tableSchema)[1:] {
+		statements = append(statements, ddlStatement{sql: stmt})
+	}
+	return statements
+}
@@ -0,0 +1,80 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// reorderStatements compares two column orders of a users table and
+// returns the statements migrating the first to the second
+func reorderStatements(t *testing.T, opts Options, oldOrder, newOrder []string) []string {
+	t.Helper()
+	snap := func(order []string) *snapshot.Snapshot {
+		users := schema.TableSchema{Name: "users", Indexes: []schema.Index{{Name: "users_pkey", Columns: []string{"id"}, Primary: true, Unique: true}}}
+		for i, name := range order {
+			users.Columns = append(users.Columns, schema.Column{Name: name, Type: "integer", Position: i + 1})
+		}
+		return &snapshot.Snapshot{Metadata: map[string]string{"db_type": opts.Dialect}, Tables: map[string]*schema.Table{"users": {Schema: users}}}
+	}
+	schemaDiff := diff.Compare(snap(oldOrder), snap(newOrder), diff.Options{CheckColumnOrder: true}).SchemaDiffs["users"]
+	if schemaDiff == nil || !schemaDiff.ColumnOrderChanged {
+		t.Fatalf("schema diff = %+v, want a column order change", schemaDiff)
+	}
+	return NewDDLGenerator(opts).Statements(schemaDiff)
+}
+
+func TestColumnReorder(t *testing.T) {
+	oldOrder := []string{"id", "name", "email", "age"}
+	newOrder := []string{"id", "email", "name", "age"}
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{name: "mysql", opts: Options{Dialect: "mysql"}, want: []string{
+			"ALTER TABLE `users` MODIFY COLUMN `name` integer NOT NULL AFTER `email`;",
+		}},
+		{name: "postgres", opts: Options{Dialect: "postgres"}, want: []string{
+			"-- WARNING: PostgreSQL cannot reorder the columns of users; rebuild the table manually or use --allow-table-rebuild",
+		}},
+		{name: "postgres rebuild", opts: Options{Dialect: "postgres", AllowTableRebuild: true}, want: []string{
+			"-- Rebuilding users to reorder its columns",
+			"CREATE TABLE \"users_dbdiff_rebuild\" (\n  \"id\" integer NOT NULL,\n  \"email\" integer NOT NULL,\n  \"name\" integer NOT NULL,\n  \"age\" integer NOT NULL,\n  PRIMARY KEY (\"id\")\n);",
+			`INSERT INTO "users_dbdiff_rebuild" ("id", "email", "name", "age") SELECT "id", "email", "name", "age" FROM "users";`,
+			`DROP TABLE "users";`,
+			`ALTER TABLE "users_dbdiff_rebuild" RENAME TO "users";`,
+			`ALTER INDEX "users_dbdiff_rebuild_pkey" RENAME TO "users_pkey";`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reorderStatements(t, tt.opts, oldOrder, newOrder); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Statements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMovedColumns(t *testing.T) {
+	tests := []struct {
+		name               string
+		oldOrder, newOrder []string
+		want               map[string]bool
+	}{
+		{name: "swap", oldOrder: []string{"a", "b", "c"}, newOrder: []string{"b", "a", "c"}, want: map[string]bool{"a": true}},
+		{name: "last to first", oldOrder: []string{"a", "b", "c", "d"}, newOrder: []string{"d", "a", "b", "c"}, want: map[string]bool{"d": true}},
+		{name: "reversed", oldOrder: []string{"a", "b", "c"}, newOrder: []string{"c", "b", "a"}, want: map[string]bool{"b": true, "a": true}},
+		{name: "unchanged", oldOrder: []string{"a", "b"}, newOrder: []string{"a", "b"}, want: map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := movedColumns(tt.oldOrder, tt.newOrder); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("movedColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
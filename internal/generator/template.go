@@ -0,0 +1,157 @@
+package generator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// Placeholder styles for Options.Placeholders
+const (
+	PlaceholderNamed      = "named"      // :column
+	PlaceholderPositional = "positional" // $1, $2 (PostgreSQL) or ? (MySQL)
+)
+
+// Value file formats, chosen by the extension of Options.ValuesFile
+const (
+	ValuesCSV  = "csv"
+	ValuesJSON = "json"
+)
+
+// TableValues holds the rows of a templated INSERT, each row's values in
+// the order of the template's columns
+type TableValues struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// ValuesFormat returns the format of a values file from its extension
+func ValuesFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ValuesCSV, nil
+	case ".json":
+		return ValuesJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported values file %q (expected a .csv or .json extension)", path)
+	}
+}
+
+// ValuesPath returns the file holding a table's values: the values file
+// with the table name before its extension, e.g. values.users.csv
+func ValuesPath(valuesFile, tableName string) string {
+	ext := filepath.Ext(valuesFile)
+	return strings.TrimSuffix(valuesFile, ext) + "." + tableName + ext
+}
+
+// templated reports whether added rows are generated as INSERT templates
+func (g *DMLGenerator) templated() bool {
+	return g.opts.Placeholders != ""
+}
+
+// generateTemplate generates a single INSERT with a placeholder per column
+// for a table's added rows, and records the rows in Options.TemplateValues
+// with their values in the same column order
+func (g *DMLGenerator) generateTemplate(tableName string, rows []schema.Row) string {
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := sortedColumns(rows[0])
+	values := &TableValues{Columns: columns}
+	for _, row := range rows {
+		tuple := make([]interface{}, len(columns))
+		for i, col := range columns {
+			tuple[i] = row[col]
+		}
+		values.Rows = append(values.Rows, tuple)
+	}
+	if g.opts.TemplateValues != nil {
+		g.opts.TemplateValues[tableName] = values
+	}
+
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = g.quoteIdentifier(col)
+		placeholders[i] = g.placeholder(col, i+1)
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
+		g.quoteIdentifier(tableName),
+		strings.Join(quoted, ", "),
+		strings.Join(placeholders, ", "),
+	)
+
+	source := fmt.Sprintf("%d rows", len(rows))
+	if g.opts.ValuesFile != "" {
+		source = fmt.Sprintf("%s (%s)", ValuesPath(g.opts.ValuesFile, tableName), source)
+	}
+	return fmt.Sprintf("-- values: %s\n%s", source, stmt)
+}
+
+// placeholder returns the parameter of the column at position (1-based) in
+// a template
+func (g *DMLGenerator) placeholder(col string, position int) string {
+	if g.opts.Placeholders == PlaceholderNamed {
+		return ":" + col
+	}
+	if g.dbType == "postgres" || g.dbType == "PostgreSQL" {
+		return fmt.Sprintf("$%d", position)
+	}
+	return "?"
+}
+
+// WriteValues writes a table's template values as CSV, with a header row
+// and \N for NULL as LOAD DATA expects (COPY needs NULL '\N'), or as a JSON
+// object of the columns and rows
+func WriteValues(w io.Writer, values *TableValues, format, dialect string) error {
+	if format == ValuesJSON {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return enc.Encode(values)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(values.Columns); err != nil {
+		return err
+	}
+	record := make([]string, len(values.Columns))
+	for _, row := range values.Rows {
+		for i, val := range row {
+			record[i] = valueText(val, dialect)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// valueText formats a value as a field of a CSV values file
+func valueText(val interface{}, dialect string) string {
+	switch v := val.(type) {
+	case nil:
+		return `\N`
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if dialect == "postgres" || dialect == "PostgreSQL" {
+			return strconv.FormatBool(v)
+		}
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
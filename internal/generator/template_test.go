@@ -0,0 +1,81 @@
+package generator
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestTemplatedInserts(t *testing.T) {
+	users := &schema.TableSchema{Name: "users", Columns: []schema.Column{
+		{Name: "id", Type: "int", Position: 1},
+		{Name: "name", Type: "varchar(50)", Position: 2},
+		{Name: "active", Type: "boolean", Position: 3},
+	}}
+	rows := []schema.Row{
+		{"id": 1, "name": "alice", "active": true},
+		{"id": 2, "name": nil, "active": false},
+	}
+	tests := []struct {
+		name      string
+		dialect   string
+		style     string
+		valuesCSV string
+		want      string
+	}{
+		{name: "named", dialect: "mysql", style: PlaceholderNamed, valuesCSV: "active,id,name\n1,1,alice\n0,2,\\N\n",
+			want: "-- values: values.users.csv (2 rows)\nINSERT INTO `users` (`active`, `id`, `name`) VALUES (:active, :id, :name);"},
+		{name: "mysql positional", dialect: "mysql", style: PlaceholderPositional, valuesCSV: "active,id,name\n1,1,alice\n0,2,\\N\n",
+			want: "-- values: values.users.csv (2 rows)\nINSERT INTO `users` (`active`, `id`, `name`) VALUES (?, ?, ?);"},
+		{name: "postgres positional", dialect: "postgres", style: PlaceholderPositional, valuesCSV: "active,id,name\ntrue,1,alice\nfalse,2,\\N\n",
+			want: "-- values: values.users.csv (2 rows)\nINSERT INTO \"users\" (\"active\", \"id\", \"name\") VALUES ($1, $2, $3);"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := make(map[string]*TableValues)
+			g := NewDMLGenerator(Options{Dialect: tt.dialect, Placeholders: tt.style, ValuesFile: "values.csv", TemplateValues: values})
+			got := g.Statements(&diff.DataDiff{TableName: "users", Schema: users, RowsAdded: rows})
+			if !reflect.DeepEqual(got, []string{tt.want}) {
+				t.Errorf("Statements() = %q, want %q", got, []string{tt.want})
+			}
+
+			// The values file lists the template's columns in the same order
+			var buf bytes.Buffer
+			if err := WriteValues(&buf, values["users"], ValuesCSV, tt.dialect); err != nil {
+				t.Fatalf("WriteValues() error = %v", err)
+			}
+			if buf.String() != tt.valuesCSV {
+				t.Errorf("values file =\n%s\nwant\n%s", buf.String(), tt.valuesCSV)
+			}
+		})
+	}
+}
+
+func TestWriteValuesJSON(t *testing.T) {
+	values := &TableValues{Columns: []string{"id", "name"}, Rows: [][]interface{}{{1, "alice"}, {2, nil}}}
+	var buf bytes.Buffer
+	if err := WriteValues(&buf, values, ValuesJSON, "mysql"); err != nil {
+		t.Fatalf("WriteValues() error = %v", err)
+	}
+	want := `{"columns":["id","name"],"rows":[[1,"alice"],[2,null]]}` + "\n"
+	if buf.String() != want {
+		t.Errorf("WriteValues() = %s, want %s", buf.String(), want)
+	}
+}
+
+func TestValuesPath(t *testing.T) {
+	if got := ValuesPath("out/values.csv", "users"); got != "out/values.users.csv" {
+		t.Errorf("ValuesPath() = %q, want out/values.users.csv", got)
+	}
+	for path, want := range map[string]string{"values.csv": ValuesCSV, "values.JSON": ValuesJSON} {
+		if got, err := ValuesFormat(path); err != nil || got != want {
+			t.Errorf("ValuesFormat(%q) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+	if _, err := ValuesFormat("values.txt"); err == nil {
+		t.Error("ValuesFormat(values.txt) error = nil, want an error")
+	}
+}
@@ -0,0 +1,137 @@
+package generator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// typeMapping maps a base type name (lowercase, without length or modifiers)
+// to its equivalent in the target dialect
+type typeMapping struct {
+	target     string
+	keepParams bool // carry over "(n)" / "(p,s)" from the source type
+}
+
+var mysqlToPostgres = map[string]typeMapping{
+	"tinyint":    {target: "smallint"},
+	"smallint":   {target: "smallint"},
+	"mediumint":  {target: "integer"},
+	"int":        {target: "integer"},
+	"integer":    {target: "integer"},
+	"bigint":     {target: "bigint"},
+	"float":      {target: "real"},
+	"double":     {target: "double precision"},
+	"decimal":    {target: "numeric", keepParams: true},
+	"numeric":    {target: "numeric", keepParams: true},
+	"date":       {target: "date"},
+	"datetime":   {target: "timestamp", keepParams: true},
+	"timestamp":  {target: "timestamp", keepParams: true},
+	"time":       {target: "time", keepParams: true},
+	"year":       {target: "smallint"},
+	"char":       {target: "char", keepParams: true},
+	"varchar":    {target: "varchar", keepParams: true},
+	"tinytext":   {target: "text"},
+	"text":       {target: "text"},
+	"mediumtext": {target: "text"},
+	"longtext":   {target: "text"},
+	"binary":     {target: "bytea"},
+	"varbinary":  {target: "bytea"},
+	"tinyblob":   {target: "bytea"},
+	"blob":       {target: "bytea"},
+	"mediumblob": {target: "bytea"},
+	"longblob":   {target: "bytea"},
+	"json":       {target: "jsonb"},
+	"bit":        {target: "bit", keepParams: true},
+}
+
+var postgresToMySQL = map[string]typeMapping{
+	"smallint":                    {target: "smallint"},
+	"integer":                     {target: "int"},
+	"bigint":                      {target: "bigint"},
+	"real":                        {target: "float"},
+	"double precision":            {target: "double"},
+	"numeric":                     {target: "decimal", keepParams: true},
+	"boolean":                     {target: "tinyint(1)"},
+	"date":                        {target: "date"},
+	"timestamp without time zone": {target: "datetime", keepParams: true},
+	"timestamp with time zone":    {target: "timestamp", keepParams: true},
+	"timestamp":                   {target: "datetime", keepParams: true},
+	"time without time zone":      {target: "time", keepParams: true},
+	"time":                        {target: "time", keepParams: true},
+	"character":                   {target: "char", keepParams: true},
+	"char":                        {target: "char", keepParams: true},
+	"character varying":           {target: "varchar", keepParams: true},
+	"varchar":                     {target: "varchar", keepParams: true},
+	"text":                        {target: "longtext"},
+	"bytea":                       {target: "longblob"},
+	"json":                        {target: "json"},
+	"jsonb":                       {target: "json"},
+	"uuid":                        {target: "char(36)"},
+}
+
+var typeParams = regexp.MustCompile(`\(([^)]*)\)`)
+
+// TranslateType maps a column type from one dialect to another. The second
+// return value is false when there is no clean mapping, in which case a
+// best-effort fallback type is returned.
+func TranslateType(columnType, from, to string) (string, bool) {
+	if from == to {
+		return columnType, true
+	}
+
+	t := strings.ToLower(strings.TrimSpace(columnType))
+	params := ""
+	if m := typeParams.FindStringSubmatch(t); m != nil {
+		params = m[1]
+	}
+	base := strings.TrimSpace(typeParams.ReplaceAllString(t, ""))
+
+	switch {
+	case from == "mysql" && to == "postgres":
+		// tinyint(1) is MySQL's boolean; unsigned and zerofill have no equivalent
+		if base == "tinyint" && params == "1" {
+			return "boolean", true
+		}
+		if base == "bit" && (params == "" || params == "1") {
+			return "boolean", true
+		}
+		base = strings.TrimSpace(strings.NewReplacer(" unsigned", "", " zerofill", "").Replace(base))
+		if strings.HasPrefix(base, "enum") || strings.HasPrefix(base, "set") {
+			return "text", false
+		}
+		// bytea has no length, so binary(16) and varbinary(16) would both
+		// lose theirs
+		if (base == "binary" || base == "varbinary") && params != "" {
+			return "bytea", false
+		}
+		return mapType(mysqlToPostgres, base, params, "text")
+
+	case from == "postgres" && to == "mysql":
+		if strings.HasSuffix(base, "[]") {
+			return "json", false
+		}
+		if base == "character varying" && params == "" {
+			return "varchar(255)", false
+		}
+		return mapType(postgresToMySQL, base, params, "longtext")
+	}
+
+	return columnType, false
+}
+
+func mapType(mappings map[string]typeMapping, base, params, fallback string) (string, bool) {
+	mapping, ok := mappings[base]
+	if !ok {
+		return fallback, false
+	}
+	if mapping.keepParams && params != "" {
+		return mapping.target + "(" + params + ")", true
+	}
+	return mapping.target, true
+}
+
+// isSequenceDefault reports whether a default value draws from a sequence
+// (a serial column in PostgreSQL)
+func isSequenceDefault(value string) bool {
+	return strings.HasPrefix(strings.ToLower(value), "nextval(")
+}
@@ -0,0 +1,26 @@
+package generator
+
+import "testing"
+
+func TestTranslateTypeKeepsLengths(t *testing.T) {
+	tests := []struct {
+		columnType string
+		from, to   string
+		want       string
+		wantOK     bool
+	}{
+		{"char(10)", "mysql", "postgres", "char(10)", true},
+		{"varchar(10)", "mysql", "postgres", "varchar(10)", true},
+		{"binary(16)", "mysql", "postgres", "bytea", false},
+		{"varbinary(16)", "mysql", "postgres", "bytea", false},
+		{"binary(16)", "mysql", "mysql", "binary(16)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.columnType+" "+tt.from+" to "+tt.to, func(t *testing.T) {
+			got, ok := TranslateType(tt.columnType, tt.from, tt.to)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("TranslateType(%q) = %q, %v, want %q, %v", tt.columnType, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
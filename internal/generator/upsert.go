@@ -0,0 +1,119 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// ParseConflictColumns parses a "table:column,column" conflict target
+// specification
+func ParseConflictColumns(spec string) (string, []string, error) {
+	tableName, list, ok := strings.Cut(spec, ":")
+	if !ok || tableName == "" || list == "" {
+		return "", nil, fmt.Errorf("invalid conflict columns %q (expected table:column[,column...])", spec)
+	}
+	columns := strings.Split(list, ",")
+	for _, column := range columns {
+		if column == "" {
+			return "", nil, fmt.Errorf("invalid conflict columns %q (expected table:column[,column...])", spec)
+		}
+	}
+	return tableName, columns, nil
+}
+
+// CheckConflictColumns verifies that each conflict target names a table of
+// the target snapshot and exactly the columns of one of its unique indexes,
+// which ON CONFLICT requires
+func CheckConflictColumns(target *snapshot.Snapshot, conflictColumns map[string][]string) error {
+	for _, tableName := range diff.SortedKeys(conflictColumns) {
+		table, ok := target.Tables[tableName]
+		if !ok {
+			return fmt.Errorf("conflict columns given for table %s which is not in the target snapshot", tableName)
+		}
+		if uniqueIndexOn(&table.Schema, conflictColumns[tableName]) == nil {
+			return fmt.Errorf("conflict columns (%s) of table %s are not the columns of a unique index",
+				strings.Join(conflictColumns[tableName], ", "), tableName)
+		}
+	}
+	return nil
+}
+
+// uniqueIndexOn returns the primary or unique index whose columns are
+// exactly columns, in any order
+func uniqueIndexOn(tableSchema *schema.TableSchema, columns []string) *schema.Index {
+	want := append([]string(nil), columns...)
+	sort.Strings(want)
+	for i := range tableSchema.Indexes {
+		idx := &tableSchema.Indexes[i]
+		if !idx.Unique && !idx.Primary {
+			continue
+		}
+		have := append([]string(nil), idx.Columns...)
+		sort.Strings(have)
+		if strings.Join(have, "\x00") == strings.Join(want, "\x00") {
+			return idx
+		}
+	}
+	return nil
+}
+
+// conflictTarget returns the columns an upsert into a table conflicts on:
+// the configured override, or else the primary key
+func (g *DMLGenerator) conflictTarget(tableName string, tableSchema *schema.TableSchema) []string {
+	if columns, ok := g.opts.ConflictColumns[tableName]; ok {
+		return columns
+	}
+	return tableSchema.PrimaryKeyColumns()
+}
+
+// upsertClause returns the clause turning an INSERT of columns into an
+// upsert, or "" when the table has no conflict target. MySQL resolves
+// ON DUPLICATE KEY against every unique key, so only PostgreSQL names
+// the target.
+func (g *DMLGenerator) upsertClause(tableName string, tableSchema *schema.TableSchema, columns []string) string {
+	target := g.conflictTarget(tableName, tableSchema)
+	if len(target) == 0 {
+		return ""
+	}
+	inTarget := make(map[string]bool, len(target))
+	for _, col := range target {
+		inTarget[col] = true
+	}
+
+	mysql := g.dbType != "postgres" && g.dbType != "PostgreSQL"
+	var updates []string
+	for _, col := range columns {
+		if inTarget[col] {
+			continue
+		}
+		quoted := g.quoteIdentifier(col)
+		if mysql {
+			updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", quoted, quoted))
+		} else {
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", quoted, quoted))
+		}
+	}
+
+	if mysql {
+		if len(updates) == 0 {
+			// Every column is part of the key; re-assigning one keeps the row
+			quoted := g.quoteIdentifier(target[0])
+			updates = append(updates, fmt.Sprintf("%s = %s", quoted, quoted))
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+
+	quotedTarget := make([]string, len(target))
+	for i, col := range target {
+		quotedTarget[i] = g.quoteIdentifier(col)
+	}
+	if len(updates) == 0 {
+		return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(quotedTarget, ", "))
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quotedTarget, ", "), strings.Join(updates, ", "))
+}
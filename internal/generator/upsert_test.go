@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// accountsSchema has a primary key id and a unique index on (tenant, email)
+func accountsSchema() *schema.TableSchema {
+	return &schema.TableSchema{
+		Name: "accounts",
+		Columns: []schema.Column{
+			{Name: "id", Type: "int", Position: 1},
+			{Name: "tenant", Type: "int", Position: 2},
+			{Name: "email", Type: "varchar(255)", Position: 3},
+		},
+		Indexes: []schema.Index{
+			{Name: "PRIMARY", Columns: []string{"id"}, Primary: true, Unique: true},
+			{Name: "idx_tenant_email", Columns: []string{"tenant", "email"}, Unique: true},
+		},
+	}
+}
+
+func TestUpsertConflictColumns(t *testing.T) {
+	tests := []struct {
+		name      string
+		dialect   string
+		conflicts map[string][]string
+		want      string
+	}{
+		{name: "postgres primary key", dialect: "postgres",
+			want: `INSERT INTO "accounts" ("email", "id", "tenant") VALUES ('a@example.com', 1, 7) ON CONFLICT ("id") DO UPDATE SET "email" = EXCLUDED."email", "tenant" = EXCLUDED."tenant";`},
+		{name: "postgres override", dialect: "postgres", conflicts: map[string][]string{"accounts": {"tenant", "email"}},
+			want: `INSERT INTO "accounts" ("email", "id", "tenant") VALUES ('a@example.com', 1, 7) ON CONFLICT ("tenant", "email") DO UPDATE SET "id" = EXCLUDED."id";`},
+		{name: "mysql override", dialect: "mysql", conflicts: map[string][]string{"accounts": {"tenant", "email"}},
+			want: "INSERT INTO `accounts` (`email`, `id`, `tenant`) VALUES ('a@example.com', 1, 7) ON DUPLICATE KEY UPDATE `id` = VALUES(`id`);"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDiff := &diff.DataDiff{TableName: "accounts", Schema: accountsSchema(), RowsAdded: []schema.Row{
+				{"id": 1, "tenant": 7, "email": "a@example.com"},
+			}}
+			g := NewDMLGenerator(Options{Dialect: tt.dialect, Upsert: true, ConflictColumns: tt.conflicts})
+			if got := g.Statements(dataDiff); !reflect.DeepEqual(got, []string{tt.want}) {
+				t.Errorf("Statements() = %q, want %q", got, []string{tt.want})
+			}
+		})
+	}
+}
+
+func TestCheckConflictColumns(t *testing.T) {
+	target := &snapshot.Snapshot{Tables: map[string]*schema.Table{"accounts": {Schema: *accountsSchema()}}}
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "unique index", spec: "accounts:email,tenant"},
+		{name: "primary key", spec: "accounts:id"},
+		{name: "not a unique index", spec: "accounts:email", wantErr: true},
+		{name: "missing table", spec: "users:id", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tableName, columns, err := ParseConflictColumns(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseConflictColumns() error = %v", err)
+			}
+			err = CheckConflictColumns(target, map[string][]string{tableName: columns})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckConflictColumns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for _, spec := range []string{"accounts", "accounts:", ":id", "accounts:id,"} {
+		if _, _, err := ParseConflictColumns(spec); err == nil {
+			t.Errorf("ParseConflictColumns(%q) error = nil, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koba/db-diff/internal/diff"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// ValidationFailure is a generated statement that failed to apply
+type ValidationFailure struct {
+	Statement string
+	Err       error
+}
+
+// execer runs a statement; *sql.Conn satisfies it
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// ValidateDDL applies the DDL for a diff to a throwaway schema on db, built
+// from the source snapshot's tables, and returns the statements that fail.
+// This catches ordering problems (e.g. dropping a column that is still
+// indexed, or altering a table that does not exist yet) as well as syntax
+// the target database rejects. A PostgreSQL schema is created in a
+// transaction that is rolled back; a MySQL database is created and dropped
+// afterwards, so the user needs the privilege to do so.
+func ValidateDDL(ctx context.Context, db *sql.DB, source *snapshot.Snapshot, result *diff.DiffResult, opts Options) ([]ValidationFailure, error) {
+	// The statements run one at a time, without client commands or guards
+	opts.Terminator = ""
+	opts.DelimiterSwitch = false
+	opts.IfExists = false
+
+	gen := NewDDLGenerator(opts)
+	var seed []string
+	for _, tableName := range diff.DependencyOrder(source) {
+		seed = append(seed, gen.CreateTableStatements(&source.Tables[tableName].Schema)...)
+	}
+	tables, deferred := tableDDL(result, opts)
+	var migration []string
+	for _, table := range tables {
+		migration = append(migration, table.sql()...)
+	}
+	migration = append(migration, deferred...)
+
+	// The schema's USE and search_path must stay on one connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a connection: %w", err)
+	}
+	defer conn.Close()
+
+	name := fmt.Sprintf("dbdiff_validate_%d", time.Now().UnixNano())
+	if gen.dbType == "postgres" || gen.dbType == "PostgreSQL" {
+		return validatePostgres(ctx, conn, name, seed, migration)
+	}
+	return validateMySQL(ctx, conn, name, seed, migration)
+}
+
+// validatePostgres applies the statements in a schema created inside a
+// transaction, rolling each failing statement back to a savepoint so that
+// the ones after it still run
+func validatePostgres(ctx context.Context, conn *sql.Conn, name string, seed, migration []string) ([]ValidationFailure, error) {
+	if _, err := conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return nil, fmt.Errorf("failed to begin validation: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+	for _, stmt := range []string{
+		fmt.Sprintf(`CREATE SCHEMA "%s"`, name),
+		fmt.Sprintf(`SET LOCAL search_path TO "%s"`, name),
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to create validation schema: %w", err)
+		}
+	}
+	return runValidation(ctx, conn, seed, migration, true)
+}
+
+// validateMySQL applies the statements in a database that is dropped
+// afterwards. MySQL commits DDL implicitly, so a failing statement leaves
+// nothing to roll back.
+func validateMySQL(ctx context.Context, conn *sql.Conn, name string, seed, migration []string) ([]ValidationFailure, error) {
+	var current sql.NullString
+	if err := conn.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&current); err != nil {
+		return nil, fmt.Errorf("failed to read the current database: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE `%s`", name)); err != nil {
+		return nil, fmt.Errorf("failed to create validation database: %w", err)
+	}
+	defer func() {
+		conn.ExecContext(context.Background(), fmt.Sprintf("DROP DATABASE `%s`", name))
+		if current.Valid {
+			conn.ExecContext(context.Background(), fmt.Sprintf("USE `%s`", current.String))
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("USE `%s`", name)); err != nil {
+		return nil, fmt.Errorf("failed to use validation database: %w", err)
+	}
+	return runValidation(ctx, conn, seed, migration, false)
+}
+
+// runValidation creates the source tables with seed, then runs each
+// migration statement and collects the ones that fail. With savepoints, a
+// failing statement is rolled back so that the transaction stays usable.
+func runValidation(ctx context.Context, db execer, seed, migration []string, savepoints bool) ([]ValidationFailure, error) {
+	for _, stmt := range seed {
+		if !hasCode(stmt) {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to create the source schema: %s: %w", firstLine(stmt), err)
+		}
+	}
+
+	var failures []ValidationFailure
+	for _, stmt := range migration {
+		if !hasCode(stmt) {
+			continue
+		}
+		if savepoints {
+			if _, err := db.ExecContext(ctx, "SAVEPOINT dbdiff_validate"); err != nil {
+				return nil, fmt.Errorf("failed to set savepoint: %w", err)
+			}
+		}
+		_, err := db.ExecContext(ctx, stmt)
+		if err == nil {
+			continue
+		}
+		failures = append(failures, ValidationFailure{Statement: stmt, Err: err})
+		if savepoints {
+			if _, err := db.ExecContext(ctx, "ROLLBACK TO SAVEPOINT dbdiff_validate"); err != nil {
+				return nil, fmt.Errorf("failed to roll back to savepoint: %w", err)
+			}
+		}
+	}
+	return failures, nil
+}
+
+// hasCode reports whether a statement has anything but "--" comments, which
+// some generated statements consist of alone
+func hasCode(stmt string) bool {
+	return firstLine(stmt) != ""
+}
+
+// firstLine returns the first line of stmt that is not a comment
+func firstLine(stmt string) string {
+	for _, line := range strings.Split(stmt, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeExecer records the statements it runs and fails those containing
+// one of fail
+type fakeExecer struct {
+	fail []string
+	ran  []string
+}
+
+func (f *fakeExecer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	f.ran = append(f.ran, query)
+	for _, s := range f.fail {
+		if strings.Contains(query, s) {
+			return nil, errors.New("failed")
+		}
+	}
+	return nil, nil
+}
+
+func TestRunValidation(t *testing.T) {
+	seed := []string{"CREATE TABLE users (id int);"}
+	migration := []string{
+		"-- WARNING: only a comment",
+		"DROP INDEX idx_email;",
+		"ALTER TABLE users ADD COLUMN email text;",
+	}
+	tests := []struct {
+		name         string
+		fail         []string
+		savepoints   bool
+		wantFailures []string
+		wantRan      []string
+		wantErr      bool
+	}{
+		{
+			name:    "all apply",
+			wantRan: []string{seed[0], migration[1], migration[2]},
+		},
+		{
+			name:         "index dropped before it exists",
+			fail:         []string{"DROP INDEX"},
+			wantFailures: []string{migration[1]},
+			wantRan:      []string{seed[0], migration[1], migration[2]},
+		},
+		{
+			name:         "savepoint rolled back after a failure",
+			fail:         []string{"DROP INDEX"},
+			savepoints:   true,
+			wantFailures: []string{migration[1]},
+			wantRan: []string{seed[0],
+				"SAVEPOINT dbdiff_validate", migration[1], "ROLLBACK TO SAVEPOINT dbdiff_validate",
+				"SAVEPOINT dbdiff_validate", migration[2]},
+		},
+		{
+			name:    "source schema fails",
+			fail:    []string{"CREATE TABLE"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeExecer{fail: tt.fail}
+			failures, err := runValidation(context.Background(), db, seed, migration, tt.savepoints)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runValidation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []string
+			for _, f := range failures {
+				got = append(got, f.Statement)
+			}
+			if !reflect.DeepEqual(got, tt.wantFailures) {
+				t.Errorf("failures = %q, want %q", got, tt.wantFailures)
+			}
+			if !reflect.DeepEqual(db.ran, tt.wantRan) {
+				t.Errorf("ran = %q, want %q", db.ran, tt.wantRan)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package integrity
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// Violation is a referencing row whose foreign key value has no matching
+// row in the referenced table
+type Violation struct {
+	Table           string
+	ForeignKey      string
+	Columns         []string
+	Values          []interface{}
+	ReferencedTable string
+}
+
+func (v Violation) String() string {
+	values := make([]string, len(v.Values))
+	for i, val := range v.Values {
+		values[i] = fmt.Sprintf("%v", val)
+	}
+	return fmt.Sprintf("%s.%s (%s) = (%s): no matching row in %s",
+		v.Table, v.ForeignKey, strings.Join(v.Columns, ", "), strings.Join(values, ", "), v.ReferencedTable)
+}
+
+// foreignKey groups the per-column ForeignKey entries of one constraint
+type foreignKey struct {
+	name              string
+	columns           []string
+	referencedTable   string
+	referencedColumns []string
+}
+
+// CheckForeignKeys verifies that every foreign key value in the snapshot
+// refers to a row present in the referenced table. Foreign keys whose
+// referenced table is not part of the snapshot are returned in skipped.
+func CheckForeignKeys(snap *snapshot.Snapshot) (violations []Violation, skipped []string) {
+	tableNames := make([]string, 0, len(snap.Tables))
+	for name := range snap.Tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+
+	for _, tableName := range tableNames {
+		table := snap.Tables[tableName]
+		for _, fk := range groupForeignKeys(&table.Schema) {
+			referenced, ok := snap.Tables[fk.referencedTable]
+			if !ok {
+				skipped = append(skipped, fmt.Sprintf("%s.%s (table %s not in snapshot)", tableName, fk.name, fk.referencedTable))
+				continue
+			}
+
+			existing := make(map[string]bool)
+			for _, row := range referenced.Data {
+				existing[valueKey(row, fk.referencedColumns)] = true
+			}
+
+			for _, row := range table.Data {
+				values, ok := fkValues(row, fk.columns)
+				if !ok {
+					continue // a NULL in any column means the constraint doesn't apply
+				}
+				if !existing[valueKey(row, fk.columns)] {
+					violations = append(violations, Violation{
+						Table:           tableName,
+						ForeignKey:      fk.name,
+						Columns:         fk.columns,
+						Values:          values,
+						ReferencedTable: fk.referencedTable,
+					})
+				}
+			}
+		}
+	}
+
+	return violations, skipped
+}
+
+func groupForeignKeys(tableSchema *schema.TableSchema) []*foreignKey {
+	var fks []*foreignKey
+	byName := make(map[string]*foreignKey)
+	for _, fk := range tableSchema.ForeignKeys {
+		group, ok := byName[fk.Name]
+		if !ok {
+			group = &foreignKey{name: fk.Name, referencedTable: fk.ReferencedTable}
+			byName[fk.Name] = group
+			fks = append(fks, group)
+		}
+		group.columns = append(group.columns, fk.Column)
+		group.referencedColumns = append(group.referencedColumns, fk.ReferencedColumn)
+	}
+	return fks
+}
+
+func fkValues(row schema.Row, columns []string) ([]interface{}, bool) {
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		if row[col] == nil {
+			return nil, false
+		}
+		values[i] = row[col]
+	}
+	return values, true
+}
+
+// valueKey builds a comparable key from column values, matching by value
+// rather than by column name so referencing and referenced rows line up
+func valueKey(row schema.Row, columns []string) string {
+	values := make([]string, len(columns))
+	for i, col := range columns {
+		b, err := json.Marshal(row[col])
+		if err != nil {
+			b = []byte(fmt.Sprintf("%v", row[col]))
+		}
+		values[i] = string(b)
+	}
+	return strings.Join(values, "\x00")
+}
@@ -0,0 +1,64 @@
+package integrity
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestCheckForeignKeys(t *testing.T) {
+	users := &schema.Table{
+		Schema: schema.TableSchema{Name: "users", Columns: []schema.Column{{Name: "id", Type: "int"}}},
+		Data:   []schema.Row{{"id": int64(1)}, {"id": int64(2)}},
+	}
+	orders := &schema.Table{
+		Schema: schema.TableSchema{
+			Name:    "orders",
+			Columns: []schema.Column{{Name: "id", Type: "int"}, {Name: "user_id", Type: "int"}, {Name: "coupon_id", Type: "int"}},
+			ForeignKeys: []schema.ForeignKey{
+				{Name: "fk_orders_user", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+				{Name: "fk_orders_coupon", Column: "coupon_id", ReferencedTable: "coupons", ReferencedColumn: "id"},
+			},
+		},
+		Data: []schema.Row{
+			{"id": int64(10), "user_id": int64(1), "coupon_id": nil},
+			{"id": int64(11), "user_id": int64(3), "coupon_id": nil},
+			{"id": int64(12), "user_id": nil, "coupon_id": int64(5)},
+		},
+	}
+	snap := &snapshot.Snapshot{Tables: map[string]*schema.Table{"users": users, "orders": orders}}
+
+	violations, skipped := CheckForeignKeys(snap)
+	want := []Violation{{Table: "orders", ForeignKey: "fk_orders_user", Columns: []string{"user_id"}, Values: []interface{}{int64(3)}, ReferencedTable: "users"}}
+	if !reflect.DeepEqual(violations, want) {
+		t.Errorf("violations = %+v, want %+v", violations, want)
+	}
+	if want := []string{"orders.fk_orders_coupon (table coupons not in snapshot)"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped = %q, want %q", skipped, want)
+	}
+	if got, want := violations[0].String(), "orders.fk_orders_user (user_id) = (3): no matching row in users"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckForeignKeysComposite(t *testing.T) {
+	regions := &schema.Table{
+		Schema: schema.TableSchema{Name: "regions"},
+		Data:   []schema.Row{{"country": "jp", "code": "13"}},
+	}
+	offices := &schema.Table{
+		Schema: schema.TableSchema{Name: "offices", ForeignKeys: []schema.ForeignKey{
+			{Name: "fk_offices_region", Column: "country", ReferencedTable: "regions", ReferencedColumn: "country"},
+			{Name: "fk_offices_region", Column: "region", ReferencedTable: "regions", ReferencedColumn: "code"},
+		}},
+		Data: []schema.Row{{"country": "jp", "region": "13"}, {"country": "jp", "region": "27"}},
+	}
+	snap := &snapshot.Snapshot{Tables: map[string]*schema.Table{"regions": regions, "offices": offices}}
+
+	violations, _ := CheckForeignKeys(snap)
+	if len(violations) != 1 || !reflect.DeepEqual(violations[0].Values, []interface{}{"jp", "27"}) {
+		t.Errorf("violations = %+v, want (jp, 27)", violations)
+	}
+}
@@ -0,0 +1,103 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+// Rules configures the naming conventions to check. Empty prefixes disable
+// the corresponding check.
+type Rules struct {
+	IndexPrefix string // required prefix for non-primary indexes, e.g. "idx_"
+	FKPrefix    string // required prefix for foreign keys, e.g. "fk_"
+	SnakeCase   bool   // require lower snake_case table, column, index and FK names
+}
+
+// Violation is a single naming-convention violation
+type Violation struct {
+	Table   string
+	Kind    string // table, column, index or foreign key
+	Name    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s %s %s", v.Table, v.Kind, v.Name, v.Message)
+}
+
+var snakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// Check scans a snapshot's schemas and returns the naming violations,
+// ordered by table name
+func Check(snap *snapshot.Snapshot, rules Rules) []Violation {
+	tableNames := make([]string, 0, len(snap.Tables))
+	for name := range snap.Tables {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+
+	var violations []Violation
+	for _, tableName := range tableNames {
+		violations = append(violations, checkTable(&snap.Tables[tableName].Schema, rules)...)
+	}
+	return violations
+}
+
+func checkTable(tableSchema *schema.TableSchema, rules Rules) []Violation {
+	var violations []Violation
+	add := func(kind, name, message string) {
+		violations = append(violations, Violation{Table: tableSchema.Name, Kind: kind, Name: name, Message: message})
+	}
+
+	if rules.SnakeCase && !snakeCase.MatchString(tableSchema.Name) {
+		add("table", tableSchema.Name, "is not snake_case")
+	}
+
+	for _, col := range tableSchema.Columns {
+		if rules.SnakeCase && !snakeCase.MatchString(col.Name) {
+			add("column", col.Name, "is not snake_case")
+		}
+	}
+
+	// MySQL creates an index named after each foreign key; those follow the FK rule
+	fkNames := make(map[string]bool)
+	for _, fk := range tableSchema.ForeignKeys {
+		fkNames[fk.Name] = true
+	}
+
+	indexes := append([]schema.Index(nil), tableSchema.Indexes...)
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	for _, idx := range indexes {
+		if idx.Primary || fkNames[idx.Name] {
+			continue
+		}
+		if rules.IndexPrefix != "" && !strings.HasPrefix(idx.Name, rules.IndexPrefix) {
+			add("index", idx.Name, fmt.Sprintf("is not prefixed with %q", rules.IndexPrefix))
+		}
+		if rules.SnakeCase && !snakeCase.MatchString(idx.Name) {
+			add("index", idx.Name, "is not snake_case")
+		}
+	}
+
+	// A composite foreign key appears once per column; report it once
+	seen := make(map[string]bool)
+	for _, fk := range tableSchema.ForeignKeys {
+		if seen[fk.Name] {
+			continue
+		}
+		seen[fk.Name] = true
+		if rules.FKPrefix != "" && !strings.HasPrefix(fk.Name, rules.FKPrefix) {
+			add("foreign key", fk.Name, fmt.Sprintf("is not prefixed with %q", rules.FKPrefix))
+		}
+		if rules.SnakeCase && !snakeCase.MatchString(fk.Name) {
+			add("foreign key", fk.Name, "is not snake_case")
+		}
+	}
+
+	return violations
+}
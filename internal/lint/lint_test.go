@@ -0,0 +1,66 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+	"github.com/koba/db-diff/internal/snapshot"
+)
+
+func TestCheck(t *testing.T) {
+	rules := Rules{IndexPrefix: "idx_", FKPrefix: "fk_", SnakeCase: true}
+	snap := func(tableSchema schema.TableSchema) *snapshot.Snapshot {
+		return &snapshot.Snapshot{Tables: map[string]*schema.Table{tableSchema.Name: {Schema: tableSchema}}}
+	}
+	tests := []struct {
+		name   string
+		schema schema.TableSchema
+		want   []Violation
+	}{
+		{
+			name: "clean",
+			schema: schema.TableSchema{
+				Name:        "orders",
+				Columns:     []schema.Column{{Name: "id"}, {Name: "user_id"}},
+				Indexes:     []schema.Index{{Name: "PRIMARY", Primary: true}, {Name: "idx_user_id"}, {Name: "fk_orders_user"}},
+				ForeignKeys: []schema.ForeignKey{{Name: "fk_orders_user", Column: "user_id"}},
+			},
+		},
+		{
+			name: "violations",
+			schema: schema.TableSchema{
+				Name:    "OrderItems",
+				Columns: []schema.Column{{Name: "id"}, {Name: "orderId"}},
+				Indexes: []schema.Index{{Name: "order_idx"}},
+				ForeignKeys: []schema.ForeignKey{
+					{Name: "orders_fkey", Column: "order_id"},
+					{Name: "orders_fkey", Column: "order_line"},
+				},
+			},
+			want: []Violation{
+				{Table: "OrderItems", Kind: "table", Name: "OrderItems", Message: "is not snake_case"},
+				{Table: "OrderItems", Kind: "column", Name: "orderId", Message: "is not snake_case"},
+				{Table: "OrderItems", Kind: "index", Name: "order_idx", Message: `is not prefixed with "idx_"`},
+				{Table: "OrderItems", Kind: "foreign key", Name: "orders_fkey", Message: `is not prefixed with "fk_"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Check(snap(tt.schema), rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDisabledRules(t *testing.T) {
+	snap := &snapshot.Snapshot{Tables: map[string]*schema.Table{"Users": {Schema: schema.TableSchema{
+		Name:    "Users",
+		Indexes: []schema.Index{{Name: "email_index"}},
+	}}}}
+	if got := Check(snap, Rules{}); len(got) != 0 {
+		t.Errorf("Check() = %v, want no violations", got)
+	}
+}
@@ -0,0 +1,84 @@
+// Package memguard watches the memory the process has obtained from the OS
+// so a command can stop with an actionable error instead of being killed by
+// the OOM killer.
+package memguard
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultInterval is how often memory is sampled
+const DefaultInterval = 200 * time.Millisecond
+
+// Guard samples memory use in a background goroutine
+type Guard struct {
+	limit      uint64
+	onExceeded func(inUse uint64)
+	peak       atomic.Uint64
+	stop       chan struct{}
+	done       chan struct{}
+	once       sync.Once
+}
+
+// Start begins sampling memory use every interval. When limit (in bytes) is
+// non-zero and exceeded, onExceeded is called once with the usage and
+// sampling stops; it is expected to abort the command.
+func Start(limit uint64, interval time.Duration, onExceeded func(inUse uint64)) *Guard {
+	g := &Guard{
+		limit:      limit,
+		onExceeded: onExceeded,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go g.run(interval)
+	return g
+}
+
+func (g *Guard) run(interval time.Duration) {
+	defer close(g.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if inUse := g.sample(); g.limit > 0 && inUse > g.limit {
+			g.onExceeded(inUse)
+			return
+		}
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample records and returns the memory currently held from the OS: what the
+// runtime obtained minus what it has returned, which tracks the resident set
+// of a Go process closely
+func (g *Guard) sample() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	inUse := m.Sys - m.HeapReleased
+	for {
+		peak := g.peak.Load()
+		if inUse <= peak || g.peak.CompareAndSwap(peak, inUse) {
+			return inUse
+		}
+	}
+}
+
+// Stop stops sampling, taking a final sample so Peak covers the whole run
+func (g *Guard) Stop() {
+	g.once.Do(func() {
+		close(g.stop)
+		<-g.done
+		g.sample()
+	})
+}
+
+// Peak returns the highest memory use sampled
+func (g *Guard) Peak() uint64 {
+	return g.peak.Load()
+}
@@ -1,5 +1,11 @@
 package schema
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 // Column represents a database column
 type Column struct {
 	Name          string  `json:"name"`
@@ -8,6 +14,33 @@ type Column struct {
 	DefaultValue  *string `json:"default_value,omitempty"`
 	AutoIncrement bool    `json:"auto_increment"`
 	Position      int     `json:"position"`
+	Collation     string  `json:"collation,omitempty"`
+	Identity      string  `json:"identity,omitempty"` // ALWAYS or BY DEFAULT for identity columns
+	// Generated is the expression of a generated column, whose values the
+	// database computes; Stored is set when they are stored rather than
+	// computed when read (VIRTUAL)
+	Generated string `json:"generated,omitempty"`
+	Stored    bool   `json:"stored,omitempty"`
+}
+
+// CollationsEqual reports whether two column collations are the same, where
+// "" is the default collation. With legacy, for snapshots taken before MySQL
+// collations were captured, a collation missing on one side is not a
+// difference.
+func CollationsEqual(a, b string, legacy bool) bool {
+	if legacy && (a == "" || b == "") {
+		return true
+	}
+	return a == b
+}
+
+// DefaultsEqual reports whether two column defaults are the same, where nil
+// is no default
+func DefaultsEqual(a, b *string) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	return a == nil || *a == *b
 }
 
 // Index represents a database index
@@ -17,6 +50,14 @@ type Index struct {
 	Unique   bool     `json:"unique"`
 	Primary  bool     `json:"primary"`
 	Type     string   `json:"type"` // e.g., BTREE, HASH
+	// Descending parallels Columns and marks columns indexed in descending
+	// order; it is omitted when every column is ascending
+	Descending []bool `json:"descending,omitempty"`
+	// Clustered is set when the table's rows are physically ordered by this
+	// index (PostgreSQL CLUSTER)
+	Clustered bool `json:"clustered,omitempty"`
+	// Comment is the index's COMMENT ON INDEX text (PostgreSQL)
+	Comment string `json:"comment,omitempty"`
 }
 
 // ForeignKey represents a foreign key constraint
@@ -27,6 +68,18 @@ type ForeignKey struct {
 	ReferencedColumn string `json:"referenced_column"`
 	OnDelete         string `json:"on_delete"` // CASCADE, SET NULL, etc.
 	OnUpdate         string `json:"on_update"`
+	Comment          string `json:"comment,omitempty"` // COMMENT ON CONSTRAINT text (PostgreSQL)
+	// DEFERRABLE constraint state (PostgreSQL)
+	Deferrable        bool `json:"deferrable,omitempty"`
+	InitiallyDeferred bool `json:"initially_deferred,omitempty"`
+	// NotValid is set for a constraint added NOT VALID whose existing rows
+	// have not been checked yet (PostgreSQL)
+	NotValid bool `json:"not_valid,omitempty"`
+}
+
+// IsDescending reports whether the i-th index column is in descending order
+func (idx *Index) IsDescending(i int) bool {
+	return i < len(idx.Descending) && idx.Descending[i]
 }
 
 // TableSchema represents a complete table schema
@@ -35,6 +88,120 @@ type TableSchema struct {
 	Columns     []Column     `json:"columns"`
 	Indexes     []Index      `json:"indexes"`
 	ForeignKeys []ForeignKey `json:"foreign_keys"`
+
+	// AutoIncrement is the next value the table's auto-increment column or
+	// sequence will produce (0: none, or not captured)
+	AutoIncrement int64 `json:"auto_increment,omitempty"`
+
+	// SystemVersioning is set for system-versioned (temporal) tables
+	SystemVersioning *SystemVersioning `json:"system_versioning,omitempty"`
+
+	// Rules are the rewrite rules defined on the table (PostgreSQL)
+	Rules []Rule `json:"rules,omitempty"`
+
+	// Checks are the table's CHECK constraints
+	Checks []CheckConstraint `json:"checks,omitempty"`
+
+	// Partitioning is set for partitioned tables
+	Partitioning *Partitioning `json:"partitioning,omitempty"`
+}
+
+// Partitioning describes how a partitioned table divides its rows
+type Partitioning struct {
+	Method     string      `json:"method"`     // RANGE, LIST, HASH (MySQL also KEY, RANGE COLUMNS, LIST COLUMNS)
+	Expression string      `json:"expression"` // the partition key
+	Partitions []Partition `json:"partitions,omitempty"`
+}
+
+// Partition is one partition of a partitioned table
+type Partition struct {
+	Name string `json:"name"`
+	// Bound is the partition's boundary clause, e.g. "FOR VALUES FROM (1)
+	// TO (100)" (PostgreSQL) or "VALUES LESS THAN (100)" (MySQL); empty for
+	// HASH and KEY partitions in MySQL
+	Bound string `json:"bound,omitempty"`
+}
+
+// Validate checks that the schema is consistent: indexes and foreign keys
+// refer to columns of the table, every index has columns, and there is at
+// most one primary index. All problems found are returned joined.
+func (ts *TableSchema) Validate() error {
+	columns := make(map[string]bool, len(ts.Columns))
+	for _, col := range ts.Columns {
+		columns[col.Name] = true
+	}
+
+	var errs []error
+	primaries := 0
+	for _, idx := range ts.Indexes {
+		if idx.Primary {
+			primaries++
+		}
+		if len(idx.Columns) == 0 {
+			errs = append(errs, fmt.Errorf("table %s: index %s has no columns", ts.Name, idx.Name))
+		}
+		for _, col := range idx.Columns {
+			if !columns[col] {
+				errs = append(errs, fmt.Errorf("table %s: index %s refers to missing column %s", ts.Name, idx.Name, col))
+			}
+		}
+	}
+	if primaries > 1 {
+		errs = append(errs, fmt.Errorf("table %s: %d primary indexes", ts.Name, primaries))
+	}
+	for _, fk := range ts.ForeignKeys {
+		if !columns[fk.Column] {
+			errs = append(errs, fmt.Errorf("table %s: foreign key %s refers to missing column %s", ts.Name, fk.Name, fk.Column))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Rule represents a rewrite rule (PostgreSQL CREATE RULE)
+type Rule struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"` // the complete CREATE RULE statement
+}
+
+// CheckConstraint represents a CHECK constraint
+type CheckConstraint struct {
+	Name        string `json:"name"`
+	Expression  string `json:"expression"`             // the condition, without CHECK and its parentheses
+	NotValid    bool   `json:"not_valid,omitempty"`    // added NOT VALID and not validated yet (PostgreSQL)
+	NotEnforced bool   `json:"not_enforced,omitempty"` // declared NOT ENFORCED, so rows are not checked (MySQL)
+}
+
+// MaterializedView represents a materialized view and its indexes (PostgreSQL)
+type MaterializedView struct {
+	Name       string  `json:"name"`
+	Definition string  `json:"definition"` // the query the view is populated from
+	Indexes    []Index `json:"indexes,omitempty"`
+}
+
+// PrimaryKeyColumns returns the columns of the table's primary key, or nil
+// when it has none
+func (ts *TableSchema) PrimaryKeyColumns() []string {
+	if ts == nil {
+		return nil
+	}
+	for _, idx := range ts.Indexes {
+		if idx.Primary {
+			return idx.Columns
+		}
+	}
+	return nil
+}
+
+// SystemVersioning describes the PERIOD FOR SYSTEM_TIME of a table whose
+// past row versions the database keeps automatically (MariaDB)
+type SystemVersioning struct {
+	PeriodStart string `json:"period_start"` // GENERATED ALWAYS AS ROW START column
+	PeriodEnd   string `json:"period_end"`   // GENERATED ALWAYS AS ROW END column
+}
+
+// IsPeriodColumn reports whether a column is maintained by system versioning
+func (v *SystemVersioning) IsPeriodColumn(name string) bool {
+	return v != nil && (name == v.PeriodStart || name == v.PeriodEnd)
 }
 
 // Row represents a single row of data
@@ -45,3 +212,14 @@ type Table struct {
 	Schema TableSchema
 	Data   []Row
 }
+
+// BaseType returns a column type without its parameters, in lower case,
+// e.g. "varchar" for "VARCHAR(255)". It is the key used to look up
+// per-type serializers and formatters.
+func BaseType(columnType string) string {
+	t := strings.ToLower(strings.TrimSpace(columnType))
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	return t
+}
@@ -0,0 +1,86 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrimaryKeyColumns(t *testing.T) {
+	tests := []struct {
+		name  string
+		table *TableSchema
+		want  []string
+	}{
+		{name: "nil schema"},
+		{name: "no primary key", table: &TableSchema{Indexes: []Index{{Name: "idx_email", Columns: []string{"email"}, Unique: true}}}},
+		{name: "single column", table: &TableSchema{Indexes: []Index{{Name: "idx_email", Columns: []string{"email"}}, {Name: "PRIMARY", Columns: []string{"id"}, Primary: true}}}, want: []string{"id"}},
+		{name: "composite", table: &TableSchema{Indexes: []Index{{Name: "PRIMARY", Columns: []string{"order_id", "line"}, Primary: true}}}, want: []string{"order_id", "line"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.table.PrimaryKeyColumns(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PrimaryKeyColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultsEqual(t *testing.T) {
+	zero, otherZero, one := "0", "0", "1"
+	tests := []struct {
+		name string
+		a, b *string
+		want bool
+	}{
+		{name: "both none", want: true},
+		{name: "default added", b: &zero, want: false},
+		{name: "same value", a: &zero, b: &otherZero, want: true},
+		{name: "value changed", a: &zero, b: &one, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultsEqual(tt.a, tt.b); got != tt.want {
+				t.Errorf("DefaultsEqual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	table := func(indexes []Index, fks []ForeignKey) *TableSchema {
+		return &TableSchema{
+			Name:        "orders",
+			Columns:     []Column{{Name: "id"}, {Name: "user_id"}},
+			Indexes:     indexes,
+			ForeignKeys: fks,
+		}
+	}
+	pk := Index{Name: "PRIMARY", Columns: []string{"id"}, Primary: true, Unique: true}
+	tests := []struct {
+		name  string
+		table *TableSchema
+		want  string
+	}{
+		{name: "valid", table: table([]Index{pk, {Name: "idx_user", Columns: []string{"user_id"}}}, []ForeignKey{{Name: "fk_user", Column: "user_id"}})},
+		{name: "index on missing column", table: table([]Index{pk, {Name: "idx_total", Columns: []string{"total"}}}, nil),
+			want: "table orders: index idx_total refers to missing column total"},
+		{name: "index without columns", table: table([]Index{{Name: "PRIMARY", Primary: true}}, nil),
+			want: "table orders: index PRIMARY has no columns"},
+		{name: "two primary indexes", table: table([]Index{pk, {Name: "pkey", Columns: []string{"user_id"}, Primary: true}}, nil),
+			want: "table orders: 2 primary indexes"},
+		{name: "foreign key on missing column", table: table([]Index{pk}, []ForeignKey{{Name: "fk_shop", Column: "shop_id"}}),
+			want: "table orders: foreign key fk_shop refers to missing column shop_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.table.Validate()
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
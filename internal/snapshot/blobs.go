@@ -0,0 +1,125 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// FormatVersion is the storage format CreateSnapshot writes. Snapshots
+// without a format_version metadata entry are version 1; version 2 added the
+// blobs table for large values stored outside the row JSON.
+const FormatVersion = 2
+
+// incrementalFormatVersion is the storage format of incremental snapshots,
+// which add tombstones of deleted rows. Full snapshots keep FormatVersion,
+// so versions of dbdiff without incremental snapshots can still read them.
+const incrementalFormatVersion = 3
+
+// blobRefKey marks a row value stored in the blobs table. The value is
+// replaced by {"$blob": "<sha256>"}, which drivers never produce themselves.
+const blobRefKey = "$blob"
+
+// externalizeBlobs moves string values longer than threshold bytes into the
+// blobs table and returns the row with references in their place. Identical
+// values are stored once. The input row is not modified.
+func externalizeBlobs(stmt *sql.Stmt, row schema.Row, threshold int) (schema.Row, error) {
+	var out schema.Row
+	for col, val := range row {
+		s, ok := val.(string)
+		if !ok || len(s) <= threshold {
+			continue
+		}
+
+		sum := sha256.Sum256([]byte(s))
+		hash := hex.EncodeToString(sum[:])
+		if _, err := stmt.Exec(hash, []byte(s)); err != nil {
+			return nil, fmt.Errorf("failed to store blob: %w", err)
+		}
+
+		if out == nil {
+			out = make(schema.Row, len(row))
+			for k, v := range row {
+				out[k] = v
+			}
+		}
+		out[col] = map[string]interface{}{blobRefKey: hash}
+	}
+	if out == nil {
+		return row, nil
+	}
+	return out, nil
+}
+
+// blobResolver replaces blob references in loaded rows with the stored
+// values, caching each blob so duplicates are read once
+type blobResolver struct {
+	db    *sql.DB
+	cache map[string]string
+}
+
+func newBlobResolver(db *sql.DB) *blobResolver {
+	return &blobResolver{db: db, cache: make(map[string]string)}
+}
+
+func (r *blobResolver) resolve(row schema.Row) error {
+	for col, val := range row {
+		ref, ok := val.(map[string]interface{})
+		if !ok || len(ref) != 1 {
+			continue
+		}
+		hash, ok := ref[blobRefKey].(string)
+		if !ok {
+			continue
+		}
+
+		data, cached := r.cache[hash]
+		if !cached {
+			var b []byte
+			if err := r.db.QueryRow("SELECT data FROM blobs WHERE hash = ?", hash).Scan(&b); err != nil {
+				return fmt.Errorf("failed to read blob %s of column %s: %w", hash, col, err)
+			}
+			data = string(b)
+			r.cache[hash] = data
+		}
+		row[col] = data
+	}
+	return nil
+}
+
+// formatVersion returns the storage format version recorded in metadata
+func formatVersion(metadata map[string]string) (int, error) {
+	v, ok := metadata["format_version"]
+	if !ok {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid snapshot format version %q", v)
+	}
+	return version, nil
+}
+
+// supportedFormatVersion returns the storage format version recorded in
+// metadata, or an error when it is newer than this version can read
+func supportedFormatVersion(metadata map[string]string) (int, error) {
+	version, err := formatVersion(metadata)
+	if err != nil {
+		return 0, err
+	}
+	if version > incrementalFormatVersion {
+		return 0, fmt.Errorf("snapshot format version %d is newer than supported (%d), upgrade dbdiff", version, incrementalFormatVersion)
+	}
+	return version, nil
+}
+
+// blobThreshold returns the threshold a snapshot's blobs were stored with
+// (0: blobs are inlined)
+func blobThreshold(metadata map[string]string) int {
+	threshold, _ := strconv.Atoi(metadata["blob_threshold"])
+	return threshold
+}
@@ -0,0 +1,43 @@
+package snapshot
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCreateSnapshotBlobs(t *testing.T) {
+	large := strings.Repeat("x", 1024)
+	other := strings.Repeat("y", 1024)
+	values := []string{large, "short", large, other}
+
+	db := newFakeDatabase(map[string][]string{"documents": values})
+	path := filepath.Join(t.TempDir(), "snap.db")
+	if err := CreateSnapshot(context.Background(), db, path, Options{BlobThreshold: 100}); err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+
+	snapshotDB, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshotDB.Close()
+	var blobs int
+	if err := snapshotDB.QueryRow("SELECT COUNT(*) FROM blobs").Scan(&blobs); err != nil {
+		t.Fatal(err)
+	}
+	if blobs != 2 {
+		t.Errorf("blobs = %d, want 2 (duplicates stored once)", blobs)
+	}
+
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	if got := tableValues(t, snap, "documents"); !reflect.DeepEqual(got, values) {
+		t.Errorf("documents rows differ after the round trip")
+	}
+}
@@ -0,0 +1,121 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// hashedPrefix marks, in metadata, the columns of a table stored as hashes
+const hashedPrefix = "hashed_columns."
+
+// ParseHashColumns parses a "table:column,column" hashed column specification
+func ParseHashColumns(spec string) (string, []string, error) {
+	tableName, list, ok := strings.Cut(spec, ":")
+	if !ok || tableName == "" || list == "" {
+		return "", nil, fmt.Errorf("invalid hash columns %q (expected table:column[,column...])", spec)
+	}
+	columns := strings.Split(list, ",")
+	for _, column := range columns {
+		if column == "" {
+			return "", nil, fmt.Errorf("invalid hash columns %q (expected table:column[,column...])", spec)
+		}
+	}
+	return tableName, columns, nil
+}
+
+// HashValue returns the salted SHA-256 of a value, so that equal values
+// hashed with the same salt compare equal without the value being stored
+func HashValue(salt string, value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode value: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte(salt+"\x00"), encoded...))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// saltID identifies a salt in metadata without revealing it
+func saltID(salt string) string {
+	sum := sha256.Sum256([]byte("dbdiff-hash-salt\x00" + salt))
+	return hex.EncodeToString(sum[:8])
+}
+
+// rowHasher returns a function replacing the values of columns in a row
+// with their hashes. NULL stays NULL, so a value being set or cleared is
+// still visible.
+func rowHasher(tableSchema *schema.TableSchema, columns []string, salt string) (func(schema.Row) error, error) {
+	for _, column := range columns {
+		if !hasColumn(tableSchema, column) {
+			return nil, fmt.Errorf("hash column %s not found in table %s", column, tableSchema.Name)
+		}
+	}
+	return func(row schema.Row) error {
+		for _, column := range columns {
+			if row[column] == nil {
+				continue
+			}
+			hashed, err := HashValue(salt, row[column])
+			if err != nil {
+				return fmt.Errorf("failed to hash %s.%s: %w", tableSchema.Name, column, err)
+			}
+			row[column] = hashed
+		}
+		return nil
+	}, nil
+}
+
+// HashedColumns returns the columns of a table stored as hashes
+func (s *Snapshot) HashedColumns(tableName string) []string {
+	if columns := s.Metadata[hashedPrefix+tableName]; columns != "" {
+		return strings.Split(columns, ",")
+	}
+	return nil
+}
+
+// CheckHashCompatible verifies that two snapshots can be compared: both
+// must hash the same columns of the tables they share, with the same salt
+func CheckHashCompatible(snap1, snap2 *Snapshot) error {
+	id1, id2 := snap1.Metadata["hash_salt_id"], snap2.Metadata["hash_salt_id"]
+	if id1 != "" && id2 != "" && id1 != id2 {
+		return fmt.Errorf("snapshots were hashed with different salts and cannot be compared")
+	}
+
+	var names []string
+	for name := range snap1.Tables {
+		if _, ok := snap2.Tables[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		columns1 := snap1.Metadata[hashedPrefix+name]
+		columns2 := snap2.Metadata[hashedPrefix+name]
+		if columns1 != columns2 {
+			return fmt.Errorf("table %s has hashed columns [%s] in one snapshot and [%s] in the other", name, columns1, columns2)
+		}
+	}
+	return nil
+}
+
+// CheckUnhashed verifies that no table of a snapshot stores hashed columns:
+// SQL generated from it would write the hashes as values and match rows on
+// them
+func CheckUnhashed(snap *Snapshot) error {
+	var keys []string
+	for key := range snap.Metadata {
+		if strings.HasPrefix(key, hashedPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	return fmt.Errorf("table %s has hashed columns [%s]; SQL cannot be generated from a snapshot with hashed columns", strings.TrimPrefix(keys[0], hashedPrefix), snap.Metadata[keys[0]])
+}
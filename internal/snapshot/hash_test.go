@@ -0,0 +1,51 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestCheckUnhashed(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		wantErr  bool
+	}{
+		{"no metadata", map[string]string{}, false},
+		{"unrelated metadata", map[string]string{"db_type": "mysql"}, false},
+		{"hashed columns", map[string]string{hashedPrefix + "users": "email", "hash_salt_id": "abcd"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap := &Snapshot{Metadata: tt.metadata, Tables: map[string]*schema.Table{}}
+			if err := CheckUnhashed(snap); (err != nil) != tt.wantErr {
+				t.Errorf("CheckUnhashed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckHashCompatible(t *testing.T) {
+	users := map[string]*schema.Table{"users": {Schema: schema.TableSchema{Name: "users"}}}
+	tests := []struct {
+		name      string
+		metadata1 map[string]string
+		metadata2 map[string]string
+		wantErr   bool
+	}{
+		{"neither hashed", map[string]string{}, map[string]string{}, false},
+		{"same columns and salt", map[string]string{hashedPrefix + "users": "email", "hash_salt_id": "a"}, map[string]string{hashedPrefix + "users": "email", "hash_salt_id": "a"}, false},
+		{"different salts", map[string]string{"hash_salt_id": "a"}, map[string]string{"hash_salt_id": "b"}, true},
+		{"hashed in one only", map[string]string{hashedPrefix + "users": "email"}, map[string]string{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap1 := &Snapshot{Metadata: tt.metadata1, Tables: users}
+			snap2 := &Snapshot{Metadata: tt.metadata2, Tables: users}
+			if err := CheckHashCompatible(snap1, snap2); (err != nil) != tt.wantErr {
+				t.Errorf("CheckHashCompatible() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
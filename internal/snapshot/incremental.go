@@ -0,0 +1,392 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// Metadata keys of an incremental snapshot: the path of the snapshot it
+// holds the changes to, relative to its own directory unless absolute, and
+// that snapshot's creation time and generation when it was taken, to
+// detect a base that was replaced or rebased since
+const (
+	baseKey           = "base"
+	baseCreatedAtKey  = "base_created_at"
+	baseGenerationKey = "base_generation"
+)
+
+// generationKey counts the times a snapshot's rows were rewritten in place
+// by Rebase (absent: never)
+const generationKey = "generation"
+
+// An incremental snapshot stores every table's schema, but only the rows of
+// a table that changed since its base. Rows added or modified are stored as
+// in a full snapshot; a row deleted is stored as a tombstone, a table_data
+// row with deleted = 1 whose row_json holds just the primary key values.
+// Tables with no primary key, a primary key other than the base's, or no
+// counterpart in the base are stored in full.
+
+// Base returns the path of the snapshot an incremental snapshot is based
+// on, or "" for a full snapshot
+func (s *Snapshot) Base() string {
+	return s.Metadata[baseKey]
+}
+
+// deltaKey returns the primary key that identifies a table's rows in an
+// incremental snapshot, or nil when the table is stored in full.
+// baseSchema is the table's schema in the base, nil when the base lacks
+// the table.
+func deltaKey(baseSchema, tableSchema *schema.TableSchema) []string {
+	if baseSchema == nil {
+		return nil
+	}
+	pkColumns := tableSchema.PrimaryKeyColumns()
+	basePK := baseSchema.PrimaryKeyColumns()
+	if len(pkColumns) == 0 || len(pkColumns) != len(basePK) {
+		return nil
+	}
+	for i, col := range pkColumns {
+		if basePK[i] != col {
+			return nil
+		}
+	}
+	return pkColumns
+}
+
+// deltaRowKey returns the key of a row by its primary key values
+func deltaRowKey(row schema.Row, pkColumns []string) string {
+	values := make([]interface{}, len(pkColumns))
+	for i, col := range pkColumns {
+		values[i] = row[col]
+	}
+	keyJSON, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprintf("%v", values)
+	}
+	return string(keyJSON)
+}
+
+// rowHash identifies a row's stored JSON, so that a base's rows can be
+// compared without being held in memory
+func rowHash(rowJSON []byte) string {
+	sum := sha256.Sum256(rowJSON)
+	return string(sum[:])
+}
+
+// tableDelta compares the rows of a table being captured with its rows in
+// the base snapshot
+type tableDelta struct {
+	pkColumns []string
+	baseRows  map[string]string // hash of each base row, by key
+	seen      map[string]bool
+}
+
+// newTableDelta returns the comparison of a table with its rows in the
+// base snapshot at basePath, or nil when the table is stored in full
+func newTableDelta(basePath, tableName string, tableSchema *schema.TableSchema) (*tableDelta, error) {
+	if basePath == "" {
+		return nil, nil
+	}
+	base, err := readBaseTable(basePath, tableName, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base snapshot: %w", err)
+	}
+	if base == nil {
+		return nil, nil
+	}
+	pkColumns := deltaKey(base.schema, tableSchema)
+	if pkColumns == nil {
+		return nil, nil
+	}
+	return &tableDelta{pkColumns: pkColumns, baseRows: base.rows, seen: make(map[string]bool)}, nil
+}
+
+// changed reports whether a captured row is new or differs from the base.
+// Rows are compared as they are stored, so the row is decoded from its
+// JSON before its key is taken, as it is when the base is loaded.
+func (d *tableDelta) changed(row schema.Row) (bool, error) {
+	rowJSON, err := json.Marshal(row)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal row: %w", err)
+	}
+	var stored schema.Row
+	if err := json.Unmarshal(rowJSON, &stored); err != nil {
+		return false, fmt.Errorf("failed to unmarshal row: %w", err)
+	}
+	key := deltaRowKey(stored, d.pkColumns)
+	d.seen[key] = true
+	baseHash, ok := d.baseRows[key]
+	return !ok || baseHash != rowHash(rowJSON), nil
+}
+
+// deleted returns the tombstones of the base rows that were not captured,
+// in key order
+func (d *tableDelta) deleted() ([]schema.Row, error) {
+	var keys []string
+	for key := range d.baseRows {
+		if !d.seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	tombstones := make([]schema.Row, 0, len(keys))
+	for _, key := range keys {
+		var values []interface{}
+		if err := json.Unmarshal([]byte(key), &values); err != nil || len(values) != len(d.pkColumns) {
+			return nil, fmt.Errorf("invalid key %s of a base row", key)
+		}
+		tombstone := make(schema.Row, len(d.pkColumns))
+		for i, col := range d.pkColumns {
+			tombstone[col] = values[i]
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones, nil
+}
+
+// baseTable is a table of a base snapshot as an incremental snapshot is
+// compared with it: its schema and a hash of each of its rows by key, nil
+// for a table without a primary key
+type baseTable struct {
+	schema *schema.TableSchema
+	rows   map[string]string
+}
+
+// readBaseTable reads one table of the snapshot at snapshotPath, following
+// the chain of bases of an incremental snapshot for that table alone. It
+// returns nil when the snapshot has no such table. child is the metadata of
+// the incremental snapshot based on this one, whose record of its base is
+// checked, and chain holds the snapshots that led to this one.
+func readBaseTable(snapshotPath, tableName string, child map[string]string, chain []string) (*baseTable, error) {
+	if _, err := os.Stat(snapshotPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot file does not exist: %s", snapshotPath)
+	}
+	db, err := sql.Open("sqlite", snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot database: %w", err)
+	}
+	defer db.Close()
+
+	metadata, err := readMetadata(db)
+	if err != nil {
+		return nil, err
+	}
+	version, err := supportedFormatVersion(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if child != nil {
+		if err := checkBase(child, metadata, snapshotPath); err != nil {
+			return nil, err
+		}
+	}
+
+	var schemaJSON string
+	err = db.QueryRow("SELECT schema_json FROM table_schemas WHERE table_name = ?", tableName).Scan(&schemaJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table schema: %w", err)
+	}
+	var tableSchema schema.TableSchema
+	if err := json.Unmarshal([]byte(schemaJSON), &tableSchema); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schema: %w", err)
+	}
+	table := &baseTable{schema: &tableSchema}
+	pkColumns := tableSchema.PrimaryKeyColumns()
+	if len(pkColumns) == 0 {
+		return table, nil
+	}
+
+	// The rows of a table stored as changes start from its base's
+	table.rows = make(map[string]string)
+	dataQuery := "SELECT row_json, 0 FROM table_data WHERE table_name = ? ORDER BY id"
+	if base := metadata[baseKey]; base != "" {
+		absPath, err := filepath.Abs(snapshotPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve snapshot path: %w", err)
+		}
+		if contains(chain, absPath) {
+			return nil, fmt.Errorf("incremental snapshot %s is based on itself", snapshotPath)
+		}
+		parent, err := readBaseTable(resolveBase(snapshotPath, base), tableName, metadata, append(chain, absPath))
+		if err != nil {
+			return nil, err
+		}
+		if parent != nil && deltaKey(parent.schema, &tableSchema) != nil {
+			table.rows = parent.rows
+		}
+		dataQuery = "SELECT row_json, deleted FROM table_data WHERE table_name = ? ORDER BY id"
+	}
+	var blobs *blobResolver
+	if version >= 2 {
+		blobs = newBlobResolver(db)
+	}
+
+	rows, err := db.Query(dataQuery, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table data: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rowJSON string
+		var isDeleted bool
+		if err := rows.Scan(&rowJSON, &isDeleted); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		var row schema.Row
+		if err := json.Unmarshal([]byte(rowJSON), &row); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal row: %w", err)
+		}
+		key := deltaRowKey(row, pkColumns)
+		if isDeleted {
+			delete(table.rows, key)
+			continue
+		}
+		// Hashed as the row is loaded, with its large values in place
+		if blobs != nil {
+			if err := blobs.resolve(row); err != nil {
+				return nil, err
+			}
+		}
+		loaded, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal row: %w", err)
+		}
+		table.rows[key] = rowHash(loaded)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query table data: %w", err)
+	}
+	return table, nil
+}
+
+// readBaseMetadata reads the metadata of a base snapshot without loading
+// its tables
+func readBaseMetadata(basePath string) (map[string]string, error) {
+	if _, err := os.Stat(basePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot file does not exist: %s", basePath)
+	}
+	metadata, err := readMetadataFile(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base snapshot: %w", err)
+	}
+	if _, err := supportedFormatVersion(metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// loadBase reads the base snapshot an incremental snapshot is to be taken
+// against and returns the metadata recording it in the new snapshot
+func loadBase(basePath, outputPath string, opts Options) (map[string]string, error) {
+	base, err := readBaseMetadata(basePath)
+	if err != nil {
+		return nil, err
+	}
+	if id := base["hash_salt_id"]; id != "" && (len(opts.HashColumns) == 0 || saltID(opts.HashSalt) != id) {
+		return nil, fmt.Errorf("the base snapshot hashes column values; take the incremental snapshot with the same hash columns and salt")
+	}
+
+	// Stored relative to the new snapshot, so the two can be moved together
+	recorded := basePath
+	if absBase, err := filepath.Abs(basePath); err == nil {
+		if absDir, err := filepath.Abs(filepath.Dir(outputPath)); err == nil {
+			if rel, err := filepath.Rel(absDir, absBase); err == nil {
+				recorded = rel
+			}
+		}
+	}
+	metadata := map[string]string{
+		baseKey:          recorded,
+		baseCreatedAtKey: base["created_at"],
+	}
+	if generation := base[generationKey]; generation != "" {
+		metadata[baseGenerationKey] = generation
+	}
+	return metadata, nil
+}
+
+// checkBase verifies that the snapshot at basePath, with metadata
+// baseMetadata, is still the one the incremental snapshot with metadata
+// metadata was taken against: neither replaced nor rebased since
+func checkBase(metadata, baseMetadata map[string]string, basePath string) error {
+	if createdAt := metadata[baseCreatedAtKey]; createdAt != "" && createdAt != baseMetadata["created_at"] {
+		return fmt.Errorf("base snapshot %s was replaced (created %s, expected %s)", basePath, baseMetadata["created_at"], createdAt)
+	}
+	if metadata[baseGenerationKey] != baseMetadata[generationKey] {
+		return fmt.Errorf("base snapshot %s was rebased after the incremental snapshot was taken", basePath)
+	}
+	return nil
+}
+
+// resolveBase returns the path of an incremental snapshot's base
+func resolveBase(snapshotPath, base string) string {
+	if filepath.IsAbs(base) {
+		return base
+	}
+	return filepath.Join(filepath.Dir(snapshotPath), base)
+}
+
+// applyBase completes the tables of an incremental snapshot with the rows
+// of its base: the base rows in their order, less the deleted ones and with
+// the modified ones replaced, followed by the added rows. deleted holds the
+// tombstones of each table.
+func applyBase(snap *Snapshot, snapshotPath string, deleted map[string][]schema.Row, chain []string) error {
+	basePath := resolveBase(snapshotPath, snap.Base())
+	base, err := loadSnapshot(basePath, chain)
+	if err != nil {
+		return fmt.Errorf("failed to load base of %s: %w", snapshotPath, err)
+	}
+	if err := checkBase(snap.Metadata, base.Metadata, basePath); err != nil {
+		return fmt.Errorf("%s: %w", snapshotPath, err)
+	}
+
+	for tableName, table := range snap.Tables {
+		baseTable, ok := base.Tables[tableName]
+		if !ok {
+			continue
+		}
+		pkColumns := deltaKey(&baseTable.Schema, &table.Schema)
+		if pkColumns == nil {
+			continue
+		}
+		removed := make(map[string]bool, len(deleted[tableName]))
+		for _, tombstone := range deleted[tableName] {
+			removed[deltaRowKey(tombstone, pkColumns)] = true
+		}
+		changed := make(map[string]schema.Row, len(table.Data))
+		for _, row := range table.Data {
+			changed[deltaRowKey(row, pkColumns)] = row
+		}
+
+		rows := make([]schema.Row, 0, len(baseTable.Data)+len(table.Data))
+		for _, row := range baseTable.Data {
+			key := deltaRowKey(row, pkColumns)
+			if removed[key] {
+				continue
+			}
+			if modified, ok := changed[key]; ok {
+				row = modified
+				delete(changed, key)
+			}
+			rows = append(rows, row)
+		}
+		for _, row := range table.Data {
+			if _, ok := changed[deltaRowKey(row, pkColumns)]; ok {
+				rows = append(rows, row)
+			}
+		}
+		table.Data = rows
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package snapshot
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIncrementalSnapshot(t *testing.T) {
+	states := []map[string][]string{
+		{"users": {"alice", "bob", "carol"}, "posts": {"hello"}},
+		{"users": {"alice", "bobby", "carol", "dave"}, "posts": {"hello"}},
+		{"users": {"alice", "bobby"}, "posts": {"hello", "world"}, "tags": {"go"}},
+	}
+	// Rows each snapshot stores: the changed and added rows and tombstones
+	wantStored := []int{4, 2, 4}
+	tests := []struct {
+		name string
+		dirs []string // directory of each snapshot, relative to the test's
+	}{
+		{"same directory", []string{".", ".", "."}},
+		{"chain across directories", []string{".", "week", "week/day"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			var paths []string
+			for i, state := range states {
+				path := filepath.Join(root, tt.dirs[i], "snap"+string(rune('0'+i))+".db")
+				opts := Options{Concurrency: 2}
+				if i > 0 {
+					opts.Base = paths[i-1]
+				}
+				if err := CreateSnapshot(context.Background(), newFakeDatabase(state), path, opts); err != nil {
+					t.Fatalf("CreateSnapshot(%d) error = %v", i, err)
+				}
+				paths = append(paths, path)
+				if got := storedRows(t, path); got != wantStored[i] {
+					t.Errorf("snapshot %d stores %d rows, want %d", i, got, wantStored[i])
+				}
+
+				snap, err := LoadSnapshot(path)
+				if err != nil {
+					t.Fatalf("LoadSnapshot(%d) error = %v", i, err)
+				}
+				wantVersion := "2"
+				if i > 0 {
+					wantVersion = "3"
+				}
+				if got := snap.Metadata["format_version"]; got != wantVersion {
+					t.Errorf("snapshot %d format_version = %s, want %s", i, got, wantVersion)
+				}
+				if len(snap.Tables) != len(state) {
+					t.Errorf("snapshot %d has %d tables, want %d", i, len(snap.Tables), len(state))
+				}
+				for name, values := range state {
+					if got := tableValues(t, snap, name); !reflect.DeepEqual(got, values) {
+						t.Errorf("snapshot %d table %s = %v, want %v", i, name, got, values)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIncrementalSnapshotDetectsChangedBase(t *testing.T) {
+	before := map[string][]string{"users": {"alice", "bob"}}
+	after := map[string][]string{"users": {"alice", "bobby"}}
+	tests := []struct {
+		name   string
+		change func(t *testing.T, basePath string)
+		want   string
+	}{
+		{"replaced", func(t *testing.T, basePath string) {
+			db, err := sql.Open("sqlite", basePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if err := setMetadata(db, "created_at", "2000-01-01T00:00:00Z"); err != nil {
+				t.Fatal(err)
+			}
+		}, "was replaced"},
+		{"rebased", func(t *testing.T, basePath string) {
+			if _, err := Rebase(basePath, "users", "", map[string]string{"1": "100"}); err != nil {
+				t.Fatal(err)
+			}
+		}, "was rebased"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			basePath := filepath.Join(dir, "base.db")
+			path := filepath.Join(dir, "incremental.db")
+			if err := CreateSnapshot(context.Background(), newFakeDatabase(before), basePath, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := CreateSnapshot(context.Background(), newFakeDatabase(after), path, Options{Base: basePath}); err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, basePath)
+
+			if _, err := LoadSnapshot(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadSnapshot() error = %v, want %q", err, tt.want)
+			}
+			err := CreateSnapshot(context.Background(), newFakeDatabase(after), path, Options{Resume: true})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("resuming error = %v, want %q", err, tt.want)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("snapshot removed: %v", err)
+			}
+		})
+	}
+}
+
+// storedRows counts the rows a snapshot file stores itself
+func storedRows(t *testing.T, path string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM table_data").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
@@ -0,0 +1,158 @@
+package snapshot
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// RebaseResult reports how many values Rebase rewrote in each table
+type RebaseResult struct {
+	Column    string         // the key column that was rewritten
+	Rewritten map[string]int // rewritten values per table
+}
+
+// Rebase rewrites the values of a key column in a snapshot file according to
+// mapping (old value -> new value, both in their string form), along with the
+// foreign key columns that reference it. This aligns a snapshot taken before
+// a migration that renumbered surrogate keys with one taken after it.
+// column defaults to the table's single-column primary key. Values missing
+// from mapping are left unchanged.
+func Rebase(snapshotPath, tableName, column string, mapping map[string]string) (*RebaseResult, error) {
+	snap, err := LoadSnapshot(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	// Its rows are changes to its base, which rewriting in full would lose
+	if snap.Base() != "" {
+		return nil, fmt.Errorf("cannot rebase incremental snapshot %s", snapshotPath)
+	}
+
+	table, ok := snap.Tables[tableName]
+	if !ok {
+		return nil, fmt.Errorf("table %s not found in snapshot", tableName)
+	}
+	if column == "" {
+		pk := table.Schema.PrimaryKeyColumns()
+		if len(pk) != 1 {
+			return nil, fmt.Errorf("table %s has no single-column primary key, specify the column to rebase", tableName)
+		}
+		column = pk[0]
+	} else if !hasColumn(&table.Schema, column) {
+		return nil, fmt.Errorf("column %s does not exist in table %s", column, tableName)
+	}
+
+	// The key column itself, plus every column referencing it
+	targets := map[string][]string{tableName: {column}}
+	for name, t := range snap.Tables {
+		for _, fk := range t.Schema.ForeignKeys {
+			if fk.ReferencedTable == tableName && fk.ReferencedColumn == column && !contains(targets[name], fk.Column) {
+				targets[name] = append(targets[name], fk.Column)
+			}
+		}
+	}
+
+	result := &RebaseResult{Column: column, Rewritten: make(map[string]int)}
+	for name, columns := range targets {
+		if n := rebaseRows(snap.Tables[name].Data, columns, mapping); n > 0 {
+			result.Rewritten[name] = n
+		}
+	}
+	if len(result.Rewritten) == 0 {
+		return result, nil
+	}
+
+	db, err := sql.Open("sqlite", snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot database: %w", err)
+	}
+	defer db.Close()
+
+	names := make([]string, 0, len(result.Rewritten))
+	for name := range result.Rewritten {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := rewriteTableData(db, name, snap.Tables[name].Data, blobThreshold(snap.Metadata)); err != nil {
+			return nil, fmt.Errorf("failed to rewrite data of table %s: %w", name, err)
+		}
+	}
+	if err := setMetadata(db, "rebased."+tableName, column); err != nil {
+		return nil, err
+	}
+	// Incremental snapshots taken against the old rows no longer apply
+	generation, _ := strconv.Atoi(snap.Metadata[generationKey])
+	if err := setMetadata(db, generationKey, strconv.Itoa(generation+1)); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// rebaseRows maps the values of columns in place and returns the number of
+// values changed
+func rebaseRows(rows []schema.Row, columns []string, mapping map[string]string) int {
+	changed := 0
+	for _, row := range rows {
+		for _, col := range columns {
+			val, ok := row[col]
+			if !ok || val == nil {
+				continue
+			}
+			newVal, ok := mapping[keyString(val)]
+			if !ok {
+				continue
+			}
+			row[col] = keyValue(val, newVal)
+			changed++
+		}
+	}
+	return changed
+}
+
+// keyString returns the string form of a stored key value as it is given
+// in a mapping. Numbers are loaded as float64, which fmt would print in
+// exponent form from 1e21 up and which would then match no mapping.
+func keyString(val interface{}) string {
+	if f, ok := val.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(val)
+}
+
+// keyValue converts a mapped value to the JSON type of the value it replaces,
+// so numeric keys stay numeric
+func keyValue(old interface{}, newVal string) interface{} {
+	if _, ok := old.(float64); ok {
+		if f, err := strconv.ParseFloat(newVal, 64); err == nil {
+			return f
+		}
+	}
+	return newVal
+}
+
+// rewriteTableData replaces the stored rows of a table, storing large values
+// the way the snapshot was taken
+func rewriteTableData(db *sql.DB, tableName string, rows []schema.Row, blobThreshold int) error {
+	writer, err := newRowWriter(db, tableName, 0, blobThreshold)
+	if err != nil {
+		return err
+	}
+	defer writer.rollback()
+
+	// Deleted in the writer's transaction so a failure keeps the old rows
+	if _, err := writer.tx.Exec("DELETE FROM table_data WHERE table_name = ?", tableName); err != nil {
+		return fmt.Errorf("failed to delete rows: %w", err)
+	}
+
+	for _, row := range rows {
+		if err := writer.write(row); err != nil {
+			return err
+		}
+	}
+	return writer.commit()
+}
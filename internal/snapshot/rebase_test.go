@@ -0,0 +1,68 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestKeyString(t *testing.T) {
+	tests := []struct {
+		val  interface{}
+		want string
+	}{
+		{float64(42), "42"},
+		{float64(1e21), "1000000000000000000000"},
+		{float64(1.5), "1.5"},
+		{"abc", "abc"},
+		{true, "true"},
+	}
+	for _, tt := range tests {
+		if got := keyString(tt.val); got != tt.want {
+			t.Errorf("keyString(%v) = %q, want %q", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestRebaseRows(t *testing.T) {
+	tests := []struct {
+		name        string
+		rows        []schema.Row
+		mapping     map[string]string
+		want        []schema.Row
+		wantChanged int
+	}{
+		{
+			name:        "numeric keys stay numeric",
+			rows:        []schema.Row{{"id": float64(1)}, {"id": float64(2)}},
+			mapping:     map[string]string{"1": "101"},
+			want:        []schema.Row{{"id": float64(101)}, {"id": float64(2)}},
+			wantChanged: 1,
+		},
+		{
+			name:        "large numeric key",
+			rows:        []schema.Row{{"id": float64(1e21)}},
+			mapping:     map[string]string{"1000000000000000000000": "7"},
+			want:        []schema.Row{{"id": float64(7)}},
+			wantChanged: 1,
+		},
+		{
+			name:        "string keys and NULL",
+			rows:        []schema.Row{{"id": "a"}, {"id": nil}},
+			mapping:     map[string]string{"a": "b"},
+			want:        []schema.Row{{"id": "b"}, {"id": nil}},
+			wantChanged: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rebaseRows(tt.rows, []string{"id"}, tt.mapping); got != tt.wantChanged {
+				t.Errorf("rebaseRows() = %d, want %d", got, tt.wantChanged)
+			}
+			if !reflect.DeepEqual(tt.rows, tt.want) {
+				t.Errorf("rows = %v, want %v", tt.rows, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package snapshot
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// completedPrefix marks, in metadata, a table whose schema and data were
+// fully written. The markers are the manifest a resumed snapshot starts from.
+const completedPrefix = "completed."
+
+func completedKey(tableName string) string {
+	return completedPrefix + tableName
+}
+
+// resumeState prepares an interrupted snapshot to be continued. It returns
+// the tables already complete and removes whatever a table that was cut off
+// left behind. opts takes the storage settings the snapshot was started
+// with, so the remaining tables are stored the same way, and the base of an
+// incremental snapshot, resolved from snapshotPath.
+func resumeState(db *sql.DB, snapshotPath string, opts *Options) (map[string]bool, error) {
+	metadata, err := readMetadata(db)
+	if err != nil {
+		return nil, err
+	}
+	version, err := formatVersion(metadata)
+	if err != nil {
+		return nil, err
+	}
+	expected := FormatVersion
+	if metadata[baseKey] != "" {
+		expected = incrementalFormatVersion
+	}
+	if version != expected {
+		return nil, fmt.Errorf("cannot resume a snapshot of format version %d (current: %d)", version, expected)
+	}
+	opts.BlobThreshold = blobThreshold(metadata)
+	opts.SkipEmptyTables = metadata["skip_empty_tables"] == "true"
+	if base := metadata[baseKey]; base != "" {
+		opts.Base = resolveBase(snapshotPath, base)
+		baseMetadata, err := readBaseMetadata(opts.Base)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBase(metadata, baseMetadata, opts.Base); err != nil {
+			return nil, err
+		}
+	}
+	if id := metadata["hash_salt_id"]; id != "" && (len(opts.HashColumns) == 0 || saltID(opts.HashSalt) != id) {
+		return nil, fmt.Errorf("the snapshot hashes column values; resume it with the same hash columns and salt")
+	}
+	if metadata["read_only"] == "true" && !opts.ReadOnly {
+		return nil, fmt.Errorf("the snapshot was taken read-only; resume it with --readonly")
+	}
+
+	completed := make(map[string]bool)
+	for key := range metadata {
+		if strings.HasPrefix(key, completedPrefix) {
+			completed[strings.TrimPrefix(key, completedPrefix)] = true
+		}
+	}
+
+	// A table with a schema but no marker was interrupted while writing rows
+	rows, err := db.Query("SELECT table_name FROM table_schemas")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table schemas: %w", err)
+	}
+	var partial []string
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table schema: %w", err)
+		}
+		if !completed[tableName] {
+			partial = append(partial, tableName)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query table schemas: %w", err)
+	}
+
+	for _, tableName := range partial {
+		if err := discardTable(db, tableName); err != nil {
+			return nil, fmt.Errorf("failed to discard partial table %s: %w", tableName, err)
+		}
+	}
+	return completed, nil
+}
+
+// discardTable removes a table's schema, rows and per-table metadata
+func discardTable(db *sql.DB, tableName string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"DELETE FROM table_data WHERE table_name = ?",
+		"DELETE FROM table_schemas WHERE table_name = ?",
+	} {
+		if _, err := tx.Exec(stmt, tableName); err != nil {
+			return err
+		}
+	}
+	for _, key := range []string{"pk_range." + tableName, "where." + tableName, hashedPrefix + tableName} {
+		if _, err := tx.Exec("DELETE FROM metadata WHERE key = ?", key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -18,11 +18,30 @@ const (
 		);
 	`
 
+	// deleted marks the tombstone of a row deleted since the base of an
+	// incremental snapshot (format version 3)
 	createTableDataTable = `
 		CREATE TABLE IF NOT EXISTS table_data (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			table_name TEXT NOT NULL,
-			row_json TEXT NOT NULL
+			row_json TEXT NOT NULL,
+			deleted INTEGER NOT NULL DEFAULT 0
+		);
+	`
+
+	// blobs holds large values referenced from row_json by hash (format version 2)
+	createBlobsTable = `
+		CREATE TABLE IF NOT EXISTS blobs (
+			hash TEXT PRIMARY KEY,
+			data BLOB NOT NULL
+		);
+	`
+
+	// materialized_views holds database-level views captured apart from tables
+	createMaterializedViewsTable = `
+		CREATE TABLE IF NOT EXISTS materialized_views (
+			name TEXT PRIMARY KEY,
+			view_json TEXT NOT NULL
 		);
 	`
 
@@ -39,6 +58,8 @@ func initializeSchema(db *sql.DB) error {
 		createTableSchemasTable,
 		createTableDataTable,
 		createTableDataIndex,
+		createBlobsTable,
+		createMaterializedViewsTable,
 	}
 
 	for _, schema := range schemas {
@@ -0,0 +1,52 @@
+package snapshot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+var (
+	typeSerializersMu sync.RWMutex
+	typeSerializers   = make(map[string]func(interface{}) (interface{}, error))
+)
+
+// RegisterTypeSerializer sets how values of a column type are converted
+// before being stored in a snapshot, for vendor types whose driver values
+// don't survive JSON encoding (e.g. binary geometry). typeName matches the
+// column type without parameters, case-insensitively. The returned value
+// must be JSON-encodable; NULL values are never passed to it.
+func RegisterTypeSerializer(typeName string, fn func(interface{}) (interface{}, error)) {
+	typeSerializersMu.Lock()
+	defer typeSerializersMu.Unlock()
+	typeSerializers[schema.BaseType(typeName)] = fn
+}
+
+// rowSerializer returns a function applying the registered serializers to
+// the columns of a table's rows
+func rowSerializer(tableSchema *schema.TableSchema) func(schema.Row) error {
+	typeSerializersMu.RLock()
+	serializers := make(map[string]func(interface{}) (interface{}, error))
+	for _, col := range tableSchema.Columns {
+		if fn, ok := typeSerializers[schema.BaseType(col.Type)]; ok {
+			serializers[col.Name] = fn
+		}
+	}
+	typeSerializersMu.RUnlock()
+
+	return func(row schema.Row) error {
+		for col, fn := range serializers {
+			val, ok := row[col]
+			if !ok || val == nil {
+				continue
+			}
+			serialized, err := fn(val)
+			if err != nil {
+				return fmt.Errorf("failed to serialize column %s: %w", col, err)
+			}
+			row[col] = serialized
+		}
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestRegisterTypeSerializer(t *testing.T) {
+	RegisterTypeSerializer("HSTORE", func(val interface{}) (interface{}, error) {
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %T", val)
+		}
+		pairs := make(map[string]interface{})
+		for _, pair := range strings.Split(s, ",") {
+			k, v, _ := strings.Cut(pair, "=>")
+			pairs[strings.Trim(k, `" `)] = strings.Trim(v, `" `)
+		}
+		return pairs, nil
+	})
+	defer func() {
+		typeSerializersMu.Lock()
+		delete(typeSerializers, "hstore")
+		typeSerializersMu.Unlock()
+	}()
+
+	serialize := rowSerializer(&schema.TableSchema{Name: "products", Columns: []schema.Column{
+		{Name: "id", Type: "integer"},
+		{Name: "attrs", Type: "hstore"},
+	}})
+	tests := []struct {
+		name    string
+		row     schema.Row
+		want    schema.Row
+		wantErr bool
+	}{
+		{name: "registered type", row: schema.Row{"id": 1, "attrs": `"color"=>"red"`}, want: schema.Row{"id": 1, "attrs": map[string]interface{}{"color": "red"}}},
+		{name: "null", row: schema.Row{"id": 2, "attrs": nil}, want: schema.Row{"id": 2, "attrs": nil}},
+		{name: "serializer error", row: schema.Row{"id": 3, "attrs": 42}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := serialize(tt.row)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serialize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.row, tt.want) {
+				t.Errorf("row = %v, want %v", tt.row, tt.want)
+			}
+		})
+	}
+}
@@ -1,15 +1,25 @@
 package snapshot
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	_ "modernc.org/sqlite"
 
+	"github.com/koba/db-diff/internal/apply"
 	"github.com/koba/db-diff/internal/database"
 	"github.com/koba/db-diff/internal/schema"
 )
@@ -18,20 +28,153 @@ import (
 type Snapshot struct {
 	Metadata map[string]string
 	Tables   map[string]*schema.Table
+
+	// MaterializedViews are captured from databases that have them
+	MaterializedViews map[string]*schema.MaterializedView
+}
+
+// Options controls what CreateSnapshot captures
+type Options struct {
+	Tables   []string                    // tables to snapshot (default: all tables)
+	Limit    int                         // maximum number of rows per table (0: unlimited)
+	PKRanges map[string]PKRange          // per-table primary key ranges
+	OrderBy  map[string]database.OrderBy // per-table row ordering
+	Where    map[string]string           // per-table SQL predicates filtering rows
+
+	// Exclude lists glob patterns (filepath.Match syntax, e.g. *_log) of
+	// tables not to snapshot, applied to Tables or to all tables. Matching
+	// ignores case when ExcludeIgnoreCase is set.
+	Exclude           []string
+	ExcludeIgnoreCase bool
+
+	// TableTimeout bounds reading each table's schema and data (0: no
+	// limit). Rows are spooled to a temporary file next to the snapshot
+	// while they are read, so waiting for other tables to be written does
+	// not count against it.
+	// Tables that time out are skipped unless Strict is set. Strict also
+	// turns a Where predicate that matches no rows of a non-empty table
+	// from a warning into an error.
+	TableTimeout time.Duration
+	Strict       bool
+
+	// SkipEmptyTables stores only the schema of tables without rows
+	SkipEmptyTables bool
+
+	// Label identifies the source database in output and metadata
+	Label string
+
+	// Tag names the environment (e.g. prod, staging) the snapshot was taken
+	// from, for finding the latest snapshot of each with FindLatest
+	Tag string
+
+	// ReadOnly records that the source was read over read-only sessions
+	ReadOnly bool
+
+	// CommitInterval commits the snapshot's row inserts every N rows
+	// (0: one transaction per table)
+	CommitInterval int
+
+	// Overwrite replaces an existing snapshot file at the output path
+	Overwrite bool
+
+	// Resume continues an interrupted snapshot at the output path, keeping
+	// the tables it completed and capturing the rest
+	Resume bool
+
+	// Base takes an incremental snapshot, which stores only the rows that
+	// differ from the snapshot at this path and is loaded together with it.
+	// A resumed snapshot keeps the base it was started with.
+	Base string
+
+	// PreserveCreationOrder records the tables in the order they were
+	// created, for output that follows the schema's definition order
+	PreserveCreationOrder bool
+
+	// BlobThreshold stores string values longer than this many bytes once
+	// in a separate blobs table, referenced by hash from the row JSON
+	// (0: all values are stored inline)
+	BlobThreshold int
+
+	// HashColumns lists, per table, columns whose values are stored as a
+	// SHA-256 hash salted with HashSalt instead of as plaintext
+	HashColumns map[string][]string
+	HashSalt    string
+
+	// Concurrency is the number of tables read from the database at the
+	// same time (0 or 1: one at a time). The snapshot file is written by a
+	// single goroutine either way.
+	Concurrency int
+}
+
+// errTableTimeout is returned by snapshotTable when the per-table deadline expires
+var errTableTimeout = errors.New("table read timed out")
+
+// PKRange is a primary-key range requested on the command line as table:from:to
+type PKRange struct {
+	From string
+	To   string
+}
+
+// ParsePKRange parses a "table:from:to" range specification
+func ParsePKRange(spec string) (string, PKRange, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", PKRange{}, fmt.Errorf("invalid pk range %q (expected table:from:to)", spec)
+	}
+	return parts[0], PKRange{From: parts[1], To: parts[2]}, nil
 }
 
-// CreateSnapshot creates a snapshot of the database
-func CreateSnapshot(db database.Database, tables []string, outputPath string, limit int) error {
+// ParseOrderBy parses a "table:column[:desc]" ordering specification
+func ParseOrderBy(spec string) (string, database.OrderBy, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return "", database.OrderBy{}, fmt.Errorf("invalid order by %q (expected table:column[:desc])", spec)
+	}
+
+	orderBy := database.OrderBy{Column: parts[1]}
+	if len(parts) == 3 {
+		switch strings.ToLower(parts[2]) {
+		case "asc":
+		case "desc":
+			orderBy.Descending = true
+		default:
+			return "", database.OrderBy{}, fmt.Errorf("invalid order by direction %q (expected asc or desc)", parts[2])
+		}
+	}
+	return parts[0], orderBy, nil
+}
+
+// ParseWhere parses a "table:predicate" row filter specification
+func ParseWhere(spec string) (string, string, error) {
+	tableName, predicate, ok := strings.Cut(spec, ":")
+	if !ok || tableName == "" || strings.TrimSpace(predicate) == "" {
+		return "", "", fmt.Errorf("invalid where %q (expected table:predicate)", spec)
+	}
+	return tableName, predicate, nil
+}
+
+// CreateSnapshot creates a snapshot of the database, or an incremental
+// snapshot against opts.Base. Cancelling ctx aborts the queries in flight
+// and fails the snapshot, which --resume can finish.
+func CreateSnapshot(ctx context.Context, db database.Database, outputPath string, opts Options) error {
 	// Ensure output directory exists
 	dir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Remove existing snapshot file if it exists
+	// Replace an existing snapshot file only when asked to, or continue it
+	resuming := false
 	if _, err := os.Stat(outputPath); err == nil {
-		if err := os.Remove(outputPath); err != nil {
-			return fmt.Errorf("failed to remove existing snapshot: %w", err)
+		switch {
+		case opts.Resume:
+			resuming = true
+		case !opts.Overwrite:
+			return fmt.Errorf("snapshot already exists at %s", outputPath)
+		default:
+			if err := os.Remove(outputPath); err != nil {
+				return fmt.Errorf("failed to remove existing snapshot: %w", err)
+			}
 		}
 	}
 
@@ -47,10 +190,175 @@ func CreateSnapshot(db database.Database, tables []string, outputPath string, li
 		return fmt.Errorf("failed to initialize snapshot schema: %w", err)
 	}
 
-	// Store metadata
+	// A resumed snapshot keeps its original metadata and storage settings
+	completed := make(map[string]bool)
+	if resuming {
+		completed, err = resumeState(snapshotDB, outputPath, &opts)
+		if err != nil {
+			return err
+		}
+		if len(completed) > 0 {
+			fmt.Fprintf(os.Stderr, "Resuming snapshot: %d table(s) already complete\n", len(completed))
+		}
+	} else {
+		var baseMetadata map[string]string
+		if opts.Base != "" {
+			if baseMetadata, err = loadBase(opts.Base, outputPath, opts); err != nil {
+				return err
+			}
+		}
+		if err := storeMetadata(snapshotDB, db.Dialect(), opts); err != nil {
+			return err
+		}
+		for key, value := range baseMetadata {
+			if err := setMetadata(snapshotDB, key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Get all tables if not specified
+	tables := opts.Tables
+	if opts.PreserveCreationOrder {
+		ordered, err := db.GetAllTablesInCreationOrder(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get all tables: %w", err)
+		}
+		if len(tables) > 0 {
+			ordered = orderTables(tables, ordered)
+		}
+		tables = ordered
+	} else if len(tables) == 0 {
+		tables, err = db.GetAllTables(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get all tables: %w", err)
+		}
+	}
+	// The apply tracking table belongs to dbdiff, not to the schema
+	if !contains(opts.Tables, apply.TrackingTable) {
+		tables = slices.DeleteFunc(tables, func(tableName string) bool { return tableName == apply.TrackingTable })
+	}
+	tables, err = ExcludeTables(tables, opts.Exclude, opts.ExcludeIgnoreCase)
+	if err != nil {
+		return err
+	}
+	if opts.PreserveCreationOrder {
+		if err := setMetadata(snapshotDB, "table_order", strings.Join(tables, ",")); err != nil {
+			return err
+		}
+	}
+
+	// Every requested range must refer to a table being captured
+	for tableName := range opts.PKRanges {
+		if !contains(tables, tableName) {
+			return fmt.Errorf("pk range given for table %s which is not being snapshotted", tableName)
+		}
+	}
+	for tableName := range opts.Where {
+		if !contains(tables, tableName) {
+			return fmt.Errorf("where given for table %s which is not being snapshotted", tableName)
+		}
+	}
+	for tableName := range opts.HashColumns {
+		if !contains(tables, tableName) {
+			return fmt.Errorf("hash columns given for table %s which is not being snapshotted", tableName)
+		}
+	}
+
+	// Read all schemas up front in batched queries, unless each table's
+	// reads have to be bounded individually by the per-table timeout
+	var schemas map[string]*schema.TableSchema
+	if opts.TableTimeout == 0 {
+		schemas, err = getTableSchemas(ctx, db, tables)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Snapshot each table
+	timedOut, err := snapshotTables(ctx, db, snapshotDB, dir, tables, completed, schemas, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := snapshotMaterializedViews(ctx, db, snapshotDB); err != nil {
+		return err
+	}
+
+	// Record skipped tables so a diff against this snapshot can account for them
+	if len(timedOut) > 0 {
+		if err := setMetadata(snapshotDB, "timed_out_tables", strings.Join(timedOut, ",")); err != nil {
+			return err
+		}
+	} else if resuming {
+		// Tables that timed out before were captured this time
+		if _, err := snapshotDB.Exec("DELETE FROM metadata WHERE key = 'timed_out_tables'"); err != nil {
+			return fmt.Errorf("failed to update metadata: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// snapshotMaterializedViews stores the database's materialized views, when
+// it has them
+func snapshotMaterializedViews(ctx context.Context, db database.Database, snapshotDB *sql.DB) error {
+	reader, ok := db.(database.MaterializedViewReader)
+	if !ok {
+		return nil
+	}
+	views, err := reader.GetMaterializedViews(ctx)
+	if err != nil {
+		return err
+	}
+	for _, view := range views {
+		viewJSON, err := json.Marshal(view)
+		if err != nil {
+			return fmt.Errorf("failed to marshal materialized view: %w", err)
+		}
+		// Replaced when a resumed snapshot captures them again
+		if _, err := snapshotDB.Exec("INSERT OR REPLACE INTO materialized_views (name, view_json) VALUES (?, ?)", view.Name, string(viewJSON)); err != nil {
+			return fmt.Errorf("failed to insert materialized view: %w", err)
+		}
+	}
+	return nil
+}
+
+// storeMetadata records the metadata of a new snapshot of a database of
+// type dbType
+func storeMetadata(snapshotDB *sql.DB, dbType string, opts Options) error {
 	metadata := map[string]string{
-		"created_at": time.Now().Format(time.RFC3339),
-		"db_type":    "unknown", // Could be enhanced to detect DB type
+		"created_at":     time.Now().Format(time.RFC3339),
+		"db_type":        dbType,
+		"format_version": strconv.Itoa(FormatVersion),
+		"collations":     "true",
+	}
+	if opts.Base != "" {
+		metadata["format_version"] = strconv.Itoa(incrementalFormatVersion)
+	}
+	if opts.Label != "" {
+		metadata["label"] = opts.Label
+	}
+	if opts.Tag != "" {
+		metadata["tag"] = opts.Tag
+	}
+	if opts.ReadOnly {
+		metadata["read_only"] = "true"
+	}
+	if opts.SkipEmptyTables {
+		metadata["skip_empty_tables"] = "true"
+	}
+	if opts.BlobThreshold > 0 {
+		metadata["blob_threshold"] = strconv.Itoa(opts.BlobThreshold)
+	}
+	if len(opts.HashColumns) > 0 {
+		metadata["hash_salt_id"] = saltID(opts.HashSalt)
+	}
+	if len(opts.Exclude) > 0 {
+		metadata["exclude"] = strings.Join(opts.Exclude, ",")
+		if opts.ExcludeIgnoreCase {
+			metadata["exclude_ignore_case"] = "true"
+		}
 	}
 
 	for key, value := range metadata {
@@ -59,87 +367,782 @@ func CreateSnapshot(db database.Database, tables []string, outputPath string, li
 			return fmt.Errorf("failed to insert metadata: %w", err)
 		}
 	}
+	return nil
+}
 
-	// Get all tables if not specified
-	if len(tables) == 0 {
-		tables, err = db.GetAllTables()
+// schemaBatchSize bounds the number of tables introspected per query
+const schemaBatchSize = 500
+
+// getTableSchemas reads the schemas of tables in batches
+func getTableSchemas(ctx context.Context, db database.Database, tables []string) (map[string]*schema.TableSchema, error) {
+	schemas := make(map[string]*schema.TableSchema, len(tables))
+	for start := 0; start < len(tables); start += schemaBatchSize {
+		end := start + schemaBatchSize
+		if end > len(tables) {
+			end = len(tables)
+		}
+		batch, err := db.GetTableSchemas(ctx, tables[start:end])
 		if err != nil {
-			return fmt.Errorf("failed to get all tables: %w", err)
+			return nil, fmt.Errorf("failed to get schemas: %w", err)
+		}
+		for name, tableSchema := range batch {
+			schemas[name] = tableSchema
 		}
 	}
+	return schemas, nil
+}
 
-	// Snapshot each table
-	for _, tableName := range tables {
-		if err := snapshotTable(db, snapshotDB, tableName, limit); err != nil {
-			return fmt.Errorf("failed to snapshot table %s: %w", tableName, err)
+// snapshotTables reads the tables not yet completed with opts.Concurrency
+// workers, each spooling a table's rows to a temporary file in spoolDir,
+// and writes each table to the snapshot once it is read, in the order the
+// workers finish them. The first error cancels the remaining reads and is
+// returned; tables that time out are skipped and returned in table order
+// unless opts.Strict is set. Only the changes to the rows of opts.Base are
+// written when it is set.
+func snapshotTables(ctx context.Context, db database.Database, snapshotDB *sql.DB, spoolDir string, tables []string, completed map[string]bool, schemas map[string]*schema.TableSchema, opts Options) ([]string, error) {
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	// Every worker holds one connection while it reads a table
+	if pool := db.DB(); pool != nil && workers > 1 {
+		pool.SetMaxOpenConns(workers)
+		pool.SetMaxIdleConns(workers)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		tableName string
+		table     *capturedTable
+		err       error
+	}
+	pending := make(chan string)
+	results := make(chan result, workers)
+	go func() {
+		defer close(pending)
+		for _, tableName := range tables {
+			if completed[tableName] {
+				continue
+			}
+			select {
+			case pending <- tableName:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tableName := range pending {
+				table, err := prepareTable(ctx, db, tableName, schemas[tableName], opts)
+				if err == nil {
+					err = table.read(db, spoolDir, opts)
+				}
+				results <- result{tableName: tableName, table: table, err: err}
+			}
+		}()
 	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
-	return nil
+	// Results are drained after an error so that no worker is left blocked
+	var timedOut []string
+	var firstErr error
+	for r := range results {
+		if firstErr != nil {
+			if r.table != nil {
+				r.table.removeSpool()
+			}
+			continue
+		}
+		err := r.err
+		if err == nil {
+			err = writeTable(snapshotDB, r.table, opts)
+			r.table.removeSpool()
+		}
+		if errors.Is(err, errTableTimeout) && !opts.Strict {
+			fmt.Fprintf(os.Stderr, "Warning: skipping table %s: %v\n", r.tableName, err)
+			timedOut = append(timedOut, r.tableName)
+			continue
+		}
+		if err == nil {
+			err = setMetadata(snapshotDB, completedKey(r.tableName), "true")
+		} else {
+			err = fmt.Errorf("failed to snapshot table %s: %w", r.tableName, err)
+		}
+		if err != nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	// A snapshot cancelled between tables stops handing them out without
+	// any read failing
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return orderTables(timedOut, tables), nil
 }
 
-func snapshotTable(db database.Database, snapshotDB *sql.DB, tableName string, limit int) error {
+// capturedTable is a table read from the database: its schema, the
+// metadata entries recording how its rows are selected, and the file its
+// rows are spooled to until they are written
+type capturedTable struct {
+	name     string
+	schema   *schema.TableSchema
+	dataOpts database.DataOptions
+	metadata [][2]string
+	hash     func(schema.Row) error
+	spool    *os.File
+
+	ctx    context.Context // bounded by the per-table timeout
+	cancel context.CancelFunc
+}
+
+// prepareTable reads one table's schema, when it was not fetched in
+// advance, and works out which of its rows to read
+func prepareTable(ctx context.Context, db database.Database, tableName string, tableSchema *schema.TableSchema, opts Options) (table *capturedTable, err error) {
+	cancel := context.CancelFunc(func() {})
+	if opts.TableTimeout > 0 {
+		ctx, cancel = context.WithTimeoutCause(ctx, opts.TableTimeout, errTableTimeout)
+	}
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
+
 	// Get table schema
-	tableSchema, err := db.GetTableSchema(tableName)
+	if tableSchema == nil {
+		tableSchema, err = db.GetTableSchema(ctx, tableName)
+		if err != nil {
+			return nil, readError(ctx, opts, "failed to get schema", err)
+		}
+	}
+
+	table = &capturedTable{name: tableName, schema: tableSchema, ctx: ctx, cancel: cancel}
+	table.dataOpts = database.DataOptions{Limit: opts.Limit}
+	rangeSpec, hasRange := opts.PKRanges[tableName]
+	if hasRange {
+		pkRange, err := resolvePKRange(tableSchema, rangeSpec)
+		if err != nil {
+			return nil, err
+		}
+		table.dataOpts.Range = pkRange
+		// Record the captured range so diffs know the data is partial
+		value := fmt.Sprintf("%s:%s:%s", pkRange.Column, rangeSpec.From, rangeSpec.To)
+		table.metadata = append(table.metadata, [2]string{"pk_range." + tableName, value})
+	}
+	if orderBy, ok := opts.OrderBy[tableName]; ok {
+		if !hasColumn(tableSchema, orderBy.Column) {
+			return nil, fmt.Errorf("order by column %s does not exist in table %s", orderBy.Column, tableName)
+		}
+		table.dataOpts.OrderBy = &orderBy
+	}
+	if where, ok := opts.Where[tableName]; ok {
+		if err := checkWhere(ctx, db, tableName, where, opts); err != nil {
+			return nil, err
+		}
+		table.dataOpts.Where = where
+		table.metadata = append(table.metadata, [2]string{"where." + tableName, where})
+	}
+	if columns, ok := opts.HashColumns[tableName]; ok {
+		table.hash, err = rowHasher(tableSchema, columns, opts.HashSalt)
+		if err != nil {
+			return nil, err
+		}
+		// Sorted, so snapshots hashing the same columns record the same list
+		sorted := append([]string(nil), columns...)
+		sort.Strings(sorted)
+		table.metadata = append(table.metadata, [2]string{hashedPrefix + tableName, strings.Join(sorted, ",")})
+	}
+	return table, nil
+}
+
+// read spools the table's rows, converted the way they are stored, to a
+// temporary file in dir, one JSON document per row. The per-table deadline
+// ends with the read.
+func (t *capturedTable) read(db database.Database, dir string, opts Options) (err error) {
+	defer t.cancel()
+
+	t.spool, err = os.CreateTemp(dir, ".dbdiff-spool-*")
 	if err != nil {
-		return fmt.Errorf("failed to get schema: %w", err)
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			t.removeSpool()
+		}
+	}()
+	buffered := bufio.NewWriter(t.spool)
+	encoder := json.NewEncoder(buffered)
+
+	serialize := rowSerializer(t.schema)
+	err = db.StreamTableData(t.ctx, t.name, t.dataOpts, func(row schema.Row) error {
+		if err := serialize(row); err != nil {
+			return err
+		}
+		// Period columns hold when each row version was written, which
+		// differs between any two databases and can't be inserted, so they
+		// are not kept
+		if v := t.schema.SystemVersioning; v != nil {
+			delete(row, v.PeriodStart)
+			delete(row, v.PeriodEnd)
+		}
+		if t.hash != nil {
+			if err := t.hash(row); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(row); err != nil {
+			return fmt.Errorf("failed to spool row: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return readError(t.ctx, opts, "failed to get data", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to spool rows: %w", err)
+	}
+	if _, err := t.spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	return nil
+}
+
+// removeSpool deletes the table's spool file
+func (t *capturedTable) removeSpool() {
+	if t.spool != nil {
+		t.spool.Close()
+		os.Remove(t.spool.Name())
+		t.spool = nil
+	}
+}
+
+// writeTable writes a table's spooled rows to the snapshot, or only its
+// changes to its rows in opts.Base, followed by the tombstones of the rows
+// deleted since. A table whose write fails is removed again, leaving no
+// trace.
+func writeTable(snapshotDB *sql.DB, table *capturedTable, opts Options) (err error) {
+	var writer *rowWriter
+	defer func() {
+		if writer != nil {
+			writer.rollback()
+		}
+		if err != nil {
+			if discardErr := discardTable(snapshotDB, table.name); discardErr != nil {
+				err = fmt.Errorf("%w (and failed to discard the table: %v)", err, discardErr)
+			}
+		}
+	}()
+
+	for _, entry := range table.metadata {
+		if err := setMetadata(snapshotDB, entry[0], entry[1]); err != nil {
+			return err
+		}
 	}
 
 	// Store schema as JSON
-	schemaJSON, err := json.Marshal(tableSchema)
+	schemaJSON, err := json.Marshal(table.schema)
 	if err != nil {
 		return fmt.Errorf("failed to marshal schema: %w", err)
 	}
 
 	_, err = snapshotDB.Exec(
 		"INSERT INTO table_schemas (table_name, schema_json) VALUES (?, ?)",
-		tableName,
+		table.name,
 		string(schemaJSON),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert schema: %w", err)
 	}
 
-	// Get table data
-	data, err := db.GetTableData(tableName, limit)
+	delta, err := newTableDelta(opts.Base, table.name, table.schema)
 	if err != nil {
-		return fmt.Errorf("failed to get data: %w", err)
+		return err
+	}
+
+	// Store data as JSON. The transaction begins with the first row, so
+	// empty tables need no data write at all.
+	startWriter := func() (err error) {
+		if writer == nil {
+			writer, err = newRowWriter(snapshotDB, table.name, opts.CommitInterval, opts.BlobThreshold)
+		}
+		return err
+	}
+	// Numbers are kept as they were spooled, so they are stored unchanged
+	decoder := json.NewDecoder(bufio.NewReader(table.spool))
+	decoder.UseNumber()
+	for {
+		var row schema.Row
+		if err := decoder.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read spooled row: %w", err)
+		}
+		if delta != nil {
+			changed, err := delta.changed(row)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+		}
+		if err := startWriter(); err != nil {
+			return err
+		}
+		if err := writer.write(row); err != nil {
+			return err
+		}
+	}
+	if delta != nil {
+		tombstones, err := delta.deleted()
+		if err != nil {
+			return err
+		}
+		for _, tombstone := range tombstones {
+			if err := startWriter(); err != nil {
+				return err
+			}
+			if err := writer.writeDeleted(tombstone); err != nil {
+				return err
+			}
+		}
+	}
+	if writer == nil {
+		return nil
+	}
+	return writer.commit()
+}
+
+// rowWriter inserts a table's rows into the snapshot, committing every
+// interval rows so a large table doesn't build one huge transaction
+type rowWriter struct {
+	db            *sql.DB
+	tableName     string
+	interval      int
+	blobThreshold int
+	pending       int
+	tx            *sql.Tx
+	stmt          *sql.Stmt
+	blobStmt      *sql.Stmt
+	deletedStmt   *sql.Stmt // prepared with the first tombstone
+}
+
+func newRowWriter(db *sql.DB, tableName string, interval, blobThreshold int) (*rowWriter, error) {
+	w := &rowWriter{db: db, tableName: tableName, interval: interval, blobThreshold: blobThreshold}
+	if err := w.begin(); err != nil {
+		return nil, err
 	}
+	return w, nil
+}
 
-	// Store data as JSON
-	tx, err := snapshotDB.Begin()
+func (w *rowWriter) begin() error {
+	tx, err := w.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer tx.Rollback()
 
 	stmt, err := tx.Prepare("INSERT INTO table_data (table_name, row_json) VALUES (?, ?)")
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
-	defer stmt.Close()
 
-	for _, row := range data {
-		rowJSON, err := json.Marshal(row)
+	if w.blobThreshold > 0 {
+		w.blobStmt, err = tx.Prepare("INSERT OR IGNORE INTO blobs (hash, data) VALUES (?, ?)")
 		if err != nil {
-			return fmt.Errorf("failed to marshal row: %w", err)
+			stmt.Close()
+			tx.Rollback()
+			return fmt.Errorf("failed to prepare statement: %w", err)
 		}
+	}
+
+	w.tx = tx
+	w.stmt = stmt
+	w.pending = 0
+	return nil
+}
 
-		_, err = stmt.Exec(tableName, string(rowJSON))
+func (w *rowWriter) write(row schema.Row) error {
+	if w.blobThreshold > 0 {
+		var err error
+		row, err = externalizeBlobs(w.blobStmt, row, w.blobThreshold)
 		if err != nil {
-			return fmt.Errorf("failed to insert row: %w", err)
+			return err
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
+	rowJSON, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("failed to marshal row: %w", err)
+	}
+
+	if _, err := w.stmt.Exec(w.tableName, string(rowJSON)); err != nil {
+		return fmt.Errorf("failed to insert row: %w", err)
+	}
+	return w.counted()
+}
+
+// counted commits once interval rows are pending
+func (w *rowWriter) counted() error {
+	w.pending++
+	if w.interval > 0 && w.pending >= w.interval {
+		if err := w.commit(); err != nil {
+			return err
+		}
+		return w.begin()
+	}
+	return nil
+}
+
+// writeDeleted writes the tombstone of a row deleted since the base of an
+// incremental snapshot, holding the row's primary key values
+func (w *rowWriter) writeDeleted(key schema.Row) error {
+	if w.deletedStmt == nil {
+		stmt, err := w.tx.Prepare("INSERT INTO table_data (table_name, row_json, deleted) VALUES (?, ?, 1)")
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		w.deletedStmt = stmt
+	}
+
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal row: %w", err)
+	}
+	if _, err := w.deletedStmt.Exec(w.tableName, string(keyJSON)); err != nil {
+		return fmt.Errorf("failed to insert row: %w", err)
+	}
+	return w.counted()
+}
+
+func (w *rowWriter) closeStatements() {
+	w.stmt.Close()
+	if w.blobStmt != nil {
+		w.blobStmt.Close()
+	}
+	if w.deletedStmt != nil {
+		w.deletedStmt.Close()
+		w.deletedStmt = nil
+	}
+}
+
+// committed is called after each commit of a table's rows; tests count
+// the commits with it
+var committed = func(tableName string) {}
+
+func (w *rowWriter) commit() error {
+	w.closeStatements()
+	err := w.tx.Commit()
+	w.tx = nil
+	if err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	committed(w.tableName)
+	return nil
+}
+
+// rollback discards uncommitted rows; it is a no-op after commit
+func (w *rowWriter) rollback() {
+	if w.tx != nil {
+		w.closeStatements()
+		w.tx.Rollback()
+		w.tx = nil
+	}
+}
+
+// checkWhere test-runs a where predicate with COUNT(*) so a typo that matches
+// nothing doesn't silently produce an empty table. It warns, or fails under
+// Strict, when the predicate matches no rows of a table that has some.
+func checkWhere(ctx context.Context, db database.Database, tableName, where string, opts Options) error {
+	matched, err := db.CountRows(ctx, tableName, where)
+	if err != nil {
+		return readError(ctx, opts, fmt.Sprintf("invalid where predicate for table %s", tableName), err)
+	}
+	if matched > 0 {
+		return nil
+	}
+
+	total, err := db.CountRows(ctx, tableName, "")
+	if err != nil {
+		return readError(ctx, opts, "failed to count rows", err)
+	}
+	if total == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("where predicate for table %s matched none of its %d rows: %s", tableName, total, where)
+	if opts.Strict {
+		return errors.New(msg)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+	return nil
+}
+
+// readError wraps a read failure, reporting it as errTableTimeout when the
+// per-table deadline expired rather than the whole snapshot's context
+func readError(ctx context.Context, opts Options, msg string, err error) error {
+	if errors.Is(context.Cause(ctx), errTableTimeout) {
+		return fmt.Errorf("%w after %s", errTableTimeout, opts.TableTimeout)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// resolvePKRange validates a range against the table's primary key and
+// converts the bounds to the key column's type
+func resolvePKRange(tableSchema *schema.TableSchema, r PKRange) (*database.PKRange, error) {
+	pkColumns := tableSchema.PrimaryKeyColumns()
+	if len(pkColumns) != 1 {
+		return nil, fmt.Errorf("pk range requires a single-column primary key, table %s has %d primary key columns", tableSchema.Name, len(pkColumns))
+	}
+
+	var column *schema.Column
+	for i := range tableSchema.Columns {
+		if tableSchema.Columns[i].Name == pkColumns[0] {
+			column = &tableSchema.Columns[i]
+			break
+		}
+	}
+	if column == nil {
+		return nil, fmt.Errorf("primary key column %s not found in table %s", pkColumns[0], tableSchema.Name)
+	}
+
+	pkRange := &database.PKRange{Column: column.Name, From: r.From, To: r.To}
+	if isIntegerType(column.Type) {
+		from, err := strconv.ParseInt(r.From, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pk range start %q for integer column %s", r.From, column.Name)
+		}
+		to, err := strconv.ParseInt(r.To, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pk range end %q for integer column %s", r.To, column.Name)
+		}
+		if from > to {
+			return nil, fmt.Errorf("invalid pk range for %s: start %d is greater than end %d", tableSchema.Name, from, to)
+		}
+		pkRange.From = from
+		pkRange.To = to
+	}
+
+	return pkRange, nil
+}
+
+func hasColumn(tableSchema *schema.TableSchema, name string) bool {
+	for _, col := range tableSchema.Columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// integerTypes are the base types of integer columns, whose range bounds
+// are parsed as integers
+var integerTypes = map[string]bool{
+	"tinyint": true, "smallint": true, "mediumint": true, "int": true,
+	"integer": true, "bigint": true, "int2": true, "int4": true, "int8": true,
+	"smallserial": true, "serial": true, "bigserial": true,
+	"serial2": true, "serial4": true, "serial8": true,
+}
+
+func isIntegerType(columnType string) bool {
+	t := schema.BaseType(columnType)
+	for _, attribute := range []string{" zerofill", " unsigned", " signed"} {
+		t = strings.TrimSuffix(t, attribute)
+	}
+	return integerTypes[t]
+}
+
+// readMetadata returns all metadata entries of a snapshot database
+func readMetadata(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT key, value FROM metadata")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metadata: %w", err)
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan metadata: %w", err)
+		}
+		metadata[key] = value
+	}
+	return metadata, rows.Err()
+}
 
+func setMetadata(db *sql.DB, key, value string) error {
+	if _, err := db.Exec("INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)", key, value); err != nil {
+		return fmt.Errorf("failed to insert metadata: %w", err)
+	}
 	return nil
 }
 
-// LoadSnapshot loads a snapshot from a SQLite file
+// orderTables returns the requested tables in the order they appear in
+// ordered, followed by any not found there in the order requested
+func orderTables(requested, ordered []string) []string {
+	result := make([]string, 0, len(requested))
+	for _, tableName := range ordered {
+		if contains(requested, tableName) {
+			result = append(result, tableName)
+		}
+	}
+	for _, tableName := range requested {
+		if !contains(result, tableName) {
+			result = append(result, tableName)
+		}
+	}
+	return result
+}
+
+// ExcludeTables returns the tables matching none of the glob patterns.
+// Patterns use filepath.Match syntax and, with ignoreCase, match
+// regardless of case.
+func ExcludeTables(tables, patterns []string, ignoreCase bool) ([]string, error) {
+	if len(patterns) == 0 {
+		return tables, nil
+	}
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	result := make([]string, 0, len(tables))
+	for _, tableName := range tables {
+		if !matchesAny(tableName, patterns, ignoreCase) {
+			result = append(result, tableName)
+		}
+	}
+	return result, nil
+}
+
+func matchesAny(tableName string, patterns []string, ignoreCase bool) bool {
+	if ignoreCase {
+		tableName = strings.ToLower(tableName)
+	}
+	for _, pattern := range patterns {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if matched, _ := filepath.Match(pattern, tableName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CollationsCaptured reports whether the snapshot records the collation of
+// every column that has one. MySQL snapshots taken before collations were
+// captured have none; PostgreSQL ones always recorded explicit collations,
+// with "" for the default.
+func (s *Snapshot) CollationsCaptured() bool {
+	return s.Metadata["collations"] == "true" || database.NormalizeType(s.Metadata["db_type"]) == "postgres"
+}
+
+// Label returns the label recorded when the snapshot was taken, if any
+func (s *Snapshot) Label() string {
+	return s.Metadata["label"]
+}
+
+// PKRange returns the primary key range a table's rows were captured with,
+// as column:from:to, or "" when all rows were captured
+func (s *Snapshot) PKRange(tableName string) string {
+	return s.Metadata["pk_range."+tableName]
+}
+
+// TableOrder returns the table creation order recorded with
+// --preserve-creation-order, or nil when tables are in name order
+func (s *Snapshot) TableOrder() []string {
+	if order := s.Metadata["table_order"]; order != "" {
+		return strings.Split(order, ",")
+	}
+	return nil
+}
+
+// RecaptureOptions returns options for taking a new snapshot that selects
+// the same rows as s: its per-table WHERE predicates and primary key
+// ranges, its excluded tables, and its hashed columns, hashed with salt.
+// The new snapshot gets the same tag.
+func (s *Snapshot) RecaptureOptions(salt string) (Options, error) {
+	opts := Options{
+		PKRanges: make(map[string]PKRange),
+		Where:    make(map[string]string),
+		Tag:      s.Tag(),
+	}
+	if exclude := s.Metadata["exclude"]; exclude != "" {
+		opts.Exclude = strings.Split(exclude, ",")
+		opts.ExcludeIgnoreCase = s.Metadata["exclude_ignore_case"] == "true"
+	}
+	for key, value := range s.Metadata {
+		switch {
+		case strings.HasPrefix(key, "pk_range."):
+			// Recorded as column:from:to
+			parts := strings.SplitN(value, ":", 3)
+			if len(parts) != 3 {
+				return Options{}, fmt.Errorf("invalid metadata %s: %q", key, value)
+			}
+			opts.PKRanges[strings.TrimPrefix(key, "pk_range.")] = PKRange{From: parts[1], To: parts[2]}
+		case strings.HasPrefix(key, "where."):
+			opts.Where[strings.TrimPrefix(key, "where.")] = value
+		case strings.HasPrefix(key, hashedPrefix):
+			if opts.HashColumns == nil {
+				opts.HashColumns = make(map[string][]string)
+			}
+			opts.HashColumns[strings.TrimPrefix(key, hashedPrefix)] = strings.Split(value, ",")
+		}
+	}
+	if id := s.Metadata["hash_salt_id"]; id != "" && saltID(salt) != id {
+		return Options{}, fmt.Errorf("the snapshot hashes column values with a different salt")
+	}
+	opts.HashSalt = salt
+	return opts, nil
+}
+
+// LoadSnapshot loads a snapshot from a SQLite file, warning about malformed
+// table schemas
 func LoadSnapshot(snapshotPath string) (*Snapshot, error) {
+	return LoadSnapshotWithOptions(snapshotPath, LoadOptions{})
+}
+
+// LoadSnapshotWithOptions loads a snapshot from a SQLite file. An
+// incremental snapshot is loaded with the snapshots it is based on and
+// returned complete.
+func LoadSnapshotWithOptions(snapshotPath string, opts LoadOptions) (*Snapshot, error) {
+	snapshot, err := loadSnapshot(snapshotPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLoaded(snapshot, snapshotPath, opts); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// loadSnapshot loads a snapshot file, following the chain of bases of an
+// incremental snapshot. chain holds the snapshots that led to this one.
+func loadSnapshot(snapshotPath string, chain []string) (*Snapshot, error) {
 	// Check if file exists
 	if _, err := os.Stat(snapshotPath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("snapshot file does not exist: %s", snapshotPath)
@@ -158,19 +1161,36 @@ func LoadSnapshot(snapshotPath string) (*Snapshot, error) {
 	}
 
 	// Load metadata
-	rows, err := db.Query("SELECT key, value FROM metadata")
+	snapshot.Metadata, err = readMetadata(db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query metadata: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var key, value string
-		if err := rows.Scan(&key, &value); err != nil {
-			return nil, fmt.Errorf("failed to scan metadata: %w", err)
+	version, err := supportedFormatVersion(snapshot.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	var blobs *blobResolver
+	if version >= 2 {
+		blobs = newBlobResolver(db)
+	}
+
+	// An incremental snapshot marks its deleted rows, which older formats
+	// have no column for
+	dataQuery := "SELECT row_json, 0 FROM table_data WHERE table_name = ? ORDER BY id"
+	incremental := snapshot.Base() != ""
+	if incremental {
+		absPath, err := filepath.Abs(snapshotPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve snapshot path: %w", err)
+		}
+		if contains(chain, absPath) {
+			return nil, fmt.Errorf("incremental snapshot %s is based on itself", snapshotPath)
 		}
-		snapshot.Metadata[key] = value
+		chain = append(chain, absPath)
+		dataQuery = "SELECT row_json, deleted FROM table_data WHERE table_name = ? ORDER BY id"
 	}
+	deleted := make(map[string][]schema.Row)
 
 	// Load table schemas
 	schemaRows, err := db.Query("SELECT table_name, schema_json FROM table_schemas")
@@ -198,14 +1218,15 @@ func LoadSnapshot(snapshotPath string) (*Snapshot, error) {
 
 	// Load table data
 	for tableName := range snapshot.Tables {
-		dataRows, err := db.Query("SELECT row_json FROM table_data WHERE table_name = ?", tableName)
+		dataRows, err := db.Query(dataQuery, tableName)
 		if err != nil {
 			return nil, fmt.Errorf("failed to query table data: %w", err)
 		}
 
 		for dataRows.Next() {
 			var rowJSON string
-			if err := dataRows.Scan(&rowJSON); err != nil {
+			var isDeleted bool
+			if err := dataRows.Scan(&rowJSON, &isDeleted); err != nil {
 				dataRows.Close()
 				return nil, fmt.Errorf("failed to scan row: %w", err)
 			}
@@ -215,11 +1236,64 @@ func LoadSnapshot(snapshotPath string) (*Snapshot, error) {
 				dataRows.Close()
 				return nil, fmt.Errorf("failed to unmarshal row: %w", err)
 			}
+			if isDeleted {
+				deleted[tableName] = append(deleted[tableName], row)
+				continue
+			}
+			if blobs != nil {
+				if err := blobs.resolve(row); err != nil {
+					dataRows.Close()
+					return nil, err
+				}
+			}
 
 			snapshot.Tables[tableName].Data = append(snapshot.Tables[tableName].Data, row)
 		}
 		dataRows.Close()
 	}
 
+	snapshot.MaterializedViews, err = loadMaterializedViews(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if incremental {
+		if err := applyBase(snapshot, snapshotPath, deleted, chain); err != nil {
+			return nil, err
+		}
+	}
+
 	return snapshot, nil
 }
+
+// loadMaterializedViews reads the materialized views of a snapshot. Snapshots
+// taken before they were captured have no materialized_views table.
+func loadMaterializedViews(db *sql.DB) (map[string]*schema.MaterializedView, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'materialized_views'").Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to query snapshot tables: %w", err)
+	}
+	views := make(map[string]*schema.MaterializedView)
+	if count == 0 {
+		return views, nil
+	}
+
+	rows, err := db.Query("SELECT view_json FROM materialized_views")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query materialized views: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var viewJSON string
+		if err := rows.Scan(&viewJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan materialized view: %w", err)
+		}
+		var view schema.MaterializedView
+		if err := json.Unmarshal([]byte(viewJSON), &view); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal materialized view: %w", err)
+		}
+		views[view.Name] = &view
+	}
+	return views, rows.Err()
+}
@@ -0,0 +1,602 @@
+package snapshot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koba/db-diff/internal/database"
+	"github.com/koba/db-diff/internal/schema"
+)
+
+// fakeDatabase serves tables from memory. Reading a table listed in slow
+// takes that long, and reading one listed in failing fails. A where
+// predicate matches the number of rows matching gives it, or every row.
+// The tables whose data was read are recorded in reads.
+type fakeDatabase struct {
+	tables   map[string]*schema.Table
+	order    []string
+	slow     map[string]time.Duration
+	failing  map[string]bool
+	matching map[string]int64
+
+	mu    sync.Mutex
+	reads []string
+}
+
+func (f *fakeDatabase) Connect(ctx context.Context) error { return nil }
+func (f *fakeDatabase) Close() error                      { return nil }
+func (f *fakeDatabase) DB() *sql.DB                       { return nil }
+func (f *fakeDatabase) Dialect() string                   { return "mysql" }
+
+func (f *fakeDatabase) GetAllTables(ctx context.Context) ([]string, error) {
+	return f.order, nil
+}
+
+func (f *fakeDatabase) GetAllTablesInCreationOrder(ctx context.Context) ([]string, error) {
+	return f.order, nil
+}
+
+func (f *fakeDatabase) GetTableSchema(ctx context.Context, tableName string) (*schema.TableSchema, error) {
+	tableSchema := f.tables[tableName].Schema
+	return &tableSchema, nil
+}
+
+func (f *fakeDatabase) GetTableSchemas(ctx context.Context, tableNames []string) (map[string]*schema.TableSchema, error) {
+	schemas := make(map[string]*schema.TableSchema, len(tableNames))
+	for _, name := range tableNames {
+		schemas[name], _ = f.GetTableSchema(ctx, name)
+	}
+	return schemas, nil
+}
+
+func (f *fakeDatabase) GetTableData(ctx context.Context, tableName string, opts database.DataOptions) ([]schema.Row, error) {
+	var rows []schema.Row
+	err := f.StreamTableData(ctx, tableName, opts, func(row schema.Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+func (f *fakeDatabase) StreamTableData(ctx context.Context, tableName string, opts database.DataOptions, fn func(schema.Row) error) error {
+	f.mu.Lock()
+	f.reads = append(f.reads, tableName)
+	f.mu.Unlock()
+	if f.failing[tableName] {
+		return errors.New("connection lost")
+	}
+	if delay := f.slow[tableName]; delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for _, row := range f.tables[tableName].Data {
+		copied := make(schema.Row, len(row))
+		for k, v := range row {
+			copied[k] = v
+		}
+		if err := fn(copied); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeDatabase) CountRows(ctx context.Context, tableName string, where string) (int64, error) {
+	if n, ok := f.matching[where]; ok && where != "" {
+		return n, nil
+	}
+	return int64(len(f.tables[tableName].Data)), nil
+}
+
+// newFakeDatabase returns a database of tables with an integer primary
+// key id and a text column name, holding the given names in id order
+func newFakeDatabase(tables map[string][]string) *fakeDatabase {
+	f := &fakeDatabase{tables: make(map[string]*schema.Table)}
+	for name, values := range tables {
+		table := &schema.Table{Schema: schema.TableSchema{
+			Name: name,
+			Columns: []schema.Column{
+				{Name: "id", Type: "int"},
+				{Name: "name", Type: "varchar(255)", Nullable: true},
+			},
+			Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true, Unique: true}},
+		}}
+		for i, value := range values {
+			table.Data = append(table.Data, schema.Row{"id": int64(i + 1), "name": value})
+		}
+		f.tables[name] = table
+		f.order = append(f.order, name)
+	}
+	return f
+}
+
+// tableValues returns the name column of a loaded table's rows
+func tableValues(t *testing.T, snap *Snapshot, tableName string) []string {
+	t.Helper()
+	table, ok := snap.Tables[tableName]
+	if !ok {
+		t.Fatalf("table %s missing from snapshot", tableName)
+	}
+	var values []string
+	for _, row := range table.Data {
+		values = append(values, row["name"].(string))
+	}
+	return values
+}
+
+func TestCreateSnapshotSpoolsTables(t *testing.T) {
+	tables := map[string][]string{
+		"users":    {"alice", "bob", "carol"},
+		"posts":    {"hello", strings.Repeat("x", 5000)},
+		"comments": nil,
+	}
+	tests := []struct {
+		name        string
+		concurrency int
+		slow        map[string]time.Duration
+		timeout     time.Duration
+		wantSkipped []string
+	}{
+		{name: "one worker", concurrency: 1},
+		{name: "several workers", concurrency: 4},
+		{name: "table timeout", concurrency: 2, slow: map[string]time.Duration{"posts": time.Second}, timeout: 100 * time.Millisecond, wantSkipped: []string{"posts"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDatabase(tables)
+			db.slow = tt.slow
+			dir := t.TempDir()
+			path := filepath.Join(dir, "snap.db")
+			opts := Options{Concurrency: tt.concurrency, TableTimeout: tt.timeout, CommitInterval: 1}
+			if err := CreateSnapshot(context.Background(), db, path, opts); err != nil {
+				t.Fatalf("CreateSnapshot() error = %v", err)
+			}
+
+			// Spool files are removed once their table is written
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if strings.HasPrefix(entry.Name(), ".dbdiff-spool-") {
+					t.Errorf("spool file %s left behind", entry.Name())
+				}
+			}
+
+			snap, err := LoadSnapshot(path)
+			if err != nil {
+				t.Fatalf("LoadSnapshot() error = %v", err)
+			}
+			skipped := map[string]bool{}
+			for _, name := range tt.wantSkipped {
+				skipped[name] = true
+			}
+			for name, values := range tables {
+				if skipped[name] {
+					if _, ok := snap.Tables[name]; ok {
+						t.Errorf("timed out table %s was stored", name)
+					}
+					continue
+				}
+				if got := tableValues(t, snap, name); !reflect.DeepEqual(got, values) {
+					t.Errorf("table %s rows = %v, want %v", name, got, values)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotTableTimeout(t *testing.T) {
+	tables := map[string][]string{"users": {"alice"}, "events": {"login"}, "posts": {"hello"}}
+	tests := []struct {
+		name   string
+		strict bool
+		cancel bool
+		// cancelAfter is when the whole snapshot is cancelled, before any
+		// table times out
+		cancelAfter time.Duration
+		wantErr     bool
+	}{
+		{name: "skipped"},
+		{name: "strict", strict: true, wantErr: true},
+		{name: "cancelled while reading", cancel: true, cancelAfter: 50 * time.Millisecond, wantErr: true},
+		{name: "cancelled before reading", cancel: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reading events blocks until its context is done
+			db := newFakeDatabase(tables)
+			db.slow = map[string]time.Duration{"events": time.Hour}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			timeout := 100 * time.Millisecond
+			if tt.cancel {
+				time.AfterFunc(tt.cancelAfter, cancel)
+				timeout = time.Hour
+			}
+
+			path := filepath.Join(t.TempDir(), "snap.db")
+			done := make(chan error, 1)
+			go func() {
+				done <- CreateSnapshot(ctx, db, path, Options{Concurrency: 1, TableTimeout: timeout, Strict: tt.strict})
+			}()
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("CreateSnapshot() did not return")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateSnapshot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				want := errTableTimeout
+				if tt.cancel {
+					want = context.Canceled
+				}
+				if !errors.Is(err, want) {
+					t.Errorf("CreateSnapshot() error = %v, want %v", err, want)
+				}
+				return
+			}
+
+			snap, err := LoadSnapshot(path)
+			if err != nil {
+				t.Fatalf("LoadSnapshot() error = %v", err)
+			}
+			if _, ok := snap.Tables["events"]; ok {
+				t.Error("timed out table events was stored")
+			}
+			for _, name := range []string{"users", "posts"} {
+				if got := tableValues(t, snap, name); !reflect.DeepEqual(got, tables[name]) {
+					t.Errorf("table %s rows = %v, want %v", name, got, tables[name])
+				}
+			}
+			if got := snap.Metadata["timed_out_tables"]; got != "events" {
+				t.Errorf("timed_out_tables = %q, want %q", got, "events")
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotCommitInterval(t *testing.T) {
+	tables := map[string][]string{"users": {"a", "b", "c", "d", "e"}}
+	tests := []struct {
+		name        string
+		interval    int
+		wantCommits int
+	}{
+		{name: "one transaction", interval: 0, wantCommits: 1},
+		{name: "every two rows", interval: 2, wantCommits: 3},
+		// The transaction begun after the last row is committed empty
+		{name: "every row", interval: 1, wantCommits: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commits := 0
+			committed = func(tableName string) {
+				if tableName == "users" {
+					commits++
+				}
+			}
+			defer func() { committed = func(string) {} }()
+
+			path := filepath.Join(t.TempDir(), "snap.db")
+			if err := CreateSnapshot(context.Background(), newFakeDatabase(tables), path, Options{CommitInterval: tt.interval}); err != nil {
+				t.Fatalf("CreateSnapshot() error = %v", err)
+			}
+			if commits != tt.wantCommits {
+				t.Errorf("commits = %d, want %d", commits, tt.wantCommits)
+			}
+			snap, err := LoadSnapshot(path)
+			if err != nil {
+				t.Fatalf("LoadSnapshot() error = %v", err)
+			}
+			if got := tableValues(t, snap, "users"); !reflect.DeepEqual(got, tables["users"]) {
+				t.Errorf("rows = %v, want %v", got, tables["users"])
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotOverwrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		overwrite bool
+		want      []string
+		wantErr   bool
+	}{
+		{name: "refused without force", want: []string{"alice"}, wantErr: true},
+		{name: "overwritten with force", overwrite: true, want: []string{"bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snap.db")
+			if err := CreateSnapshot(context.Background(), newFakeDatabase(map[string][]string{"users": {"alice"}}), path, Options{}); err != nil {
+				t.Fatalf("CreateSnapshot() error = %v", err)
+			}
+			err := CreateSnapshot(context.Background(), newFakeDatabase(map[string][]string{"users": {"bob"}}), path, Options{Overwrite: tt.overwrite})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("second CreateSnapshot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			snap, err := LoadSnapshot(path)
+			if err != nil {
+				t.Fatalf("LoadSnapshot() error = %v", err)
+			}
+			if got := tableValues(t, snap, "users"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotResume(t *testing.T) {
+	tables := map[string][]string{"users": {"alice"}, "posts": {"hello"}, "comments": {"nice"}}
+	path := filepath.Join(t.TempDir(), "snap.db")
+
+	// The first run fails at posts, after users is written
+	db := newFakeDatabase(tables)
+	db.order = []string{"users", "posts", "comments"}
+	db.failing = map[string]bool{"posts": true}
+	if err := CreateSnapshot(context.Background(), db, path, Options{Concurrency: 1}); err == nil {
+		t.Fatal("CreateSnapshot() error = nil, want posts to fail")
+	}
+
+	db = newFakeDatabase(tables)
+	db.order = []string{"users", "posts", "comments"}
+	if err := CreateSnapshot(context.Background(), db, path, Options{Concurrency: 1, Resume: true}); err != nil {
+		t.Fatalf("resumed CreateSnapshot() error = %v", err)
+	}
+	if want := []string{"posts", "comments"}; !reflect.DeepEqual(db.reads, want) {
+		t.Errorf("resume read %v, want %v", db.reads, want)
+	}
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	for name, values := range tables {
+		if got := tableValues(t, snap, name); !reflect.DeepEqual(got, values) {
+			t.Errorf("table %s rows = %v, want %v", name, got, values)
+		}
+	}
+}
+
+func TestResolvePKRange(t *testing.T) {
+	table := func(columnType string) *schema.TableSchema {
+		return &schema.TableSchema{
+			Name:    "events",
+			Columns: []schema.Column{{Name: "id", Type: columnType}},
+			Indexes: []schema.Index{{Name: "PRIMARY", Columns: []string{"id"}, Primary: true}},
+		}
+	}
+	tests := []struct {
+		name       string
+		columnType string
+		r          PKRange
+		want       *database.PKRange
+		wantErr    bool
+	}{
+		{name: "integer", columnType: "int(11) unsigned", r: PKRange{From: "1000", To: "2000"}, want: &database.PKRange{Column: "id", From: int64(1000), To: int64(2000)}},
+		{name: "serial", columnType: "bigserial", r: PKRange{From: "1", To: "2"}, want: &database.PKRange{Column: "id", From: int64(1), To: int64(2)}},
+		{name: "integer reversed", columnType: "bigint", r: PKRange{From: "2", To: "1"}, wantErr: true},
+		{name: "integer not a number", columnType: "integer", r: PKRange{From: "a", To: "b"}, wantErr: true},
+		{name: "string", columnType: "varchar(20)", r: PKRange{From: "a", To: "m"}, want: &database.PKRange{Column: "id", From: "a", To: "m"}},
+		{name: "interval", columnType: "interval", r: PKRange{From: "1 day", To: "2 days"}, want: &database.PKRange{Column: "id", From: "1 day", To: "2 days"}},
+		{name: "point", columnType: "point", r: PKRange{From: "(0,0)", To: "(1,1)"}, want: &database.PKRange{Column: "id", From: "(0,0)", To: "(1,1)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolvePKRange(table(tt.columnType), tt.r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolvePKRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolvePKRange() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotLabel(t *testing.T) {
+	db := newFakeDatabase(map[string][]string{"users": {"alice"}})
+	path := filepath.Join(t.TempDir(), "snap.db")
+	if err := CreateSnapshot(context.Background(), db, path, Options{Label: "app@db.internal"}); err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	if got := snap.Label(); got != "app@db.internal" {
+		t.Errorf("Label() = %q, want %q", got, "app@db.internal")
+	}
+}
+
+func TestCreateSnapshotSkipEmptyTables(t *testing.T) {
+	db := newFakeDatabase(map[string][]string{"users": {"alice"}, "audit_log": nil})
+	path := filepath.Join(t.TempDir(), "snap.db")
+	if err := CreateSnapshot(context.Background(), db, path, Options{SkipEmptyTables: true}); err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+
+	snapshotDB, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshotDB.Close()
+	count := func(query string) int {
+		var n int
+		if err := snapshotDB.QueryRow(query, "audit_log").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if got := count("SELECT COUNT(*) FROM table_schemas WHERE table_name = ?"); got != 1 {
+		t.Errorf("audit_log schemas = %d, want 1", got)
+	}
+	if got := count("SELECT COUNT(*) FROM table_data WHERE table_name = ?"); got != 0 {
+		t.Errorf("audit_log rows = %d, want 0", got)
+	}
+
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	if table, ok := snap.Tables["audit_log"]; !ok || len(table.Data) != 0 {
+		t.Errorf("audit_log = %+v, want an empty table", table)
+	}
+	if got := tableValues(t, snap, "users"); !reflect.DeepEqual(got, []string{"alice"}) {
+		t.Errorf("users rows = %v, want [alice]", got)
+	}
+}
+
+func TestCheckWhere(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    []string
+		where   string
+		strict  bool
+		wantErr bool
+	}{
+		{name: "matching", rows: []string{"alice", "bob"}, where: "name = 'alice'"},
+		{name: "matching nothing", rows: []string{"alice", "bob"}, where: "name = 'alcie'"},
+		{name: "matching nothing, strict", rows: []string{"alice", "bob"}, where: "name = 'alcie'", strict: true, wantErr: true},
+		{name: "empty table, strict", where: "name = 'alcie'", strict: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDatabase(map[string][]string{"users": tt.rows})
+			db.matching = map[string]int64{"name = 'alice'": 1, "name = 'alcie'": 0}
+			err := checkWhere(context.Background(), db, "users", tt.where, Options{Strict: tt.strict})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkWhere() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseOrderBy(t *testing.T) {
+	tests := []struct {
+		spec      string
+		wantTable string
+		want      database.OrderBy
+		wantErr   bool
+	}{
+		{spec: "orders:created_at", wantTable: "orders", want: database.OrderBy{Column: "created_at"}},
+		{spec: "orders:created_at:desc", wantTable: "orders", want: database.OrderBy{Column: "created_at", Descending: true}},
+		{spec: "orders:created_at:ASC", wantTable: "orders", want: database.OrderBy{Column: "created_at"}},
+		{spec: "orders:created_at:down", wantErr: true},
+		{spec: "orders", wantErr: true},
+		{spec: ":created_at", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			tableName, got, err := ParseOrderBy(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOrderBy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tableName != tt.wantTable || got != tt.want {
+				t.Errorf("ParseOrderBy() = %q, %+v, want %q, %+v", tableName, got, tt.wantTable, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotOrderByUnknownColumn(t *testing.T) {
+	db := newFakeDatabase(map[string][]string{"users": {"alice"}})
+	opts := Options{OrderBy: map[string]database.OrderBy{"users": {Column: "created_at"}}}
+	err := CreateSnapshot(context.Background(), db, filepath.Join(t.TempDir(), "snap.db"), opts)
+	if err == nil || !strings.Contains(err.Error(), "order by column created_at does not exist") {
+		t.Errorf("CreateSnapshot() error = %v, want a missing column error", err)
+	}
+}
+
+func TestCreateSnapshotSkipsTrackingTable(t *testing.T) {
+	tests := []struct {
+		name       string
+		requested  []string
+		wantTables []string
+	}{
+		{name: "all tables", wantTables: []string{"users"}},
+		{name: "requested by name", requested: []string{"users", "dbdiff_migrations"}, wantTables: []string{"dbdiff_migrations", "users"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDatabase(map[string][]string{"users": {"alice"}, "dbdiff_migrations": {"abc"}})
+			path := filepath.Join(t.TempDir(), "snap.db")
+			if err := CreateSnapshot(context.Background(), db, path, Options{Tables: tt.requested}); err != nil {
+				t.Fatalf("CreateSnapshot() error = %v", err)
+			}
+			snap, err := LoadSnapshot(path)
+			if err != nil {
+				t.Fatalf("LoadSnapshot() error = %v", err)
+			}
+			var got []string
+			for name := range snap.Tables {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.wantTables) {
+				t.Errorf("tables = %v, want %v", got, tt.wantTables)
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotPreserveCreationOrder(t *testing.T) {
+	db := newFakeDatabase(map[string][]string{"zones": nil, "accounts": nil, "bookings": nil})
+	db.order = []string{"zones", "accounts", "bookings"}
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{name: "all tables", opts: Options{PreserveCreationOrder: true}, want: []string{"zones", "accounts", "bookings"}},
+		{name: "selected tables", opts: Options{PreserveCreationOrder: true, Tables: []string{"bookings", "zones"}}, want: []string{"zones", "bookings"}},
+		{name: "name order", opts: Options{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snap.db")
+			if err := CreateSnapshot(context.Background(), db, path, tt.opts); err != nil {
+				t.Fatalf("CreateSnapshot() error = %v", err)
+			}
+			snap, err := LoadSnapshot(path)
+			if err != nil {
+				t.Fatalf("LoadSnapshot() error = %v", err)
+			}
+			if got := snap.TableOrder(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TableOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotReadOnly(t *testing.T) {
+	db := newFakeDatabase(map[string][]string{"users": {"alice"}})
+	for _, readOnly := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "snap.db")
+		if err := CreateSnapshot(context.Background(), db, path, Options{ReadOnly: readOnly}); err != nil {
+			t.Fatalf("CreateSnapshot() error = %v", err)
+		}
+		snap, err := LoadSnapshot(path)
+		if err != nil {
+			t.Fatalf("LoadSnapshot() error = %v", err)
+		}
+		if got := snap.Metadata["read_only"] == "true"; got != readOnly {
+			t.Errorf("read_only recorded = %v, want %v", got, readOnly)
+		}
+	}
+}
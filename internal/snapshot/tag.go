@@ -0,0 +1,81 @@
+package snapshot
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Tag returns the environment tag the snapshot was taken with, if any
+func (s *Snapshot) Tag() string {
+	return s.Metadata["tag"]
+}
+
+// FindLatest returns the path of the most recently created snapshot in dir
+// tagged tag, by the created_at recorded in its metadata
+func FindLatest(dir, tag string) (string, error) {
+	latest, err := findLatest(dir, func(metadata map[string]string) bool { return metadata["tag"] == tag })
+	if err == nil && latest == "" {
+		err = fmt.Errorf("no snapshot tagged %q in %s", tag, dir)
+	}
+	return latest, err
+}
+
+// FindNewest returns the path of the most recently created snapshot in dir,
+// whatever its tag
+func FindNewest(dir string) (string, error) {
+	latest, err := findLatest(dir, func(map[string]string) bool { return true })
+	if err == nil && latest == "" {
+		err = fmt.Errorf("no snapshot in %s", dir)
+	}
+	return latest, err
+}
+
+// findLatest returns the most recently created snapshot in dir whose
+// metadata matches, or "" when there is none
+func findLatest(dir string, match func(metadata map[string]string) bool) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	var latest string
+	var latestAt time.Time
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".db") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		metadata, err := readMetadataFile(path)
+		if err != nil {
+			// Not a snapshot, or one being written
+			continue
+		}
+		if !match(metadata) {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339, metadata["created_at"])
+		if err != nil {
+			continue
+		}
+		if latest == "" || createdAt.After(latestAt) {
+			latest, latestAt = path, createdAt
+		}
+	}
+
+	return latest, nil
+}
+
+// readMetadataFile reads the metadata of a snapshot file without loading
+// its tables
+func readMetadataFile(path string) (map[string]string, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return readMetadata(db)
+}
@@ -0,0 +1,67 @@
+package snapshot
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindLatest(t *testing.T) {
+	dir := t.TempDir()
+	db := newFakeDatabase(map[string][]string{"users": {"alice"}})
+	for _, s := range []struct {
+		file, tag, createdAt string
+	}{
+		{"prod-1.db", "prod", "2026-03-01T10:00:00Z"},
+		{"prod-3.db", "prod", "2026-03-03T10:00:00Z"},
+		{"prod-2.db", "prod", "2026-03-02T10:00:00Z"},
+		{"staging-1.db", "staging", "2026-03-04T10:00:00Z"},
+		{"staging-2.db", "staging", "2026-03-02T10:00:00Z"},
+		{"untagged.db", "", "2026-03-05T10:00:00Z"},
+	} {
+		path := filepath.Join(dir, s.file)
+		if err := CreateSnapshot(context.Background(), db, path, Options{Tag: s.tag}); err != nil {
+			t.Fatalf("CreateSnapshot(%s) error = %v", s.file, err)
+		}
+		snapshotDB, err := sql.Open("sqlite", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = setMetadata(snapshotDB, "created_at", s.createdAt)
+		snapshotDB.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files that aren't snapshots are skipped
+	if err := os.WriteFile(filepath.Join(dir, "notes.db"), []byte("not a snapshot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{tag: "prod", want: "prod-3.db"},
+		{tag: "staging", want: "staging-1.db"},
+		{tag: "dev", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, err := FindLatest(dir, tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindLatest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != filepath.Join(dir, tt.want) {
+				t.Errorf("FindLatest() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got, err := FindNewest(dir); err != nil || got != filepath.Join(dir, "untagged.db") {
+		t.Errorf("FindNewest() = %s, %v, want untagged.db", got, err)
+	}
+}
@@ -0,0 +1,61 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LoadOptions controls LoadSnapshotWithOptions
+type LoadOptions struct {
+	// Strict fails the load of a malformed snapshot instead of warning
+	Strict bool
+}
+
+// Validate checks every table schema of the snapshot (see
+// schema.TableSchema.Validate) and that foreign keys refer to tables and
+// columns the snapshot has. A snapshot of selected tables may legitimately
+// lack a referenced table, which is reported all the same.
+func (s *Snapshot) Validate() error {
+	names := make([]string, 0, len(s.Tables))
+	for name := range s.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		tableSchema := &s.Tables[name].Schema
+		if err := tableSchema.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+		for _, fk := range tableSchema.ForeignKeys {
+			referenced, ok := s.Tables[fk.ReferencedTable]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("table %s: foreign key %s refers to missing table %s", name, fk.Name, fk.ReferencedTable))
+			case !hasColumn(&referenced.Schema, fk.ReferencedColumn):
+				errs = append(errs, fmt.Errorf("table %s: foreign key %s refers to missing column %s.%s", name, fk.Name, fk.ReferencedTable, fk.ReferencedColumn))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkLoaded validates a loaded snapshot, warning about each problem or,
+// when strict, failing
+func checkLoaded(snap *Snapshot, snapshotPath string, opts LoadOptions) error {
+	err := snap.Validate()
+	if err == nil {
+		return nil
+	}
+	if opts.Strict {
+		return fmt.Errorf("snapshot %s is malformed: %w", snapshotPath, err)
+	}
+	for _, problem := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", snapshotPath, problem)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/koba/db-diff/internal/schema"
+)
+
+func TestSnapshotValidate(t *testing.T) {
+	snap := func(fk schema.ForeignKey) *Snapshot {
+		db := newFakeDatabase(map[string][]string{"users": nil, "orders": nil})
+		db.tables["orders"].Schema.ForeignKeys = []schema.ForeignKey{fk}
+		return &Snapshot{Tables: db.tables}
+	}
+	tests := []struct {
+		name string
+		fk   schema.ForeignKey
+		want string
+	}{
+		{name: "valid", fk: schema.ForeignKey{Name: "fk_user", Column: "id", ReferencedTable: "users", ReferencedColumn: "id"}},
+		{name: "missing table", fk: schema.ForeignKey{Name: "fk_shop", Column: "id", ReferencedTable: "shops", ReferencedColumn: "id"},
+			want: "table orders: foreign key fk_shop refers to missing table shops"},
+		{name: "missing column", fk: schema.ForeignKey{Name: "fk_user", Column: "id", ReferencedTable: "users", ReferencedColumn: "uuid"},
+			want: "table orders: foreign key fk_user refers to missing column users.uuid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := snap(tt.fk).Validate()
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSnapshotStrict(t *testing.T) {
+	db := newFakeDatabase(map[string][]string{"orders": {"first"}})
+	db.tables["orders"].Schema.Indexes = append(db.tables["orders"].Schema.Indexes, schema.Index{Name: "idx_total", Columns: []string{"total"}})
+	path := filepath.Join(t.TempDir(), "snap.db")
+	if err := CreateSnapshot(context.Background(), db, path, Options{}); err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+
+	if _, err := LoadSnapshotWithOptions(path, LoadOptions{}); err != nil {
+		t.Errorf("LoadSnapshotWithOptions() error = %v, want only a warning", err)
+	}
+	if _, err := LoadSnapshotWithOptions(path, LoadOptions{Strict: true}); err == nil {
+		t.Error("LoadSnapshotWithOptions(Strict) error = nil, want the malformed index")
+	}
+}
@@ -0,0 +1,111 @@
+// Package textenc transcodes generated text for targets that do not read
+// UTF-8, such as SQL Server scripts in UTF-16 or old latin1 MySQL servers.
+package textenc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// UTF8 is the default encoding, which leaves text as it is
+const UTF8 = "utf-8"
+
+// encodings maps the accepted names to their encodings. The UTF-16
+// encodings and utf-8-bom start the output with a byte order mark.
+var encodings = map[string]encoding.Encoding{
+	UTF8:           nil,
+	"utf-8-bom":    unicode.UTF8BOM,
+	"utf-16":       unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+	"shift_jis":    japanese.ShiftJIS,
+	"euc-jp":       japanese.EUCJP,
+}
+
+// Names returns the accepted encoding names
+func Names() []string {
+	names := make([]string, 0, len(encodings))
+	for name := range encodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check reports an error for an encoding name that is not accepted
+func Check(name string) error {
+	if _, ok := encodings[strings.ToLower(name)]; !ok {
+		return fmt.Errorf("unsupported encoding %q (expected one of %s)", name, strings.Join(Names(), ", "))
+	}
+	return nil
+}
+
+// Encode transcodes UTF-8 text to the named encoding. Text with characters
+// the encoding cannot represent is an error rather than silently replaced.
+func Encode(text, name string) ([]byte, error) {
+	if err := Check(name); err != nil {
+		return nil, err
+	}
+	enc := encodings[strings.ToLower(name)]
+	if enc == nil {
+		return []byte(text), nil
+	}
+	encoded, _, err := transform.Bytes(enc.NewEncoder(), []byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode output as %s: %w", name, err)
+	}
+	return encoded, nil
+}
+
+// NewWriter returns a writer transcoding the UTF-8 text written to it to
+// the named encoding. It must be closed to flush the end of the text; Close
+// also returns the first error of any write, since report writers ignore
+// them.
+func NewWriter(w io.Writer, name string) (io.WriteCloser, error) {
+	if err := Check(name); err != nil {
+		return nil, err
+	}
+	enc := encodings[strings.ToLower(name)]
+	if enc == nil {
+		return &writer{w: w, name: name}, nil
+	}
+	return &writer{w: transform.NewWriter(w, enc.NewEncoder()), name: name}, nil
+}
+
+type writer struct {
+	w    io.Writer
+	name string
+	err  error
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = fmt.Errorf("failed to encode output as %s: %w", w.name, err)
+	}
+	return n, w.err
+}
+
+// Close flushes the transcoder. The destination itself is left open.
+func (w *writer) Close() error {
+	if c, ok := w.w.(*transform.Writer); ok {
+		if err := c.Close(); err != nil && w.err == nil {
+			w.err = fmt.Errorf("failed to encode output as %s: %w", w.name, err)
+		}
+	}
+	return w.err
+}
@@ -0,0 +1,75 @@
+package textenc
+
+import (
+	"bytes"
+	"testing"
+)
+
+// closeRecorder is a destination that records whether it was closed
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		text     string
+		want     []byte
+		wantErr  bool
+	}{
+		{"utf-8", "utf-8", "café", []byte("café"), false},
+		{"name case", "LATIN1", "café", []byte("caf\xe9"), false},
+		{"utf-16le", "utf-16le", "a", []byte{0xff, 0xfe, 'a', 0}, false},
+		{"unrepresentable", "latin1", "日本", nil, true},
+		{"unknown", "ebcdic", "a", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(tt.text, tt.encoding)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Encode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriterLeavesDestinationOpen(t *testing.T) {
+	tests := []struct {
+		encoding string
+		want     []byte
+	}{
+		{"utf-8", []byte("café")},
+		{"latin1", []byte("caf\xe9")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			dest := &closeRecorder{}
+			w, err := NewWriter(dest, tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte("café")); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if dest.closed {
+				t.Error("Close() closed the destination")
+			}
+			if !bytes.Equal(dest.Bytes(), tt.want) {
+				t.Errorf("wrote %q, want %q", dest.Bytes(), tt.want)
+			}
+		})
+	}
+}